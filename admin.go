@@ -0,0 +1,130 @@
+package pushpop
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithAdminToken requires admin API requests to carry the token as a
+// bearer token. Without it the admin API performs no authentication of its
+// own and must be protected by the embedding application.
+func WithAdminToken(token string) Option {
+	return func(h *Hub) {
+		h.adminToken = NewSecret(token)
+	}
+}
+
+// HandleAdmin returns the admin API handler. Mount it on "/admin/".
+func HandleAdmin(hub *Hub) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/users/{id}", hub.handleAdminUser)
+	mux.HandleFunc("DELETE /admin/users/{id}/data", hub.handleAdminPurgeUser)
+	mux.HandleFunc("PUT /admin/users/{id}/shadow-ban", hub.handleAdminShadowBanUser)
+	mux.HandleFunc("DELETE /admin/users/{id}/shadow-ban", hub.handleAdminShadowBanUser)
+	mux.HandleFunc("GET /admin/channels", hub.handleAdminChannels)
+	mux.HandleFunc("GET /admin/channels/{name}", hub.handleAdminChannel)
+	mux.HandleFunc("PUT /admin/channels/{name}", hub.handleAdminConfigure)
+	mux.HandleFunc("DELETE /admin/channels/{name}", hub.handleAdminUndeclare)
+	mux.HandleFunc("GET /admin/declared-channels", hub.handleAdminDeclared)
+	mux.HandleFunc("GET /admin/aliases", hub.handleAdminAliases)
+	mux.HandleFunc("PUT /admin/aliases/{name}", hub.handleAdminAlias)
+	mux.HandleFunc("DELETE /admin/aliases/{name}", hub.handleAdminRemoveAlias)
+	mux.HandleFunc("GET /admin/connections", hub.handleAdminConnections)
+	mux.HandleFunc("GET /admin/connections/{id}", hub.handleAdminConnection)
+	mux.HandleFunc("DELETE /admin/connections/{id}", hub.handleAdminDisconnect)
+	mux.HandleFunc("PUT /admin/connections/{id}/shadow-ban", hub.handleAdminShadowBanConnection)
+	mux.HandleFunc("DELETE /admin/connections/{id}/shadow-ban", hub.handleAdminShadowBanConnection)
+	mux.HandleFunc("GET /admin/blocklist", hub.handleAdminBlocklist)
+	mux.HandleFunc("POST /admin/blocklist", hub.handleAdminBlock)
+	mux.HandleFunc("DELETE /admin/blocklist", hub.handleAdminBlock)
+	mux.HandleFunc("POST /admin/drain", hub.handleAdminDrain)
+	mux.HandleFunc("DELETE /admin/drain", hub.handleAdminResume)
+	mux.HandleFunc("GET /admin/snapshot", hub.handleAdminSnapshot)
+	mux.HandleFunc("POST /admin/broadcast", hub.handleAdminBroadcast)
+	mux.HandleFunc("GET /admin/recurring", hub.handleAdminRecurring)
+	mux.HandleFunc("PUT /admin/recurring/{name}", hub.handleAdminAddRecurring)
+	mux.HandleFunc("DELETE /admin/recurring/{name}", hub.handleAdminRemoveRecurring)
+	mux.HandleFunc("GET /admin/replays", hub.handleAdminReplays)
+	mux.HandleFunc("POST /admin/replays", hub.handleAdminStartReplay)
+	mux.HandleFunc("GET /admin/replays/{id}", hub.handleAdminReplay)
+	mux.HandleFunc("DELETE /admin/replays/{id}", hub.handleAdminCancelReplay)
+	mux.HandleFunc("GET /admin/tenants", hub.handleAdminTenants)
+	mux.HandleFunc("GET /admin/tenants/{tenant}", hub.handleAdminTenant)
+	mux.HandleFunc("GET /admin/usage", hub.handleAdminUsage)
+	mux.HandleFunc("GET /admin/keys", hub.handleAdminKeys)
+	mux.HandleFunc("POST /admin/keys", hub.handleAdminCreateKey)
+	mux.HandleFunc("POST /admin/keys/{id}/rotate", hub.handleAdminRotateKey)
+	mux.HandleFunc("DELETE /admin/keys/{id}", hub.handleAdminRevokeKey)
+	return hub.requireAdmin(mux)
+}
+
+// requireAdmin checks the admin bearer token, which is the admin token or
+// an admin API key.
+func (h *Hub) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.AdminSecured() && !h.adminBearer(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AdminSecured reports whether admin requests are authenticated, with the
+// admin token or admin API keys; once an admin key has been created, it
+// stays true after the last one is revoked. Admin APIs served outside
+// HandleAdmin should refuse every call while it is false.
+func (h *Hub) AdminSecured() bool {
+	return h.adminToken.Get() != "" || h.apiKeys.has(ScopeAdmin)
+}
+
+// adminBearer reports whether r carries the admin token or an admin API
+// key as its bearer token.
+func (h *Hub) adminBearer(r *http.Request) bool {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return h.adminCredential(token)
+}
+
+// adminCredential reports whether token is the admin token or an admin API
+// key.
+func (h *Hub) adminCredential(token string) bool {
+	adminToken := h.adminToken.Get()
+	static := adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+	return static || h.apiKeys.verify(token, ScopeAdmin, time.Now())
+}
+
+// AuthorizedAdmin reports whether token is the admin token or an admin API
+// key, for admin APIs served outside HandleAdmin. It is false for every
+// token while the hub has neither.
+func (h *Hub) AuthorizedAdmin(token string) bool {
+	return h.AdminSecured() && h.adminCredential(token)
+}
+
+// handleAdminUser reports a user's last-seen timestamps.
+func (h *Hub) handleAdminUser(w http.ResponseWriter, r *http.Request) {
+	seen, ok := h.LastSeen(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Unknown User", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, seen)
+}
+
+// handleAdminDisconnect kicks a connection by socket ID.
+func (h *Hub) handleAdminDisconnect(w http.ResponseWriter, r *http.Request) {
+	if !h.Disconnect(r.PathValue("id")) {
+		http.Error(w, "Unknown Connection", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,148 @@
+package pushpop
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+)
+
+var errAliasChain = errors.New("aliases cannot point to or from other aliases")
+
+// membership is a client's subscription to a channel as the hub keeps it:
+// the events it receives and the alias it subscribed through, if any.
+type membership struct {
+	filter eventFilter
+	alias  string
+}
+
+// name returns the channel name the client subscribed with.
+func (s *Subscription) name() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Channel
+}
+
+func (s *Subscription) membership() membership {
+	return membership{filter: newEventFilter(s.Events), alias: s.Alias}
+}
+
+// label renames message to the alias the client subscribed to its channel
+// through, so clients keep seeing the name they asked for.
+func (c *Client) label(message Message) Message {
+	if m, ok := c.channels.Load(message.Channel); ok {
+		if alias := m.(membership).alias; alias != "" {
+			message.Channel = alias
+		}
+	}
+	return message
+}
+
+// WithChannelAlias makes alias a name for target; see AliasChannel. Invalid
+// aliases are logged and ignored.
+func WithChannelAlias(alias, target string) Option {
+	return func(h *Hub) {
+		if err := h.AliasChannel(alias, target); err != nil {
+			h.log.Error("Invalid channel alias", "alias", alias, "target", target, "err", err)
+		}
+	}
+}
+
+// AliasChannel makes alias a name for target, so a channel can be renamed
+// or migrated server-side, e.g. "news" to "news:v2", without breaking
+// deployed clients. Subscriptions, client publishes, triggers, and history
+// requests for the alias use the target, and subscribers through the alias
+// receive its messages under the alias name. Connections subscribed to the
+// alias as a channel of its own before it was created keep that
+// subscription until they resubscribe.
+func (h *Hub) AliasChannel(alias, target string) error {
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+	if alias == "" || target == "" || alias == target {
+		return errAliasChain
+	}
+	if _, ok := h.registry.aliases[target]; ok {
+		return errAliasChain
+	}
+	for _, t := range h.registry.aliases {
+		if t == alias {
+			return errAliasChain
+		}
+	}
+	if h.registry.aliases == nil {
+		h.registry.aliases = make(map[string]string)
+	}
+	h.registry.aliases[alias] = target
+	return nil
+}
+
+// RemoveChannelAlias removes an alias and reports whether it existed.
+func (h *Hub) RemoveChannelAlias(alias string) bool {
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+	_, ok := h.registry.aliases[alias]
+	delete(h.registry.aliases, alias)
+	return ok
+}
+
+// ChannelAliases returns the aliases and their targets.
+func (h *Hub) ChannelAliases() map[string]string {
+	h.registry.mu.RLock()
+	defer h.registry.mu.RUnlock()
+	aliases := make(map[string]string, len(h.registry.aliases))
+	for alias, target := range h.registry.aliases {
+		aliases[alias] = target
+	}
+	return aliases
+}
+
+// resolveChannel returns the target of an alias, or name itself.
+func (h *Hub) resolveChannel(name string) string {
+	h.registry.mu.RLock()
+	defer h.registry.mu.RUnlock()
+	if target, ok := h.registry.aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// handleAdminAliases lists the aliases.
+func (h *Hub) handleAdminAliases(w http.ResponseWriter, r *http.Request) {
+	aliases := h.ChannelAliases()
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	list := make([]map[string]string, 0, len(names))
+	for _, alias := range names {
+		list = append(list, map[string]string{"alias": alias, "target": aliases[alias]})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"aliases": list})
+}
+
+// handleAdminAlias points an alias at the target in a {"target": ...} body.
+func (h *Hub) handleAdminAlias(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+	if err := h.AliasChannel(r.PathValue("name"), body.Target); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminRemoveAlias removes an alias.
+func (h *Hub) handleAdminRemoveAlias(w http.ResponseWriter, r *http.Request) {
+	if !h.RemoveChannelAlias(r.PathValue("name")) {
+		http.Error(w, "Unknown Alias", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,228 @@
+// Package analytics inserts the metadata of every message a Hub fans out
+// into Postgres or ClickHouse, for after-the-fact traffic analysis without
+// scraping logs.
+//
+// It uses database/sql, so the application links the driver of its
+// choice, e.g. github.com/jackc/pgx/v5/stdlib or
+// github.com/ClickHouse/clickhouse-go/v2:
+//
+//	sink := analytics.New(analytics.Config{DB: db, Dialect: analytics.Postgres}, log)
+//	hub := pushpop.NewHub(log, pushpop.WithMessageObserver(sink.Observe))
+//	go sink.Run(ctx)
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+)
+
+// Dialect is the SQL dialect of the database.
+type Dialect string
+
+// Supported dialects.
+const (
+	Postgres   Dialect = "postgres"
+	ClickHouse Dialect = "clickhouse"
+)
+
+// columns are the columns of a row, in insert order.
+var columns = []string{
+	"id", "channel", "event", "origin_type", "origin_id", "payload_bytes",
+	"published_at", "fanned_out_at", "enqueued", "failed",
+}
+
+// tableName restricts Config.Table to plain, optionally schema-qualified,
+// identifiers, since it is written into statements.
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Config configures a Sink.
+type Config struct {
+	DB      *sql.DB
+	Dialect Dialect
+	// Table receives a row per message. Defaults to "pushpop_messages".
+	Table string
+	// CreateTable creates the table if it does not exist when Run starts.
+	CreateTable bool
+	// BatchSize is how many rows are inserted at once. Defaults to 1000.
+	BatchSize int
+	// Interval is how often a partial batch is inserted. Defaults to 5s.
+	Interval time.Duration
+	// BufferSize bounds the records waiting to be inserted. Defaults to
+	// 10000.
+	BufferSize int
+}
+
+// Sink inserts message records into a database in batches.
+type Sink struct {
+	cfg Config
+	log pushpop.Logger
+	in  chan pushpop.MessageRecord
+}
+
+// New creates a Sink. Pass its Observe method to pushpop.WithMessageObserver
+// and call Run to start inserting.
+func New(cfg Config, log pushpop.Logger) *Sink {
+	if cfg.Dialect == "" {
+		cfg.Dialect = Postgres
+	}
+	if cfg.Table == "" {
+		cfg.Table = "pushpop_messages"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+	return &Sink{cfg: cfg, log: log, in: make(chan pushpop.MessageRecord, cfg.BufferSize)}
+}
+
+// Observe queues a record for insertion, dropping it if the buffer is full.
+func (s *Sink) Observe(record pushpop.MessageRecord) {
+	select {
+	case s.in <- record:
+	default:
+		s.log.Warn("Analytics buffer full, dropping record", "channel", record.Message.Channel)
+	}
+}
+
+// Run inserts queued records until ctx is cancelled, then inserts what is
+// left. A batch that fails to insert is logged and dropped.
+func (s *Sink) Run(ctx context.Context) error {
+	if !tableName.MatchString(s.cfg.Table) {
+		return fmt.Errorf("invalid table name %q", s.cfg.Table)
+	}
+	if s.cfg.CreateTable {
+		if _, err := s.cfg.DB.ExecContext(ctx, s.createStatement()); err != nil {
+			return fmt.Errorf("create table: %w", err)
+		}
+	}
+
+	batch := make([]pushpop.MessageRecord, 0, s.cfg.BatchSize)
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for len(s.in) > 0 {
+				batch = append(batch, <-s.in)
+			}
+			insertCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			s.insert(insertCtx, batch)
+			return nil
+		case record := <-s.in:
+			batch = append(batch, record)
+			if len(batch) >= s.cfg.BatchSize {
+				s.insert(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.insert(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// insert writes a batch, logging a failure.
+func (s *Sink) insert(ctx context.Context, batch []pushpop.MessageRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.insertBatch(ctx, batch); err != nil {
+		s.log.Error("Failed to insert analytics records", "records", len(batch), "err", err)
+	}
+}
+
+// insertBatch writes a batch in a transaction with a prepared statement,
+// which ClickHouse drivers send as a single block.
+func (s *Sink) insertBatch(ctx context.Context, batch []pushpop.MessageRecord) error {
+	tx, err := s.cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, s.insertStatement())
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, record := range batch {
+		if _, err := stmt.ExecContext(ctx, row(record)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// row returns the column values of a record.
+func row(record pushpop.MessageRecord) []interface{} {
+	message := record.Message
+	var id, originType, originID string
+	publishedAt := record.FannedOutAt
+	if envelope := message.Envelope; envelope != nil {
+		id, publishedAt = envelope.ID, envelope.Timestamp
+		originType, originID = string(envelope.Origin.Type), envelope.Origin.ID
+	}
+	var size int64
+	if data, err := json.Marshal(message.Payload); err == nil {
+		size = int64(len(data))
+	}
+	return []interface{}{
+		id, message.Channel, message.Event, originType, originID, size,
+		publishedAt.UTC(), record.FannedOutAt.UTC(), int64(record.Enqueued), int64(record.Failed),
+	}
+}
+
+// insertStatement returns the statement inserting a row.
+func (s *Sink) insertStatement() string {
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+		if s.cfg.Dialect == Postgres {
+			placeholders[i] = "$" + strconv.Itoa(i+1)
+		}
+	}
+	return "INSERT INTO " + s.cfg.Table + " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+}
+
+// createStatement returns the statement creating the table.
+func (s *Sink) createStatement() string {
+	if s.cfg.Dialect == ClickHouse {
+		return "CREATE TABLE IF NOT EXISTS " + s.cfg.Table + ` (
+	id String,
+	channel LowCardinality(String),
+	event LowCardinality(String),
+	origin_type LowCardinality(String),
+	origin_id String,
+	payload_bytes Int64,
+	published_at DateTime64(3, 'UTC'),
+	fanned_out_at DateTime64(3, 'UTC'),
+	enqueued Int64,
+	failed Int64
+) ENGINE = MergeTree ORDER BY (channel, fanned_out_at)`
+	}
+	return "CREATE TABLE IF NOT EXISTS " + s.cfg.Table + ` (
+	id text NOT NULL,
+	channel text NOT NULL,
+	event text NOT NULL,
+	origin_type text NOT NULL,
+	origin_id text NOT NULL,
+	payload_bytes bigint NOT NULL,
+	published_at timestamptz NOT NULL,
+	fanned_out_at timestamptz NOT NULL,
+	enqueued bigint NOT NULL,
+	failed bigint NOT NULL
+)`
+}
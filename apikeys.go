@@ -0,0 +1,312 @@
+package pushpop
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultKeyOverlap is how long a rotated key's previous secret stays
+// valid unless another overlap is given.
+const defaultKeyOverlap = time.Hour
+
+var (
+	errUnknownKeyScope = errors.New("scope must be publish or admin")
+	errUnknownAPIKey   = errors.New("unknown API key")
+)
+
+// KeyScope is what an API key grants.
+type KeyScope string
+
+// API key scopes. Admin keys may also publish.
+const (
+	ScopePublish KeyScope = "publish"
+	ScopeAdmin   KeyScope = "admin"
+)
+
+// APIKey is a credential for producers calling /trigger, or for the admin
+// API, that can be created, rotated, and revoked at runtime.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Scope     KeyScope   `json:"scope"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	// Secret is only returned when the key is created or rotated. Send it
+	// as an "Authorization: Bearer" header.
+	Secret string `json:"secret,omitempty"`
+}
+
+// StoredAPIKey is an API key as kept in snapshots, with the hashes of its
+// valid secrets instead of the secrets.
+type StoredAPIKey struct {
+	APIKey
+	Secrets []KeySecret `json:"secrets"`
+}
+
+// KeySecret is the SHA-256 hash of a key's secret. A secret replaced by
+// rotation expires at the end of the overlap window.
+type KeySecret struct {
+	Hash      string     `json:"hash"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// keyStore holds the API keys by ID.
+type keyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*StoredAPIKey
+	// secured marks the scopes that ever had a key. Their checks stay on
+	// when the last key is revoked, rather than opening the API again.
+	secured map[KeyScope]bool
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey creates a key with the given scope and returns it with its
+// secret, which cannot be retrieved later.
+func (h *Hub) CreateAPIKey(name string, scope KeyScope) (APIKey, error) {
+	if scope != ScopePublish && scope != ScopeAdmin {
+		return APIKey{}, errUnknownKeyScope
+	}
+	secret := "pp_" + newToken()
+	key := &StoredAPIKey{
+		APIKey:  APIKey{ID: newToken()[:16], Name: name, Scope: scope, CreatedAt: time.Now()},
+		Secrets: []KeySecret{{Hash: hashSecret(secret)}},
+	}
+
+	h.apiKeys.mu.Lock()
+	defer h.apiKeys.mu.Unlock()
+	if h.apiKeys.keys == nil {
+		h.apiKeys.keys = make(map[string]*StoredAPIKey)
+	}
+	h.apiKeys.keys[key.ID] = key
+	h.apiKeys.secure(scope)
+	created := key.APIKey
+	created.Secret = secret
+	return created, nil
+}
+
+// RotateAPIKey gives a key a new secret and returns it. The previous
+// secrets stay valid for overlap, one hour if it is zero, so producers can
+// switch over without downtime.
+func (h *Hub) RotateAPIKey(id string, overlap time.Duration) (APIKey, error) {
+	if overlap <= 0 {
+		overlap = defaultKeyOverlap
+	}
+	now := time.Now()
+	expires := now.Add(overlap)
+	secret := "pp_" + newToken()
+
+	h.apiKeys.mu.Lock()
+	defer h.apiKeys.mu.Unlock()
+	key, ok := h.apiKeys.keys[id]
+	if !ok {
+		return APIKey{}, errUnknownAPIKey
+	}
+	secrets := []KeySecret{{Hash: hashSecret(secret)}}
+	for _, s := range key.Secrets {
+		if s.ExpiresAt != nil && !s.ExpiresAt.After(now) {
+			continue
+		}
+		if s.ExpiresAt == nil || s.ExpiresAt.After(expires) {
+			s.ExpiresAt = &expires
+		}
+		secrets = append(secrets, s)
+	}
+	key.Secrets = secrets
+	key.RotatedAt = &now
+	rotated := key.APIKey
+	rotated.Secret = secret
+	return rotated, nil
+}
+
+// RevokeAPIKey deletes a key, invalidating all of its secrets at once. It
+// reports whether the key existed. Revoking the last key of a scope does
+// not turn its checks off: requests are refused until a new key is
+// created.
+func (h *Hub) RevokeAPIKey(id string) bool {
+	h.apiKeys.mu.Lock()
+	defer h.apiKeys.mu.Unlock()
+	_, ok := h.apiKeys.keys[id]
+	delete(h.apiKeys.keys, id)
+	return ok
+}
+
+// APIKeys lists the keys, without secrets, oldest first.
+func (h *Hub) APIKeys() []APIKey {
+	h.apiKeys.mu.RLock()
+	defer h.apiKeys.mu.RUnlock()
+	keys := make([]APIKey, 0, len(h.apiKeys.keys))
+	for _, key := range h.apiKeys.keys {
+		keys = append(keys, key.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// has reports whether a key with scope was ever created, which turns on
+// key checks for that scope for good.
+func (s *keyStore) has(scope KeyScope) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.secured[scope]
+}
+
+// secure turns on key checks for scope. The caller holds mu.
+func (s *keyStore) secure(scope KeyScope) {
+	if s.secured == nil {
+		s.secured = make(map[KeyScope]bool)
+	}
+	s.secured[scope] = true
+}
+
+// scopes lists the scopes whose key checks are on, for a Snapshot.
+func (s *keyStore) scopes() []KeyScope {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scopes := make([]KeyScope, 0, len(s.secured))
+	for scope := range s.secured {
+		scopes = append(scopes, scope)
+	}
+	sort.Slice(scopes, func(i, j int) bool { return scopes[i] < scopes[j] })
+	return scopes
+}
+
+// verify reports whether secret is a valid secret of a key granting scope.
+func (s *keyStore) verify(secret string, scope KeyScope, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	hash := []byte(hashSecret(secret))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.Scope != scope && key.Scope != ScopeAdmin {
+			continue
+		}
+		for _, stored := range key.Secrets {
+			if stored.ExpiresAt != nil && !stored.ExpiresAt.After(now) {
+				continue
+			}
+			if subtle.ConstantTimeCompare(hash, []byte(stored.Hash)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// snapshot copies the keys for a Snapshot.
+func (s *keyStore) snapshot() []StoredAPIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]StoredAPIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, StoredAPIKey{APIKey: key.APIKey, Secrets: append([]KeySecret(nil), key.Secrets...)})
+	}
+	return keys
+}
+
+// restore replaces the keys with those of a Snapshot, and turns on the
+// checks of their scopes and of scopes.
+func (s *keyStore) restore(keys []StoredAPIKey, scopes []KeyScope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = make(map[string]*StoredAPIKey, len(keys))
+	for i := range keys {
+		s.keys[keys[i].ID] = &keys[i]
+		s.secure(keys[i].Scope)
+	}
+	for _, scope := range scopes {
+		s.secure(scope)
+	}
+}
+
+// authorizedPublisher checks the request's bearer token once a publish key
+// has been created; until then /trigger performs no authentication of its
+// own.
+func (h *Hub) authorizedPublisher(r *http.Request) bool {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return h.AuthorizedPublisher(token)
+}
+
+// AuthorizedPublisher reports whether token is a valid publish key, or
+// true until the hub's first publish key is created, for publish APIs
+// served outside the hub's handlers.
+func (h *Hub) AuthorizedPublisher(token string) bool {
+	if !h.apiKeys.has(ScopePublish) {
+		return true
+	}
+	return h.apiKeys.verify(token, ScopePublish, time.Now())
+}
+
+// handleAdminKeys lists the API keys.
+func (h *Hub) handleAdminKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.APIKeys())
+}
+
+// handleAdminCreateKey creates a key from a {"name": ..., "scope": ...}
+// body.
+func (h *Hub) handleAdminCreateKey(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name  string   `json:"name"`
+		Scope KeyScope `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+	key, err := h.CreateAPIKey(body.Name, body.Scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// handleAdminRotateKey rotates a key. The optional body sets the overlap,
+// written like "24h".
+func (h *Hub) handleAdminRotateKey(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Overlap string `json:"overlap"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+			return
+		}
+	}
+	var overlap time.Duration
+	if body.Overlap != "" {
+		var err error
+		if overlap, err = time.ParseDuration(body.Overlap); err != nil {
+			http.Error(w, "Invalid Overlap", http.StatusBadRequest)
+			return
+		}
+	}
+	key, err := h.RotateAPIKey(r.PathValue("id"), overlap)
+	if err != nil {
+		http.Error(w, "Unknown Key", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+// handleAdminRevokeKey revokes a key.
+func (h *Hub) handleAdminRevokeKey(w http.ResponseWriter, r *http.Request) {
+	if !h.RevokeAPIKey(r.PathValue("id")) {
+		http.Error(w, "Unknown Key", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
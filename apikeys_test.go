@@ -0,0 +1,154 @@
+package pushpop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trigger posts a message to /trigger with token as its bearer token and
+// returns the status code.
+func trigger(t *testing.T, server *httptest.Server, token string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/trigger", strings.NewReader(`{"channel": "orders", "event": "created"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("trigger: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	hub := newTestHub(t)
+	publish, err := hub.CreateAPIKey("producer", ScopePublish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := hub.CreateAPIKey("operator", ScopeAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hub.CreateAPIKey("other", "read"); err != errUnknownKeyScope {
+		t.Errorf("unknown scope: got %v, want %v", err, errUnknownKeyScope)
+	}
+
+	tests := []struct {
+		name             string
+		token            string
+		publisher, admin bool
+	}{
+		{"publish key", publish.Secret, true, false},
+		{"admin key", admin.Secret, true, true},
+		{"no token", "", false, false},
+		{"unknown key", "pp_" + newToken(), false, false},
+		{"tampered key", publish.Secret[:len(publish.Secret)-1] + "x", false, false},
+		{"key ID", publish.ID, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hub.AuthorizedPublisher(tt.token); got != tt.publisher {
+				t.Errorf("AuthorizedPublisher = %v, want %v", got, tt.publisher)
+			}
+			if got := hub.AuthorizedAdmin(tt.token); got != tt.admin {
+				t.Errorf("AuthorizedAdmin = %v, want %v", got, tt.admin)
+			}
+		})
+	}
+}
+
+func TestAPIKeyRotation(t *testing.T) {
+	hub := newTestHub(t)
+	key, err := hub.CreateAPIKey("producer", ScopePublish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := hub.RotateAPIKey(key.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Secret == key.Secret {
+		t.Fatal("rotation kept the secret")
+	}
+	now := time.Now()
+	tests := []struct {
+		name   string
+		secret string
+		at     time.Time
+		valid  bool
+	}{
+		{"new secret", rotated.Secret, now, true},
+		{"old secret within the overlap", key.Secret, now, true},
+		{"old secret after the overlap", key.Secret, now.Add(2 * time.Hour), false},
+		{"new secret after the overlap", rotated.Secret, now.Add(2 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hub.apiKeys.verify(tt.secret, ScopePublish, tt.at); got != tt.valid {
+				t.Errorf("verify = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+	if _, err := hub.RotateAPIKey("missing", 0); err != errUnknownAPIKey {
+		t.Errorf("rotate unknown key: got %v, want %v", err, errUnknownAPIKey)
+	}
+}
+
+// TestRevokeLastKey checks that revoking the last key of a scope keeps the
+// scope locked instead of opening it to unauthenticated requests.
+func TestRevokeLastKey(t *testing.T) {
+	hub := newTestHub(t)
+	server := httptest.NewServer(hub.Handler())
+	defer server.Close()
+
+	if status := trigger(t, server, ""); status != http.StatusOK {
+		t.Fatalf("before any key: got %d, want %d", status, http.StatusOK)
+	}
+	key, err := hub.CreateAPIKey("producer", ScopePublish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := trigger(t, server, key.Secret); status != http.StatusOK {
+		t.Fatalf("with key: got %d, want %d", status, http.StatusOK)
+	}
+	if !hub.RevokeAPIKey(key.ID) {
+		t.Fatal("revoke: key not found")
+	}
+	if hub.RevokeAPIKey(key.ID) {
+		t.Error("revoke: key revoked twice")
+	}
+	for _, token := range []string{"", key.Secret} {
+		if status := trigger(t, server, token); status != http.StatusUnauthorized {
+			t.Errorf("after revoking the last key, token %q: got %d, want %d", token, status, http.StatusUnauthorized)
+		}
+	}
+
+	admin, err := hub.CreateAPIKey("operator", ScopeAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.RevokeAPIKey(admin.ID)
+	if !hub.AdminSecured() {
+		t.Error("admin API unsecured after revoking the last admin key")
+	}
+	if hub.AuthorizedAdmin("") || hub.AuthorizedAdmin(admin.Secret) {
+		t.Error("admin API authorized after revoking the last admin key")
+	}
+
+	// The locked scopes survive a restart.
+	restored := NewHub(hub.log)
+	if err := restored.Restore(hub.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	if restored.AuthorizedPublisher("") || !restored.AdminSecured() {
+		t.Error("scopes unlocked by a snapshot")
+	}
+}
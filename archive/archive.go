@@ -0,0 +1,225 @@
+// Package archive batches the messages of pushpop channels into files and
+// writes them to object storage such as S3, for audit trails and training
+// data.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+)
+
+// Store writes archive files.
+type Store interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+}
+
+// Encoder writes a batch of messages in a file format.
+type Encoder interface {
+	// Extension is appended to object keys, e.g. ".ndjson".
+	Extension() string
+	ContentType() string
+	Encode(w io.Writer, messages []pushpop.Message) error
+}
+
+// NDJSON encodes a message per line as JSON, with its envelope.
+type NDJSON struct{}
+
+// Extension returns ".ndjson".
+func (NDJSON) Extension() string { return ".ndjson" }
+
+// ContentType returns "application/x-ndjson".
+func (NDJSON) ContentType() string { return "application/x-ndjson" }
+
+// Encode writes the messages a line each.
+func (NDJSON) Encode(w io.Writer, messages []pushpop.Message) error {
+	enc := json.NewEncoder(w)
+	for _, message := range messages {
+		if err := enc.Encode(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config configures an Archiver.
+type Config struct {
+	// Channels are the archived channels.
+	Channels []string
+	// Store receives the files.
+	Store Store
+	// Encoder is the file format. Defaults to NDJSON.
+	Encoder Encoder
+	// Gzip compresses files, adding ".gz" to their keys.
+	Gzip bool
+	// Keyring, if set, encrypts files at rest, after compressing them,
+	// adding ".enc" to their keys. Give the Source the same keyring.
+	Keyring *pushpop.Keyring
+	// Prefix starts every object key, e.g. "pushpop/". Keys continue with
+	// Hive-style partitions, "channel=<channel>/date=<YYYY-MM-DD>/", and a
+	// file name that sorts by time.
+	Prefix string
+	// Interval is how often batches are written. Defaults to 1m.
+	Interval time.Duration
+	// MaxBatch writes a channel's batch early once it holds this many
+	// messages. Defaults to 10000.
+	MaxBatch int
+	// BufferSize bounds the messages waiting to be batched. Defaults to
+	// 4096.
+	BufferSize int
+}
+
+// Archiver writes the messages broadcast on channels to a Store in
+// batches.
+type Archiver struct {
+	hub *pushpop.Hub
+	cfg Config
+	log pushpop.Logger
+	in  chan pushpop.Message
+}
+
+// New creates an Archiver for hub. Call Run to start archiving.
+func New(hub *pushpop.Hub, cfg Config, log pushpop.Logger) *Archiver {
+	if cfg.Encoder == nil {
+		cfg.Encoder = NDJSON{}
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = 10000
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 4096
+	}
+	return &Archiver{
+		hub: hub,
+		cfg: cfg,
+		log: log,
+		in:  make(chan pushpop.Message, cfg.BufferSize),
+	}
+}
+
+// Run archives messages until ctx is cancelled, then writes what is left.
+// Batches that fail to write are retried with the next interval, keeping up
+// to ten batches of a channel.
+func (a *Archiver) Run(ctx context.Context) error {
+	for _, channel := range a.cfg.Channels {
+		unsubscribe := a.hub.Subscribe(channel, func(message pushpop.Message) {
+			if message.Replayed {
+				return
+			}
+			select {
+			case a.in <- message:
+			default:
+				a.log.Warn("Archive buffer full, dropping message", "channel", message.Channel)
+			}
+		})
+		defer unsubscribe()
+	}
+
+	batches := make(map[string][]pushpop.Message)
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			a.drain(batches)
+			flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			for channel := range batches {
+				a.flush(flushCtx, batches, channel)
+			}
+			return nil
+		case message := <-a.in:
+			batches[message.Channel] = append(batches[message.Channel], message)
+			if len(batches[message.Channel])%a.cfg.MaxBatch == 0 {
+				a.flush(ctx, batches, message.Channel)
+			}
+		case <-ticker.C:
+			for channel := range batches {
+				a.flush(ctx, batches, channel)
+			}
+		}
+	}
+}
+
+// drain batches the messages still buffered.
+func (a *Archiver) drain(batches map[string][]pushpop.Message) {
+	for {
+		select {
+		case message := <-a.in:
+			batches[message.Channel] = append(batches[message.Channel], message)
+		default:
+			return
+		}
+	}
+}
+
+// flush writes a channel's batch and forgets it once written. A failed
+// batch is kept for the next flush, up to ten batches' worth of messages.
+func (a *Archiver) flush(ctx context.Context, batches map[string][]pushpop.Message, channel string) {
+	messages := batches[channel]
+	if len(messages) == 0 {
+		delete(batches, channel)
+		return
+	}
+	if err := a.write(ctx, channel, messages); err != nil {
+		a.log.Error("Failed to write archive", "channel", channel, "messages", len(messages), "err", err)
+		if limit := 10 * a.cfg.MaxBatch; len(messages) > limit {
+			a.log.Warn("Archive backlog full, dropping oldest messages", "channel", channel, "dropped", len(messages)-limit)
+			batches[channel] = messages[len(messages)-limit:]
+		}
+		return
+	}
+	delete(batches, channel)
+}
+
+// write encodes messages into a file and stores it.
+func (a *Archiver) write(ctx context.Context, channel string, messages []pushpop.Message) error {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if a.cfg.Gzip {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	if err := a.cfg.Encoder.Encode(w, messages); err != nil {
+		return err
+	}
+	contentType := a.cfg.Encoder.ContentType()
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		contentType = "application/gzip"
+	}
+	body := buf.Bytes()
+	if a.cfg.Keyring != nil {
+		var err error
+		if body, err = a.cfg.Keyring.Encrypt(body); err != nil {
+			return err
+		}
+		contentType = "application/octet-stream"
+	}
+	return a.cfg.Store.Put(ctx, a.key(channel, time.Now()), body, contentType)
+}
+
+// key names the file of a channel's batch written at t.
+func (a *Archiver) key(channel string, t time.Time) string {
+	t = t.UTC()
+	key := a.cfg.Prefix + "channel=" + channel + "/date=" + t.Format(time.DateOnly) + "/" +
+		t.Format("150405") + "-" + pushpop.NewMessageID() + a.cfg.Encoder.Extension()
+	if a.cfg.Gzip {
+		key += ".gz"
+	}
+	if a.cfg.Keyring != nil {
+		key += ".enc"
+	}
+	return key
+}
@@ -0,0 +1,259 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3Store.
+type S3Config struct {
+	// Endpoint is the service URL, e.g. "http://minio:9000". Defaults to
+	// AWS S3 in Region.
+	Endpoint string
+	// Region defaults to "us-east-1".
+	Region string
+	Bucket string
+	// AccessKeyID and SecretAccessKey sign requests, with SessionToken for
+	// temporary credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// PathStyle addresses the bucket in the path instead of the host name,
+	// as most S3-compatible services other than AWS expect.
+	PathStyle bool
+	// Client defaults to a client with a 1m timeout.
+	Client *http.Client
+}
+
+// S3Store is a Store and ReadStore for an S3 bucket, or a bucket of an
+// S3-compatible service such as MinIO or R2, signing requests with AWS
+// Signature Version 4.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+}
+
+// NewS3Store returns a store for the configured bucket.
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("missing bucket")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: time.Minute}
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+	}
+	return &S3Store{cfg: cfg, endpoint: endpoint}, nil
+}
+
+// Put uploads a file with a single PUT.
+func (s *S3Store) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	req, err := s.request(ctx, http.MethodPut, key, nil, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.do(req, body)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads a file.
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// List returns the keys starting with prefix, in lexical order.
+func (s *S3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		req, err := s.request(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, nil)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// request builds a request for key, or for the bucket if key is empty.
+func (s *S3Store) request(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Request, error) {
+	target := *s.endpoint
+	path := "/"
+	if key != "" {
+		path += escapePath(key)
+	}
+	if s.cfg.PathStyle {
+		path = "/" + escapePath(s.cfg.Bucket) + strings.TrimSuffix(path, "/")
+	} else {
+		target.Host = s.cfg.Bucket + "." + target.Host
+	}
+	target.RawPath = strings.TrimSuffix(s.endpoint.EscapedPath(), "/") + path
+	target.Path, _ = url.PathUnescape(target.RawPath)
+	target.RawQuery = canonicalQuery(query)
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	return http.NewRequestWithContext(ctx, method, target.String(), reader)
+}
+
+// do signs and sends a request, turning any answer but 200 into an error.
+func (s *S3Store) do(req *http.Request, body []byte) (*http.Response, error) {
+	s.sign(req, body, time.Now())
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 headers to req.
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{"host": req.URL.Host, "x-amz-content-sha256": payloadHash, "x-amz-date": amzDate}
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = s.cfg.SessionToken
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// escapePath escapes an object key as Signature Version 4 expects: every
+// byte but unreserved characters and the slashes between segments.
+func escapePath(key string) string {
+	return escape(key, "-_.~/")
+}
+
+// canonicalQuery encodes a query string with sorted, escaped parameters,
+// as Signature Version 4 expects.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, escape(key, "-_.~")+"="+escape(value, "-_.~"))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// escape percent-encodes every byte of s but letters, digits, and keep.
+func escape(s, keep string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte(keep, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
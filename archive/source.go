@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+)
+
+// ReadStore reads archive files back, e.g. for replays.
+type ReadStore interface {
+	// List returns the keys starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Source reads the NDJSON files written by an Archiver, gzipped, encrypted,
+// or neither, so they can be replayed with pushpop.WithReplaySource.
+type Source struct {
+	Store ReadStore
+	// Prefix is the Archiver's Config.Prefix.
+	Prefix string
+	// Keyring decrypts files the Archiver encrypted. It must hold every
+	// key files were encrypted with.
+	Keyring *pushpop.Keyring
+}
+
+// Messages returns the archived messages of channel published from from
+// until to, oldest first.
+func (s *Source) Messages(ctx context.Context, channel string, from, to time.Time) ([]pushpop.Message, error) {
+	var messages []pushpop.Message
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.AddDate(0, 0, 1) {
+		keys, err := s.Store.List(ctx, s.Prefix+"channel="+channel+"/date="+day.Format(time.DateOnly)+"/")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			data, err := s.Store.Get(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			name, encrypted := strings.CutSuffix(key, ".enc")
+			if encrypted {
+				if data, err = s.Keyring.Decrypt(data); err != nil {
+					return nil, fmt.Errorf("%s: %w", key, err)
+				}
+			}
+			var r io.Reader = bytes.NewReader(data)
+			if strings.HasSuffix(name, ".gz") {
+				if r, err = gzip.NewReader(r); err != nil {
+					return nil, err
+				}
+			}
+			scanner := bufio.NewScanner(r)
+			scanner.Buffer(nil, 64<<20)
+			for scanner.Scan() {
+				var message pushpop.Message
+				if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+					return nil, err
+				}
+				if envelope := message.Envelope; envelope == nil || envelope.Timestamp.Before(from) || !envelope.Timestamp.Before(to) {
+					continue
+				}
+				messages = append(messages, message)
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Envelope.Timestamp.Before(messages[j].Envelope.Timestamp)
+	})
+	return messages, nil
+}
@@ -0,0 +1,111 @@
+package pushpop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxTriggerBatch bounds the messages of a batch trigger.
+const maxTriggerBatch = 1000
+
+// batchMessage is a message of a batch trigger: a trigger with its own
+// idempotency key.
+type batchMessage struct {
+	triggerRequest
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// BatchResult is the outcome of a message of a batch trigger, in the order
+// of the batch.
+type BatchResult struct {
+	// ID is the message ID, shared by all of the message's channels.
+	ID string `json:"id,omitempty"`
+	// Status is the HTTP status /trigger would have answered the message
+	// with, e.g. 200, 404 for an unknown channel, or 429 when rate limited.
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// RetryAfter is how many seconds a rate limited message should wait
+	// before it is retried.
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Duplicate reports that a message with the same idempotency key was
+	// already published, with ID.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// HandleTriggerBatch publishes several messages in one request, e.g. from a
+// producer buffering its messages:
+//
+//	{"messages": [{"channel": "orders", "event": "created", "payload": {...}, "idempotency_key": "..."}, ...]}
+//
+// Each message may list several channels and carry an idempotency key, like
+// a /trigger with an Idempotency-Key header. The hub answers 200 with a
+// result per message, in order; a message failing does not fail the rest.
+// Batch messages cannot be scheduled or sent to a single socket. The body
+// is limited like a /trigger body.
+func HandleTriggerBatch(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hub.intake.add()
+		defer hub.intake.done()
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid Request Method", http.StatusMethodNotAllowed)
+			return
+		}
+		if !hub.authorizedPublisher(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if hub.triggerBodyLimit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, hub.triggerBodyLimit)
+		}
+		body, err := io.ReadAll(r.Body)
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err == nil {
+			err = hub.jsonLimits.check(body)
+		}
+		var batch struct {
+			Messages []batchMessage `json:"messages"`
+		}
+		if err == nil {
+			err = json.Unmarshal(body, &batch)
+		}
+		if err != nil {
+			hub.log.Error("error decoding batch", "err", err)
+			http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+			return
+		}
+		if len(batch.Messages) > maxTriggerBatch {
+			http.Error(w, "Too Many Messages", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), defaultTriggerTimeout)
+		defer cancel()
+		results := make([]BatchResult, len(batch.Messages))
+		for i, message := range batch.Messages {
+			results[i] = hub.triggerBatchMessage(ctx, message)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+	}
+}
+
+// triggerBatchMessage publishes a message of a batch trigger.
+func (h *Hub) triggerBatchMessage(ctx context.Context, req batchMessage) BatchResult {
+	if req.DeliverAt != nil || req.Delay != "" {
+		return BatchResult{Status: http.StatusBadRequest, Error: "batch messages cannot be scheduled"}
+	}
+	published, err := h.Publish(ctx, req.Message, PublishOptions{Channels: req.Channels, IdempotencyKey: req.IdempotencyKey})
+	result := BatchResult{ID: published.ID, Status: http.StatusOK, Duplicate: published.Duplicate}
+	var refused *PublishError
+	if errors.As(err, &refused) {
+		result.Status, result.Error = refused.Status, refused.Message
+		result.RetryAfter = int(refused.RetryAfter / time.Second)
+	}
+	return result
+}
@@ -0,0 +1,194 @@
+package pushpop
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var errBlocked = errors.New("blocked")
+
+// BlocklistEntries lists blocked IPs, CIDRs, and user IDs.
+type BlocklistEntries struct {
+	IPs   []string `json:"ips"`
+	Users []string `json:"users"`
+}
+
+// blocklist holds the blocked addresses and users.
+type blocklist struct {
+	mu       sync.RWMutex
+	prefixes map[netip.Prefix]bool
+	users    map[string]bool
+}
+
+func newBlocklist() *blocklist {
+	return &blocklist{
+		prefixes: make(map[netip.Prefix]bool),
+		users:    make(map[string]bool),
+	}
+}
+
+// parseBlockedIP parses an IP or CIDR into a prefix.
+func parseBlockedIP(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// blocked reports whether the session's IP or user is blocked.
+func (b *blocklist) blocked(session *Session) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if session.UserID != "" && b.users[session.UserID] {
+		return true
+	}
+	if len(b.prefixes) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(session.RemoteIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for prefix := range b.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithBlocklist blocks the given IPs, CIDRs, and user IDs from the start.
+// Invalid addresses are logged and skipped.
+func WithBlocklist(ips, users []string) Option {
+	return func(h *Hub) {
+		for _, ip := range ips {
+			if err := h.BlockIP(ip); err != nil {
+				h.log.Warn("Invalid blocklist entry", "ip", ip, "err", err)
+			}
+		}
+		for _, user := range users {
+			h.BlockUser(user)
+		}
+	}
+}
+
+// BlockIP blocks an IP address or CIDR range, e.g. "203.0.113.0/24", and
+// disconnects matching connections.
+func (h *Hub) BlockIP(ip string) error {
+	prefix, err := parseBlockedIP(ip)
+	if err != nil {
+		return err
+	}
+	h.blocklist.mu.Lock()
+	h.blocklist.prefixes[prefix] = true
+	h.blocklist.mu.Unlock()
+	h.disconnectBlocked()
+	return nil
+}
+
+// UnblockIP removes an IP address or CIDR range from the blocklist.
+func (h *Hub) UnblockIP(ip string) error {
+	prefix, err := parseBlockedIP(ip)
+	if err != nil {
+		return err
+	}
+	h.blocklist.mu.Lock()
+	delete(h.blocklist.prefixes, prefix)
+	h.blocklist.mu.Unlock()
+	return nil
+}
+
+// BlockUser blocks a user ID and disconnects the user's connections.
+func (h *Hub) BlockUser(userID string) {
+	h.blocklist.mu.Lock()
+	h.blocklist.users[userID] = true
+	h.blocklist.mu.Unlock()
+	h.disconnectBlocked()
+}
+
+// UnblockUser removes a user ID from the blocklist.
+func (h *Hub) UnblockUser(userID string) {
+	h.blocklist.mu.Lock()
+	delete(h.blocklist.users, userID)
+	h.blocklist.mu.Unlock()
+}
+
+// Blocklist returns the current blocklist.
+func (h *Hub) Blocklist() BlocklistEntries {
+	h.blocklist.mu.RLock()
+	defer h.blocklist.mu.RUnlock()
+	entries := BlocklistEntries{IPs: []string{}, Users: []string{}}
+	for prefix := range h.blocklist.prefixes {
+		if prefix.IsSingleIP() {
+			entries.IPs = append(entries.IPs, prefix.Addr().String())
+		} else {
+			entries.IPs = append(entries.IPs, prefix.String())
+		}
+	}
+	for user := range h.blocklist.users {
+		entries.Users = append(entries.Users, user)
+	}
+	sort.Strings(entries.IPs)
+	sort.Strings(entries.Users)
+	return entries
+}
+
+// disconnectBlocked closes every connection that is now blocked.
+func (h *Hub) disconnectBlocked() {
+	h.clients.Range(func(key, _ interface{}) bool {
+		client := key.(*Client)
+		if h.blocklist.blocked(client.session) {
+			h.log.Info("Disconnecting blocked client", "ip", client.session.RemoteIP, "user", client.session.UserID)
+			client.Close()
+		}
+		return true
+	})
+}
+
+// handleAdminBlocklist lists the blocklist.
+func (h *Hub) handleAdminBlocklist(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.Blocklist())
+}
+
+// handleAdminBlock adds or, for DELETE, removes the entries in the body.
+func (h *Hub) handleAdminBlock(w http.ResponseWriter, r *http.Request) {
+	var entries BlocklistEntries
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+	for _, ip := range entries.IPs {
+		if _, err := parseBlockedIP(ip); err != nil {
+			http.Error(w, "Invalid IP or CIDR: "+ip, http.StatusBadRequest)
+			return
+		}
+	}
+
+	remove := r.Method == http.MethodDelete
+	for _, ip := range entries.IPs {
+		if remove {
+			_ = h.UnblockIP(ip)
+		} else {
+			_ = h.BlockIP(ip)
+		}
+	}
+	for _, user := range entries.Users {
+		if remove {
+			h.UnblockUser(user)
+		} else {
+			h.BlockUser(user)
+		}
+	}
+	writeJSON(w, http.StatusOK, h.Blocklist())
+}
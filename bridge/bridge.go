@@ -0,0 +1,216 @@
+// Package bridge connects a pushpop Hub to a remote pushpop server, relaying
+// channels in one or both directions, e.g. to mirror a few channels of a
+// hosted server into a self-hosted one without federating the two.
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+	"github.com/biohackerellie/pushpop/client"
+)
+
+// Config configures a Bridge.
+type Config struct {
+	// URL is the remote server's WebSocket endpoint, e.g.
+	// "wss://push.example.com/ws". Required for Inbound.
+	URL string
+	// Header is sent with the WebSocket handshake, e.g. an Authorization
+	// header checked by the remote server's OnConnect hook.
+	Header http.Header
+	// TriggerURL is the remote server's trigger endpoint, e.g.
+	// "https://push.example.com/trigger". Required for Outbound.
+	TriggerURL string
+	// Token is a publish API key of the remote server, sent with triggers.
+	Token string
+	// Inbound channels are subscribed to on the remote server, and their
+	// messages triggered on the hub.
+	Inbound []string
+	// Outbound channels have every message broadcast on the hub triggered
+	// on the remote server.
+	Outbound []string
+	// Name tags the messages the bridge relays as Origin{Type: "bridge",
+	// ID: Name}, so it skips them when they come back around. Bridges
+	// between the same servers need distinct names. Defaults to "pushpop".
+	Name string
+	// BufferSize bounds the outbound queue. Defaults to 1024.
+	BufferSize int
+	// ReconnectDelay is the wait between attempts to connect to the remote
+	// server. Defaults to 5s.
+	ReconnectDelay time.Duration
+	// HTTPClient sends triggers. Defaults to a client with a 10s timeout.
+	HTTPClient *http.Client
+}
+
+// Bridge relays messages between a Hub and a remote pushpop server.
+type Bridge struct {
+	hub    *pushpop.Hub
+	cfg    Config
+	log    pushpop.Logger
+	origin pushpop.Origin
+	out    chan pushpop.Message
+}
+
+// New creates a Bridge for hub. Call Run to start relaying.
+func New(hub *pushpop.Hub, cfg Config, log pushpop.Logger) *Bridge {
+	if cfg.Name == "" {
+		cfg.Name = "pushpop"
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1024
+	}
+	if cfg.ReconnectDelay <= 0 {
+		cfg.ReconnectDelay = 5 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Bridge{
+		hub:    hub,
+		cfg:    cfg,
+		log:    log,
+		origin: pushpop.Origin{Type: pushpop.OriginBridge, ID: cfg.Name},
+		out:    make(chan pushpop.Message, cfg.BufferSize),
+	}
+}
+
+// Run relays messages until ctx is cancelled. The client reconnects to the
+// remote server on its own once connected; Run retries the first connection.
+func (b *Bridge) Run(ctx context.Context) error {
+	for _, channel := range b.cfg.Outbound {
+		unsubscribe := b.hub.Subscribe(channel, func(message pushpop.Message) {
+			if !b.relayed(message.Event, message.Envelope) {
+				return
+			}
+			select {
+			case b.out <- message:
+			default:
+				b.log.Warn("Bridge outbound buffer full, dropping message", "channel", message.Channel)
+			}
+		})
+		defer unsubscribe()
+	}
+
+	if len(b.cfg.Inbound) > 0 {
+		conn, err := b.connect(ctx)
+		if err != nil {
+			return nil
+		}
+		defer conn.Close()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message := <-b.out:
+			if err := b.publish(ctx, message); err != nil && ctx.Err() == nil {
+				b.log.Warn("Bridge failed to relay message", "channel", message.Channel, "event", message.Event, "err", err)
+			}
+		}
+	}
+}
+
+// relayed reports whether a message crosses the bridge: neither the hub's
+// own events nor messages the bridge relayed itself do.
+func (b *Bridge) relayed(event string, envelope *pushpop.Envelope) bool {
+	if strings.HasPrefix(event, "pushpop:") {
+		return false
+	}
+	return envelope == nil || envelope.Origin != b.origin
+}
+
+// connect subscribes to the inbound channels on the remote server, retrying
+// until it succeeds or ctx is cancelled.
+func (b *Bridge) connect(ctx context.Context) (*client.Client, error) {
+	for {
+		conn, err := b.subscribe(ctx)
+		if err == nil {
+			b.log.Info("Bridge connected", "url", b.cfg.URL, "inbound", len(b.cfg.Inbound), "outbound", len(b.cfg.Outbound))
+			return conn, nil
+		}
+		b.log.Error("Bridge failed to connect", "url", b.cfg.URL, "err", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(b.cfg.ReconnectDelay):
+		}
+	}
+}
+
+// subscribe dials the remote server and triggers the messages of the
+// inbound channels on the hub.
+func (b *Bridge) subscribe(ctx context.Context) (*client.Client, error) {
+	conn, err := client.Dial(ctx, b.cfg.URL,
+		client.WithHeader(b.cfg.Header),
+		client.WithErrorHandler(func(err error) {
+			b.log.Warn("Bridge failed to relay message", "err", err)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range b.cfg.Inbound {
+		channel, err := conn.Subscribe(name)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		channel.BindAll(func(_ context.Context, event client.Event) error {
+			if event.Replayed || !b.relayed(event.Event, event.Envelope) {
+				return nil
+			}
+			var payload interface{}
+			if len(event.Payload) > 0 {
+				if err := json.Unmarshal(event.Payload, &payload); err != nil {
+					return err
+				}
+			}
+			b.hub.Trigger(pushpop.Message{
+				Channel:  event.Channel,
+				Event:    event.Event,
+				Payload:  payload,
+				Envelope: &pushpop.Envelope{Origin: b.origin},
+			})
+			return nil
+		})
+	}
+	return conn, nil
+}
+
+// publish triggers a hub message on the remote server, tagged with the
+// bridge's origin.
+func (b *Bridge) publish(ctx context.Context, message pushpop.Message) error {
+	body, err := json.Marshal(pushpop.Message{
+		Channel:  message.Channel,
+		Event:    message.Event,
+		Payload:  message.Payload,
+		Envelope: &pushpop.Envelope{Origin: b.origin},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg.TriggerURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.cfg.Token)
+	}
+	resp, err := b.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("trigger answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package pushpop
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Broadcast delivers an event to every connection, regardless of its
+// channel subscriptions, for system-wide announcements such as scheduled
+// maintenance. The message is sent without a channel, like other server
+// notices, and with a broker it reaches the connections of every node.
+func (h *Hub) Broadcast(event string, payload interface{}) {
+	select {
+	case h.broadcast <- Message{Event: event, Payload: payload}:
+	case <-h.stopped():
+	}
+}
+
+// broadcastGlobal queues a message without a channel for every connection
+// on this node. It runs on the Run goroutine.
+func (h *Hub) broadcastGlobal(message Message, report *deliveryReport) {
+	h.clients.Range(func(key, _ interface{}) bool {
+		client := key.(*Client)
+		if reason := h.deliver(client, message); reason == "" {
+			report.enqueued++
+		} else {
+			report.failures = append(report.failures, DeliveryFailure{
+				SocketID: client.id,
+				UserID:   client.session.UserID,
+				Reason:   reason,
+			})
+		}
+		return true
+	})
+}
+
+// handleAdminBroadcast sends the event in a {"event": ..., "payload": ...}
+// body to every connection.
+func (h *Hub) handleAdminBroadcast(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Event   string      `json:"event"`
+		Payload interface{} `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Event == "" {
+		http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+	h.Broadcast(body.Event, body.Payload)
+	w.WriteHeader(http.StatusAccepted)
+}
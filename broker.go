@@ -0,0 +1,58 @@
+package pushpop
+
+import (
+	"context"
+	"time"
+)
+
+// Broker relays broadcasts between hubs running on different nodes, so a
+// message triggered on one node reaches subscribers connected to any node.
+type Broker interface {
+	// Publish sends a locally originated message to the other nodes.
+	Publish(ctx context.Context, message Message) error
+	// Subscribe delivers messages published by other nodes to handler until
+	// ctx is cancelled. Implementations must not deliver a node's own
+	// messages back to it.
+	Subscribe(ctx context.Context, handler func(Message)) error
+}
+
+// WithBroker relays every broadcast through broker so multiple pushpop
+// nodes can share subscribers.
+func WithBroker(broker Broker) Option {
+	return func(h *Hub) {
+		h.broker = broker
+	}
+}
+
+// runBroker publishes local broadcasts to the broker in order and feeds
+// messages from other nodes into the hub.
+func (h *Hub) runBroker(ctx context.Context) {
+	go func() {
+		for {
+			if err := h.broker.Subscribe(ctx, func(message Message) {
+				select {
+				case h.remote <- message:
+				case <-ctx.Done():
+				}
+			}); err != nil {
+				h.log.Error("Broker subscription failed", "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-h.outbound:
+			if err := h.broker.Publish(ctx, message); err != nil {
+				h.log.Error("Error publishing message to broker", "channel", message.Channel, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package pushpop
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// otherChannels is the label of channels outside the prefixes and top N.
+const otherChannels = "_other"
+
+// defaultTopChannels is how many unprefixed channels are reported
+// individually when ChannelMetrics.TopN is zero.
+const defaultTopChannels = 20
+
+// ChannelMetrics configures per-channel metrics. Channels matching one of
+// Prefixes are rolled up under "<prefix>*", the TopN busiest other channels
+// are reported by name, and the rest are summed under "_other", so the
+// number of series stays bounded however many channels exist.
+type ChannelMetrics struct {
+	Prefixes []string
+	// TopN defaults to 20.
+	TopN int
+}
+
+// channelMetrics counts messages per rolled-up channel label.
+type channelMetrics struct {
+	config ChannelMetrics
+
+	mu sync.Mutex
+	// messages counts the messages of prefix groups and of all unprefixed
+	// channels, under otherChannels, for as long as the hub runs.
+	messages map[string]uint64
+}
+
+// WithChannelMetrics enables per-channel message and subscriber metrics.
+func WithChannelMetrics(config ChannelMetrics) Option {
+	return func(h *Hub) {
+		if config.TopN <= 0 {
+			config.TopN = defaultTopChannels
+		}
+		// Longest prefixes first, so the most specific group wins.
+		config.Prefixes = append([]string(nil), config.Prefixes...)
+		sort.Slice(config.Prefixes, func(i, j int) bool {
+			return len(config.Prefixes[i]) > len(config.Prefixes[j])
+		})
+		h.metrics.channels = &channelMetrics{config: config, messages: make(map[string]uint64)}
+	}
+}
+
+// group returns the prefix label of channel, or false if no prefix matches.
+func (m *channelMetrics) group(channel string) (string, bool) {
+	for _, prefix := range m.config.Prefixes {
+		if strings.HasPrefix(channel, prefix) {
+			return prefix + "*", true
+		}
+	}
+	return "", false
+}
+
+// countChannelMessage counts a message broadcast to channel. It runs on the
+// Run goroutine.
+func (h *Hub) countChannelMessage(channel string, state *channelState) {
+	m := h.metrics.channels
+	if m == nil {
+		return
+	}
+	label, ok := m.group(channel)
+	if !ok {
+		label = otherChannels
+		if state != nil {
+			state.messages.Add(1)
+		}
+	}
+	m.mu.Lock()
+	m.messages[label]++
+	m.mu.Unlock()
+}
+
+// channelSample is one reported channel label.
+type channelSample struct {
+	label       string
+	subscribers int64
+	messages    uint64
+}
+
+// write writes the per-channel metrics of hub.
+func (m *channelMetrics) write(w io.Writer, hub *Hub) {
+	m.mu.Lock()
+	groups := make(map[string]*channelSample, len(m.messages))
+	for label, messages := range m.messages {
+		groups[label] = &channelSample{label: label, messages: messages}
+	}
+	m.mu.Unlock()
+	if groups[otherChannels] == nil {
+		groups[otherChannels] = &channelSample{label: otherChannels}
+	}
+
+	var candidates []channelSample
+	hub.channels.Range(func(key, val interface{}) bool {
+		channel, state := key.(string), val.(*channelState)
+		if label, ok := m.group(channel); ok {
+			if groups[label] == nil {
+				groups[label] = &channelSample{label: label}
+			}
+			groups[label].subscribers += state.count.Load()
+			return true
+		}
+		candidates = append(candidates, channelSample{label: channel, subscribers: state.count.Load(), messages: state.messages.Load()})
+		return true
+	})
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.messages != b.messages {
+			return a.messages > b.messages
+		}
+		if a.subscribers != b.subscribers {
+			return a.subscribers > b.subscribers
+		}
+		return a.label < b.label
+	})
+	other := groups[otherChannels]
+	samples := make([]channelSample, 0, len(groups)+m.config.TopN)
+	for i, candidate := range candidates {
+		if i >= m.config.TopN {
+			other.subscribers += candidate.subscribers
+			continue
+		}
+		samples = append(samples, candidate)
+		// Messages of reported channels are not counted again in _other.
+		other.messages -= min(candidate.messages, other.messages)
+	}
+	for _, group := range groups {
+		samples = append(samples, *group)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].label < samples[j].label })
+
+	fmt.Fprintf(w, "# HELP pushpop_channel_subscribers Subscribers per channel, rolled up by prefix.\n# TYPE pushpop_channel_subscribers gauge\n")
+	for _, sample := range samples {
+		fmt.Fprintf(w, "pushpop_channel_subscribers{channel=\"%s\"} %d\n", labelValue(sample.label), sample.subscribers)
+	}
+	fmt.Fprintf(w, "# HELP pushpop_channel_messages_total Messages broadcast per channel, rolled up by prefix.\n# TYPE pushpop_channel_messages_total counter\n")
+	for _, sample := range samples {
+		fmt.Fprintf(w, "pushpop_channel_messages_total{channel=\"%s\"} %d\n", labelValue(sample.label), sample.messages)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue escapes a Prometheus label value.
+func labelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
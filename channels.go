@@ -0,0 +1,149 @@
+package pushpop
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// channelState holds the subscribers of a channel. count is maintained
+// alongside clients so occupancy is exact without ranging the map.
+type channelState struct {
+	clients sync.Map
+	count   atomic.Int64
+	// messages counts broadcasts for per-channel metrics.
+	messages atomic.Uint64
+	// tenant is the tenant of the subscriber that created the channel.
+	tenant string
+	// idleSince is when the last subscriber left, or zero while the
+	// channel is occupied. It is owned by Run.
+	idleSince time.Time
+}
+
+// WithMaxChannels caps the number of distinct channels on this node.
+// Subscriptions that would create a new channel beyond the cap are rejected
+// with CodeChannelLimit; joining an existing channel is always allowed.
+func WithMaxChannels(n int) Option {
+	return func(h *Hub) {
+		h.maxChannels = n
+	}
+}
+
+// WithMaxTenantChannels caps the number of distinct channels each tenant,
+// see Session.Tenant, may create on this node.
+func WithMaxTenantChannels(n int) Option {
+	return func(h *Hub) {
+		h.maxTenantChannels = n
+	}
+}
+
+// createChannel creates the state of a new channel for a subscriber of
+// tenant, or returns nil if a channel limit is reached. It runs on the Run
+// goroutine.
+func (h *Hub) createChannel(tenant string) *channelState {
+	if h.maxChannels > 0 && h.channelCount >= h.maxChannels {
+		return nil
+	}
+	if h.maxTenantChannels > 0 && h.tenantChannels[tenant] >= h.maxTenantChannels {
+		return nil
+	}
+	h.channelCount++
+	if h.tenantChannels == nil {
+		h.tenantChannels = make(map[string]int)
+	}
+	h.tenantChannels[tenant]++
+	return &channelState{tenant: tenant}
+}
+
+// WithChannelIdleTTL keeps the state of a channel, such as its history and
+// settings, for ttl after its last subscriber leaves, so it survives brief
+// gaps in occupancy. Idle channels still count towards the channel limits.
+// By default channels are deleted as soon as they are empty.
+func WithChannelIdleTTL(ttl time.Duration) Option {
+	return func(h *Hub) {
+		h.channelIdleTTL = ttl
+	}
+}
+
+// channelEmptied handles a channel losing its last subscriber. It runs on
+// the Run goroutine.
+func (h *Hub) channelEmptied(name string, state *channelState) {
+	if h.channelIdleTTL <= 0 {
+		h.deleteChannel(name, state)
+		return
+	}
+	state.idleSince = time.Now()
+}
+
+// collectIdleChannels deletes channels that have been empty for longer than
+// the idle TTL. It runs on the Run goroutine.
+func (h *Hub) collectIdleChannels(now time.Time) {
+	h.channels.Range(func(key, val interface{}) bool {
+		state := val.(*channelState)
+		if state.count.Load() == 0 && !state.idleSince.IsZero() && now.Sub(state.idleSince) >= h.channelIdleTTL {
+			h.deleteChannel(key.(string), state)
+		}
+		return true
+	})
+}
+
+// deleteChannel removes an empty channel. It runs on the Run goroutine.
+func (h *Hub) deleteChannel(name string, state *channelState) {
+	h.channels.Delete(name)
+	h.channelCount--
+	if h.tenantChannels[state.tenant]--; h.tenantChannels[state.tenant] <= 0 {
+		delete(h.tenantChannels, state.tenant)
+	}
+}
+
+// ChannelInfo describes a channel.
+type ChannelInfo struct {
+	Name        string `json:"name"`
+	Subscribers int    `json:"subscribers"`
+	// Settings are the channel's effective settings, resolved from prefix
+	// defaults and its own configuration.
+	Settings *ChannelSettings `json:"settings,omitempty"`
+}
+
+// Occupancy returns the number of local subscribers of channel.
+func (h *Hub) Occupancy(channel string) int {
+	val, ok := h.channels.Load(channel)
+	if !ok {
+		return 0
+	}
+	return int(val.(*channelState).count.Load())
+}
+
+// Channels returns every occupied channel with its subscriber count, sorted
+// by name.
+func (h *Hub) Channels() []ChannelInfo {
+	var infos []ChannelInfo
+	h.channels.Range(func(key, val interface{}) bool {
+		if count := val.(*channelState).count.Load(); count > 0 {
+			infos = append(infos, ChannelInfo{Name: key.(string), Subscribers: int(count)})
+		}
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// handleAdminChannels lists occupied channels.
+func (h *Hub) handleAdminChannels(w http.ResponseWriter, r *http.Request) {
+	infos := h.Channels()
+	if infos == nil {
+		infos = []ChannelInfo{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"channels": infos})
+}
+
+// handleAdminChannel reports the occupancy and settings of a single
+// channel.
+func (h *Hub) handleAdminChannel(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	settings := h.settingsFor(name).redacted()
+	info := ChannelInfo{Name: name, Subscribers: h.Occupancy(name), Settings: &settings}
+	writeJSON(w, http.StatusOK, info)
+}
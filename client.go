@@ -2,9 +2,12 @@ package pushpop
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -12,18 +15,112 @@ import (
 
 // Client represents a WebSocket client.
 type Client struct {
+	id       string
+	token    string
+	session  *Session
 	channels sync.Map
 	hub      *Hub
-	conn     *websocket.Conn
+	conn     Conn
 	send     chan Message
+	high     chan Message
+	low      chan Message
+	pong     chan struct{}
 	log      Logger
+	// rpc is set for clients that speak JSON-RPC; see WithJSONRPC.
+	rpc *jsonrpcState
+
+	// readLimit and idleTimeout follow the client's subscriptions; see
+	// WithChannelLimits.
+	readLimit   atomic.Int64
+	idleTimeout atomic.Int64
+	rtt         atomic.Int64
+	// lastActive is when the client last sent a frame or pong, in unix
+	// nanoseconds.
+	lastActive atomic.Int64
+
+	// subscriptions counts the client's channels. It is owned by Run.
+	subscriptions int
+
+	// sendMu guards send against being written to after it is closed.
+	sendMu    sync.Mutex
+	closed    bool
+	closeOnce sync.Once
+	// closeCode is sent in the close frame; zero sends an empty frame.
+	closeCode atomic.Int32
+	// flushed is closed once the write pump has exited.
+	flushed chan struct{}
+}
+
+// Conn is the connection a Client exchanges frames over. It is satisfied by
+// *websocket.Conn, by the SockJS fallback transports, and by the connections
+// of gorilla-compatible WebSocket libraries such as fasthttp/websocket, so
+// other HTTP stacks can hand connections to the hub with ServeConn.
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteJSON(v interface{}) error
+	SetWriteDeadline(t time.Time) error
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// ID returns the client's socket ID.
+func (c *Client) ID() string {
+	return c.id
+}
+
+// RemoteAddr returns the network address of the client.
+func (c *Client) RemoteAddr() string {
+	return c.conn.RemoteAddr().String()
+}
+
+// enqueue queues message for the write pump without blocking, in the buffer
+// for its priority. It reports false if the buffer is full or the client has
+// been removed.
+func (c *Client) enqueue(message Message) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.queue(message.Priority) <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// isClosed reports whether the client has been removed.
+func (c *Client) isClosed() bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.closed
 }
 
-// Constants for WebSocket timeouts.
+// closeSend closes the send buffer, which makes the write pump send a close
+// frame and exit. Only the first call has any effect.
+func (c *Client) closeSend() {
+	c.closeOnce.Do(func() {
+		c.sendMu.Lock()
+		defer c.sendMu.Unlock()
+		c.closed = true
+		close(c.send)
+	})
+}
+
+// Close disconnects the client. Queued messages are flushed before the
+// close frame is sent. It is safe to call more than once and from any
+// goroutine.
+func (c *Client) Close() {
+	c.hub.RemoveClient(c)
+}
+
+// Constants for WebSocket timeouts. pongWait and maxMessageSize are the
+// defaults for WithIdleTimeout and WithReadLimit.
 const (
 	writeWait      = 10 * time.Second
 	pongWait       = 30 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512
 )
 
@@ -39,46 +136,105 @@ var upgrader = websocket.Upgrader{
 // ServeWs handles WebSocket requests from clients.
 func ServeWs(hub *Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
+		hub.upgrades.add()
+		defer hub.upgrades.done()
+		if !hub.accepting() {
+			http.Error(w, "Server Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		session := newSession(r)
+		if err := hub.connect(session); err != nil {
+			hub.log.Warn("Connection rejected", "ip", session.RemoteIP, "err", err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		conn, err := hub.upgradeConn(w, r)
 		if err != nil {
 			hub.log.Error("Failed to upgrade connection", "err", err)
 			return
 		}
-		conn.SetReadLimit(maxMessageSize)
-		if err := conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
-			hub.log.Error("Error setting read deadline", "err", err)
-		}
-		conn.SetPongHandler(func(string) error {
-			if err := conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
-				hub.log.Error("Error setting read deadline", "err", err)
-			}
-			return nil
-		})
+		hub.serveClient(conn, session)
+	}
+}
 
-		client := &Client{
-			hub:      hub,
-			conn:     conn,
-			send:     make(chan Message, 256),
-			channels: sync.Map{},
-			log:      hub.log,
-		}
+// serveClient registers a client for an established connection and starts
+// its read and write pumps. A resume query parameter on the session asks the
+// hub to restore the recovery held for a previous connection.
+func (h *Hub) serveClient(conn Conn, session *Session) *Client {
+	client := &Client{
+		id:       session.ID,
+		token:    newToken(),
+		session:  session,
+		hub:      h,
+		conn:     conn,
+		send:     make(chan Message, 256),
+		high:     make(chan Message, highQueueSize),
+		low:      make(chan Message, lowQueueSize),
+		pong:     make(chan struct{}, 1),
+		flushed:  make(chan struct{}),
+		channels: sync.Map{},
+		log:      h.log,
+	}
+	if h.jsonrpc && jsonrpcRequested(session.Header, session.Query) {
+		client.rpc = &jsonrpcState{subscribes: make(map[string][]json.RawMessage)}
+	}
+	client.readLimit.Store(h.readLimit)
+	client.idleTimeout.Store(int64(h.idleTimeout))
+	client.touch(session.ConnectedAt)
 
-		hub.clients.Store(client, true)
+	h.clients.Store(client, true)
+	h.tenants.connected(session.Tenant, 1)
+	h.lastSeen.connected(session.UserID, session.ConnectedAt)
 
-		go client.writePump()
-		go client.readPump()
+	established := map[string]interface{}{
+		"socket_id": client.id,
+		"heartbeat": client.heartbeatInfo(),
+	}
+	if h.recoveryWindow > 0 {
+		established["resume_token"] = client.token
+		established["recovery_window"] = h.recoveryWindow.Seconds()
+	}
+	client.enqueue(Message{Event: EventConnectionEstablished, Payload: established})
+	if resumeToken := session.Query.Get("resume"); resumeToken != "" && h.recoveryWindow > 0 {
+		select {
+		case h.resume <- &resumeRequest{client: client, token: resumeToken, member: memberOf(session)}:
+		case <-h.stopped():
+		}
 	}
+
+	go client.writePump()
+	go client.readPump()
+	return client
 }
 
 // readPump reads messages from the WebSocket connection.
 func (c *Client) readPump() {
 	defer func() {
+		c.hub.recoverPanic(c, recover())
 		c.hub.RemoveClient(c) // Unregister the client from the hub
 		c.conn.Close()        // Close the WebSocket connection
 	}()
 
+	limiter, _ := c.conn.(readLimiter)
+	heartbeat := c.hub.heartbeat
+	if limiter != nil && heartbeat != HeartbeatNone {
+		c.refreshDeadline(limiter)
+		if heartbeat == HeartbeatProtocol {
+			limiter.SetPongHandler(func(appData string) error {
+				c.recordRTT(appData)
+				c.touch(time.Now())
+				c.refreshDeadline(limiter)
+				return nil
+			})
+		}
+	}
+
 	for {
+		if limiter != nil {
+			limiter.SetReadLimit(c.readLimit.Load())
+		}
 		messageType, rawMessage, err := c.conn.ReadMessage()
+		c.hub.tenants.transferred(c.session.Tenant, len(rawMessage), 0)
 		if err != nil {
 			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 				c.log.Info("WebSocket closed by client", "addr", c.conn.RemoteAddr())
@@ -90,11 +246,29 @@ func (c *Client) readPump() {
 			return
 		}
 
+		now := time.Now()
+		c.touch(now)
+		c.hub.lastSeen.active(c.session.UserID, now)
+		if limiter != nil && heartbeat == HeartbeatApp {
+			// Any frame, not only pings, proves the client is alive.
+			c.refreshDeadline(limiter)
+		}
+
 		if messageType != websocket.TextMessage {
 			c.log.Warn("Unsupported message type from client", "client", c.conn.RemoteAddr(), "message", messageType)
 			continue
 		}
 
+		if err := c.hub.jsonLimits.check(rawMessage); err != nil {
+			c.log.Warn("Dropped frame from client", "client", c.conn.RemoteAddr(), "err", err)
+			continue
+		}
+
+		if c.rpc != nil {
+			c.readJSONRPC(rawMessage)
+			continue
+		}
+
 		// Parse the message as JSON
 		var message map[string]interface{}
 		if err := json.Unmarshal(rawMessage, &message); err != nil {
@@ -102,90 +276,257 @@ func (c *Client) readPump() {
 			continue
 		}
 
-		// Extract the action and handle it
 		action, _ := message["action"].(string)
 		channel, _ := message["channel"].(string)
+		frame := &Frame{
+			Client:  c,
+			Action:  action,
+			Channel: channel,
+			Payload: message["payload"],
+			Fields:  message,
+		}
+		if err := c.hub.dispatch(frame); err != nil {
+			c.log.Warn("Dropped frame from client", "action", action, "client", c.conn.RemoteAddr(), "err", err)
+		}
+	}
+}
 
-		switch action {
-		case "ping":
-			// Respond to client heartbeat
-			if err := c.conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"pong"}`)); err != nil {
-				c.log.Error("Error sending pong to client", "client", c.conn.RemoteAddr(), "err", err)
-				return
-			}
-		case "subscribe":
-			if channel == "" {
-				c.log.Warn("Client attempted to subscribe without specifying a channel.", "client", c.conn.RemoteAddr())
-				continue
-			}
-			c.hub.register <- &Subscription{Client: c, Channel: channel}
-			c.log.Debug("Client subscribed to channel", "client", c.conn.RemoteAddr(), "channel", channel)
-		case "unsubscribe":
-			if channel == "" {
-				c.log.Warn("Client attempted to unsubscribe without specifying a channel.", "client", c.conn.RemoteAddr())
-				continue
-			}
-			c.hub.unregister <- &Subscription{Client: c, Channel: channel}
-			c.log.Debug("Client unsubscribed from channel", "client", c.conn.RemoteAddr(), "channel", channel)
-		case "message":
-			payload := message["payload"]
-			if channel == "" {
-				c.log.Warn("Client attempted to send a message without specifying a channel.", "client", c.conn.RemoteAddr())
-				continue
-			}
-			msg := Message{
-				Channel: channel,
-				Event:   "message",
-				Payload: payload,
-			}
-			c.hub.broadcast <- msg
-			c.log.Debug("Client sent a message to channel", "client", c.conn.RemoteAddr(), "channel", channel)
+// handleFrame applies an inbound frame to the hub. It is the innermost
+// handler of the middleware chain.
+func (h *Hub) handleFrame(frame *Frame) error {
+	c := frame.Client
+	// Aliases resolve to their target; name is kept for replies.
+	name := frame.Channel
+	channel := h.resolveChannel(name)
+
+	switch frame.Action {
+	case "ping":
+		// Respond to client heartbeat from the write pump, the connection's
+		// only writer. Pings that arrive while a pong is pending coalesce.
+		select {
+		case c.pong <- struct{}{}:
 		default:
-			c.log.Error("Unhandled action from client", "action", action, "client", c.conn.RemoteAddr())
 		}
+	case "ack":
+		if id, _ := frame.Fields["id"].(string); id != "" {
+			h.receipts.ack(h, id, c.id)
+		}
+	case "time":
+		h.sendControl(c, Message{Event: EventTime, Payload: serverTime(frame.Payload), Priority: PriorityHigh})
+	case "subscribe":
+		if channel == "" {
+			h.rejectSubscription(c, name, CodeInvalidChannel, "missing channel")
+			return nil
+		}
+		if err := h.authorizeSubscribe(c.session, channel); err != nil {
+			code, message := subscriptionError(err)
+			h.rejectSubscription(c, name, code, message)
+			c.log.Debug("Subscription denied", "client", c.conn.RemoteAddr(), "channel", channel, "err", err)
+			return nil
+		}
+		sub := &Subscription{Client: c, Channel: channel, Events: frameEvents(frame), member: memberOf(c.session)}
+		if name != channel {
+			sub.Alias = name
+		}
+		select {
+		case h.register <- sub:
+		case <-h.stopped():
+			return errHubStopped
+		}
+		c.log.Debug("Client subscribed to channel", "client", c.conn.RemoteAddr(), "channel", channel)
+	case "unsubscribe":
+		if channel == "" {
+			c.log.Warn("Client attempted to unsubscribe without specifying a channel.", "client", c.conn.RemoteAddr())
+			return nil
+		}
+		select {
+		case h.unregister <- &Subscription{Client: c, Channel: channel}:
+		case <-h.stopped():
+			return errHubStopped
+		}
+		c.log.Debug("Client unsubscribed from channel", "client", c.conn.RemoteAddr(), "channel", channel)
+	case "members":
+		if !h.presenceEnabled(channel) {
+			return nil
+		}
+		if _, ok := c.channels.Load(channel); !ok {
+			c.log.Warn("Client requested members of a channel it is not subscribed to", "client", c.conn.RemoteAddr(), "channel", channel)
+			return nil
+		}
+		h.sendControl(c, Message{Channel: name, Event: EventMembers, Payload: h.Members(channel)})
+	case "mark_read":
+		id, _ := frame.Fields["id"].(string)
+		if _, ok := c.channels.Load(channel); !ok || c.session.UserID == "" {
+			c.log.Warn("Client marked a channel read without being subscribed or signed in", "client", c.conn.RemoteAddr(), "channel", channel)
+			return nil
+		}
+		h.MarkRead(channel, c.session.UserID, id)
+	case "reads":
+		if _, ok := c.channels.Load(channel); !ok {
+			c.log.Warn("Client requested read positions of a channel it is not subscribed to", "client", c.conn.RemoteAddr(), "channel", channel)
+			return nil
+		}
+		h.sendControl(c, Message{Channel: name, Event: EventReads, Payload: h.ReadPositions(channel)})
+	case "message":
+		if channel == "" {
+			c.log.Warn("Client attempted to send a message without specifying a channel.", "client", c.conn.RemoteAddr())
+			return nil
+		}
+		msg := Message{
+			Channel: channel,
+			Event:   "message",
+			Payload: frame.Payload,
+		}
+		if err := h.publish(c, msg); err != nil {
+			return err
+		}
+		c.log.Debug("Client sent a message to channel", "client", c.conn.RemoteAddr(), "channel", channel)
+	case "request":
+		id, _ := frame.Fields["id"].(string)
+		method, _ := frame.Fields["method"].(string)
+		if (channel == "" && method == "") || id == "" {
+			c.log.Warn("Client attempted to send a request without an id or a channel or method.", "client", c.conn.RemoteAddr())
+			return nil
+		}
+		replyTo, _ := frame.Fields["reply_to"].(string)
+		h.handleRequest(c, &Request{Channel: channel, Method: method, ID: id, ReplyTo: replyTo, Payload: frame.Payload, Session: c.session})
+	case "ephemeral":
+		event, _ := frame.Fields["event"].(string)
+		if channel == "" || event == "" {
+			c.log.Warn("Client attempted to send an ephemeral event without a channel or event.", "client", c.conn.RemoteAddr())
+			return nil
+		}
+		return h.publish(c, Message{Channel: channel, Event: event, Payload: frame.Payload, Ephemeral: true})
+	default:
+		c.log.Error("Unhandled action from client", "action", frame.Action, "client", c.conn.RemoteAddr())
 	}
+	return nil
 }
 
-// writePump writes messages to the WebSocket connection.
-
+// writePump writes messages to the WebSocket connection, high priority
+// messages first and low priority messages only when nothing else is
+// queued. Pings and pongs compete with normal messages so they are never
+// starved.
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	var pings <-chan time.Time
+	var ticker *time.Ticker
+	if c.hub.heartbeat == HeartbeatProtocol {
+		ticker = time.NewTicker(c.pingPeriod())
+		pings = ticker.C
+	}
 	defer func() {
-		ticker.Stop()
+		c.hub.recoverPanic(c, recover())
+		if ticker != nil {
+			ticker.Stop()
+		}
 		c.conn.Close()
+		close(c.flushed)
 	}()
 	for {
+		var ok bool
 		select {
-		case message, ok := <-c.send:
-			if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-				c.log.Error("Error setting write deadline", "err", err)
-			}
-			if !ok {
-				// The hub closed the channel.
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			if err := c.conn.WriteJSON(message); err != nil {
-				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					c.log.Debug("WebSocket closed by client")
-				} else {
-					c.log.Error("Error writing JSON", "err", err)
+		case message := <-c.high:
+			ok = c.writeQueued(message)
+		default:
+			select {
+			case message := <-c.high:
+				ok = c.writeQueued(message)
+			case message, open := <-c.send:
+				ok = c.writeSent(message, open)
+			case <-c.pong:
+				ok = c.writePong()
+			case <-pings:
+				ok = c.writePing(ticker)
+			default:
+				select {
+				case message := <-c.high:
+					ok = c.writeQueued(message)
+				case message, open := <-c.send:
+					ok = c.writeSent(message, open)
+				case message := <-c.low:
+					ok = c.writeQueued(message)
+				case <-c.pong:
+					ok = c.writePong()
+				case <-pings:
+					ok = c.writePing(ticker)
 				}
-				return
 			}
-		case <-ticker.C:
-			if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-				c.log.Error("Error setting write deadline", "err", err)
-			}
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					c.log.Debug("WebSocket closed by client")
-				} else {
-					c.log.Error("Error sending ping", "err", err)
-				}
-				return
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// writeSent writes a message received from send. Once the hub has closed
+// send, the high and low priority queues, which are never closed, are
+// flushed and the close frame is sent.
+func (c *Client) writeSent(message Message, open bool) bool {
+	if open {
+		return c.writeQueued(message)
+	}
+	for _, queue := range []chan Message{c.high, c.low} {
+		for len(queue) > 0 {
+			if !c.writeQueued(<-queue) {
+				return false
 			}
 		}
 	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		c.log.Error("Error setting write deadline", "err", err)
+	}
+	frame := []byte{}
+	if code := c.closeCode.Load(); code != 0 {
+		frame = websocket.FormatCloseMessage(int(code), "")
+	}
+	_ = c.conn.WriteMessage(websocket.CloseMessage, frame)
+	return false
+}
+
+// writeQueued writes a queued message. It reports false once the
+// connection has failed.
+func (c *Client) writeQueued(message Message) bool {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		c.log.Error("Error setting write deadline", "err", err)
+	}
+	if err := c.writeMessage(message); err != nil {
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			c.log.Debug("WebSocket closed by client")
+		} else {
+			c.log.Error("Error writing JSON", "err", err)
+		}
+		return false
+	}
+	return true
+}
+
+// writePong answers an application-level ping.
+func (c *Client) writePong() bool {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		c.log.Error("Error setting write deadline", "err", err)
+	}
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"pong"}`)); err != nil {
+		c.log.Error("Error sending pong to client", "client", c.conn.RemoteAddr(), "err", err)
+		return false
+	}
+	return true
+}
+
+// writePing sends a protocol ping carrying the send time.
+func (c *Client) writePing(ticker *time.Ticker) bool {
+	ticker.Reset(c.pingPeriod())
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		c.log.Error("Error setting write deadline", "err", err)
+	}
+	// The send time rides along so the pong yields the RTT.
+	stamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := c.conn.WriteMessage(websocket.PingMessage, []byte(stamp)); err != nil {
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			c.log.Debug("WebSocket closed by client")
+		} else {
+			c.log.Error("Error sending ping", "err", err)
+		}
+		return false
+	}
+	return true
 }
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/biohackerellie/pushpop"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// DecodeError reports a payload that could not be decoded into the type a
+// handler was bound with.
+type DecodeError struct {
+	Channel string
+	Event   string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode %s on %s: %v", e.Event, e.Channel, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// HandlerError wraps an error returned by a bound handler.
+type HandlerError struct {
+	Channel string
+	Event   string
+	Err     error
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("handle %s on %s: %v", e.Event, e.Channel, e.Err)
+}
+
+func (e *HandlerError) Unwrap() error { return e.Err }
+
+// Channel is a subscribed channel.
+type Channel struct {
+	client *Client
+	name   string
+	events []string
+
+	mu       sync.RWMutex
+	bindings map[string][]binding
+	all      []func(context.Context, Event) error
+}
+
+// Event is a message received on a channel, as passed to BindAll handlers.
+type Event struct {
+	Channel  string
+	Event    string
+	Payload  json.RawMessage
+	Envelope *pushpop.Envelope
+	Replayed bool
+}
+
+// binding is a handler with the payload type it decodes into.
+type binding struct {
+	fn      reflect.Value
+	payload reflect.Type
+}
+
+// Name returns the channel name.
+func (ch *Channel) Name() string {
+	return ch.name
+}
+
+// subscribeFrame returns the frame that subscribes to the channel.
+func (ch *Channel) subscribeFrame() map[string]interface{} {
+	frame := map[string]interface{}{"action": "subscribe", "channel": ch.name}
+	if len(ch.events) > 0 {
+		frame["events"] = ch.events
+	}
+	return frame
+}
+
+// Bind calls handler for every event of that name on the channel. The
+// handler has the form func(context.Context, T) error, and each payload is
+// decoded from JSON into a T:
+//
+//	channel.Bind("order.updated", func(ctx context.Context, order OrderUpdated) error {
+//		...
+//	})
+//
+// Decode failures and handler errors are passed to the client's error
+// handler as a *DecodeError or *HandlerError. Handlers run on the client's
+// read goroutine in order and should not block. Bind panics if handler has
+// another form.
+func (ch *Channel) Bind(event string, handler interface{}) {
+	fn := reflect.ValueOf(handler)
+	t := fn.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.In(0) != contextType ||
+		t.NumOut() != 1 || t.Out(0) != errorType {
+		panic(fmt.Sprintf("client: Bind handler must be func(context.Context, T) error, got %s", t))
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.bindings[event] = append(ch.bindings[event], binding{fn: fn, payload: t.In(1)})
+}
+
+// BindAll calls handler for every event on the channel, including the
+// hub's own "pushpop:" events, with the payload left undecoded, e.g. to relay
+// messages elsewhere. Handler errors are reported like those of Bind.
+func (ch *Channel) BindAll(handler func(context.Context, Event) error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.all = append(ch.all, handler)
+}
+
+// Unsubscribe leaves the channel and drops its handlers.
+func (ch *Channel) Unsubscribe() error {
+	c := ch.client
+	c.mu.Lock()
+	if c.channels[ch.name] == ch {
+		delete(c.channels, ch.name)
+	}
+	c.mu.Unlock()
+	return c.send(map[string]interface{}{"action": "unsubscribe", "channel": ch.name})
+}
+
+// dispatch decodes a frame for each handler bound to its event.
+func (ch *Channel) dispatch(f frame) {
+	ch.mu.RLock()
+	bindings := ch.bindings[f.Event]
+	all := ch.all
+	ch.mu.RUnlock()
+
+	ctx := ch.client.ctx
+	for _, b := range bindings {
+		payload := reflect.New(b.payload)
+		if len(f.Payload) > 0 {
+			if err := json.Unmarshal(f.Payload, payload.Interface()); err != nil {
+				ch.client.onError(&DecodeError{Channel: ch.name, Event: f.Event, Err: err})
+				continue
+			}
+		}
+		out := b.fn.Call([]reflect.Value{reflect.ValueOf(ctx), payload.Elem()})
+		if err, _ := out[0].Interface().(error); err != nil {
+			ch.client.onError(&HandlerError{Channel: ch.name, Event: f.Event, Err: err})
+		}
+	}
+	for _, handler := range all {
+		event := Event{Channel: ch.name, Event: f.Event, Payload: f.Payload, Envelope: f.Envelope, Replayed: f.Replayed}
+		if err := handler(ctx, event); err != nil {
+			ch.client.onError(&HandlerError{Channel: ch.name, Event: f.Event, Err: err})
+		}
+	}
+}
@@ -0,0 +1,348 @@
+// Package client is a Go SDK for connecting to a pushpop server, for
+// services and CLIs that consume channels the way the TypeScript client
+// does in the browser.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+	"github.com/gorilla/websocket"
+)
+
+// writeWait bounds each frame write, and handshakeWait the wait for the
+// server to establish a connection.
+const (
+	writeWait     = 10 * time.Second
+	handshakeWait = 10 * time.Second
+)
+
+var (
+	// ErrClosed is returned when using a client after Close.
+	ErrClosed = errors.New("client is closed")
+	// ErrNotConnected is returned when publishing while the client is
+	// reconnecting.
+	ErrNotConnected = errors.New("client is not connected")
+)
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHeader sets headers sent with the WebSocket handshake, e.g. an
+// Authorization header checked by the server's OnConnect hook.
+func WithHeader(header http.Header) Option {
+	return func(c *Client) {
+		c.header = header
+	}
+}
+
+// WithDialer replaces the default WebSocket dialer.
+func WithDialer(dialer *websocket.Dialer) Option {
+	return func(c *Client) {
+		c.dialer = dialer
+	}
+}
+
+// WithErrorHandler receives errors that have no caller to return to, such
+// as payloads that fail to decode and errors returned by bound handlers.
+// By default they are dropped.
+func WithErrorHandler(fn func(error)) Option {
+	return func(c *Client) {
+		c.onError = fn
+	}
+}
+
+// WithStateChange registers a state callback before connecting, so it also
+// sees the transition out of Connecting. See Client.OnStateChange.
+func WithStateChange(fn func(StateChange)) Option {
+	return func(c *Client) {
+		c.OnStateChange(fn)
+	}
+}
+
+// Client is a connection to a pushpop server. It reconnects when the
+// connection drops and resubscribes to its channels.
+type Client struct {
+	url       string
+	header    http.Header
+	dialer    *websocket.Dialer
+	onError   func(error)
+	reconnect ReconnectPolicy
+
+	// writeMu guards conn, which is replaced on reconnect, and serializes
+	// writes to it.
+	writeMu  sync.Mutex
+	conn     *websocket.Conn
+	socketID string
+
+	// ctx is passed to handlers and cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.RWMutex
+	channels map[string]*Channel
+
+	// pending holds the calls awaiting a reply, by request ID.
+	pendingMu sync.Mutex
+	pending   map[string]chan reply
+	callSeq   uint64
+
+	stateMu     sync.RWMutex
+	state       State
+	lastErr     error
+	listeners   map[int]func(StateChange)
+	listenerSeq int
+}
+
+// frame is a message received from the server.
+type frame struct {
+	Channel  string            `json:"channel"`
+	Event    string            `json:"event"`
+	Payload  json.RawMessage   `json:"payload"`
+	Replayed bool              `json:"replayed,omitempty"`
+	Envelope *pushpop.Envelope `json:"envelope,omitempty"`
+	Ack      bool              `json:"ack,omitempty"`
+}
+
+// Dial connects to the WebSocket endpoint at url, e.g.
+// "wss://push.example.com/ws", and waits for the server to establish the
+// connection. If the first connection fails, the client is Failed and the
+// error is returned.
+func Dial(ctx context.Context, url string, opts ...Option) (*Client, error) {
+	c := &Client{
+		url:       url,
+		dialer:    websocket.DefaultDialer,
+		onError:   func(error) {},
+		channels:  make(map[string]*Channel),
+		pending:   make(map[string]chan reply),
+		listeners: make(map[int]func(StateChange)),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		c.setState(StateFailed, err)
+		c.cancel()
+		return nil, err
+	}
+	go c.readLoop(conn)
+	return c, nil
+}
+
+// connect dials the server, waits for the connection to be established,
+// and resubscribes to every channel.
+func (c *Client) connect(ctx context.Context) (*websocket.Conn, error) {
+	conn, _, err := c.dialer.DialContext(ctx, c.url, c.header)
+	if err != nil {
+		return nil, err
+	}
+	var established struct {
+		Event   string `json:"event"`
+		Payload struct {
+			SocketID string `json:"socket_id"`
+		} `json:"payload"`
+	}
+	deadline := time.Now().Add(handshakeWait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	err = conn.SetReadDeadline(deadline)
+	if err == nil {
+		err = conn.ReadJSON(&established)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if established.Event != pushpop.EventConnectionEstablished {
+		conn.Close()
+		return nil, errors.New("unexpected handshake event " + established.Event)
+	}
+
+	c.mu.RLock()
+	subscribes := make([]map[string]interface{}, 0, len(c.channels))
+	for _, channel := range c.channels {
+		subscribes = append(subscribes, channel.subscribeFrame())
+	}
+	c.mu.RUnlock()
+
+	c.writeMu.Lock()
+	if c.ctx.Err() != nil {
+		// Closed while connecting.
+		c.writeMu.Unlock()
+		conn.Close()
+		return nil, ErrClosed
+	}
+	c.conn = conn
+	c.socketID = established.Payload.SocketID
+	for _, subscribe := range subscribes {
+		err := conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err == nil {
+			err = conn.WriteJSON(subscribe)
+		}
+		if err != nil {
+			c.conn = nil
+			c.writeMu.Unlock()
+			conn.Close()
+			return nil, err
+		}
+	}
+	c.writeMu.Unlock()
+
+	c.setState(StateConnected, nil)
+	return conn, nil
+}
+
+// SocketID returns the ID the server assigned to the current connection.
+func (c *Client) SocketID() string {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.socketID
+}
+
+// Subscribe subscribes to a channel and returns it, or the existing
+// channel if already subscribed. While reconnecting the subscription is
+// made once the connection is back. Naming events limits the subscription
+// to them, so the server does not send the channel's other events.
+func (c *Client) Subscribe(name string, events ...string) (*Channel, error) {
+	if c.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+	c.mu.Lock()
+	if channel, ok := c.channels[name]; ok {
+		c.mu.Unlock()
+		return channel, nil
+	}
+	channel := &Channel{client: c, name: name, events: events, bindings: make(map[string][]binding)}
+	c.channels[name] = channel
+	c.mu.Unlock()
+
+	err := c.send(channel.subscribeFrame())
+	if err != nil && err != ErrNotConnected {
+		c.mu.Lock()
+		delete(c.channels, name)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return channel, nil
+}
+
+// Publish sends payload to a channel as a "message" event.
+func (c *Client) Publish(channel string, payload interface{}) error {
+	return c.send(map[string]interface{}{"action": "message", "channel": channel, "payload": payload})
+}
+
+// Close closes the connection, stops reconnecting, and cancels the context
+// passed to handlers. The client is left Disconnected.
+func (c *Client) Close() error {
+	c.cancel()
+	c.setState(StateDisconnected, nil)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	conn := c.conn
+	c.conn = nil
+	// The close frame is best effort; the connection is closed either way.
+	_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return conn.Close()
+}
+
+// send writes a JSON frame to the server.
+func (c *Client) send(v interface{}) error {
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return c.conn.WriteJSON(v)
+}
+
+// readLoop dispatches frames from conn until it closes, then reconnects.
+func (c *Client) readLoop(conn *websocket.Conn) {
+	for {
+		var f frame
+		if err := conn.ReadJSON(&f); err != nil {
+			c.dropped(conn, err)
+			return
+		}
+		if f.Event == pushpop.EventReply {
+			c.resolve(f)
+			continue
+		}
+
+		c.mu.RLock()
+		channel := c.channels[f.Channel]
+		c.mu.RUnlock()
+		if channel != nil {
+			channel.dispatch(f)
+		}
+		if f.Ack && f.Envelope != nil {
+			// A failed ack means the connection dropped, which the next
+			// read reports.
+			_ = c.send(map[string]string{"action": "ack", "channel": f.Channel, "id": f.Envelope.ID})
+		}
+	}
+}
+
+// dropped handles the loss of conn by reconnecting, unless the client was
+// closed.
+func (c *Client) dropped(conn *websocket.Conn, err error) {
+	c.writeMu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.writeMu.Unlock()
+	conn.Close()
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	if c.reconnect.Disabled {
+		c.setState(StateFailed, err)
+		c.cancel()
+		return
+	}
+	c.setState(StateReconnecting, err)
+	for attempt := 1; c.reconnect.MaxAttempts == 0 || attempt <= c.reconnect.MaxAttempts; attempt++ {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(c.reconnect.delay(attempt)):
+		}
+		next, err := c.connect(c.ctx)
+		if err == nil {
+			go c.readLoop(next)
+			return
+		}
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.stateMu.Lock()
+		c.lastErr = err
+		c.stateMu.Unlock()
+	}
+	c.setState(StateFailed, c.LastError())
+	c.cancel()
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+)
+
+// defaultCallTimeout bounds calls whose context has no deadline.
+const defaultCallTimeout = 10 * time.Second
+
+// reply is the payload of a pushpop.EventReply frame.
+type reply struct {
+	ID     string              `json:"id"`
+	Result json.RawMessage     `json:"result"`
+	Error  *pushpop.ReplyError `json:"error"`
+}
+
+// Call sends a request with payload on channel and waits for the server's
+// reply, decoding its result into result unless result is nil. A failed
+// request returns a *pushpop.ReplyError. Calls without a deadline time out
+// after 10s.
+func (c *Client) Call(ctx context.Context, channel string, payload, result interface{}) error {
+	return c.call(ctx, map[string]interface{}{"action": "request", "channel": channel, "payload": payload}, result)
+}
+
+// CallMethod calls an RPC method registered on the server with Hub.Handle,
+// like Call.
+func (c *Client) CallMethod(ctx context.Context, method string, payload, result interface{}) error {
+	return c.call(ctx, map[string]interface{}{"action": "request", "method": method, "payload": payload}, result)
+}
+
+// call sends a request frame with a new correlation ID and waits for the
+// reply.
+func (c *Client) call(ctx context.Context, request map[string]interface{}, result interface{}) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultCallTimeout)
+		defer cancel()
+	}
+
+	replies := make(chan reply, 1)
+	c.pendingMu.Lock()
+	c.callSeq++
+	id := strconv.FormatUint(c.callSeq, 10)
+	c.pending[id] = replies
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	request["id"] = id
+	if err := c.send(request); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.ctx.Done():
+		return ErrClosed
+	case r := <-replies:
+		if r.Error != nil {
+			return r.Error
+		}
+		if result == nil || len(r.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(r.Result, result)
+	}
+}
+
+// resolve hands a reply frame to the call waiting for it.
+func (c *Client) resolve(f frame) {
+	var r reply
+	if err := json.Unmarshal(f.Payload, &r); err != nil {
+		c.onError(&DecodeError{Channel: f.Channel, Event: f.Event, Err: err})
+		return
+	}
+	c.pendingMu.Lock()
+	replies, ok := c.pending[r.ID]
+	c.pendingMu.Unlock()
+	if ok {
+		select {
+		case replies <- r:
+		default:
+			// A duplicate reply; the call already has one.
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package client
+
+import "time"
+
+// State is the connection state of a Client.
+type State int
+
+// Connection states. A client starts Connecting, is Connected once the
+// server established the connection, and is Reconnecting after the
+// connection drops until a new one is established. Close leaves it
+// Disconnected, and running out of reconnect attempts leaves it Failed.
+const (
+	StateConnecting State = iota
+	StateConnected
+	StateReconnecting
+	StateDisconnected
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateDisconnected:
+		return "disconnected"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// StateChange is a transition between connection states. Err is the error
+// that caused it, if any.
+type StateChange struct {
+	Previous State
+	Current  State
+	Err      error
+}
+
+// ReconnectPolicy controls reconnection after the connection drops. The
+// delay between attempts doubles from MinDelay up to MaxDelay.
+type ReconnectPolicy struct {
+	// MaxAttempts limits consecutive attempts; 0 retries forever.
+	MaxAttempts int
+	// MinDelay defaults to 1s and MaxDelay to 30s.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Disabled leaves the client Failed when the connection drops.
+	Disabled bool
+}
+
+// WithReconnect sets the reconnect policy.
+func WithReconnect(policy ReconnectPolicy) Option {
+	return func(c *Client) {
+		c.reconnect = policy
+	}
+}
+
+// delay returns the backoff before the given attempt, counted from 1.
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	delay := p.MinDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// State returns the current connection state.
+func (c *Client) State() State {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.state
+}
+
+// LastError returns the error behind the most recent failed connection or
+// dropped connection, or nil.
+func (c *Client) LastError() error {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.lastErr
+}
+
+// OnStateChange calls fn on every state transition, on the goroutine that
+// caused it. The returned func removes the callback.
+func (c *Client) OnStateChange(fn func(StateChange)) (remove func()) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.listenerSeq++
+	id := c.listenerSeq
+	c.listeners[id] = fn
+	return func() {
+		c.stateMu.Lock()
+		defer c.stateMu.Unlock()
+		delete(c.listeners, id)
+	}
+}
+
+// setState transitions to state and notifies the listeners. A transition
+// out of Disconnected is ignored, so a closed client stays closed.
+func (c *Client) setState(state State, err error) {
+	c.stateMu.Lock()
+	previous := c.state
+	if previous == state || previous == StateDisconnected {
+		c.stateMu.Unlock()
+		return
+	}
+	c.state = state
+	if err != nil {
+		c.lastErr = err
+	}
+	listeners := make([]func(StateChange), 0, len(c.listeners))
+	for _, fn := range c.listeners {
+		listeners = append(listeners, fn)
+	}
+	c.stateMu.Unlock()
+
+	change := StateChange{Previous: previous, Current: state, Err: err}
+	for _, fn := range listeners {
+		fn(change)
+	}
+}
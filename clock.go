@@ -0,0 +1,28 @@
+package pushpop
+
+import (
+	"net/http"
+	"time"
+)
+
+// EventTime answers a "time" action with the server clock.
+const EventTime = "pushpop:time"
+
+// serverTime reports the server clock in Unix milliseconds along with the
+// caller's echo, so clients can pair replies with requests and estimate
+// their clock offset as server_time - (sent + received) / 2.
+func serverTime(echo interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"server_time": time.Now().UnixMilli(),
+		"echo":        echo,
+	}
+}
+
+// HandleTime returns an HTTP handler that reports the server clock. The echo
+// query parameter is returned unchanged.
+func HandleTime() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, serverTime(r.URL.Query().Get("echo")))
+	}
+}
@@ -0,0 +1,130 @@
+package pushpop
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// CloudEventsChannelExtension is the CloudEvents extension attribute used to
+// select the channel a CloudEvent is delivered to. The event's `type`
+// attribute becomes the message event.
+const CloudEventsChannelExtension = "channel"
+
+const (
+	cloudEventsContentType  = "application/cloudevents+json"
+	cloudEventsSpecVersion  = "1.0"
+	cloudEventsHeaderPrefix = "Ce-"
+)
+
+var (
+	errCloudEventSpecVersion = errors.New("unsupported cloudevents specversion")
+	errCloudEventType        = errors.New("cloudevent is missing the type attribute")
+	errCloudEventChannel     = errors.New("cloudevent is missing the " + CloudEventsChannelExtension + " extension attribute")
+)
+
+// isCloudEvent reports whether the request carries a CloudEvent in either the
+// structured or binary HTTP content mode.
+func isCloudEvent(r *http.Request) bool {
+	if r.Header.Get(cloudEventsHeaderPrefix+"Specversion") != "" {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == cloudEventsContentType
+}
+
+// decodeCloudEvent maps a CloudEvent HTTP request onto a Message.
+func decodeCloudEvent(r *http.Request) (Message, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == cloudEventsContentType {
+		return decodeStructuredCloudEvent(r.Body)
+	}
+	return decodeBinaryCloudEvent(r)
+}
+
+// decodeStructuredCloudEvent decodes a CloudEvent whose attributes and data
+// are all carried in a JSON body.
+func decodeStructuredCloudEvent(body io.Reader) (Message, error) {
+	var event map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&event); err != nil {
+		return Message{}, err
+	}
+
+	attr := func(name string) string {
+		var v string
+		_ = json.Unmarshal(event[name], &v)
+		return v
+	}
+
+	if attr("specversion") != cloudEventsSpecVersion {
+		return Message{}, errCloudEventSpecVersion
+	}
+
+	var payload interface{}
+	if raw, ok := event["data_base64"]; ok {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return Message{}, err
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return Message{}, err
+		}
+		payload = decodeCloudEventData(attr("datacontenttype"), data)
+	} else if raw, ok := event["data"]; ok {
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return Message{}, err
+		}
+	}
+
+	return cloudEventMessage(attr("type"), attr(CloudEventsChannelExtension), payload)
+}
+
+// decodeBinaryCloudEvent decodes a CloudEvent whose attributes are carried in
+// ce- headers and whose body is the event data.
+func decodeBinaryCloudEvent(r *http.Request) (Message, error) {
+	if r.Header.Get(cloudEventsHeaderPrefix+"Specversion") != cloudEventsSpecVersion {
+		return Message{}, errCloudEventSpecVersion
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var payload interface{}
+	if len(data) > 0 {
+		payload = decodeCloudEventData(r.Header.Get("Content-Type"), data)
+	}
+
+	return cloudEventMessage(
+		r.Header.Get(cloudEventsHeaderPrefix+"Type"),
+		r.Header.Get(cloudEventsHeaderPrefix+CloudEventsChannelExtension),
+		payload,
+	)
+}
+
+// decodeCloudEventData decodes JSON event data into a value and passes any
+// other content type through as a string.
+func decodeCloudEventData(contentType string, data []byte) interface{} {
+	if jsonMediaType(contentType) {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err == nil {
+			return v
+		}
+	}
+	return string(data)
+}
+
+func cloudEventMessage(eventType, channel string, payload interface{}) (Message, error) {
+	if eventType == "" {
+		return Message{}, errCloudEventType
+	}
+	if channel == "" {
+		return Message{}, errCloudEventChannel
+	}
+	return Message{Channel: channel, Event: eventType, Payload: payload}, nil
+}
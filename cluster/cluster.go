@@ -0,0 +1,262 @@
+// Package cluster implements broker-less clustering for pushpop. Nodes find
+// each other with hashicorp/memberlist gossip and relay broadcasts to every
+// other member directly, so multi-node fan-out needs no Redis or NATS.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+	"github.com/hashicorp/memberlist"
+)
+
+// Config configures a Cluster.
+type Config struct {
+	// NodeName must be unique in the cluster. Defaults to the hostname.
+	NodeName string
+	// BindAddr and BindPort are the gossip listen address. Defaults to
+	// 0.0.0.0:7946.
+	BindAddr string
+	BindPort int
+	// AdvertiseAddr and AdvertisePort are the address other members use to
+	// reach this node, when it differs from the bind address.
+	AdvertiseAddr string
+	AdvertisePort int
+	// Seeds are host:port addresses of existing members to join.
+	Seeds []string
+	// SecretKey enables gossip encryption. It must be 16, 24, or 32 bytes.
+	SecretKey []byte
+	// Discovery finds peers to join in addition to Seeds, e.g. DNSSRV or
+	// KubernetesEndpoints. It is polled every DiscoveryInterval.
+	Discovery Discoverer
+	// DiscoveryInterval defaults to 30s.
+	DiscoveryInterval time.Duration
+}
+
+// Cluster is a pushpop Broker that relays broadcasts node-to-node over a
+// memberlist gossip cluster.
+type Cluster struct {
+	list *memberlist.Memberlist
+	log  pushpop.Logger
+	ring *Ring
+
+	// changed signals a membership change. Events fire while memberlist
+	// holds its node lock, so the ring is rebuilt on a separate goroutine.
+	changed chan struct{}
+	stop    context.CancelFunc
+
+	mu          sync.RWMutex
+	handler     func(pushpop.Message)
+	rebalancers []func(members []string)
+}
+
+// New starts the local gossip member and joins any configured seeds. Seeds
+// that cannot be reached are logged; the node keeps running and can be
+// joined later.
+func New(cfg Config, logger pushpop.Logger) (*Cluster, error) {
+	c := &Cluster{log: logger, ring: NewRing(nil), changed: make(chan struct{}, 1)}
+
+	conf := memberlist.DefaultLANConfig()
+	if cfg.NodeName != "" {
+		conf.Name = cfg.NodeName
+	}
+	if cfg.BindAddr != "" {
+		conf.BindAddr = cfg.BindAddr
+	}
+	if cfg.BindPort != 0 {
+		conf.BindPort = cfg.BindPort
+		conf.AdvertisePort = cfg.BindPort
+	}
+	if cfg.AdvertiseAddr != "" {
+		conf.AdvertiseAddr = cfg.AdvertiseAddr
+	}
+	if cfg.AdvertisePort != 0 {
+		conf.AdvertisePort = cfg.AdvertisePort
+	}
+	conf.SecretKey = cfg.SecretKey
+	conf.Delegate = &delegate{cluster: c}
+	conf.Events = &events{cluster: c}
+	conf.Logger = log.New(io.Discard, "", 0)
+
+	list, err := memberlist.Create(conf)
+	if err != nil {
+		return nil, err
+	}
+	c.list = list
+	c.rebalance()
+	go func() {
+		for range c.changed {
+			c.rebalance()
+		}
+	}()
+
+	if len(cfg.Seeds) > 0 {
+		if _, err := c.Join(cfg.Seeds); err != nil {
+			logger.Warn("Failed to join cluster seeds", "seeds", cfg.Seeds, "err", err)
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	c.stop = stop
+	if cfg.Discovery != nil {
+		interval := cfg.DiscoveryInterval
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		go c.discover(ctx, cfg.Discovery, interval)
+	}
+	return c, nil
+}
+
+// Join contacts the given members and returns how many were reached.
+func (c *Cluster) Join(addrs []string) (int, error) {
+	return c.list.Join(addrs)
+}
+
+// Members returns the names of all live members, including this node.
+func (c *Cluster) Members() []string {
+	members := c.list.Members()
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		names = append(names, member.Name)
+	}
+	return names
+}
+
+// LocalNode returns this node's name.
+func (c *Cluster) LocalNode() string {
+	return c.list.LocalNode().Name
+}
+
+// Owner returns the name of the member that owns channel's state.
+func (c *Cluster) Owner(channel string) string {
+	return c.ring.Owner(channel)
+}
+
+// IsLocal reports whether this node owns channel's state.
+func (c *Cluster) IsLocal(channel string) bool {
+	return c.ring.Owner(channel) == c.LocalNode()
+}
+
+// OnRebalance registers fn to be called with the new member list whenever
+// membership changes and channel ownership is recomputed. Owners use it to
+// hand off or load the state of channels that moved.
+func (c *Cluster) OnRebalance(fn func(members []string)) {
+	c.mu.Lock()
+	c.rebalancers = append(c.rebalancers, fn)
+	c.mu.Unlock()
+}
+
+// rebalance rebuilds the ownership ring from the live members.
+func (c *Cluster) rebalance() {
+	members := c.Members()
+	c.ring.Set(members)
+
+	c.mu.RLock()
+	rebalancers := c.rebalancers
+	c.mu.RUnlock()
+	for _, fn := range rebalancers {
+		fn(members)
+	}
+}
+
+// Publish relays message to every other live member.
+func (c *Cluster) Publish(_ context.Context, message pushpop.Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	local := c.list.LocalNode()
+	for _, member := range c.list.Members() {
+		if member.Name == local.Name {
+			continue
+		}
+		if err := c.list.SendReliable(member, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe delivers messages relayed by other members to handler until ctx
+// is cancelled.
+func (c *Cluster) Subscribe(ctx context.Context, handler func(pushpop.Message)) error {
+	c.mu.Lock()
+	c.handler = handler
+	c.mu.Unlock()
+
+	<-ctx.Done()
+
+	c.mu.Lock()
+	c.handler = nil
+	c.mu.Unlock()
+	return nil
+}
+
+// Leave announces departure to the cluster and stops gossiping.
+func (c *Cluster) Leave(timeout time.Duration) error {
+	c.stop()
+	if err := c.list.Leave(timeout); err != nil {
+		return err
+	}
+	return c.list.Shutdown()
+}
+
+func (c *Cluster) notifyChanged() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// delegate receives relayed broadcasts from other members.
+type delegate struct {
+	cluster *Cluster
+}
+
+func (d *delegate) NodeMeta(limit int) []byte                  { return nil }
+func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (d *delegate) LocalState(join bool) []byte                { return nil }
+func (d *delegate) MergeRemoteState(buf []byte, join bool)     {}
+
+func (d *delegate) NotifyMsg(data []byte) {
+	var message pushpop.Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		d.cluster.log.Warn("Invalid message from cluster member", "err", err)
+		return
+	}
+
+	d.cluster.mu.RLock()
+	handler := d.cluster.handler
+	d.cluster.mu.RUnlock()
+	if handler != nil {
+		handler(message)
+	}
+}
+
+// events logs membership changes and rebalances channel ownership.
+type events struct {
+	cluster *Cluster
+}
+
+func (e *events) NotifyJoin(node *memberlist.Node) {
+	e.cluster.log.Info("Cluster member joined", "node", node.Name, "addr", node.Address())
+	e.cluster.notifyChanged()
+}
+
+func (e *events) NotifyLeave(node *memberlist.Node) {
+	e.cluster.log.Info("Cluster member left", "node", node.Name, "addr", node.Address())
+	e.cluster.notifyChanged()
+}
+
+func (e *events) NotifyUpdate(node *memberlist.Node) {
+	e.cluster.log.Debug("Cluster member updated", "node", node.Name, "addr", node.Address())
+}
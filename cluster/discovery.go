@@ -0,0 +1,195 @@
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default in-cluster service account paths.
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// Discoverer finds the gossip addresses of potential cluster peers.
+type Discoverer interface {
+	Discover(ctx context.Context) ([]string, error)
+}
+
+// DNSSRV discovers peers from the SRV records of name, such as the
+// "_gossip._tcp.pushpop.default.svc.cluster.local" record of a headless
+// Kubernetes service.
+type DNSSRV struct {
+	Name     string
+	Resolver *net.Resolver
+}
+
+// Discover resolves the SRV records into host:port addresses.
+func (d DNSSRV) Discover(ctx context.Context) ([]string, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	_, records, err := resolver.LookupSRV(ctx, "", "", d.Name)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	return addrs, nil
+}
+
+// KubernetesEndpoints discovers peers from the Endpoints API using the pod's
+// service account, so scaling the StatefulSet or Deployment grows the mesh.
+type KubernetesEndpoints struct {
+	// Namespace to search. Defaults to the pod's own namespace.
+	Namespace string
+	// LabelSelector selects the Endpoints objects, e.g. "app=pushpop".
+	LabelSelector string
+	// Port is the gossip port of the peers. Defaults to 7946.
+	Port int
+
+	client *http.Client
+	host   string
+	token  string
+}
+
+// Discover lists the ready addresses of every matching Endpoints object.
+func (k *KubernetesEndpoints) Discover(ctx context.Context) ([]string, error) {
+	if err := k.init(); err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v1/namespaces/%s/endpoints?labelSelector=%s",
+		k.host, url.PathEscape(k.Namespace), url.QueryEscape(k.LabelSelector))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubernetes endpoints: unexpected status %s", resp.Status)
+	}
+
+	var list struct {
+		Items []struct {
+			Subsets []struct {
+				Addresses []struct {
+					IP string `json:"ip"`
+				} `json:"addresses"`
+			} `json:"subsets"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, item := range list.Items {
+		for _, subset := range item.Subsets {
+			for _, address := range subset.Addresses {
+				addrs = append(addrs, net.JoinHostPort(address.IP, strconv.Itoa(k.Port)))
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// init loads the in-cluster API address and service account credentials.
+func (k *KubernetesEndpoints) init() error {
+	if k.client != nil {
+		return nil
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return fmt.Errorf("kubernetes endpoints: not running in a cluster")
+	}
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	if k.Namespace == "" {
+		namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return err
+		}
+		k.Namespace = strings.TrimSpace(string(namespace))
+	}
+	if k.Port == 0 {
+		k.Port = 7946
+	}
+
+	k.host = "https://" + net.JoinHostPort(host, port)
+	k.token = strings.TrimSpace(string(token))
+	k.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	return nil
+}
+
+// discover periodically joins any discovered peers that are not yet members.
+func (c *Cluster) discover(ctx context.Context, d Discoverer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.joinDiscovered(ctx, d)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cluster) joinDiscovered(ctx context.Context, d Discoverer) {
+	addrs, err := d.Discover(ctx)
+	if err != nil {
+		c.log.Warn("Cluster peer discovery failed", "err", err)
+		return
+	}
+
+	known := make(map[string]bool)
+	for _, member := range c.list.Members() {
+		known[member.Address()] = true
+	}
+
+	var join []string
+	for _, addr := range addrs {
+		if !known[addr] {
+			join = append(join, addr)
+		}
+	}
+	if len(join) == 0 {
+		return
+	}
+	if _, err := c.Join(join); err != nil {
+		c.log.Debug("Failed to join discovered peers", "peers", join, "err", err)
+	}
+}
@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// virtualNodes is the number of ring points per member. More points give a
+// more even spread of channels at the cost of a larger ring.
+const virtualNodes = 128
+
+// Ring assigns channels to members with consistent hashing, so a membership
+// change only moves the channels owned by the nodes that came or went.
+type Ring struct {
+	mu     sync.RWMutex
+	points []uint32
+	owners map[uint32]string
+}
+
+// NewRing builds a ring over members.
+func NewRing(members []string) *Ring {
+	r := &Ring{}
+	r.Set(members)
+	return r
+}
+
+// Set replaces the ring's members.
+func (r *Ring) Set(members []string) {
+	points := make([]uint32, 0, len(members)*virtualNodes)
+	owners := make(map[uint32]string, len(members)*virtualNodes)
+	for _, member := range members {
+		for i := 0; i < virtualNodes; i++ {
+			point := crc32.ChecksumIEEE([]byte(member + "#" + strconv.Itoa(i)))
+			points = append(points, point)
+			owners[point] = member
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+
+	r.mu.Lock()
+	r.points = points
+	r.owners = owners
+	r.mu.Unlock()
+}
+
+// Owner returns the member that owns channel, or "" if the ring is empty.
+func (r *Ring) Owner(channel string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.points) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(channel))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
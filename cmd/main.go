@@ -1,13 +1,33 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	p "github.com/biohackerellie/pushpop"
+	"github.com/biohackerellie/pushpop/amqpbridge"
+	"github.com/biohackerellie/pushpop/archive"
+	hubbridge "github.com/biohackerellie/pushpop/bridge"
+	"github.com/biohackerellie/pushpop/cluster"
+	"github.com/biohackerellie/pushpop/connectapi"
+	"github.com/biohackerellie/pushpop/grpcapi"
+	"github.com/biohackerellie/pushpop/natsbroker"
+	"github.com/biohackerellie/pushpop/redisbroker"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -22,19 +42,279 @@ func main() {
 	})
 	log := slog.New(logHandler)
 
-	hub := p.NewHub(log)
-	go hub.Run()
+	var opts []p.Option
+	adminToken := secretEnv(log, "ADMIN_TOKEN")
+	if adminToken.Get() != "" {
+		opts = append(opts, p.WithAdminSecret(adminToken))
+	}
+	if limit, err := strconv.ParseInt(os.Getenv("READ_LIMIT"), 10, 64); err == nil && limit > 0 {
+		opts = append(opts, p.WithReadLimit(limit))
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("IDLE_TIMEOUT")); err == nil && timeout > 0 {
+		opts = append(opts, p.WithIdleTimeout(timeout))
+	}
+	if limit, err := strconv.ParseInt(os.Getenv("TRIGGER_BODY_LIMIT"), 10, 64); err == nil {
+		opts = append(opts, p.WithTriggerBodyLimit(limit))
+	}
+	if n, err := strconv.Atoi(os.Getenv("MAX_PAYLOAD_SIZE")); err == nil && n > 0 {
+		opts = append(opts, p.WithMaxPayloadSize(n))
+	}
+	jsonLimits := p.DefaultJSONLimits
+	if n, err := strconv.Atoi(os.Getenv("JSON_MAX_DEPTH")); err == nil {
+		jsonLimits.MaxDepth = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("JSON_MAX_KEYS")); err == nil {
+		jsonLimits.MaxKeys = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("JSON_MAX_STRING_LENGTH")); err == nil {
+		jsonLimits.MaxStringLength = n
+	}
+	opts = append(opts, p.WithJSONLimits(jsonLimits))
+	if n, err := strconv.Atoi(os.Getenv("MAX_SUBSCRIPTIONS")); err == nil && n > 0 {
+		opts = append(opts, p.WithMaxSubscriptions(n))
+	}
+	if n, err := strconv.Atoi(os.Getenv("MAX_CHANNELS")); err == nil && n > 0 {
+		opts = append(opts, p.WithMaxChannels(n))
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("CHANNEL_IDLE_TTL")); err == nil && ttl > 0 {
+		opts = append(opts, p.WithChannelIdleTTL(ttl))
+	}
+	if os.Getenv("STRICT_CHANNELS") == "true" {
+		opts = append(opts, p.WithStrictChannels(splitList(os.Getenv("DECLARED_CHANNELS"))...))
+	}
+	if period, err := time.ParseDuration(os.Getenv("TENANT_METERING")); err == nil {
+		opts = append(opts, p.WithTenantMetering(period))
+	}
+	if path := os.Getenv("USAGE_EXPORT_FILE"); path != "" {
+		opts = append(opts, p.WithUsageSink(p.UsageFile(path)))
+	}
+	if phases := os.Getenv("SHUTDOWN_PHASES"); phases != "" {
+		opts = append(opts, p.WithShutdownPhases(shutdownPhases(phases)))
+	}
+	for _, alias := range splitList(os.Getenv("CHANNEL_ALIASES")) {
+		if name, target, ok := strings.Cut(alias, "="); ok {
+			opts = append(opts, p.WithChannelAlias(name, target))
+		}
+	}
+	if os.Getenv("CHANNEL_METRICS") == "true" {
+		topN, _ := strconv.Atoi(os.Getenv("CHANNEL_METRICS_TOP_N"))
+		opts = append(opts, p.WithChannelMetrics(p.ChannelMetrics{
+			Prefixes: splitList(os.Getenv("CHANNEL_METRICS_PREFIXES")),
+			TopN:     topN,
+		}))
+	}
+	if away, err := time.ParseDuration(os.Getenv("PRESENCE_AWAY")); err == nil && away > 0 {
+		offline, _ := time.ParseDuration(os.Getenv("PRESENCE_OFFLINE"))
+		opts = append(opts, p.WithPresenceLiveness(p.PresenceLiveness{Away: away, Offline: offline}))
+	}
+	if threshold, err := strconv.Atoi(os.Getenv("COMPRESSION_THRESHOLD")); err == nil && threshold >= 0 {
+		opts = append(opts, p.WithCompression(threshold))
+	}
+	if os.Getenv("JSONRPC") == "true" {
+		opts = append(opts, p.WithJSONRPC())
+	}
+	if mode, ok := p.ParseHeartbeatMode(os.Getenv("HEARTBEAT")); ok {
+		opts = append(opts, p.WithHeartbeat(mode))
+	}
+	if ips, users := splitList(os.Getenv("BLOCKLIST_IPS")), splitList(os.Getenv("BLOCKLIST_USERS")); len(ips) > 0 || len(users) > 0 {
+		opts = append(opts, p.WithBlocklist(ips, users))
+	}
+	if url := os.Getenv("FORWARD_AUTH_URL"); url != "" {
+		opts = append(opts, p.WithForwardAuth(p.ForwardAuthConfig{
+			URL:             url,
+			ResponseHeaders: splitList(os.Getenv("FORWARD_AUTH_RESPONSE_HEADERS")),
+			UserHeader:      os.Getenv("FORWARD_AUTH_USER_HEADER"),
+		}))
+	}
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		opts = append(opts, p.WithOIDC(p.OIDCConfig{
+			Issuer:    issuer,
+			Audience:  os.Getenv("OIDC_AUDIENCE"),
+			JWKSURL:   os.Getenv("OIDC_JWKS_URL"),
+			UserClaim: os.Getenv("OIDC_USER_CLAIM"),
+			TagClaims: splitList(os.Getenv("OIDC_TAG_CLAIMS")),
+			Optional:  os.Getenv("OIDC_OPTIONAL") == "true",
+		}))
+	}
+	if url := os.Getenv("MODERATION_URL"); url != "" {
+		opts = append(opts, p.WithModerator(&p.HTTPModerator{URL: url}))
+	}
+	// ENCRYPTION_KEYS encrypts the schedule file and archive files at
+	// rest, with the first key; the others still decrypt.
+	var keyring *p.Keyring
+	if keys := secretEnv(log, "ENCRYPTION_KEYS").Get(); keys != "" {
+		var err error
+		if keyring, err = p.ParseKeyring(keys); err != nil {
+			log.Error("Invalid encryption keys", "err", err)
+			panic(err)
+		}
+	}
+	if path := os.Getenv("SCHEDULE_FILE"); path != "" {
+		store := p.NewFileScheduleStore(path)
+		store.Keyring = keyring
+		opts = append(opts, p.WithScheduleStore(store))
+	}
+	var policy *filePolicy
+	if path := os.Getenv("POLICY_FILE"); path != "" {
+		policy = &filePolicy{path: path}
+		if err := policy.reload(); err != nil {
+			log.Error("Failed to load policy", "path", path, "err", err)
+			panic(err)
+		}
+		opts = append(opts, p.WithPolicy(policy))
+	} else if url := os.Getenv("OPA_URL"); url != "" {
+		opts = append(opts, p.WithPolicy(&p.OPAPolicy{URL: url}))
+	}
+	if window, err := time.ParseDuration(os.Getenv("RECOVERY_WINDOW")); err == nil && window > 0 {
+		buffer, err := strconv.Atoi(os.Getenv("RECOVERY_BUFFER"))
+		if err != nil || buffer <= 0 {
+			buffer = 100
+		}
+		opts = append(opts, p.WithRecoveryWindow(window, buffer))
+	}
+
+	if os.Getenv("CLUSTER_MODE") == "gossip" {
+		port, _ := strconv.Atoi(os.Getenv("CLUSTER_BIND_PORT"))
+		gossip, err := cluster.New(cluster.Config{
+			NodeName:      os.Getenv("CLUSTER_NODE_NAME"),
+			BindPort:      port,
+			AdvertiseAddr: os.Getenv("CLUSTER_ADVERTISE_ADDR"),
+			Seeds:         splitList(os.Getenv("CLUSTER_SEEDS")),
+			SecretKey:     []byte(secretEnv(log, "CLUSTER_SECRET").Get()),
+			Discovery:     clusterDiscovery(port),
+		}, log)
+		if err != nil {
+			log.Error("Failed to start cluster", "err", err)
+			panic(err)
+		}
+		opts = append(opts, p.WithBroker(gossip), p.WithOwnership(gossip))
+	} else if natsURL := os.Getenv("NATS_URL"); natsURL != "" || os.Getenv("NATS_EMBED") == "true" {
+		if os.Getenv("NATS_EMBED") == "true" {
+			port, _ := strconv.Atoi(os.Getenv("NATS_PORT"))
+			clusterPort, _ := strconv.Atoi(os.Getenv("NATS_CLUSTER_PORT"))
+			embedded, err := natsbroker.StartEmbedded(natsbroker.EmbeddedConfig{
+				Port:        port,
+				ClusterName: "pushpop",
+				ClusterPort: clusterPort,
+				Routes:      splitList(os.Getenv("NATS_ROUTES")),
+			})
+			if err != nil {
+				log.Error("Failed to start embedded NATS server", "err", err)
+				panic(err)
+			}
+			defer embedded.Shutdown()
+			natsURL = embedded.ClientURL()
+		}
+		broker, err := natsbroker.New(natsbroker.Config{URL: natsURL})
+		if err != nil {
+			log.Error("Failed to connect to NATS", "err", err)
+			panic(err)
+		}
+		opts = append(opts, p.WithBroker(broker))
+	} else if addrs := splitList(os.Getenv("REDIS_ADDRS")); len(addrs) > 0 {
+		db, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+		opts = append(opts, p.WithBroker(redisbroker.New(redisbroker.Config{
+			Addrs:            addrs,
+			MasterName:       os.Getenv("REDIS_MASTER_NAME"),
+			SentinelPassword: secretEnv(log, "REDIS_SENTINEL_PASSWORD").Get(),
+			Username:         os.Getenv("REDIS_USERNAME"),
+			Password:         secretEnv(log, "REDIS_PASSWORD").Get(),
+			DB:               db,
+		})))
+	}
+	if upstream := os.Getenv("FEDERATION_UPSTREAM"); upstream != "" {
+		opts = append(opts, p.WithFederation(p.FederationConfig{
+			Upstream: upstream,
+			Prefixes: splitList(os.Getenv("FEDERATION_PREFIXES")),
+			Token:    secretEnv(log, "FEDERATION_TOKEN").Get(),
+		}))
+	}
+
+	var archiveStore *archive.S3Store
+	if bucket := os.Getenv("ARCHIVE_S3_BUCKET"); bucket != "" {
+		store, err := archive.NewS3Store(archive.S3Config{
+			Endpoint:        os.Getenv("ARCHIVE_S3_ENDPOINT"),
+			Region:          os.Getenv("ARCHIVE_S3_REGION"),
+			Bucket:          bucket,
+			AccessKeyID:     os.Getenv("ARCHIVE_S3_ACCESS_KEY_ID"),
+			SecretAccessKey: secretEnv(log, "ARCHIVE_S3_SECRET_ACCESS_KEY").Get(),
+			PathStyle:       os.Getenv("ARCHIVE_S3_PATH_STYLE") == "true",
+		})
+		if err != nil {
+			log.Error("Failed to configure archive storage", "err", err)
+			panic(err)
+		}
+		archiveStore = store
+		opts = append(opts, p.WithReplaySource("archive", &archive.Source{Store: store, Prefix: os.Getenv("ARCHIVE_PREFIX"), Keyring: keyring}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := p.NewHub(log, opts...)
+	snapshotFile := os.Getenv("SNAPSHOT_FILE")
+	if snapshotFile != "" {
+		if err := hub.LoadSnapshot(snapshotFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Error("Failed to load snapshot", "path", snapshotFile, "err", err)
+		}
+	}
+	go func() {
+		if err := hub.Run(ctx); err != nil {
+			log.Error("Hub stopped", "err", err)
+		}
+	}()
+
+	if url := os.Getenv("AMQP_URL"); url != "" {
+		bridge := amqpbridge.New(hub, amqpbridge.Config{
+			URL:      url,
+			Inbound:  amqpBindings(os.Getenv("AMQP_INBOUND"), false),
+			Outbound: amqpBindings(os.Getenv("AMQP_OUTBOUND"), true),
+		}, log)
+		go func() { _ = bridge.Run(ctx) }()
+	}
+	if inbound, outbound := splitList(os.Getenv("BRIDGE_INBOUND")), splitList(os.Getenv("BRIDGE_OUTBOUND")); len(inbound) > 0 || len(outbound) > 0 {
+		bridge := hubbridge.New(hub, hubbridge.Config{
+			URL:        os.Getenv("BRIDGE_URL"),
+			TriggerURL: os.Getenv("BRIDGE_TRIGGER_URL"),
+			Token:      secretEnv(log, "BRIDGE_TOKEN").Get(),
+			Inbound:    inbound,
+			Outbound:   outbound,
+			Name:       os.Getenv("BRIDGE_NAME"),
+		}, log)
+		go func() { _ = bridge.Run(ctx) }()
+	}
+	if channels := splitList(os.Getenv("ARCHIVE_CHANNELS")); archiveStore != nil && len(channels) > 0 {
+		interval, _ := time.ParseDuration(os.Getenv("ARCHIVE_INTERVAL"))
+		archiver := archive.New(hub, archive.Config{
+			Channels: channels,
+			Store:    archiveStore,
+			Gzip:     true,
+			Keyring:  keyring,
+			Prefix:   os.Getenv("ARCHIVE_PREFIX"),
+			Interval: interval,
+		}, log)
+		go func() { _ = archiver.Run(ctx) }()
+	}
 	// Register routes
-	http.HandleFunc("/trigger", p.HandleTrigger(hub))
-	http.HandleFunc("/ws", p.ServeWs(hub))
+	mux := http.NewServeMux()
+	mux.Handle("/", hub.Handler())
+	mux.HandleFunc("/ingest/{source}", p.HandleIngest(hub, ingestSources(log)))
+	// CONNECT_API=true serves the publish and admin APIs with ConnectRPC,
+	// accepting cleartext HTTP/2 for gRPC clients.
+	connectAPI := os.Getenv("CONNECT_API") == "true"
+	if connectAPI {
+		connectapi.Mount(mux, hub)
+	}
 	// Start the server
 	server := &http.Server{
-		Addr: "0.0.0.0:8945",
+		Addr:    "0.0.0.0:8945",
+		Handler: mux,
+	}
+	if connectAPI {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
 	}
-
-	// Graceful shutdown context
-	shutdownCtx, stop := context.WithCancel(context.Background())
-	defer stop()
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -43,16 +323,250 @@ func main() {
 		}
 	}()
 
+	// GRPC_ADDR, e.g. ":9090", also serves the publish API over gRPC.
+	var grpcServer *grpc.Server
+	if addr := os.Getenv("GRPC_ADDR"); addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Error("Failed to listen for gRPC", "addr", addr, "err", err)
+			panic(err)
+		}
+		grpcServer = grpc.NewServer()
+		grpcapi.Register(grpcServer, hub)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Error("gRPC server error", "err", err)
+			}
+		}()
+	}
+
 	log.Info("Server started")
-	// Wait for shutdown signal
+	// Wait for a shutdown signal. SIGHUP reloads the policy file and SIGUSR1
+	// dumps the hub's stats and goroutines for debugging hangs.
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
-	<-signalChan
-	log.Info("Shutting down server...")
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+	for sig := range signalChan {
+		if sig == syscall.SIGHUP {
+			if policy != nil {
+				if err := policy.reload(); err != nil {
+					log.Error("Failed to reload policy", "path", policy.path, "err", err)
+					continue
+				}
+			}
+			log.Info("Configuration reloaded")
+			continue
+		}
+		if sig == syscall.SIGUSR1 {
+			dumpStats(log, hub)
+			continue
+		}
+		log.Info("Shutting down server...", "signal", sig)
+		break
+	}
+
+	// SHUTDOWN_TIMEOUT bounds the wait for clients to flush their buffers.
+	shutdownTimeout := 10 * time.Second
+	if timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && timeout > 0 {
+		shutdownTimeout = timeout
+	}
+	shutdownCtx, stop := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer stop()
 
 	// Stop accepting new requests and clean up
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Error("Server shutdown failed", "err", err)
 	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+	if snapshotFile != "" {
+		// Snapshot before the hub removes its clients and their presence.
+		if err := hub.SaveSnapshot(snapshotFile); err != nil {
+			log.Error("Failed to save snapshot", "path", snapshotFile, "err", err)
+		}
+	}
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Error("Hub shutdown failed", "err", err)
+	}
 	log.Info("Server gracefully stopped")
 }
+
+// shutdownPhases parses phase timeouts written like
+// "upgrades=1s,intake=5s,broadcasts=5s,clients=10s".
+func shutdownPhases(spec string) p.ShutdownPhases {
+	var phases p.ShutdownPhases
+	for _, entry := range splitList(spec) {
+		name, value, _ := strings.Cut(entry, "=")
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "upgrades":
+			phases.Upgrades = timeout
+		case "intake":
+			phases.Intake = timeout
+		case "broadcasts":
+			phases.Broadcasts = timeout
+		case "clients":
+			phases.Clients = timeout
+		}
+	}
+	return phases
+}
+
+// ingestSources builds the webhook ingest configuration from the environment.
+// INGEST_SOURCES lists source names; each source is configured with
+// INGEST_<NAME>_TYPE (github, stripe, pushpop or hmac), INGEST_<NAME>_SECRET or
+// INGEST_<NAME>_SECRET_FILE, INGEST_<NAME>_CHANNELS (comma separated), and
+// for hmac sources INGEST_<NAME>_HEADER. Sources without a secret are
+// skipped, since anyone could sign their webhooks.
+func ingestSources(log *slog.Logger) map[string]p.IngestSource {
+	sources := make(map[string]p.IngestSource)
+	for _, name := range splitList(os.Getenv("INGEST_SOURCES")) {
+		prefix := "INGEST_" + strings.ToUpper(name) + "_"
+		if os.Getenv(prefix+"SECRET") == "" && os.Getenv(prefix+"SECRET_FILE") == "" {
+			log.Error("Skipping ingest source without a secret", "source", name, "env", prefix+"SECRET")
+			continue
+		}
+		header := os.Getenv(prefix + "HEADER")
+
+		var build func(secret string) p.WebhookVerifier
+		switch os.Getenv(prefix + "TYPE") {
+		case "github":
+			build = p.GitHubVerifier
+		case "stripe":
+			build = func(secret string) p.WebhookVerifier { return p.StripeVerifier(secret, 0) }
+		case "pushpop":
+			build = func(secret string) p.WebhookVerifier { return p.EgressVerifier(secret, 0) }
+		default:
+			build = func(secret string) p.WebhookVerifier { return p.HMACVerifier(header, secret) }
+		}
+
+		sources[name] = p.IngestSource{
+			Verifier: p.SecretVerifier(secretEnv(log, prefix+"SECRET"), build),
+			Channels: splitList(os.Getenv(prefix + "CHANNELS")),
+		}
+	}
+	return sources
+}
+
+// secretEnv reads a secret from the environment variable name, or from the
+// file named by name_FILE, such as a Kubernetes secret mount, which is
+// watched for changes.
+func secretEnv(log *slog.Logger, name string) *p.Secret {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return p.NewSecret(os.Getenv(name))
+	}
+	secret, err := p.WatchSecret(context.Background(), p.FileSecrets{}, path, 0)
+	if err != nil {
+		log.Error("Failed to read secret", "name", name, "path", path, "err", err)
+		panic(err)
+	}
+	return secret
+}
+
+// filePolicy is a RulePolicy loaded from a file, which can be reloaded
+// while the server runs.
+type filePolicy struct {
+	path   string
+	policy atomic.Pointer[p.RulePolicy]
+}
+
+func (f *filePolicy) Authorize(ctx context.Context, session *p.Session, action p.Action, channel string) error {
+	return f.policy.Load().Authorize(ctx, session, action, channel)
+}
+
+// reload reads the file again, keeping the current rules if it is invalid.
+func (f *filePolicy) reload() error {
+	policy, err := loadPolicy(f.path)
+	if err != nil {
+		return err
+	}
+	f.policy.Store(policy)
+	return nil
+}
+
+// dumpStats logs the hub's stats and a dump of every goroutine's stack.
+func dumpStats(log *slog.Logger, hub *p.Hub) {
+	stats := hub.Stats()
+	log.Info("Hub stats",
+		"connections", stats.Connections,
+		"channels", stats.Channels,
+		"subscriptions", stats.Subscriptions,
+		"queued", stats.Queued,
+		"draining", stats.Draining,
+		"goroutines", stats.Goroutines,
+	)
+	var dump bytes.Buffer
+	_ = pprof.Lookup("goroutine").WriteTo(&dump, 1)
+	log.Info("Goroutine dump", "stacks", dump.String())
+}
+
+// loadPolicy reads a RulePolicy from a JSON file.
+func loadPolicy(path string) (*p.RulePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy p.RulePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// splitList splits a comma separated environment value, dropping blanks.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// amqpBindings parses a comma separated list of AMQP bindings. Inbound
+// bindings are written exchange/routingkey=channel and outbound bindings
+// channel=exchange/routingkey.
+func amqpBindings(value string, outbound bool) []amqpbridge.Binding {
+	var bindings []amqpbridge.Binding
+	for _, item := range splitList(value) {
+		left, right, _ := strings.Cut(item, "=")
+		route, channel := left, right
+		if outbound {
+			route, channel = right, left
+		}
+		exchange, key, _ := strings.Cut(route, "/")
+		bindings = append(bindings, amqpbridge.Binding{Exchange: exchange, RoutingKey: key, Channel: channel})
+	}
+	return bindings
+}
+
+// clusterDiscovery selects the peer discovery mechanism named by
+// CLUSTER_DISCOVERY, if any.
+func clusterDiscovery(port int) cluster.Discoverer {
+	switch os.Getenv("CLUSTER_DISCOVERY") {
+	case "dns-srv":
+		return cluster.DNSSRV{Name: os.Getenv("CLUSTER_DNS_SRV")}
+	case "kubernetes":
+		return &cluster.KubernetesEndpoints{
+			Namespace:     os.Getenv("CLUSTER_K8S_NAMESPACE"),
+			LabelSelector: os.Getenv("CLUSTER_K8S_SELECTOR"),
+			Port:          port,
+		}
+	default:
+		return nil
+	}
+}
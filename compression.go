@@ -0,0 +1,77 @@
+package pushpop
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// compressingUpgrader is upgrader with permessage-deflate negotiation.
+var compressingUpgrader = func() websocket.Upgrader {
+	u := upgrader
+	u.EnableCompression = true
+	return u
+}()
+
+// WithCompression negotiates permessage-deflate with clients that support
+// it and compresses messages whose encoding is at least threshold bytes;
+// smaller messages cost more to compress than they save. Channels can
+// raise the threshold or opt out with their Compression settings, which
+// may be changed at runtime.
+func WithCompression(threshold int) Option {
+	return func(h *Hub) {
+		h.compression = true
+		h.compressionThreshold = threshold
+	}
+}
+
+// upgrade upgrades a request to a WebSocket connection, offering
+// compression if the hub compresses messages and accepting the JSON-RPC
+// subprotocol if the hub speaks it.
+func (h *Hub) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	header := h.jsonrpcHeader(r)
+	if h.compression {
+		return compressingUpgrader.Upgrade(w, r, header)
+	}
+	return upgrader.Upgrade(w, r, header)
+}
+
+// compresses reports whether a message of size bytes on channel should be
+// compressed.
+func (h *Hub) compresses(channel string, size int) bool {
+	settings := h.settingsFor(h.resolveChannel(channel))
+	if settings.Compression != nil && !*settings.Compression {
+		return false
+	}
+	threshold := h.compressionThreshold
+	if settings.CompressionThreshold > 0 {
+		threshold = settings.CompressionThreshold
+	}
+	return size >= threshold
+}
+
+// writeMessage writes message to the client, compressed if the connection
+// negotiated compression and the message's channel calls for it, and meters
+// its size for the client's tenant. JSON-RPC clients are sent the message
+// as a notification, or the response it carries.
+func (c *Client) writeMessage(message Message) error {
+	var frame interface{} = message
+	if c.rpc != nil {
+		frame = c.jsonrpcFrame(message)
+	}
+	conn, ok := c.conn.(interface{ EnableWriteCompression(bool) })
+	compress := c.hub.compression && ok
+	if !compress && c.hub.tenants == nil {
+		return c.conn.WriteJSON(frame)
+	}
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	if compress {
+		conn.EnableWriteCompression(c.hub.compresses(message.Channel, len(data)))
+	}
+	c.hub.tenants.transferred(c.session.Tenant, 0, len(data))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,341 @@
+package connectapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/biohackerellie/pushpop"
+	pushpopv1 "github.com/biohackerellie/pushpop/proto/pushpop/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// AdminServer implements pushpop.v1.AdminService for a hub. Calls need the
+// admin token or an admin API key as a bearer token; while the hub has
+// neither, every call is refused.
+type AdminServer struct {
+	hub *pushpop.Hub
+}
+
+// NewAdminServer returns the AdminService of hub.
+func NewAdminServer(hub *pushpop.Hub) *AdminServer {
+	return &AdminServer{hub: hub}
+}
+
+// authorize checks that the hub's admin API is secured and that a call
+// carries an admin credential.
+func (s *AdminServer) authorize(req connect.AnyRequest) error {
+	if !s.hub.AdminSecured() {
+		return connect.NewError(connect.CodePermissionDenied, errors.New("admin API disabled: no admin token or admin API key"))
+	}
+	if !s.hub.AuthorizedAdmin(bearer(req.Header())) {
+		return unauthorized()
+	}
+	return nil
+}
+
+// GetStats summarizes the hub.
+func (s *AdminServer) GetStats(_ context.Context, req *connect.Request[pushpopv1.GetStatsRequest]) (*connect.Response[pushpopv1.GetStatsResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	stats := s.hub.Stats()
+	return connect.NewResponse(&pushpopv1.GetStatsResponse{
+		Connections:   int32(stats.Connections),
+		Channels:      int32(stats.Channels),
+		Subscriptions: int32(stats.Subscriptions),
+		Queued:        int32(stats.Queued),
+		Draining:      stats.Draining,
+		Goroutines:    int32(stats.Goroutines),
+	}), nil
+}
+
+// ListChannels lists the channels with subscribers.
+func (s *AdminServer) ListChannels(_ context.Context, req *connect.Request[pushpopv1.ListChannelsRequest]) (*connect.Response[pushpopv1.ListChannelsResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	var channels []*pushpopv1.Channel
+	for _, info := range s.hub.Channels() {
+		channel := &pushpopv1.Channel{Name: info.Name, Subscribers: int32(info.Subscribers)}
+		if info.Settings != nil {
+			settings, err := toStruct(info.Settings)
+			if err != nil {
+				return nil, connect.NewError(connect.CodeInternal, err)
+			}
+			channel.Settings = settings
+		}
+		channels = append(channels, channel)
+	}
+	return connect.NewResponse(&pushpopv1.ListChannelsResponse{Channels: channels}), nil
+}
+
+// ListConnections lists the connections to this node.
+func (s *AdminServer) ListConnections(_ context.Context, req *connect.Request[pushpopv1.ListConnectionsRequest]) (*connect.Response[pushpopv1.ListConnectionsResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	var connections []*pushpopv1.Connection
+	for _, info := range s.hub.Connections() {
+		connections = append(connections, &pushpopv1.Connection{
+			SocketId:    info.SocketID,
+			RemoteIp:    info.RemoteIP,
+			UserId:      info.UserID,
+			ConnectedAt: timestamp(info.ConnectedAt),
+			Rtt:         durationpb.New(time.Duration(info.RTTMillis * float64(time.Millisecond))),
+			Channels:    info.Channels,
+		})
+	}
+	return connect.NewResponse(&pushpopv1.ListConnectionsResponse{Connections: connections}), nil
+}
+
+// Disconnect kicks a connection.
+func (s *AdminServer) Disconnect(_ context.Context, req *connect.Request[pushpopv1.DisconnectRequest]) (*connect.Response[pushpopv1.DisconnectResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	if !s.hub.Disconnect(req.Msg.GetSocketId()) {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("unknown connection"))
+	}
+	return connect.NewResponse(&pushpopv1.DisconnectResponse{}), nil
+}
+
+// Broadcast sends an event to every connected client.
+func (s *AdminServer) Broadcast(_ context.Context, req *connect.Request[pushpopv1.BroadcastRequest]) (*connect.Response[pushpopv1.BroadcastResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	if req.Msg.GetEvent() == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("missing event"))
+	}
+	var payload interface{}
+	if value := req.Msg.GetPayload(); value != nil {
+		payload = value.AsInterface()
+	}
+	s.hub.Broadcast(req.Msg.GetEvent(), payload)
+	return connect.NewResponse(&pushpopv1.BroadcastResponse{}), nil
+}
+
+// Drain puts the hub in maintenance mode.
+func (s *AdminServer) Drain(_ context.Context, req *connect.Request[pushpopv1.DrainRequest]) (*connect.Response[pushpopv1.DrainResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	s.hub.Drain(pushpop.DrainOptions{
+		Target: req.Msg.GetTarget(),
+		Jitter: req.Msg.GetJitter().AsDuration(),
+		Period: req.Msg.GetPeriod().AsDuration(),
+	})
+	return connect.NewResponse(&pushpopv1.DrainResponse{}), nil
+}
+
+// Resume leaves maintenance mode.
+func (s *AdminServer) Resume(_ context.Context, req *connect.Request[pushpopv1.ResumeRequest]) (*connect.Response[pushpopv1.ResumeResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	s.hub.Resume()
+	return connect.NewResponse(&pushpopv1.ResumeResponse{}), nil
+}
+
+// GetBlocklist lists the blocked addresses and users.
+func (s *AdminServer) GetBlocklist(_ context.Context, req *connect.Request[pushpopv1.GetBlocklistRequest]) (*connect.Response[pushpopv1.GetBlocklistResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&pushpopv1.GetBlocklistResponse{Blocklist: s.blocklist()}), nil
+}
+
+// Block blocks addresses and users.
+func (s *AdminServer) Block(_ context.Context, req *connect.Request[pushpopv1.BlockRequest]) (*connect.Response[pushpopv1.BlockResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	entries := req.Msg.GetEntries()
+	for _, ip := range entries.GetIps() {
+		if err := s.hub.BlockIP(ip); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+	}
+	for _, user := range entries.GetUserIds() {
+		s.hub.BlockUser(user)
+	}
+	return connect.NewResponse(&pushpopv1.BlockResponse{Blocklist: s.blocklist()}), nil
+}
+
+// Unblock lifts blocks of addresses and users.
+func (s *AdminServer) Unblock(_ context.Context, req *connect.Request[pushpopv1.UnblockRequest]) (*connect.Response[pushpopv1.UnblockResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	entries := req.Msg.GetEntries()
+	for _, ip := range entries.GetIps() {
+		if err := s.hub.UnblockIP(ip); err != nil {
+			return nil, connect.NewError(connect.CodeInvalidArgument, err)
+		}
+	}
+	for _, user := range entries.GetUserIds() {
+		s.hub.UnblockUser(user)
+	}
+	return connect.NewResponse(&pushpopv1.UnblockResponse{Blocklist: s.blocklist()}), nil
+}
+
+// blocklist returns the hub's blocklist.
+func (s *AdminServer) blocklist() *pushpopv1.Blocklist {
+	entries := s.hub.Blocklist()
+	return &pushpopv1.Blocklist{Ips: entries.IPs, UserIds: entries.Users}
+}
+
+// ListAPIKeys lists the API keys, without secrets.
+func (s *AdminServer) ListAPIKeys(_ context.Context, req *connect.Request[pushpopv1.ListAPIKeysRequest]) (*connect.Response[pushpopv1.ListAPIKeysResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	var keys []*pushpopv1.APIKey
+	for _, key := range s.hub.APIKeys() {
+		keys = append(keys, apiKey(key))
+	}
+	return connect.NewResponse(&pushpopv1.ListAPIKeysResponse{Keys: keys}), nil
+}
+
+// CreateAPIKey creates an API key.
+func (s *AdminServer) CreateAPIKey(_ context.Context, req *connect.Request[pushpopv1.CreateAPIKeyRequest]) (*connect.Response[pushpopv1.CreateAPIKeyResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	key, err := s.hub.CreateAPIKey(req.Msg.GetName(), pushpop.KeyScope(req.Msg.GetScope()))
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	return connect.NewResponse(&pushpopv1.CreateAPIKeyResponse{Key: apiKey(key)}), nil
+}
+
+// RotateAPIKey gives an API key a new secret.
+func (s *AdminServer) RotateAPIKey(_ context.Context, req *connect.Request[pushpopv1.RotateAPIKeyRequest]) (*connect.Response[pushpopv1.RotateAPIKeyResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	key, err := s.hub.RotateAPIKey(req.Msg.GetId(), req.Msg.GetOverlap().AsDuration())
+	if err != nil {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+	return connect.NewResponse(&pushpopv1.RotateAPIKeyResponse{Key: apiKey(key)}), nil
+}
+
+// RevokeAPIKey deletes an API key.
+func (s *AdminServer) RevokeAPIKey(_ context.Context, req *connect.Request[pushpopv1.RevokeAPIKeyRequest]) (*connect.Response[pushpopv1.RevokeAPIKeyResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	if !s.hub.RevokeAPIKey(req.Msg.GetId()) {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("unknown key"))
+	}
+	return connect.NewResponse(&pushpopv1.RevokeAPIKeyResponse{}), nil
+}
+
+// apiKey returns the protobuf message of an API key.
+func apiKey(key pushpop.APIKey) *pushpopv1.APIKey {
+	message := &pushpopv1.APIKey{
+		Id:        key.ID,
+		Name:      key.Name,
+		Scope:     string(key.Scope),
+		CreatedAt: timestamp(key.CreatedAt),
+		Secret:    key.Secret,
+	}
+	if key.RotatedAt != nil {
+		message.RotatedAt = timestamp(*key.RotatedAt)
+	}
+	return message
+}
+
+// ListReplays lists the running and recent replays.
+func (s *AdminServer) ListReplays(_ context.Context, req *connect.Request[pushpopv1.ListReplaysRequest]) (*connect.Response[pushpopv1.ListReplaysResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	var replays []*pushpopv1.Replay
+	for _, r := range s.hub.Replays() {
+		replays = append(replays, replay(r))
+	}
+	return connect.NewResponse(&pushpopv1.ListReplaysResponse{Replays: replays}), nil
+}
+
+// GetReplay reports a replay.
+func (s *AdminServer) GetReplay(_ context.Context, req *connect.Request[pushpopv1.GetReplayRequest]) (*connect.Response[pushpopv1.GetReplayResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	r, ok := s.hub.Replay(req.Msg.GetId())
+	if !ok {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("unknown replay"))
+	}
+	return connect.NewResponse(&pushpopv1.GetReplayResponse{Replay: replay(r)}), nil
+}
+
+// StartReplay starts a replay.
+func (s *AdminServer) StartReplay(_ context.Context, req *connect.Request[pushpopv1.StartReplayRequest]) (*connect.Response[pushpopv1.StartReplayResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	r, err := s.hub.StartReplay(pushpop.Replay{
+		Channel: req.Msg.GetChannel(),
+		Target:  req.Msg.GetTarget(),
+		Source:  req.Msg.GetSource(),
+		From:    timeOf(req.Msg.GetFrom()),
+		To:      timeOf(req.Msg.GetTo()),
+		Speed:   req.Msg.GetSpeed(),
+	})
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	return connect.NewResponse(&pushpopv1.StartReplayResponse{Replay: replay(r)}), nil
+}
+
+// CancelReplay stops a running replay.
+func (s *AdminServer) CancelReplay(_ context.Context, req *connect.Request[pushpopv1.CancelReplayRequest]) (*connect.Response[pushpopv1.CancelReplayResponse], error) {
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	if !s.hub.CancelReplay(req.Msg.GetId()) {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("unknown replay"))
+	}
+	return connect.NewResponse(&pushpopv1.CancelReplayResponse{}), nil
+}
+
+// replay returns the protobuf message of a replay.
+func replay(r pushpop.Replay) *pushpopv1.Replay {
+	message := &pushpopv1.Replay{
+		Id:        r.ID,
+		Channel:   r.Channel,
+		Target:    r.Target,
+		Source:    r.Source,
+		From:      timestamp(r.From),
+		To:        timestamp(r.To),
+		Speed:     r.Speed,
+		Status:    r.Status,
+		Total:     int32(r.Total),
+		Published: int32(r.Published),
+		Error:     r.Error,
+		Created:   timestamp(r.Created),
+	}
+	if r.Finished != nil {
+		message.Finished = timestamp(*r.Finished)
+	}
+	return message
+}
+
+// toStruct converts v to a Struct through its JSON encoding.
+func toStruct(v interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(fields)
+}
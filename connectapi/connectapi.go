@@ -0,0 +1,94 @@
+// Package connectapi serves a hub's publish and admin APIs with
+// ConnectRPC, so the services of proto/pushpop/v1 are callable from
+// Connect, gRPC, and gRPC-Web clients generated from the one schema, and
+// as plain HTTP POSTs with JSON bodies:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/", hub.Handler())
+//	connectapi.Mount(mux, hub)
+//
+// gRPC clients need HTTP/2; serve cleartext HTTP/2 with the server's
+// Protocols, or use TLS.
+package connectapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/biohackerellie/pushpop"
+	"github.com/biohackerellie/pushpop/proto/pushpop/v1/pushpopv1connect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Mount serves the PublishService and AdminService of hub on mux, at
+// "/pushpop.v1.PublishService/" and "/pushpop.v1.AdminService/".
+func Mount(mux *http.ServeMux, hub *pushpop.Hub, opts ...connect.HandlerOption) {
+	mux.Handle(pushpopv1connect.NewPublishServiceHandler(NewPublishServer(hub), opts...))
+	mux.Handle(pushpopv1connect.NewAdminServiceHandler(NewAdminServer(hub), opts...))
+}
+
+// bearer returns the bearer token of a call.
+func bearer(header http.Header) string {
+	token, _ := strings.CutPrefix(header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// unauthorized fails a call without a valid token.
+func unauthorized() *connect.Error {
+	return connect.NewError(connect.CodeUnauthenticated, errors.New("unauthorized"))
+}
+
+// publishError returns the Connect error of an error of Hub.Publish, with
+// a Retry-After header for rate limited messages.
+func publishError(err error) *connect.Error {
+	connectErr := connect.NewError(code(err), err)
+	var refused *pushpop.PublishError
+	if errors.As(err, &refused) && refused.RetryAfter > 0 {
+		connectErr.Meta().Set("Retry-After", strconv.Itoa(int(refused.RetryAfter.Seconds())))
+	}
+	return connectErr
+}
+
+// code returns the Connect code of an error of Hub.Publish, mapping the
+// HTTP status of a *pushpop.PublishError.
+func code(err error) connect.Code {
+	var refused *pushpop.PublishError
+	if !errors.As(err, &refused) {
+		return connect.CodeInternal
+	}
+	switch refused.Status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return connect.CodeInvalidArgument
+	case http.StatusNotFound:
+		return connect.CodeNotFound
+	case http.StatusConflict:
+		return connect.CodeAborted
+	case http.StatusRequestTimeout:
+		return connect.CodeDeadlineExceeded
+	case http.StatusTooManyRequests:
+		return connect.CodeResourceExhausted
+	case http.StatusServiceUnavailable:
+		return connect.CodeUnavailable
+	}
+	return connect.CodeInternal
+}
+
+// timestamp returns t as a Timestamp, or nil if it is zero.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// timeOf returns the time of a Timestamp, or the zero time if it is nil.
+func timeOf(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
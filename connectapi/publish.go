@@ -0,0 +1,81 @@
+package connectapi
+
+import (
+	"context"
+	"errors"
+
+	"connectrpc.com/connect"
+	"github.com/biohackerellie/pushpop"
+	pushpopv1 "github.com/biohackerellie/pushpop/proto/pushpop/v1"
+)
+
+// maxBatch bounds the messages of a PublishBatch call, like
+// /trigger/batch.
+const maxBatch = 1000
+
+// PublishServer implements pushpop.v1.PublishService for a hub. Calls are
+// authorized like /trigger.
+type PublishServer struct {
+	hub *pushpop.Hub
+}
+
+// NewPublishServer returns the PublishService of hub.
+func NewPublishServer(hub *pushpop.Hub) *PublishServer {
+	return &PublishServer{hub: hub}
+}
+
+// Publish publishes a message.
+func (s *PublishServer) Publish(ctx context.Context, req *connect.Request[pushpopv1.PublishRequest]) (*connect.Response[pushpopv1.PublishResponse], error) {
+	if !s.hub.AuthorizedPublisher(bearer(req.Header())) {
+		return nil, unauthorized()
+	}
+	message, opts := fromProto(req.Msg.GetMessage())
+	opts.Report = req.Msg.GetReport()
+	result, err := s.hub.Publish(ctx, message, opts)
+	if err != nil {
+		return nil, publishError(err)
+	}
+	resp := &pushpopv1.PublishResponse{Id: result.ID, Duplicate: result.Duplicate}
+	if opts.Report {
+		resp.Subscribers = int32(result.Fanout.Subscribers)
+		resp.Channels = make(map[string]int32, len(result.Fanout.Channels))
+		for channel, subscribers := range result.Fanout.Channels {
+			resp.Channels[channel] = int32(subscribers)
+		}
+	}
+	return connect.NewResponse(resp), nil
+}
+
+// PublishBatch publishes messages and returns a result per message.
+func (s *PublishServer) PublishBatch(ctx context.Context, req *connect.Request[pushpopv1.PublishBatchRequest]) (*connect.Response[pushpopv1.PublishBatchResponse], error) {
+	if !s.hub.AuthorizedPublisher(bearer(req.Header())) {
+		return nil, unauthorized()
+	}
+	if len(req.Msg.GetMessages()) > maxBatch {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("too many messages"))
+	}
+	results := make([]*pushpopv1.PublishResult, len(req.Msg.GetMessages()))
+	for i, m := range req.Msg.GetMessages() {
+		message, opts := fromProto(m)
+		published, err := s.hub.Publish(ctx, message, opts)
+		result := &pushpopv1.PublishResult{Id: published.ID, Duplicate: published.Duplicate}
+		if err != nil {
+			result.Code, result.Error = int32(code(err)), err.Error()
+			var refused *pushpop.PublishError
+			if errors.As(err, &refused) {
+				result.RetryAfterSeconds = int32(refused.RetryAfter.Seconds())
+			}
+		}
+		results[i] = result
+	}
+	return connect.NewResponse(&pushpopv1.PublishBatchResponse{Results: results}), nil
+}
+
+// fromProto returns the message and options of a protobuf message.
+func fromProto(m *pushpopv1.Message) (pushpop.Message, pushpop.PublishOptions) {
+	message := pushpop.Message{Channel: m.GetChannel(), Event: m.GetEvent()}
+	if payload := m.GetPayload(); payload != nil {
+		message.Payload = payload.AsInterface()
+	}
+	return message, pushpop.PublishOptions{Channels: m.GetChannels(), IdempotencyKey: m.GetIdempotencyKey()}
+}
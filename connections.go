@@ -0,0 +1,94 @@
+package pushpop
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ConnectionInfo describes an open connection.
+type ConnectionInfo struct {
+	SocketID    string    `json:"socket_id"`
+	RemoteIP    string    `json:"remote_ip"`
+	UserID      string    `json:"user_id,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	// RTTMillis is the latest heartbeat round-trip time, or zero if none
+	// has been measured yet.
+	RTTMillis float64  `json:"rtt_ms"`
+	Channels  []string `json:"channels"`
+}
+
+// RTT returns the latest heartbeat round-trip time of the client, or zero
+// if none has been measured. It is only measured with HeartbeatProtocol.
+func (c *Client) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// recordRTT handles the pong to a ping sent by the write pump, which carries
+// the send time as its payload.
+func (c *Client) recordRTT(appData string) {
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return
+	}
+	rtt := time.Since(time.Unix(0, sent))
+	if rtt < 0 {
+		return
+	}
+	c.rtt.Store(int64(rtt))
+	c.hub.metrics.rtt.observe(rtt.Seconds())
+}
+
+// info describes the client.
+func (c *Client) info() ConnectionInfo {
+	channels := []string{}
+	c.channels.Range(func(key, _ interface{}) bool {
+		channels = append(channels, key.(string))
+		return true
+	})
+	sort.Strings(channels)
+	return ConnectionInfo{
+		SocketID:    c.id,
+		RemoteIP:    c.session.RemoteIP,
+		UserID:      c.session.UserID,
+		ConnectedAt: c.session.ConnectedAt,
+		RTTMillis:   float64(c.RTT()) / float64(time.Millisecond),
+		Channels:    channels,
+	}
+}
+
+// Connections describes every open connection on this node, oldest first.
+func (h *Hub) Connections() []ConnectionInfo {
+	infos := []ConnectionInfo{}
+	h.clients.Range(func(key, _ interface{}) bool {
+		infos = append(infos, key.(*Client).info())
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ConnectedAt.Before(infos[j].ConnectedAt) })
+	return infos
+}
+
+// handleAdminConnections lists open connections.
+func (h *Hub) handleAdminConnections(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"connections": h.Connections()})
+}
+
+// handleAdminConnection describes a single connection.
+func (h *Hub) handleAdminConnection(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var info *ConnectionInfo
+	h.clients.Range(func(key, _ interface{}) bool {
+		if client := key.(*Client); client.id == id {
+			i := client.info()
+			info = &i
+			return false
+		}
+		return true
+	})
+	if info == nil {
+		http.Error(w, "Unknown Connection", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,348 @@
+package pushpop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecurringPublish publishes a message to a channel on a cron schedule,
+// e.g. a heartbeat or stats event every minute.
+type RecurringPublish struct {
+	Name string `json:"name"`
+	// Schedule is a cron expression of five fields, minute, hour, day of
+	// month, month, and day of week, evaluated in UTC, e.g. "*/5 * * * *";
+	// a shorthand like "@hourly" or "@daily"; or "@every" and a duration,
+	// e.g. "@every 30s".
+	Schedule string      `json:"schedule"`
+	Channel  string      `json:"channel"`
+	Event    string      `json:"event"`
+	Payload  interface{} `json:"payload,omitempty"`
+	// Stats publishes the hub's Stats as the payload instead of Payload.
+	Stats bool `json:"stats,omitempty"`
+	// Next and LastRun are maintained by the hub.
+	Next    time.Time  `json:"next"`
+	LastRun *time.Time `json:"last_run,omitempty"`
+}
+
+// WithRecurringPublish adds a recurring publish. An invalid one is logged
+// and ignored.
+func WithRecurringPublish(publish RecurringPublish) Option {
+	return func(h *Hub) {
+		if err := h.AddRecurringPublish(publish); err != nil {
+			h.log.Error("Invalid recurring publish", "name", publish.Name, "err", err)
+		}
+	}
+}
+
+// recurringTable holds the recurring publishes by name.
+type recurringTable struct {
+	mu        sync.Mutex
+	publishes map[string]*recurring
+	wake      chan struct{}
+}
+
+// recurring is a recurring publish with its parsed schedule.
+type recurring struct {
+	RecurringPublish
+	schedule cronSchedule
+}
+
+func newRecurringTable() *recurringTable {
+	return &recurringTable{publishes: make(map[string]*recurring), wake: make(chan struct{}, 1)}
+}
+
+// AddRecurringPublish adds a recurring publish, replacing any with the same
+// name. It takes effect immediately.
+func (h *Hub) AddRecurringPublish(publish RecurringPublish) error {
+	if publish.Name == "" {
+		return errors.New("missing name")
+	}
+	if publish.Channel == "" || publish.Event == "" {
+		return errors.New("missing channel or event")
+	}
+	schedule, err := parseCron(publish.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	publish.Next = schedule.next(time.Now())
+	publish.LastRun = nil
+	if publish.Next.IsZero() {
+		return errors.New("invalid schedule: it never fires")
+	}
+
+	t := h.recurring
+	t.mu.Lock()
+	t.publishes[publish.Name] = &recurring{RecurringPublish: publish, schedule: schedule}
+	t.mu.Unlock()
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// RemoveRecurringPublish removes a recurring publish and reports whether it
+// existed.
+func (h *Hub) RemoveRecurringPublish(name string) bool {
+	t := h.recurring
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.publishes[name]
+	delete(t.publishes, name)
+	return ok
+}
+
+// RecurringPublishes returns the recurring publishes, sorted by name.
+func (h *Hub) RecurringPublishes() []RecurringPublish {
+	t := h.recurring
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	publishes := make([]RecurringPublish, 0, len(t.publishes))
+	for _, r := range t.publishes {
+		publishes = append(publishes, r.RecurringPublish)
+	}
+	sort.Slice(publishes, func(i, j int) bool { return publishes[i].Name < publishes[j].Name })
+	return publishes
+}
+
+// due returns the publishes due at now and advances their schedules, and
+// when the next one is due.
+func (t *recurringTable) due(now time.Time) ([]RecurringPublish, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var due []RecurringPublish
+	var next time.Time
+	for _, r := range t.publishes {
+		if r.Next.IsZero() {
+			continue
+		}
+		if !r.Next.After(now) {
+			ran := now
+			r.LastRun = &ran
+			due = append(due, r.RecurringPublish)
+			r.Next = r.schedule.next(now)
+		}
+		if !r.Next.IsZero() && (next.IsZero() || r.Next.Before(next)) {
+			next = r.Next
+		}
+	}
+	return due, next
+}
+
+// runRecurring publishes the recurring publishes as they come due until ctx
+// is cancelled. Runs missed while the hub was stopped are published once.
+func (h *Hub) runRecurring(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		due, next := h.recurring.due(time.Now())
+		for _, publish := range due {
+			if !h.publishRecurring(ctx, publish) {
+				return
+			}
+		}
+		if next.IsZero() {
+			timer.Stop()
+		} else {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.recurring.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// publishRecurring broadcasts a run of a recurring publish. It reports
+// false if ctx was cancelled first.
+func (h *Hub) publishRecurring(ctx context.Context, publish RecurringPublish) bool {
+	message := Message{Channel: h.resolveChannel(publish.Channel), Event: publish.Event, Payload: publish.Payload}
+	if publish.Stats {
+		message.Payload = h.Stats()
+	}
+	message = stamp(message, Origin{Type: OriginServer})
+	send, err := h.admit(message)
+	if err != nil {
+		h.log.Warn("Dropped recurring publish", "name", publish.Name, "channel", message.Channel, "err", err)
+		return true
+	}
+	if !send {
+		return true
+	}
+	select {
+	case h.broadcast <- message:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// cronSchedule is a parsed RecurringPublish.Schedule. Fields hold a bit per
+// allowed value.
+type cronSchedule struct {
+	every                         time.Duration
+	minute, hour, dom, month, dow uint64
+	// anyDOM and anyDOW record unrestricted day fields; when both days are
+	// restricted, either matching is enough, as in cron.
+	anyDOM, anyDOW bool
+}
+
+// cronShorthands are the schedules written with "@".
+var cronShorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a schedule.
+func parseCron(spec string) (cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil || d < time.Second {
+			return cronSchedule{}, fmt.Errorf("invalid interval %q", every)
+		}
+		return cronSchedule{every: d}, nil
+	}
+	if expanded, ok := cronShorthands[spec]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	var s cronSchedule
+	var err error
+	for i, field := range []struct {
+		dst      *uint64
+		min, max int
+	}{{&s.minute, 0, 59}, {&s.hour, 0, 23}, {&s.dom, 1, 31}, {&s.month, 1, 12}, {&s.dow, 0, 7}} {
+		if *field.dst, err = parseCronField(fields[i], field.min, field.max); err != nil {
+			return cronSchedule{}, err
+		}
+	}
+	// Sunday is 0 or 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.anyDOM = strings.HasPrefix(fields[2], "*")
+	s.anyDOW = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges like
+// "1-5", and steps like "*/15" or "0-30/10".
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// next returns the first time after t the schedule fires, or the zero
+// time if it never does, e.g. for February 30th.
+func (s cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the schedule fires on t's day.
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.anyDOM || s.anyDOW {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// handleAdminRecurring lists the recurring publishes.
+func (h *Hub) handleAdminRecurring(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recurring": h.RecurringPublishes()})
+}
+
+// handleAdminAddRecurring adds or replaces the recurring publish named by
+// the path from the body.
+func (h *Hub) handleAdminAddRecurring(w http.ResponseWriter, r *http.Request) {
+	var publish RecurringPublish
+	if err := json.NewDecoder(r.Body).Decode(&publish); err != nil {
+		http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+	publish.Name = r.PathValue("name")
+	if err := h.AddRecurringPublish(publish); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminRemoveRecurring removes a recurring publish.
+func (h *Hub) handleAdminRemoveRecurring(w http.ResponseWriter, r *http.Request) {
+	if !h.RemoveRecurringPublish(r.PathValue("name")) {
+		http.Error(w, "Unknown Recurring Publish", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
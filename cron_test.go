@@ -0,0 +1,136 @@
+package pushpop
+
+import (
+	"testing"
+	"time"
+)
+
+// cronBits returns the field bits of values.
+func cronBits(values ...int) uint64 {
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << v
+	}
+	return bits
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  uint64
+		valid bool
+	}{
+		{"*", cronBits(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11), true},
+		{"5", cronBits(5), true},
+		{"0", cronBits(0), true},
+		{"11", cronBits(11), true},
+		{"1,3,5", cronBits(1, 3, 5), true},
+		{"2-4", cronBits(2, 3, 4), true},
+		{"*/4", cronBits(0, 4, 8), true},
+		{"1-9/3", cronBits(1, 4, 7), true},
+		{"6/2", cronBits(6, 8, 10), true},
+		{"1-2,8-9", cronBits(1, 2, 8, 9), true},
+		{"3,3", cronBits(3), true},
+		{"", 0, false},
+		{"12", 0, false},
+		{"-1", 0, false},
+		{"4-2", 0, false},
+		{"0-12", 0, false},
+		{"*/0", 0, false},
+		{"*/-1", 0, false},
+		{"*/x", 0, false},
+		{"a", 0, false},
+		{"1-", 0, false},
+		{"1,", 0, false},
+		{"1-2-3", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			got, err := parseCronField(tt.field, 0, 11)
+			if (err == nil) != tt.valid {
+				t.Fatalf("got error %v, want valid: %v", err, tt.valid)
+			}
+			if got != tt.want {
+				t.Errorf("got %b, want %b", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"* * * * *", true},
+		{"*/5 9-17 * * 1-5", true},
+		{"0 0 1,15 * *", true},
+		{"  30 2 * * 7  ", true},
+		{"@hourly", true},
+		{"@every 30s", true},
+		{"@every 1h30m", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * 32 * *", false},
+		{"* * * 0 *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"@fortnightly", false},
+		{"@every", false},
+		{"@every 500ms", false},
+		{"@every -1m", false},
+		{"@every soon", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if _, err := parseCron(tt.spec); (err == nil) != tt.valid {
+				t.Errorf("got error %v, want valid: %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-03-15 is a Friday.
+	from := time.Date(2024, 3, 15, 10, 7, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", at(3, 15, 10, 8)},
+		{"*/15 * * * *", at(3, 15, 10, 15)},
+		{"7 * * * *", at(3, 15, 11, 7)},
+		{"@hourly", at(3, 15, 11, 0)},
+		{"@daily", at(3, 16, 0, 0)},
+		{"@weekly", at(3, 17, 0, 0)},
+		{"@monthly", at(4, 1, 0, 0)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", at(3, 18, 9, 0)},
+		{"0 0 * * 7", at(3, 17, 0, 0)},
+		{"30 8 29 2 *", time.Date(2028, 2, 29, 8, 30, 0, 0, time.UTC)},
+		// Both days restricted: the 1st or a Monday, whichever is first.
+		{"0 0 1 * 1", at(3, 18, 0, 0)},
+		// One day restricted: Mondays in April only.
+		{"0 0 * 4 1", at(4, 1, 0, 0)},
+		{"@every 90s", from.Add(90 * time.Second)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.next(from); !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package pushpop
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// EventReconnect advises a client to reconnect, usually to another node.
+const EventReconnect = "pushpop:reconnect"
+
+// DrainOptions configures Drain.
+type DrainOptions struct {
+	// Target is the host clients should reconnect to. Empty means the same
+	// address, e.g. behind a load balancer.
+	Target string `json:"target,omitempty"`
+	// Jitter is the window over which clients should spread their
+	// reconnects.
+	Jitter time.Duration `json:"jitter"`
+	// Period is how long to take closing existing connections. Zero closes
+	// them all at once.
+	Period time.Duration `json:"period"`
+}
+
+// Drain puts the hub in maintenance mode for a rolling restart: new
+// connections are refused, every client is sent an EventReconnect advisory
+// with the target and jitter window, and existing connections are closed
+// gradually over opts.Period. It returns immediately; calling it again
+// restarts the drain with the new options.
+func (h *Hub) Drain(opts DrainOptions) {
+	h.lifecycleMu.Lock()
+	if h.stopDrain != nil {
+		h.stopDrain()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.stopDrain = cancel
+	h.lifecycleMu.Unlock()
+
+	h.draining.Store(true)
+	h.log.Info("Draining connections", "target", opts.Target, "period", opts.Period)
+
+	var clients []*Client
+	h.clients.Range(func(key, _ interface{}) bool {
+		clients = append(clients, key.(*Client))
+		return true
+	})
+	advice := map[string]interface{}{
+		"target": opts.Target,
+		"jitter": opts.Jitter.Seconds(),
+	}
+	for _, client := range clients {
+		h.sendControl(client, Message{Event: EventReconnect, Payload: advice, Priority: PriorityHigh})
+	}
+
+	go func() {
+		var interval time.Duration
+		if len(clients) > 0 {
+			interval = opts.Period / time.Duration(len(clients))
+		}
+		// Closing in random order keeps reconnect load even across nodes.
+		rand.Shuffle(len(clients), func(i, j int) { clients[i], clients[j] = clients[j], clients[i] })
+		for _, client := range clients {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			client.Close()
+		}
+	}()
+}
+
+// Resume ends a drain: new connections are accepted again and connections
+// not yet closed are kept.
+func (h *Hub) Resume() {
+	h.lifecycleMu.Lock()
+	if h.stopDrain != nil {
+		h.stopDrain()
+		h.stopDrain = nil
+	}
+	h.lifecycleMu.Unlock()
+	h.draining.Store(false)
+}
+
+// Draining reports whether the hub is draining.
+func (h *Hub) Draining() bool {
+	return h.draining.Load()
+}
+
+// accepting reports whether new connections are accepted.
+func (h *Hub) accepting() bool {
+	return !h.closing.Load() && !h.draining.Load()
+}
+
+// handleAdminDrain starts a drain. The optional body sets the options, with
+// durations written like "30s".
+func (h *Hub) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Target string `json:"target"`
+		Jitter string `json:"jitter"`
+		Period string `json:"period"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+			return
+		}
+	}
+	opts := DrainOptions{Target: body.Target}
+	for _, field := range []struct {
+		value string
+		dst   *time.Duration
+	}{{body.Jitter, &opts.Jitter}, {body.Period, &opts.Period}} {
+		if field.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(field.value)
+		if err != nil {
+			http.Error(w, "Invalid Duration", http.StatusBadRequest)
+			return
+		}
+		*field.dst = d
+	}
+	h.Drain(opts)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleAdminResume ends a drain.
+func (h *Hub) handleAdminResume(w http.ResponseWriter, r *http.Request) {
+	h.Resume()
+	w.WriteHeader(http.StatusNoContent)
+}
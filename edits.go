@@ -0,0 +1,95 @@
+package pushpop
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Edit events. Publishing one on a channel updates or tombstones the
+// history entry with the envelope ID in its MessageEdit payload, and
+// subscribers receive it to update what they display.
+const (
+	EventMessageEdited  = "pushpop:message_edited"
+	EventMessageDeleted = "pushpop:message_deleted"
+)
+
+// MessageEdit is the payload of edit events.
+type MessageEdit struct {
+	// ID is the envelope ID of the edited or deleted message.
+	ID string `json:"id"`
+	// Payload replaces the message's payload for EventMessageEdited.
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// EditMessage replaces the payload of the message with envelope ID id on
+// channel, in history and for subscribers, e.g. after a user edits a chat
+// message.
+func (h *Hub) EditMessage(channel, id string, payload interface{}) {
+	h.Trigger(Message{Channel: channel, Event: EventMessageEdited, Payload: MessageEdit{ID: id, Payload: payload}})
+}
+
+// DeleteMessage tombstones the message with envelope ID id on channel, so
+// history fetches return it without its payload and catch-up skips it,
+// e.g. after moderation.
+func (h *Hub) DeleteMessage(channel, id string) {
+	h.Trigger(Message{Channel: channel, Event: EventMessageDeleted, Payload: MessageEdit{ID: id}})
+}
+
+// isEdit reports whether message is an edit event.
+func isEdit(message Message) bool {
+	return message.Event == EventMessageEdited || message.Event == EventMessageDeleted
+}
+
+// decodeEdit returns the MessageEdit payload of an edit event, whether it
+// was published from Go or decoded from JSON.
+func decodeEdit(payload interface{}) (MessageEdit, bool) {
+	if edit, ok := payload.(MessageEdit); ok {
+		return edit, edit.ID != ""
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return MessageEdit{}, false
+	}
+	var edit MessageEdit
+	if err := json.Unmarshal(data, &edit); err != nil {
+		return MessageEdit{}, false
+	}
+	return edit, edit.ID != ""
+}
+
+// amend applies an edit event to the history of channel. Entries stay in
+// place, and deleted messages leave a tombstone, so readers paging through
+// history see that they existed.
+func (s *historyStore) amend(channel string, edit MessageEdit, deleted bool, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history, ok := s.channels[channel]
+	if !ok {
+		return false
+	}
+	for i := len(history.messages) - 1; i >= 0; i-- {
+		stored := &history.messages[i]
+		if stored.Envelope == nil || stored.Envelope.ID != edit.ID {
+			continue
+		}
+		if stored.Deleted {
+			return false
+		}
+		history.bytes -= stored.size
+		if deleted {
+			stored.Deleted = true
+			stored.Payload = nil
+			stored.size = 0
+		} else {
+			stored.EditedAt = &now
+			stored.Payload = edit.Payload
+			if stored.size > 0 {
+				data, _ := json.Marshal(edit.Payload)
+				stored.size = len(data)
+			}
+		}
+		history.bytes += stored.size
+		return true
+	}
+	return false
+}
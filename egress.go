@@ -0,0 +1,221 @@
+package pushpop
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// egressQueueSize bounds the messages waiting to be routed to their
+	// webhook, and those waiting to be POSTed to each webhook.
+	egressQueueSize = 1000
+	// egressIdle is how long a webhook's goroutine waits for messages
+	// before it exits.
+	egressIdle = time.Minute
+	// egressTimeout bounds each webhook request.
+	egressTimeout = 10 * time.Second
+	// egressMaxBackoff caps the delay between attempts.
+	egressMaxBackoff = time.Minute
+)
+
+// EgressWebhook POSTs every message published on a channel to an HTTP
+// endpoint, so backend services can consume it without holding a
+// WebSocket. The body is the message as JSON, as it was published, before
+// any transform:
+//
+//	{"channel": "orders", "event": "created", "payload": {...}, "envelope": {"id": "...", ...}}
+//
+// Requests carry the Pushpop-Message-Id and Pushpop-Delivery-Attempt
+// headers, and with a Secret a Pushpop-Signature header of the form
+// "t=<unix time>,v1=<hex HMAC-SHA256 of the time, '.', and the body>";
+// see EgressVerifier. Messages arriving from other nodes over the broker
+// are POSTed by the node that accepted them.
+type EgressWebhook struct {
+	URL string `json:"url"`
+	// Secret is left out of the settings the admin API reports.
+	Secret string `json:"secret,omitempty"`
+	// MaxAttempts bounds the deliveries of a message. Network errors, 429,
+	// and 5xx answers are retried with exponential backoff. Defaults to 5.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
+// egressDelivery is a message queued for a webhook.
+type egressDelivery struct {
+	webhook EgressWebhook
+	message Message
+}
+
+// egress queues a published message for its channel's webhook, if any. It
+// runs on the Run goroutine.
+func (h *Hub) egress(message Message) {
+	if message.Channel == "" || message.SocketID != "" || message.Replayed {
+		return
+	}
+	webhook := h.settingsFor(message.Channel).Webhook
+	if webhook == nil || webhook.URL == "" {
+		return
+	}
+	message.fanout = nil
+	message.peer = nil
+	select {
+	case h.egressQueue <- egressDelivery{webhook: *webhook, message: message}:
+	default:
+		h.log.Warn("Webhook queue full, message not delivered", "channel", message.Channel, "url", webhook.URL)
+	}
+}
+
+// runEgress routes queued messages to a queue per webhook URL, each
+// POSTed in order by its own goroutine, so a slow or failing endpoint only
+// delays and drops its own messages. Messages still queued or being
+// retried when ctx is cancelled are dropped.
+func (h *Hub) runEgress(ctx context.Context) {
+	client := &http.Client{Timeout: egressTimeout}
+	queues := make(map[string]chan egressDelivery)
+	idle := make(chan string)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	start := func(url string, queue chan egressDelivery) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.runEgressEndpoint(ctx, client, url, queue, idle)
+		}()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery := <-h.egressQueue:
+			url := delivery.webhook.URL
+			queue, ok := queues[url]
+			if !ok {
+				queue = make(chan egressDelivery, egressQueueSize)
+				queues[url] = queue
+				start(url, queue)
+			}
+			select {
+			case queue <- delivery:
+			default:
+				h.log.Warn("Webhook queue full, message not delivered", "channel", delivery.message.Channel, "url", url)
+			}
+		case url := <-idle:
+			// Only this goroutine adds to the queue, so it is safe to drop
+			// once empty; otherwise messages arrived as the endpoint's
+			// goroutine was exiting.
+			if queue := queues[url]; len(queue) > 0 {
+				start(url, queue)
+			} else {
+				delete(queues, url)
+			}
+		}
+	}
+}
+
+// runEgressEndpoint POSTs the messages queued for one webhook URL until ctx
+// is cancelled, or until the queue has stayed empty for egressIdle, when
+// it reports url on idle.
+func (h *Hub) runEgressEndpoint(ctx context.Context, client *http.Client, url string, queue <-chan egressDelivery, idle chan<- string) {
+	timer := time.NewTimer(egressIdle)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery := <-queue:
+			h.deliverEgress(ctx, client, delivery)
+			timer.Reset(egressIdle)
+		case <-timer.C:
+			select {
+			case idle <- url:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}
+}
+
+// deliverEgress POSTs a message to a webhook, retrying failed attempts.
+func (h *Hub) deliverEgress(ctx context.Context, client *http.Client, delivery egressDelivery) {
+	body, err := json.Marshal(delivery.message)
+	if err != nil {
+		h.log.Error("Failed to encode webhook message", "channel", delivery.message.Channel, "err", err)
+		return
+	}
+	attempts := delivery.webhook.MaxAttempts
+	if attempts <= 0 {
+		attempts = 5
+	}
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		retry, err := postEgress(ctx, client, delivery, body, attempt)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= attempts {
+			h.log.Warn("Webhook delivery failed", "channel", delivery.message.Channel, "url", delivery.webhook.URL, "attempts", attempt, "err", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, egressMaxBackoff)
+	}
+}
+
+// postEgress makes one webhook request, and reports whether a failure may
+// be retried.
+func postEgress(ctx context.Context, client *http.Client, delivery egressDelivery, body []byte, attempt int) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if envelope := delivery.message.Envelope; envelope != nil {
+		req.Header.Set("Pushpop-Message-Id", envelope.ID)
+	}
+	req.Header.Set("Pushpop-Delivery-Attempt", strconv.Itoa(attempt))
+	if secret := delivery.webhook.Secret; secret != "" {
+		req.Header.Set("Pushpop-Signature", signEgress([]byte(secret), time.Now(), body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// redacted returns settings without the webhook secret, for reporting
+// them over the admin API.
+func (s ChannelSettings) redacted() ChannelSettings {
+	if s.Webhook != nil && s.Webhook.Secret != "" {
+		webhook := *s.Webhook
+		webhook.Secret = ""
+		s.Webhook = &webhook
+	}
+	return s
+}
+
+// signEgress returns the Pushpop-Signature header of a body sent at t.
+func signEgress(secret []byte, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
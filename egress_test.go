@@ -0,0 +1,80 @@
+package pushpop
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestEgressIsolation checks that a failing webhook, whose deliveries are
+// retried with backoff, does not hold up another channel's webhook.
+func TestEgressIsolation(t *testing.T) {
+	var failed atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed.Add(1)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+	delivered := make(chan string, 1)
+	var signature string
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get("Pushpop-Signature")
+		delivered <- string(body)
+	}))
+	t.Cleanup(healthy.Close)
+
+	hub := newTestHub(t,
+		WithChannelDefaults("failing-", ChannelSettings{Webhook: &EgressWebhook{URL: failing.URL}}),
+		WithChannelDefaults("healthy-", ChannelSettings{Webhook: &EgressWebhook{URL: healthy.URL, Secret: "s3cret"}}),
+	)
+	for range 8 {
+		hub.Trigger(Message{Channel: "failing-orders", Event: "created", Payload: "x"})
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for failed.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	hub.Trigger(Message{Channel: "healthy-orders", Event: "created", Payload: "y"})
+
+	select {
+	case body := <-delivered:
+		r := webhook(body, http.Header{"Pushpop-Signature": {signature}})
+		if err := EgressVerifier("s3cret", 0).Verify(r, []byte(body)); err != nil {
+			t.Errorf("verify: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("healthy webhook was not called while another was failing")
+	}
+}
+
+func TestEgressSecretRedacted(t *testing.T) {
+	hub := newTestHub(t)
+	admin := HandleAdmin(hub)
+	body := `{"webhook": {"url": "https://billing.internal/pushpop", "secret": "s3cret"}}`
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/admin/channels/orders", strings.NewReader(body)),
+		httptest.NewRequest(http.MethodGet, "/admin/channels/orders", nil),
+	} {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", r.Method, w.Code, w.Body)
+		}
+		if strings.Contains(w.Body.String(), "s3cret") {
+			t.Errorf("%s: secret reported: %s", r.Method, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), "billing.internal") {
+			t.Errorf("%s: got %s", r.Method, w.Body)
+		}
+	}
+
+	// The hub still signs with it.
+	if settings, _ := hub.ChannelSettings("orders"); settings.Webhook == nil || settings.Webhook.Secret != "s3cret" {
+		t.Errorf("got settings %+v", settings)
+	}
+}
@@ -0,0 +1,142 @@
+package pushpop
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedMagic starts data encrypted by a Keyring, so data written
+// before encryption was turned on is still read.
+var encryptedMagic = []byte("PPENC1")
+
+// ErrUnknownKey is returned by Keyring.Decrypt for data encrypted with a
+// key the keyring does not hold.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring encrypts payloads at rest with AES-GCM, for stores such as
+// FileScheduleStore and archive files. Each key has an ID that is written
+// with the data it encrypts: new data is encrypted with the primary key,
+// and data encrypted with any key of the keyring can be read. To rotate,
+// add a new primary key and keep the old ones until the data encrypted
+// with them has been rewritten or expired.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring returns a keyring that encrypts with the key named primary.
+// Keys are 16, 24, or 32 bytes, for AES-128, AES-192, or AES-256.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 || strings.ContainsAny(id, ":,") {
+			return nil, fmt.Errorf("invalid encryption key ID %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[primary]; !ok {
+		return nil, fmt.Errorf("primary encryption key %q not found", primary)
+	}
+	return k, nil
+}
+
+// ParseKeyring parses a keyring from a comma-separated list of
+// "<id>:<base64 key>" entries, e.g. the server binary's ENCRYPTION_KEYS.
+// The first entry is the primary key.
+func ParseKeyring(spec string) (*Keyring, error) {
+	var primary string
+	keys := make(map[string][]byte)
+	for i, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Errors name the entry by position, not content, so they do not
+		// leak keys into logs.
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("encryption key %d is not <id>:<base64 key>", i+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("duplicate encryption key ID %q", id)
+		}
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+	if primary == "" {
+		return nil, errors.New("no encryption keys")
+	}
+	return NewKeyring(primary, keys)
+}
+
+// Encrypt encrypts plaintext with the primary key. A nil keyring returns
+// plaintext unchanged.
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+	aead := k.keys[k.primary]
+	out := make([]byte, 0, len(encryptedMagic)+1+len(k.primary)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, byte(len(k.primary)))
+	out = append(out, k.primary...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	// The key ID is authenticated, so it cannot be swapped for another.
+	return aead.Seal(out, nonce, plaintext, []byte(k.primary)), nil
+}
+
+// Decrypt decrypts data written by Encrypt with any key of the keyring.
+// Data that was not encrypted is returned unchanged, so stores written
+// before encryption was turned on stay readable.
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	if !Encrypted(data) {
+		return data, nil
+	}
+	rest := data[len(encryptedMagic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return nil, errors.New("truncated encrypted data")
+	}
+	id := string(rest[1 : 1+rest[0]])
+	rest = rest[1+len(id):]
+	if k == nil {
+		return nil, fmt.Errorf("%w %q: no keyring", ErrUnknownKey, id)
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("truncated encrypted data")
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(id))
+}
+
+// Encrypted reports whether data was written by Keyring.Encrypt.
+func Encrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
@@ -0,0 +1,128 @@
+package pushpop
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// testKey returns a 32-byte key filled with b.
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestKeyring(t *testing.T) {
+	old, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewKeyring("k1", map[string][]byte{"k1": testKey(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte(`{"channel": "orders", "data": "paid"}`)
+	sealed, err := old.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Encrypted(sealed) || bytes.Contains(sealed, plaintext) {
+		t.Fatalf("Encrypt returned %q", sealed)
+	}
+	resealed, err := rotated.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	// Renaming k1 to k2, which the rotated keyring also holds, must fail
+	// too, as the key ID is authenticated.
+	renamed := bytes.Clone(sealed)
+	renamed[len(encryptedMagic)+2] = '2'
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		data    []byte
+		want    []byte
+		// err, if set, is the error wanted when want is nil.
+		err error
+	}{
+		{"valid", old, sealed, plaintext, nil},
+		{"rotated keyring reads old data", rotated, sealed, plaintext, nil},
+		{"rotated keyring reads new data", rotated, resealed, plaintext, nil},
+		{"old keyring does not read new data", old, resealed, nil, ErrUnknownKey},
+		{"wrong key", other, sealed, nil, nil},
+		{"tampered ciphertext", old, tampered, nil, nil},
+		{"tampered key ID", rotated, renamed, nil, nil},
+		{"truncated", old, sealed[:len(encryptedMagic)+4], nil, nil},
+		{"nil keyring", nil, sealed, nil, ErrUnknownKey},
+		{"plaintext", old, plaintext, plaintext, nil},
+		{"plaintext without keyring", nil, plaintext, plaintext, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.keyring.Decrypt(tt.data)
+			if (err == nil) != (tt.want != nil) {
+				t.Fatalf("got error %v, want error: %v", err, tt.want == nil)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if first, _ := rotated.Encrypt(plaintext); bytes.Equal(first, resealed) {
+		t.Error("Encrypt reused a nonce")
+	}
+	if got, err := (*Keyring)(nil).Encrypt(plaintext); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("nil keyring encrypted to %q, %v", got, err)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	encode := base64.StdEncoding.EncodeToString
+	tests := []struct {
+		name    string
+		spec    string
+		primary string
+		valid   bool
+	}{
+		{"single key", "k1:" + encode(testKey(1)), "k1", true},
+		{"first key is primary", "k2:" + encode(testKey(2)) + ", k1:" + encode(testKey(1)), "k2", true},
+		{"AES-128", "k1:" + encode(testKey(1)[:16]), "k1", true},
+		{"empty", "", "", false},
+		{"only separators", " , ", "", false},
+		{"missing ID", encode(testKey(1)), "", false},
+		{"empty ID", ":" + encode(testKey(1)), "", false},
+		{"empty key", "k1:", "", false},
+		{"bad base64", "k1:not base64!", "", false},
+		{"bad key length", "k1:" + encode(testKey(1)[:20]), "", false},
+		{"duplicate ID", "k1:" + encode(testKey(1)) + ",k1:" + encode(testKey(2)), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring, err := ParseKeyring(tt.spec)
+			if !tt.valid {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keyring.primary != tt.primary {
+				t.Errorf("primary key %q, want %q", keyring.primary, tt.primary)
+			}
+		})
+	}
+}
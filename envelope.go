@@ -0,0 +1,95 @@
+package pushpop
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// OriginType is what published a message.
+type OriginType string
+
+// Message origins.
+const (
+	// OriginAPI is a producer calling /trigger.
+	OriginAPI OriginType = "api"
+	// OriginClient is a connected client; Origin.ID is its socket ID and
+	// Origin.User its user ID, if it has one.
+	OriginClient OriginType = "client"
+	// OriginWebhook is an ingested webhook; Origin.ID is its source.
+	OriginWebhook OriginType = "webhook"
+	// OriginBridge is a bridge to another messaging system; Origin.ID is
+	// the bridge's name.
+	OriginBridge OriginType = "bridge"
+	// OriginServer is the application calling Trigger, or the hub itself,
+	// e.g. for presence events.
+	OriginServer OriginType = "server"
+)
+
+// Origin identifies the publisher of a message.
+type Origin struct {
+	Type OriginType `json:"type"`
+	ID   string     `json:"id,omitempty"`
+	// User is the user ID of the client that published the message, so
+	// stored messages can be found by their sender, e.g. by PurgeUser.
+	User string `json:"user,omitempty"`
+}
+
+// Envelope is the metadata the hub stamps on every broadcast. It is sent
+// to clients, kept in history, and relayed to other nodes with the message.
+type Envelope struct {
+	// ID is a ULID, unique across nodes and sortable by time.
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Origin    Origin    `json:"origin"`
+}
+
+// stamp returns message with a complete envelope. A preset envelope keeps
+// its fields; a missing ID or timestamp is generated and a missing origin
+// is origin. The envelope is copied, so callers may reuse theirs.
+func stamp(message Message, origin Origin) Message {
+	envelope := Envelope{Origin: origin}
+	if message.Envelope != nil {
+		envelope = *message.Envelope
+		if envelope.Origin.Type == "" {
+			envelope.Origin = origin
+		}
+	}
+	if envelope.Timestamp.IsZero() {
+		envelope.Timestamp = time.Now()
+	}
+	if envelope.ID == "" {
+		envelope.ID = newULID(envelope.Timestamp)
+	}
+	message.Envelope = &envelope
+	return message
+}
+
+// NewMessageID returns a new envelope ID. Preset it on a message's Envelope
+// before Trigger to know the ID, e.g. to look up its delivery receipt.
+func NewMessageID() string {
+	return newULID(time.Now())
+}
+
+// crockford is the Crockford base32 alphabet ULIDs are written in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID for t: 48 bits of milliseconds followed by 80
+// random bits, as 26 characters.
+func newULID(t time.Time) string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(t.UnixMilli())<<16)
+	_, _ = rand.Read(id[6:])
+
+	// 128 bits are written as 26 characters of 5 bits, the first holding
+	// only the top 3 bits.
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
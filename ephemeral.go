@@ -0,0 +1,20 @@
+package pushpop
+
+// TriggerEphemeral sends a transient event, such as a typing indicator or a
+// cursor position, to a channel's subscribers. Ephemeral messages are never
+// buffered for recovery, and a subscriber whose send buffer is full simply
+// misses them instead of being disconnected as a slow consumer.
+func (h *Hub) TriggerEphemeral(channel, event string, payload interface{}) {
+	h.Trigger(Message{Channel: channel, Event: event, Payload: payload, Ephemeral: true})
+}
+
+// Typing announces that user started or stopped typing on channel.
+func (h *Hub) Typing(channel, user string, typing bool) {
+	h.TriggerEphemeral(channel, "typing", map[string]interface{}{"user": user, "typing": typing})
+}
+
+// Cursor shares user's cursor position on channel. position is any JSON
+// encodable value, e.g. {"x": 10, "y": 20}.
+func (h *Hub) Cursor(channel, user string, position interface{}) {
+	h.TriggerEphemeral(channel, "cursor", map[string]interface{}{"user": user, "position": position})
+}
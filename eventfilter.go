@@ -0,0 +1,62 @@
+package pushpop
+
+import (
+	"sort"
+	"strings"
+)
+
+// eventFilter is the set of events a subscription receives, or nil for
+// every event. Events of the pushpop: namespace, such as presence changes,
+// always pass.
+type eventFilter map[string]bool
+
+func newEventFilter(events []string) eventFilter {
+	if len(events) == 0 {
+		return nil
+	}
+	filter := make(eventFilter, len(events))
+	for _, event := range events {
+		filter[event] = true
+	}
+	return filter
+}
+
+// allows reports whether the subscription receives event.
+func (f eventFilter) allows(event string) bool {
+	return f == nil || f[event] || strings.HasPrefix(event, "pushpop:")
+}
+
+// events lists the filter's events in order, or nil for every event.
+func (f eventFilter) events() []string {
+	if f == nil {
+		return nil
+	}
+	events := make([]string, 0, len(f))
+	for event := range f {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+// frameEvents reads the events list of a subscribe frame.
+func frameEvents(frame *Frame) []string {
+	list, _ := frame.Fields["events"].([]interface{})
+	events := make([]string, 0, len(list))
+	for _, v := range list {
+		if event, ok := v.(string); ok && event != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// refilter replaces the event filter, and the name, of an existing
+// subscription. It runs on the Run goroutine.
+func (h *Hub) refilter(sub *Subscription) {
+	m := sub.membership()
+	sub.Client.channels.Store(sub.Channel, m)
+	if val, ok := h.channels.Load(sub.Channel); ok {
+		val.(*channelState).clients.Store(sub.Client, m)
+	}
+}
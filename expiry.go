@@ -0,0 +1,81 @@
+package pushpop
+
+import "time"
+
+// channelExpiryInterval is how often Run looks for expired channels.
+const channelExpiryInterval = time.Second
+
+// EventChannelExpired is the terminal event of a channel whose lifetime has
+// elapsed; its subscribers are unsubscribed right after it.
+const EventChannelExpired = "pushpop:channel_expired"
+
+// ChannelExpired is the payload of EventChannelExpired.
+type ChannelExpired struct {
+	Channel   string    `json:"channel"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+// expiresAt applies the Lifetime of settings configured at now.
+func (s *ChannelSettings) expiresAt(now time.Time) {
+	if s.Lifetime > 0 && s.ExpiresAt == nil {
+		at := now.Add(s.Lifetime)
+		s.ExpiresAt = &at
+	}
+}
+
+// expiredChannels returns the channels configured by name whose lifetime
+// has elapsed at now.
+func (r *channelRegistry) expiredChannels(now time.Time) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var expired []string
+	for name, settings := range r.settings {
+		if settings.ExpiresAt != nil && !settings.ExpiresAt.After(now) {
+			expired = append(expired, name)
+		}
+	}
+	return expired
+}
+
+// expireChannels tears down the channels whose lifetime has elapsed: their
+// subscribers receive EventChannelExpired and are unsubscribed, and their
+// history, read positions, settings, and declaration are deleted. It runs
+// on the Run goroutine.
+func (h *Hub) expireChannels(now time.Time) {
+	for _, name := range h.registry.expiredChannels(now) {
+		if val, ok := h.channels.Load(name); ok {
+			state := val.(*channelState)
+			notice := Message{
+				Channel:  name,
+				Event:    EventChannelExpired,
+				Payload:  ChannelExpired{Channel: name, ExpiredAt: now},
+				Priority: PriorityHigh,
+			}
+			var clients []*Client
+			state.clients.Range(func(key, _ interface{}) bool {
+				client := key.(*Client)
+				h.sendControl(client, notice)
+				clients = append(clients, client)
+				return true
+			})
+			for _, client := range clients {
+				h.removeSubscription(&Subscription{Client: client, Channel: name})
+			}
+		}
+		h.history.drop(name)
+
+		h.registry.mu.Lock()
+		delete(h.registry.settings, name)
+		delete(h.registry.declared, name)
+		h.registry.mu.Unlock()
+		h.resetLimiter(name)
+		h.log.Info("Channel expired", "channel", name)
+	}
+}
+
+// drop deletes the history and read positions of channel.
+func (s *historyStore) drop(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels, channel)
+}
@@ -0,0 +1,137 @@
+package pushpop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reasons a message was not enqueued to a subscriber.
+const (
+	// FailureFiltered means an interceptor dropped the message.
+	FailureFiltered = "filtered"
+	// FailureDropped means the subscriber's buffer was full and the
+	// ephemeral message was dropped.
+	FailureDropped = "dropped"
+	// FailureEvicted means the subscriber's buffer was full and it was
+	// disconnected as a slow consumer.
+	FailureEvicted = "evicted"
+	// FailureDisconnected means the subscriber was already leaving.
+	FailureDisconnected = "disconnected"
+	// FailureQuota means the subscriber's tenant is over its quota.
+	FailureQuota = "quota"
+)
+
+// Trigger wait timeouts. The default matches the trigger queue timeout.
+const (
+	defaultTriggerTimeout = 5 * time.Second
+	maxTriggerTimeout     = 30 * time.Second
+)
+
+// Fanout reports how many subscribers on this node a triggered message was
+// enqueued to. Subscribers on other nodes of a cluster are not counted.
+type Fanout struct {
+	Subscribers int            `json:"subscribers"`
+	Channels    map[string]int `json:"channels"`
+	// Failures lists the subscribers the message was not enqueued to.
+	// Only ?wait=enqueue reports them.
+	Failures []DeliveryFailure `json:"failures,omitempty"`
+	// Pending lists the channels not confirmed before the timeout.
+	Pending []string `json:"pending,omitempty"`
+}
+
+// DeliveryFailure describes a subscriber a message was not enqueued to.
+type DeliveryFailure struct {
+	Channel  string `json:"channel"`
+	SocketID string `json:"socket_id"`
+	UserID   string `json:"user_id,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// deliveryReport is the local delivery result of a broadcast.
+type deliveryReport struct {
+	enqueued int
+	failures []DeliveryFailure
+}
+
+// triggerRequest is the body of a trigger. Channels publishes the same
+// event to several channels; otherwise the message's channel is used.
+type triggerRequest struct {
+	Message
+	Channels []string `json:"channels,omitempty"`
+	// DeliverAt or Delay, a duration like "10m", schedule the message for
+	// later; see Hub.Schedule.
+	DeliverAt *time.Time `json:"deliver_at,omitempty"`
+	Delay     string     `json:"delay,omitempty"`
+}
+
+// deliverAt returns when a scheduled trigger is due, and false for
+// triggers to publish now.
+func (t triggerRequest) deliverAt(now time.Time) (time.Time, bool, error) {
+	switch {
+	case t.DeliverAt != nil && t.Delay != "":
+		return time.Time{}, false, errors.New("deliver_at and delay are exclusive")
+	case t.DeliverAt != nil:
+		return *t.DeliverAt, true, nil
+	case t.Delay != "":
+		delay, err := time.ParseDuration(t.Delay)
+		if err != nil || delay < 0 {
+			return time.Time{}, false, fmt.Errorf("invalid delay %q", t.Delay)
+		}
+		return now.Add(delay), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// channels lists the channels the trigger publishes to.
+func (t triggerRequest) channels() []string {
+	if len(t.Channels) > 0 {
+		return t.Channels
+	}
+	return []string{t.Channel}
+}
+
+// triggerMessage admits and broadcasts message. With report set it waits
+// for Run to deliver the message and returns the delivery results.
+// Messages sampled or queued by a rate limit report nothing.
+func (h *Hub) triggerMessage(ctx context.Context, message Message, report bool) (deliveryReport, error) {
+	message.Channel = h.resolveChannel(message.Channel)
+	message = stamp(message, Origin{Type: OriginServer})
+	send, err := h.admit(message)
+	if err != nil || !send {
+		return deliveryReport{}, err
+	}
+
+	var fanout chan deliveryReport
+	if report {
+		fanout = make(chan deliveryReport, 1)
+		message.fanout = fanout
+	}
+	select {
+	case <-ctx.Done():
+		return deliveryReport{}, ctx.Err()
+	case <-h.stopped():
+		return deliveryReport{}, errHubStopped
+	case h.broadcast <- message:
+	}
+	if !report {
+		return deliveryReport{}, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return deliveryReport{}, ctx.Err()
+	case result := <-fanout:
+		return result, nil
+	}
+}
+
+// triggerTimeout parses the ?timeout of a waiting trigger.
+func triggerTimeout(value string) time.Duration {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return defaultTriggerTimeout
+	}
+	return min(timeout, maxTriggerTimeout)
+}
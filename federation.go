@@ -0,0 +1,306 @@
+package pushpop
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// federationQueueSize bounds the messages waiting to be sent to a peer.
+	federationQueueSize = 1000
+	// federationDedupeWindow is how long relayed message IDs are
+	// remembered, so a message looping between peers is dropped.
+	federationDedupeWindow = time.Minute
+	// federationMaxBackoff caps the delay between reconnects to the
+	// upstream.
+	federationMaxBackoff = 30 * time.Second
+)
+
+// FederationConfig connects a hub to an upstream hub, mirroring the
+// channels with the given prefixes in both directions, e.g. between
+// regions that share no broker.
+type FederationConfig struct {
+	// Upstream is the WebSocket URL of the upstream's federation endpoint,
+	// e.g. "wss://eu.example.com/federation".
+	Upstream string
+	// Prefixes selects the mirrored channels; "" mirrors every channel.
+	Prefixes []string
+	// Token is the upstream's admin token or an admin API key of it.
+	Token string
+}
+
+// WithFederation connects the hub to an upstream hub while it runs. The
+// upstream serves HandleFederation, and is reconnected to with backoff.
+func WithFederation(config FederationConfig) Option {
+	return func(h *Hub) {
+		h.federation.upstream = &config
+	}
+}
+
+// federationHello is the first frame a peer sends, naming the prefixes it
+// mirrors.
+type federationHello struct {
+	Prefixes []string `json:"prefixes"`
+}
+
+// federation holds the links to federated hubs: the upstream, if any, and
+// the downstream hubs connected to this one.
+type federation struct {
+	upstream *FederationConfig
+
+	mu    sync.Mutex
+	links map[*federationLink]bool
+	// seen holds the envelope IDs of messages relayed in either
+	// direction.
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newFederation() *federation {
+	return &federation{links: make(map[*federationLink]bool), seen: make(map[string]time.Time)}
+}
+
+// federationLink is a connection to a federated hub.
+type federationLink struct {
+	peer     string
+	prefixes []string
+	send     chan Message
+}
+
+// mirrors reports whether channel is mirrored over the link.
+func (l *federationLink) mirrors(channel string) bool {
+	for _, prefix := range l.prefixes {
+		if strings.HasPrefix(channel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// witness records a relayed message and reports whether it was new. Callers
+// hold mu.
+func (f *federation) witness(id string, now time.Time) bool {
+	if now.Sub(f.lastPrune) > federationDedupeWindow {
+		for old, at := range f.seen {
+			if now.Sub(at) > federationDedupeWindow {
+				delete(f.seen, old)
+			}
+		}
+		f.lastPrune = now
+	}
+	if _, ok := f.seen[id]; ok {
+		return false
+	}
+	f.seen[id] = now
+	return true
+}
+
+// forward queues a broadcast to the peers mirroring its channel, other than
+// the one it came from. It runs on the Run goroutine.
+func (h *Hub) forward(message Message) {
+	if message.Channel == "" || message.SocketID != "" || message.Replayed || message.Envelope == nil {
+		return
+	}
+	from := message.peer
+	message.peer = nil
+	message.fanout = nil
+	f := h.federation
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.links) == 0 {
+		return
+	}
+	f.witness(message.Envelope.ID, time.Now())
+	for link := range f.links {
+		if link == from || !link.mirrors(message.Channel) {
+			continue
+		}
+		select {
+		case link.send <- message:
+		default:
+			h.log.Warn("Federation queue full, message not relayed", "peer", link.peer, "channel", message.Channel)
+		}
+	}
+}
+
+// receive broadcasts a message from a peer, unless it was seen before.
+func (h *Hub) receive(ctx context.Context, link *federationLink, message Message) {
+	if message.Envelope == nil || message.SocketID != "" || !link.mirrors(message.Channel) {
+		return
+	}
+	f := h.federation
+	f.mu.Lock()
+	fresh := f.witness(message.Envelope.ID, time.Now())
+	f.mu.Unlock()
+	if !fresh || !h.channelAllowed(message.Channel) {
+		return
+	}
+	message.peer = link
+	select {
+	case h.broadcast <- message:
+	case <-ctx.Done():
+	}
+}
+
+// serveLink relays messages over a peer connection until it fails or ctx
+// is cancelled. keepalive sends pings; the other side answers them.
+func (h *Hub) serveLink(ctx context.Context, conn *websocket.Conn, link *federationLink, keepalive bool) error {
+	f := h.federation
+	f.mu.Lock()
+	f.links[link] = true
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.links, link)
+		f.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	extend := func(string) error { return conn.SetReadDeadline(time.Now().Add(pongWait)) }
+	if err := extend(""); err != nil {
+		return err
+	}
+	conn.SetPongHandler(extend)
+	conn.SetPingHandler(func(data string) error {
+		if err := extend(data); err != nil {
+			return err
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+	})
+
+	go func() {
+		defer cancel()
+		ticker := time.NewTicker(pongWait * 9 / 10)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message := <-link.send:
+				if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+					return
+				}
+				if err := conn.WriteJSON(message); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if !keepalive {
+					continue
+				}
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			return err
+		}
+		if err := extend(""); err != nil {
+			return err
+		}
+		h.receive(ctx, link, message)
+	}
+}
+
+// runFederation keeps the hub connected to its upstream until ctx is
+// cancelled.
+func (h *Hub) runFederation(ctx context.Context) {
+	config := h.federation.upstream
+	backoff := time.Second
+	for {
+		connected := time.Now()
+		err := h.federate(ctx, config)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(connected) > federationMaxBackoff {
+			backoff = time.Second
+		}
+		h.log.Warn("Federation link lost", "upstream", config.Upstream, "err", err, "retry", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, federationMaxBackoff)
+	}
+}
+
+// federate connects to the upstream once and relays messages until the
+// connection fails.
+func (h *Hub) federate(ctx context.Context, config *FederationConfig) error {
+	header := http.Header{}
+	if config.Token != "" {
+		header.Set("Authorization", "Bearer "+config.Token)
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, config.Upstream, header)
+	if err != nil {
+		return err
+	}
+	if err := conn.WriteJSON(federationHello{Prefixes: config.Prefixes}); err != nil {
+		conn.Close()
+		return err
+	}
+	h.log.Info("Federation link established", "upstream", config.Upstream)
+	link := &federationLink{peer: config.Upstream, prefixes: config.Prefixes, send: make(chan Message, federationQueueSize)}
+	return h.serveLink(ctx, conn, link, true)
+}
+
+// HandleFederation returns an HTTP handler that accepts downstream hubs
+// configured with WithFederation. Mount it on "/federation". Peers
+// authenticate with the admin token or an admin API key; without either
+// the endpoint is disabled.
+func HandleFederation(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hub.AdminSecured() {
+			http.Error(w, "Federation Disabled", http.StatusForbidden)
+			return
+		}
+		if !hub.adminBearer(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(writeWait)); err != nil {
+			conn.Close()
+			return
+		}
+		var hello federationHello
+		if err := conn.ReadJSON(&hello); err != nil {
+			conn.Close()
+			return
+		}
+		link := &federationLink{peer: r.RemoteAddr, prefixes: hello.Prefixes, send: make(chan Message, federationQueueSize)}
+		hub.log.Info("Federated hub connected", "peer", link.peer, "prefixes", hello.Prefixes)
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-hub.stopped():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		err = hub.serveLink(ctx, conn, link, false)
+		hub.log.Info("Federated hub disconnected", "peer", link.peer, "err", err)
+	}
+}
@@ -0,0 +1,118 @@
+package pushpop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// forwardAuthTimeout bounds the auth request unless another timeout is
+// given.
+const forwardAuthTimeout = 10 * time.Second
+
+var errForwardAuth = errors.New("forward auth failed")
+
+// ForwardAuthConfig delegates connection authentication to an external
+// service, the way Traefik's ForwardAuth and Caddy's forward_auth do.
+type ForwardAuthConfig struct {
+	// URL is the auth service's endpoint. It receives a GET with the
+	// headers of the upgrade request and X-Forwarded-Method, -Proto,
+	// -Host, -Uri, and -For describing it.
+	URL string
+	// ResponseHeaders lists the headers of a successful auth response
+	// copied into Session.Header, e.g. "X-Forwarded-User". Any values the
+	// client sent for them are removed first, so hooks can trust them.
+	ResponseHeaders []string
+	// UserHeader is the auth response header used as Session.UserID, e.g.
+	// "X-Forwarded-User" or "Remote-User".
+	UserHeader string
+	// Timeout bounds the auth request; defaults to 10s.
+	Timeout time.Duration
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// WithForwardAuth authenticates connections by calling an auth service
+// before upgrading. A 2xx response admits the connection; any other
+// response, or an unreachable service, refuses it with 403. Forward auth
+// runs before OIDC and the OnConnect hook, which see the identity it
+// returned.
+func WithForwardAuth(config ForwardAuthConfig) Option {
+	return func(h *Hub) {
+		if config.Timeout <= 0 {
+			config.Timeout = forwardAuthTimeout
+		}
+		if config.Client == nil {
+			config.Client = http.DefaultClient
+		}
+		h.forwardAuth = &forwardAuth{config: config}
+	}
+}
+
+// forwardAuth authenticates sessions against an auth service.
+type forwardAuth struct {
+	config ForwardAuthConfig
+}
+
+// authenticate asks the auth service about the session's upgrade request
+// and maps the identity it returns.
+func (f *forwardAuth) authenticate(session *Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), f.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.config.URL, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range session.Header {
+		if !strings.HasPrefix(name, "Sec-Websocket-") {
+			req.Header[name] = values
+		}
+	}
+	// The auth request is not itself an upgrade.
+	for _, name := range []string{"Connection", "Upgrade", "Content-Length"} {
+		req.Header.Del(name)
+	}
+	proto := "http"
+	if session.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Method", http.MethodGet)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", session.host)
+	req.Header.Set("X-Forwarded-Uri", session.uri)
+	if forwarded := session.Header.Get("X-Forwarded-For"); forwarded != "" {
+		req.Header.Set("X-Forwarded-For", forwarded+", "+session.RemoteIP)
+	} else {
+		req.Header.Set("X-Forwarded-For", session.RemoteIP)
+	}
+
+	resp, err := f.config.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errForwardAuth, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s", errForwardAuth, resp.Status)
+	}
+
+	if session.Header == nil {
+		session.Header = make(http.Header)
+	}
+	for _, name := range f.config.ResponseHeaders {
+		session.Header.Del(name)
+		for _, value := range resp.Header.Values(name) {
+			session.Header.Add(name, value)
+		}
+	}
+	if f.config.UserHeader != "" {
+		if user := resp.Header.Get(f.config.UserHeader); user != "" {
+			session.UserID = user
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package pushpop
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout bounds each dependency check.
+const healthCheckTimeout = 2 * time.Second
+
+// Health statuses.
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// Pinger is implemented by dependencies that can check their connectivity,
+// such as the Redis and NATS brokers. A Broker that implements Pinger is
+// checked by the readiness endpoint automatically.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthCheck is a dependency checked by the readiness endpoint.
+type HealthCheck struct {
+	Check func(ctx context.Context) error
+	// Optional dependencies only degrade readiness: the node keeps
+	// reporting ready while they fail.
+	Optional bool
+}
+
+// CheckResult is the outcome of a single dependency check.
+type CheckResult struct {
+	Status   string  `json:"status"`
+	Latency  float64 `json:"latency_ms"`
+	Error    string  `json:"error,omitempty"`
+	Optional bool    `json:"optional,omitempty"`
+}
+
+// Health is the readiness report of a hub.
+type Health struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// WithHealthCheck adds a dependency to the readiness checks.
+func WithHealthCheck(name string, check HealthCheck) Option {
+	return func(h *Hub) {
+		if h.healthChecks == nil {
+			h.healthChecks = make(map[string]HealthCheck)
+		}
+		h.healthChecks[name] = check
+	}
+}
+
+// checks returns the configured dependency checks, including the broker's.
+func (h *Hub) checks() map[string]HealthCheck {
+	checks := make(map[string]HealthCheck, len(h.healthChecks)+1)
+	if pinger, ok := h.broker.(Pinger); ok {
+		checks["broker"] = HealthCheck{Check: pinger.Ping}
+	}
+	for name, check := range h.healthChecks {
+		checks[name] = check
+	}
+	return checks
+}
+
+// Health runs every dependency check concurrently and reports the hub's
+// readiness. The hub is unavailable while it is draining or shutting down,
+// or when a required dependency fails, and degraded when an optional one
+// fails.
+func (h *Hub) Health(ctx context.Context) Health {
+	checks := h.checks()
+	health := Health{Status: HealthOK, Checks: make(map[string]CheckResult, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check.Check(ctx)
+			result := CheckResult{
+				Status:   HealthOK,
+				Latency:  float64(time.Since(start).Microseconds()) / 1000,
+				Optional: check.Optional,
+			}
+			if err != nil {
+				result.Status, result.Error = HealthUnavailable, err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			health.Checks[name] = result
+			switch {
+			case err == nil:
+			case !check.Optional:
+				health.Status = HealthUnavailable
+			case health.Status == HealthOK:
+				health.Status = HealthDegraded
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !h.accepting() {
+		health.Status = HealthUnavailable
+	}
+	return health
+}
+
+// HandleHealth returns a liveness handler. It reports 200 while the hub's
+// Run loop is running and 503 once it has stopped.
+func HandleHealth(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hub.stopped():
+			writeJSON(w, http.StatusServiceUnavailable, Health{Status: HealthUnavailable})
+		default:
+			writeJSON(w, http.StatusOK, Health{Status: HealthOK})
+		}
+	}
+}
+
+// HandleReady returns a readiness handler that runs the dependency checks
+// and reports their status and latency. It responds 503 when the hub is
+// unavailable, so load balancers stop routing new clients to the node.
+func HandleReady(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := hub.Health(r.Context())
+		status := http.StatusOK
+		if health.Status == HealthUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, health)
+	}
+}
@@ -0,0 +1,69 @@
+package pushpop
+
+import "time"
+
+// HeartbeatMode selects how connections are kept alive and how dead ones are
+// detected.
+type HeartbeatMode int
+
+const (
+	// HeartbeatProtocol sends WebSocket ping frames from the server and
+	// closes connections that stop answering them. It is the default.
+	HeartbeatProtocol HeartbeatMode = iota
+	// HeartbeatApp expects clients to send {"action":"ping"} at the
+	// advertised interval and closes connections that go quiet for longer
+	// than the idle timeout. It suits clients, such as browsers, that cannot
+	// observe protocol pings.
+	HeartbeatApp
+	// HeartbeatNone disables heartbeats and idle detection entirely.
+	HeartbeatNone
+)
+
+func (m HeartbeatMode) String() string {
+	switch m {
+	case HeartbeatApp:
+		return "app"
+	case HeartbeatNone:
+		return "none"
+	default:
+		return "protocol"
+	}
+}
+
+// ParseHeartbeatMode parses "protocol", "app", or "none".
+func ParseHeartbeatMode(s string) (HeartbeatMode, bool) {
+	switch s {
+	case "protocol":
+		return HeartbeatProtocol, true
+	case "app":
+		return HeartbeatApp, true
+	case "none":
+		return HeartbeatNone, true
+	}
+	return HeartbeatProtocol, false
+}
+
+// WithHeartbeat sets the heartbeat strategy. The heartbeat interval is 90%
+// of the idle timeout, see WithIdleTimeout, and is advertised to clients in
+// the connection_established payload.
+func WithHeartbeat(mode HeartbeatMode) Option {
+	return func(h *Hub) {
+		h.heartbeat = mode
+	}
+}
+
+// heartbeatInfo is the heartbeat advertised at connect time.
+func (c *Client) heartbeatInfo() map[string]interface{} {
+	info := map[string]interface{}{"mode": c.hub.heartbeat.String()}
+	if c.hub.heartbeat != HeartbeatNone {
+		info["interval"] = c.pingPeriod().Seconds()
+	}
+	return info
+}
+
+// refreshDeadline extends the read deadline by the idle timeout.
+func (c *Client) refreshDeadline(limiter readLimiter) {
+	if err := limiter.SetReadDeadline(time.Now().Add(c.idle())); err != nil {
+		c.log.Error("Error setting read deadline", "err", err)
+	}
+}
@@ -0,0 +1,364 @@
+package pushpop
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredMessage is a message kept in a channel's history.
+type StoredMessage struct {
+	// ID increases with every message stored on the channel.
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	Message
+	// EditedAt is when the payload was last replaced by an edit event.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// Deleted marks a tombstone left by a delete event; its payload is
+	// gone.
+	Deleted bool `json:"deleted,omitempty"`
+
+	// size is the encoded size of the payload, for byte retention.
+	size int
+}
+
+// retention bounds a channel's history. Zero fields are unbounded.
+type retention struct {
+	count int
+	age   time.Duration
+	bytes int
+}
+
+// evictions counts messages evicted from history by reason.
+type evictions struct {
+	count, age, bytes int
+}
+
+// channelHistory is the history of a single channel.
+type channelHistory struct {
+	seq      uint64
+	messages []StoredMessage
+	bytes    int
+	// reads are the read positions of the channel's members, by user ID.
+	reads map[string]ReadPosition
+}
+
+// evict drops the oldest messages until the history satisfies r.
+func (c *channelHistory) evict(r retention, now time.Time) evictions {
+	var evicted evictions
+	drop := 0
+	for drop < len(c.messages) {
+		message := c.messages[drop]
+		switch {
+		case r.count > 0 && len(c.messages)-drop > r.count:
+			evicted.count++
+		case r.age > 0 && now.Sub(message.Time) > r.age:
+			evicted.age++
+		case r.bytes > 0 && c.bytes > r.bytes:
+			evicted.bytes++
+		default:
+			c.messages = append(c.messages[:0:0], c.messages[drop:]...)
+			return evicted
+		}
+		c.bytes -= message.size
+		drop++
+	}
+	c.messages = nil
+	return evicted
+}
+
+// historyStore keeps the recent messages of channels with history
+// retention settings.
+type historyStore struct {
+	mu       sync.RWMutex
+	channels map[string]*channelHistory
+}
+
+func newHistoryStore() *historyStore {
+	return &historyStore{channels: make(map[string]*channelHistory)}
+}
+
+// append stores message and evicts what falls outside r.
+func (s *historyStore) append(message Message, r retention) evictions {
+	var size int
+	if r.bytes > 0 {
+		data, _ := json.Marshal(message.Payload)
+		size = len(data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history, ok := s.channels[message.Channel]
+	if !ok {
+		history = &channelHistory{}
+		s.channels[message.Channel] = history
+	}
+	history.seq++
+	now := time.Now()
+	history.messages = append(history.messages, StoredMessage{ID: history.seq, Time: now, Message: message, size: size})
+	history.bytes += size
+	return history.evict(r, now)
+}
+
+// prune applies the retention of every channel, as resolved by retain.
+func (s *historyStore) prune(retain func(channel string) retention, now time.Time) evictions {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total evictions
+	for channel, history := range s.channels {
+		evicted := history.evict(retain(channel), now)
+		total.count += evicted.count
+		total.age += evicted.age
+		total.bytes += evicted.bytes
+	}
+	return total
+}
+
+// sequences returns the last message ID of every channel.
+func (s *historyStore) sequences() map[string]uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sequences := make(map[string]uint64, len(s.channels))
+	for channel, history := range s.channels {
+		sequences[channel] = history.seq
+	}
+	return sequences
+}
+
+// restore continues every channel's message IDs from sequences.
+func (s *historyStore) restore(sequences map[string]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for channel, seq := range sequences {
+		history, ok := s.channels[channel]
+		if !ok {
+			history = &channelHistory{}
+			s.channels[channel] = history
+		}
+		history.seq = max(history.seq, seq)
+	}
+}
+
+// purge deletes the stored messages of the channels matching match, and
+// the messages clients of user published elsewhere, and returns how many
+// there were. Message IDs keep counting from where they were.
+func (s *historyStore) purge(match func(channel string) bool, user string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := 0
+	for channel, history := range s.channels {
+		if match(channel) {
+			purged += len(history.messages)
+			history.messages = nil
+			history.bytes = 0
+			continue
+		}
+		kept := history.messages[:0]
+		for _, stored := range history.messages {
+			if publishedBy(stored.Message, user) {
+				purged++
+				history.bytes -= stored.size
+				continue
+			}
+			kept = append(kept, stored)
+		}
+		clear(history.messages[len(kept):])
+		history.messages = kept
+	}
+	return purged
+}
+
+// publishedBy reports whether message was published by a client of user.
+func publishedBy(message Message, user string) bool {
+	return user != "" && message.Envelope != nil &&
+		message.Envelope.Origin.Type == OriginClient && message.Envelope.Origin.User == user
+}
+
+// size returns the number of stored messages.
+func (s *historyStore) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, history := range s.channels {
+		n += len(history.messages)
+	}
+	return n
+}
+
+// recent returns up to limit of the newest messages of channel, oldest
+// first. A limit of zero or less returns them all.
+func (s *historyStore) recent(channel string, limit int) []StoredMessage {
+	return s.before(channel, 0, limit)
+}
+
+// before is like recent but only considers messages with an ID lower than
+// before, unless before is zero.
+func (s *historyStore) before(channel string, before uint64, limit int) []StoredMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history, ok := s.channels[channel]
+	if !ok {
+		return nil
+	}
+	messages := history.messages
+	if before > 0 {
+		// IDs increase but may have gaps where PurgeUser removed
+		// messages, so the cut-off is searched for.
+		messages = messages[:sort.Search(len(messages), func(i int) bool { return messages[i].ID >= before })]
+	}
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return append([]StoredMessage(nil), messages...)
+}
+
+// retention resolves the history retention of channel. A channel keeps
+// history when any of its retention settings is set.
+func (h *Hub) retention(channel string) (retention, bool) {
+	settings := h.settingsFor(channel)
+	r := retention{
+		count: max(settings.HistorySize, settings.CatchUp),
+		age:   settings.HistoryTTL,
+		bytes: settings.HistoryMaxBytes,
+	}
+	return r, r != retention{}
+}
+
+// recordHistory stores message if its channel keeps history, or applies it
+// to the stored messages if it is an edit event. It runs on the Run
+// goroutine, so IDs follow delivery order. Replayed messages are already
+// stored, and the hub's other "pushpop:" events, such as presence joins
+// and leaves, describe the moment they are sent and are not stored.
+func (h *Hub) recordHistory(message Message) {
+	if message.Ephemeral || message.Replayed {
+		return
+	}
+	r, ok := h.retention(message.Channel)
+	if !ok {
+		return
+	}
+	if isEdit(message) {
+		if edit, ok := decodeEdit(message.Payload); ok {
+			h.history.amend(message.Channel, edit, message.Event == EventMessageDeleted, time.Now())
+		}
+		return
+	}
+	if strings.HasPrefix(message.Event, "pushpop:") {
+		return
+	}
+	h.metrics.historyEvicted(h.history.append(message, r))
+}
+
+// historyPruneInterval is how often expired history is pruned.
+const historyPruneInterval = 5 * time.Second
+
+// pruneHistory evicts expired history in the background until ctx is
+// cancelled, so age limits apply even to channels that go quiet.
+func (h *Hub) pruneHistory(ctx context.Context) {
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.metrics.historyEvicted(h.history.prune(func(channel string) retention {
+				r, _ := h.retention(channel)
+				return r
+			}, now))
+		}
+	}
+}
+
+// subscribe handles a client's subscribe request, delivering the channel's
+// catch-up messages once the subscription is in place and then the
+// acknowledgement. It runs on the Run goroutine, so no live message can
+// arrive ahead of the catch-up.
+func (h *Hub) subscribe(sub *Subscription) {
+	if _, ok := sub.Client.channels.Load(sub.Channel); ok {
+		// Repeated subscribes update the event filter and are acknowledged
+		// again.
+		h.refilter(sub)
+		h.acknowledgeSubscription(sub.Client, sub.name(), sub.Channel)
+		return
+	}
+	if !h.addSubscription(sub) {
+		return
+	}
+	if n := h.settingsFor(sub.Channel).CatchUp; n > 0 {
+		filter := newEventFilter(sub.Events)
+		for _, stored := range h.history.recent(sub.Channel, n) {
+			if stored.Deleted || !filter.allows(stored.Event) {
+				continue
+			}
+			message := stored.Message
+			message.Replayed = true
+			h.deliver(sub.Client, message)
+		}
+	}
+	h.acknowledgeSubscription(sub.Client, sub.name(), sub.Channel)
+}
+
+// History returns up to limit of the newest messages kept for channel,
+// oldest first. Channels keep history when their settings have a
+// HistorySize.
+func (h *Hub) History(channel string, limit int) []StoredMessage {
+	return h.history.recent(channel, limit)
+}
+
+// HistoryBefore is like History but returns messages older than the given
+// message ID, for paging backwards.
+func (h *Hub) HistoryBefore(channel string, before uint64, limit int) []StoredMessage {
+	return h.history.before(channel, before, limit)
+}
+
+// HandleHistory returns an HTTP handler that serves a channel's history as
+// JSON, so late-loading UIs can backfill over HTTP. Mount it on
+// "GET /channels/{name}/history". The limit query parameter caps the number
+// of messages (default 50, at most 1000) and before pages backwards from a
+// message ID. Requests are authorized with the same OnConnect and
+// OnSubscribe hooks as a WebSocket subscription.
+func HandleHistory(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channel := hub.resolveChannel(r.PathValue("name"))
+		session := newSession(r)
+		if err := hub.connect(session); err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err := hub.authorizeSubscribe(session, channel); err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		limit := 50
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid Limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, 1000)
+		}
+		var before uint64
+		if value := r.URL.Query().Get("before"); value != "" {
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid Before", http.StatusBadRequest)
+				return
+			}
+			before = n
+		}
+
+		messages := hub.HistoryBefore(channel, before, limit)
+		if messages == nil {
+			messages = []StoredMessage{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"channel": channel, "messages": messages})
+	}
+}
@@ -0,0 +1,59 @@
+package pushpop
+
+import (
+	"slices"
+	"testing"
+)
+
+// ids returns the IDs of messages.
+func ids(messages []StoredMessage) []uint64 {
+	var out []uint64
+	for _, m := range messages {
+		out = append(out, m.ID)
+	}
+	return out
+}
+
+// TestPurgedHistoryPaging checks that paging with before stays exclusive
+// once PurgeUser has left gaps in a channel's message IDs.
+func TestPurgedHistoryPaging(t *testing.T) {
+	s := newHistoryStore()
+	for i := 1; i <= 6; i++ {
+		user := "alice"
+		if i%2 == 0 {
+			user = "bob"
+		}
+		s.append(Message{Channel: "room", Event: "chat", Payload: i, Envelope: &Envelope{Origin: Origin{Type: OriginClient, User: user}}}, retention{count: 10})
+	}
+	if n := s.purge(func(string) bool { return false }, "bob"); n != 3 {
+		t.Fatalf("purged %d messages, want 3", n)
+	}
+
+	tests := []struct {
+		name   string
+		before uint64
+		limit  int
+		want   []uint64
+	}{
+		{"all", 0, 0, []uint64{1, 3, 5}},
+		{"newest", 0, 2, []uint64{3, 5}},
+		{"before a purged ID", 4, 10, []uint64{1, 3}},
+		{"before a kept ID", 5, 10, []uint64{1, 3}},
+		{"before a kept ID with a limit", 5, 1, []uint64{3}},
+		{"before the oldest", 1, 10, nil},
+		{"past the newest", 100, 10, []uint64{1, 3, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(s.before("room", tt.before, tt.limit)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// New messages keep counting from where IDs were.
+	s.append(Message{Channel: "room", Event: "chat"}, retention{count: 10})
+	if got := ids(s.recent("room", 1)); !slices.Equal(got, []uint64{7}) {
+		t.Errorf("next message got ID %v, want 7", got)
+	}
+}
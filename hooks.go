@@ -0,0 +1,71 @@
+package pushpop
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Hooks are application callbacks invoked by the hub. Any hook may be nil.
+type Hooks struct {
+	// OnConnect is called before a connection is accepted. Returning an
+	// error rejects the connection with 403 Forbidden. It may set
+	// Session.UserID and store values on the session.
+	OnConnect func(session *Session) error
+	// OnDisconnect is called once a connection has been removed.
+	OnDisconnect func(session *Session)
+	// OnSubscribe authorizes a subscription. Returning an error denies it.
+	// For presence channels it may set Session.UserInfo, which is shared
+	// with the other members.
+	OnSubscribe func(session *Session, channel string) error
+	// OnError is called with errors and recovered panics. client is nil
+	// when the error is not tied to a single connection.
+	OnError func(client *Client, err error)
+}
+
+// WithHooks registers application hooks.
+func WithHooks(hooks Hooks) Option {
+	return func(h *Hub) {
+		h.hooks = hooks
+	}
+}
+
+// PanicError wraps a value recovered from a panic.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("pushpop: recovered panic: %v", e.Value)
+}
+
+// reportError logs err and notifies the OnError hook.
+func (h *Hub) reportError(client *Client, err error) {
+	if client != nil {
+		h.log.Error("Client error", "client", client.conn.RemoteAddr(), "err", err)
+	} else {
+		h.log.Error("Hub error", "err", err)
+	}
+	if h.hooks.OnError != nil {
+		h.hooks.OnError(client, err)
+	}
+}
+
+// recoverPanic reports a panic in progress, if any, and returns whether one
+// was recovered. It must be called directly by a deferred function.
+func (h *Hub) recoverPanic(client *Client, value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	h.reportError(client, &PanicError{Value: value, Stack: debug.Stack()})
+	return true
+}
+
+// safely runs fn, recovering and reporting any panic so that one bad event
+// cannot take down the hub's dispatch loop.
+func (h *Hub) safely(client *Client, fn func()) {
+	defer func() {
+		h.recoverPanic(client, recover())
+	}()
+	fn()
+}
@@ -1,10 +1,15 @@
 package pushpop
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,22 +18,162 @@ type Message struct {
 	Channel string      `json:"channel"`
 	Event   string      `json:"event"`
 	Payload interface{} `json:"payload"`
+	// Ephemeral marks high-frequency transient signals, such as typing
+	// indicators, that are dropped rather than buffered under backpressure.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// Replayed marks messages re-sent from a channel's history, such as
+	// catch-up messages delivered on subscribe.
+	Replayed bool `json:"replayed,omitempty"`
+	// Priority orders the message in each client's queue; see Priority.
+	// Low priority messages are dropped rather than buffered under
+	// backpressure.
+	Priority Priority `json:"priority,omitempty"`
+	// SocketID addresses the message to a single connection instead of the
+	// channel's subscribers; see TriggerSocket. It is cleared before the
+	// message is sent.
+	SocketID string `json:"socket_id,omitempty"`
+	// Envelope is the ID, timestamp, and origin the hub stamps on the
+	// message when it is published; see Envelope. Set it before Trigger to
+	// supply the origin or an ID of your own.
+	Envelope *Envelope `json:"envelope,omitempty"`
+	// Ack asks the client to acknowledge the message, on channels with
+	// delivery receipts; see Receipts.
+	Ack bool `json:"ack,omitempty"`
+
+	// fanout receives the local delivery results of the message, for
+	// trigger reports.
+	fanout chan<- deliveryReport
+	// peer is the federated hub the message came from, so it is not
+	// relayed back.
+	peer *federationLink
+	// response is a JSON-RPC response queued for a client in place of
+	// the message; see WithJSONRPC.
+	response *jsonrpcResponse
 }
 
 // Subscription represents a client subscription to a channel.
 type Subscription struct {
 	Client  *Client
 	Channel string
+	// Events limits the subscription to the named events, if set.
+	Events []string
+	// Alias is the alias the client subscribed through, if any; Channel
+	// is its target.
+	Alias string
+
+	// member is the client's presence member, captured from its session
+	// where hooks may still change it, so Run never reads the session's
+	// user fields.
+	member Member
 }
 
 // Hub maintains the set of active clients and broadcasts messages.
+//
+// All broadcasts flow through a single queue drained by Run, which gives a
+// FIFO ordering guarantee per channel: if message A is accepted before
+// message B on the same channel, every subscriber receives A before B.
+//
+// Run is the single owner of subscription state. Other goroutines never
+// mutate channel membership directly; they queue registrations, removals,
+// and broadcasts for Run to apply in order.
 type Hub struct {
 	clients    sync.Map
 	broadcast  chan Message
 	register   chan *Subscription
 	unregister chan *Subscription
+	leave      chan *Client
 	channels   sync.Map
 	log        Logger
+
+	broker   Broker
+	remote   chan Message
+	outbound chan Message
+
+	healthChecks map[string]HealthCheck
+
+	ownership Ownership
+
+	middleware   []Middleware
+	dispatch     FrameHandler
+	interceptors []Interceptor
+	hooks        Hooks
+	policy       Policy
+	oidc         *oidcVerifier
+	forwardAuth  *forwardAuth
+	moderator    Moderator
+
+	lifecycleMu sync.Mutex
+	cancelRun   context.CancelFunc
+	done        chan struct{}
+	closing     atomic.Bool
+	// intakeClosed refuses new messages during Shutdown.
+	intakeClosed   atomic.Bool
+	upgrades       inflight
+	intake         inflight
+	shutdownPhases ShutdownPhases
+	draining       atomic.Bool
+	stopDrain      context.CancelFunc
+
+	handlersMu sync.RWMutex
+	handlers   map[string]map[int]func(Message)
+	handlerSeq int
+
+	requestHandlers map[string]RequestHandler
+	methods         map[string]*method
+	requestTimeout  time.Duration
+
+	resume         chan *resumeRequest
+	targeted       chan targetedMessage
+	recoveries     *recoveryStore
+	presence       *presenceStore
+	liveness       *PresenceLiveness
+	lastSeen       *lastSeenStore
+	adminToken     *Secret
+	apiKeys        keyStore
+	recoveryWindow time.Duration
+	recoveryBuffer int
+
+	readLimit   int64
+	idleTimeout time.Duration
+	heartbeat   HeartbeatMode
+
+	triggerBodyLimit int64
+	maxPayloadSize   int
+	jsonLimits       JSONLimits
+
+	compression          bool
+	compressionThreshold int
+	upgrader             Upgrader
+	jsonrpc              bool
+
+	metrics    *metrics
+	blocklist  *blocklist
+	shadowBans shadowBans
+
+	limiters rateLimiters
+
+	maxSubscriptions int
+
+	// Channel limits; the counters are owned by Run.
+	maxChannels       int
+	maxTenantChannels int
+	tenants           *tenantMeter
+	channelCount      int
+	tenantChannels    map[string]int
+	channelIdleTTL    time.Duration
+
+	registry    channelRegistry
+	history     *historyStore
+	jobs        *jobStore
+	receipts    *receiptStore
+	schedule    *scheduler
+	recurring   *recurringTable
+	replays     *replayStore
+	idempotency *idempotencyStore
+
+	federation  *federation
+	egressQueue chan egressDelivery
+	observers   []func(MessageRecord)
 }
 
 type Logger interface {
@@ -39,116 +184,686 @@ type Logger interface {
 }
 
 // NewHub creates a new Hub.
-func NewHub(log Logger) *Hub {
-	return &Hub{
-		broadcast:  make(chan Message, 100),
-		register:   make(chan *Subscription, 100),
-		unregister: make(chan *Subscription, 100),
-		channels:   sync.Map{},
-		clients:    sync.Map{},
-		log:        log,
+func NewHub(log Logger, opts ...Option) *Hub {
+	h := &Hub{
+		broadcast:   make(chan Message, 100),
+		register:    make(chan *Subscription, 100),
+		unregister:  make(chan *Subscription, 100),
+		leave:       make(chan *Client, 100),
+		resume:      make(chan *resumeRequest, 100),
+		targeted:    make(chan targetedMessage, 100),
+		remote:      make(chan Message, 100),
+		outbound:    make(chan Message, 1000),
+		recoveries:  newRecoveryStore(),
+		presence:    newPresenceStore(),
+		lastSeen:    newLastSeenStore(),
+		metrics:     newMetrics(),
+		blocklist:   newBlocklist(),
+		history:     newHistoryStore(),
+		jobs:        newJobStore(),
+		receipts:    newReceiptStore(),
+		schedule:    newScheduler(),
+		recurring:   newRecurringTable(),
+		replays:     newReplayStore(),
+		idempotency: newIdempotencyStore(),
+		federation:  newFederation(),
+		egressQueue: make(chan egressDelivery, egressQueueSize),
+		channels:    sync.Map{},
+		clients:     sync.Map{},
+		log:         log,
+
+		readLimit:   maxMessageSize,
+		idleTimeout: pongWait,
+
+		triggerBodyLimit: maxTriggerBodySize,
+		jsonLimits:       DefaultJSONLimits,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	h.buildFrameChain()
+	h.done = make(chan struct{})
+	return h
 }
 
-// Run processes incoming events for the Hub.
-func (h *Hub) Run() {
+// Run processes incoming events for the Hub until ctx is cancelled or
+// Shutdown is called. Before returning it drains any registrations and
+// broadcasts that were already queued and waits for its background
+// goroutines to exit.
+//
+// Run may be called again once it has returned, e.g. after Shutdown, to
+// restart the hub; channel settings, history, and other state are kept.
+// It returns an error if the hub is already running.
+func (h *Hub) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done, err := h.start(cancel)
+	if err != nil {
+		cancel()
+		return err
+	}
+	var wg sync.WaitGroup
+	defer h.finish(done)
+	defer wg.Wait()
+	defer cancel()
+
+	if h.broker != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.runBroker(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.pruneHistory(ctx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.runSchedule(ctx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.runRecurring(ctx)
+	}()
+	if h.tenants != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.rollUpUsage(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.runEgress(ctx)
+	}()
+	if h.federation.upstream != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.runFederation(ctx)
+		}()
+	}
+
+	// Idle channels are swept at a tenth of their TTL.
+	var sweep <-chan time.Time
+	if h.channelIdleTTL > 0 {
+		ticker := time.NewTicker(max(h.channelIdleTTL/10, time.Second))
+		defer ticker.Stop()
+		sweep = ticker.C
+	}
+
+	var liveness <-chan time.Time
+	if h.liveness != nil {
+		ticker := time.NewTicker(max(h.liveness.Away/4, time.Second))
+		defer ticker.Stop()
+		liveness = ticker.C
+	}
+
+	expiry := time.NewTicker(channelExpiryInterval)
+	defer expiry.Stop()
+
+	// Presence members restored from a snapshot expire together.
+	var restored <-chan time.Time
+	if until := h.presence.restoredUntil; !until.IsZero() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+		restored = timer.C
+	}
+
 	for {
 		select {
+		case <-ctx.Done():
+			h.drain()
+			return nil
 		case sub := <-h.register:
-			h.addSubscription(sub)
+			h.safely(sub.Client, func() { h.subscribe(sub) })
 		case sub := <-h.unregister:
-			h.removeSubscription(sub)
+			h.safely(sub.Client, func() { h.removeSubscription(sub) })
+		case client := <-h.leave:
+			h.safely(client, func() { h.removeSubscriptions(client) })
+		case req := <-h.resume:
+			h.safely(req.client, func() { h.resumeClient(req) })
 		case message := <-h.broadcast:
-			h.broadcastMessage(message)
+			message = stamp(message, Origin{Type: OriginServer})
+			h.safely(nil, func() { h.broadcastMessage(message) })
+			if h.broker != nil {
+				select {
+				case h.outbound <- message:
+				default:
+					h.log.Warn("Broker outbound queue full, message not relayed", "channel", message.Channel)
+				}
+			}
+			h.forward(message)
+			h.egress(message)
+		case message := <-h.remote:
+			h.safely(nil, func() { h.broadcastMessage(message) })
+			h.forward(message)
+		case target := <-h.targeted:
+			h.safely(nil, func() { h.deliverTargeted(target) })
+		case now := <-sweep:
+			h.safely(nil, func() { h.collectIdleChannels(now) })
+		case now := <-expiry.C:
+			h.safely(nil, func() { h.expireChannels(now) })
+		case now := <-liveness:
+			h.safely(nil, func() { h.checkLiveness(now) })
+		case <-restored:
+			h.safely(nil, h.expireRestoredPresence)
 		}
 	}
 }
 
-func (h *Hub) addSubscription(sub *Subscription) {
-	val, _ := h.channels.LoadOrStore(sub.Channel, &sync.Map{})
-	clients := val.(*sync.Map)
-	clients.Store(sub.Client, true)
-	sub.Client.channels.Store(sub.Channel, true)
+// addSubscription and removeSubscription only run on the Run goroutine, so
+// the occupancy counters cannot race with each other. addSubscription
+// reports whether a new subscription was made.
+func (h *Hub) addSubscription(sub *Subscription) bool {
+	if _, ok := h.clients.Load(sub.Client); !ok {
+		// The client was removed while the subscription was queued.
+		return false
+	}
+	if _, ok := sub.Client.channels.Load(sub.Channel); ok {
+		return false
+	}
+	if !h.channelAllowed(sub.Channel) {
+		h.rejectSubscription(sub.Client, sub.name(), CodeUnknownChannel, "channel is not declared")
+		return false
+	}
+	if h.maxSubscriptions > 0 && sub.Client.subscriptions >= h.maxSubscriptions {
+		h.rejectSubscription(sub.Client, sub.name(), CodeSubscriptionLimit, "subscription limit reached")
+		return false
+	}
+	val, ok := h.channels.Load(sub.Channel)
+	if !ok {
+		state := h.createChannel(sub.Client.session.Tenant)
+		if state == nil {
+			h.rejectSubscription(sub.Client, sub.name(), CodeChannelLimit, "channel limit reached")
+			return false
+		}
+		h.channels.Store(sub.Channel, state)
+		val = state
+	}
+	state := val.(*channelState)
+	m := sub.membership()
+	if _, loaded := state.clients.LoadOrStore(sub.Client, m); !loaded {
+		state.count.Add(1)
+		state.idleSince = time.Time{}
+	}
+	sub.Client.channels.Store(sub.Channel, m)
+	sub.Client.subscriptions++
+	h.updateLimits(sub.Client)
+
+	if h.presenceEnabled(sub.Channel) {
+		h.joinPresence(sub.Channel, sub.Client, sub.member)
+	}
+	return true
 }
 
 func (h *Hub) removeSubscription(sub *Subscription) {
 	val, ok := h.channels.Load(sub.Channel)
-	if ok {
-		clients := val.(*sync.Map)
+	if !ok {
+		return
+	}
+	state := val.(*channelState)
 
-		sub.Client.channels.Delete(sub.Channel)
-		clients.Delete(sub.Client)
-		count := 0
+	sub.Client.channels.Delete(sub.Channel)
+	h.updateLimits(sub.Client)
+	if _, loaded := state.clients.LoadAndDelete(sub.Client); !loaded {
+		return
+	}
+	sub.Client.subscriptions--
+	// Presence may have been turned off since the client joined, so leave
+	// unconditionally; it is a no-op for non-members.
+	h.leavePresence(sub.Channel, sub.Client)
+	if state.count.Add(-1) == 0 {
+		h.channelEmptied(sub.Channel, state)
+	}
+}
 
-		clients.Range(func(_, _ interface{}) bool {
-			count++
-			return false
-		})
-		if count == 0 {
-			h.channels.Delete(sub.Channel)
-		}
+// removeSubscriptions removes a departed client from every channel, in
+// channel name order so presence departures are announced deterministically.
+func (h *Hub) removeSubscriptions(client *Client) {
+	var channels []string
+	client.channels.Range(func(key, _ interface{}) bool {
+		channels = append(channels, key.(string))
+		return true
+	})
+	sort.Strings(channels)
+	for _, channel := range channels {
+		h.removeSubscription(&Subscription{Client: client, Channel: channel})
 	}
 }
 
 func (h *Hub) broadcastMessage(message Message) {
-	val, ok := h.channels.Load(message.Channel)
-	if ok {
-		clients := val.(*sync.Map)
-		clients.Range(func(key, _ interface{}) bool {
-			client := key.(*Client)
+	var report deliveryReport
+	if reply := message.fanout; reply != nil {
+		message.fanout = nil
+		defer func() {
 			select {
-			case client.send <- message:
+			case reply <- report:
 			default:
-				h.RemoveClient(client)
 			}
+		}()
+	}
+	switch {
+	case message.SocketID != "":
+		h.deliverSocket(message, &report)
+		return
+	case message.Channel == "":
+		// Messages without a channel are global broadcasts.
+		h.broadcastGlobal(message, &report)
+		return
+	}
+
+	message, err := h.transform(message)
+	if err != nil {
+		h.log.Warn("Dropped message that failed its channel transform", "channel", message.Channel, "event", message.Event, "err", err)
+		return
+	}
+	if len(h.observers) > 0 {
+		defer h.observe(message, &report)
+	}
+	h.handlersMu.RLock()
+	for _, handler := range h.handlers[message.Channel] {
+		h.safely(nil, func() { handler(message) })
+	}
+	h.handlersMu.RUnlock()
+
+	if h.recoveryWindow > 0 && !message.Ephemeral {
+		h.recoveries.buffer(message, h.recoveryBuffer)
+	}
+	h.recordHistory(message)
+	val, ok := h.channels.Load(message.Channel)
+	if !ok {
+		h.countChannelMessage(message.Channel, nil)
+		return
+	}
+	state := val.(*channelState)
+	h.countChannelMessage(message.Channel, state)
+	var receipt *receipt
+	if settings := h.settingsFor(message.Channel).Receipts; settings != nil && message.Envelope != nil && !message.Ephemeral {
+		receipt = h.receipts.open(h, message, *settings)
+		defer h.receipts.seal(h, receipt)
+		message.Ack = true
+	}
+	state.clients.Range(func(key, m interface{}) bool {
+		client := key.(*Client)
+		if !m.(membership).filter.allows(message.Event) {
 			return true
-		})
+		}
+		if receipt != nil {
+			h.receipts.expect(receipt, client.id, true)
+		}
+		if reason := h.deliver(client, message); reason == "" {
+			report.enqueued++
+		} else {
+			if receipt != nil {
+				h.receipts.expect(receipt, client.id, false)
+			}
+			report.failures = append(report.failures, DeliveryFailure{
+				Channel:  message.Channel,
+				SocketID: client.id,
+				UserID:   client.session.UserID,
+				Reason:   reason,
+			})
+		}
+		return true
+	})
+}
+
+// deliver queues message for a single subscriber, evicting the subscriber
+// if its buffer is full. A panic while preparing the message, e.g. in an
+// interceptor, tears down only that subscriber. It runs on the Run
+// goroutine and returns why the message was not enqueued, or "" if it was.
+func (h *Hub) deliver(client *Client, message Message) (reason string) {
+	defer func() {
+		if h.recoverPanic(client, recover()) {
+			h.evict(client)
+			reason = FailureEvicted
+		}
+	}()
+
+	message, ok := h.intercept(client, message)
+	if !ok {
+		return FailureFiltered
+	}
+	if !h.tenants.deliver(client.session.Tenant) {
+		return FailureQuota
+	}
+	message = client.label(message)
+	if !client.enqueue(message) {
+		if client.isClosed() {
+			return FailureDisconnected
+		}
+		if message.Ephemeral || message.Priority == PriorityLow {
+			// Drop the newest transient or low priority message rather
+			// than evict.
+			return FailureDropped
+		}
+		h.evict(client)
+		return FailureEvicted
+	}
+	return ""
+}
+
+// Subscribe registers a server-side handler for messages broadcast on
+// channel. Handlers run on the hub's dispatch goroutine in delivery order and
+// must not block; hand long-running work off to another goroutine. The
+// returned func removes the handler.
+func (h *Hub) Subscribe(channel string, handler func(Message)) (unsubscribe func()) {
+	h.handlersMu.Lock()
+	defer h.handlersMu.Unlock()
+	if h.handlers == nil {
+		h.handlers = make(map[string]map[int]func(Message))
+	}
+	if h.handlers[channel] == nil {
+		h.handlers[channel] = make(map[int]func(Message))
+	}
+	h.handlerSeq++
+	id := h.handlerSeq
+	h.handlers[channel][id] = handler
+
+	return func() {
+		h.handlersMu.Lock()
+		defer h.handlersMu.Unlock()
+		delete(h.handlers[channel], id)
+		if len(h.handlers[channel]) == 0 {
+			delete(h.handlers, channel)
+		}
 	}
 }
 
 // Trigger sends a message to all clients subscribed to a channel.
+//
+// Triggered messages share the same queue as client-originated messages and
+// are fanned out by Run, so messages on a channel are delivered to every
+// subscriber in the order they were accepted. Messages beyond the channel's
+// rate limit are handled according to its Overflow mode; rejected ones, and
+// messages for undeclared channels in strict mode, are logged and dropped.
 func (h *Hub) Trigger(message Message) {
-	h.broadcastMessage(message)
+	switch err := h.accept(message); err {
+	case errUnknownChannel:
+		h.log.Warn("Dropped message for undeclared channel", "channel", message.Channel, "event", message.Event)
+	case errPayloadTooLarge:
+		h.log.Warn("Dropped message with oversized payload", "channel", message.Channel, "event", message.Event)
+	case errHubStopped:
+		h.log.Warn("Dropped message during shutdown", "channel", message.Channel, "event", message.Event)
+	default:
+		if errors.Is(err, errRateLimited) {
+			h.log.Warn("Dropped message over channel rate limit", "channel", message.Channel, "event", message.Event)
+		} else if errors.Is(err, errInvalidPayload) {
+			h.log.Warn("Dropped message with invalid payload", "channel", message.Channel, "event", message.Event, "err", err)
+		}
+	}
 }
 
 // HandleTrigger returns an HTTP handler for triggering messages.
+//
+// The body is either a JSON Message or a CloudEvent in the structured
+// (application/cloudevents+json) or binary (ce- headers) HTTP content mode.
+// A JSON body may list several "channels" instead of a single channel, or
+// address a single connection with "socket_id"; see TriggerSocket. With
+// ?report=true the response is a Fanout reporting how many subscribers the
+// message was enqueued to. ?wait=enqueue also lists the subscribers it
+// could not be enqueued to, and answers 504 with the channels still pending
+// if ?timeout (5s by default) passes first. ?async=true answers 202 with a
+// Job at once and publishes in the background; see HandleJob. A body with
+// "deliver_at" or "delay" answers 202 with the ScheduledMessage instead;
+// see Hub.Schedule. The envelope is stamped by the hub, except that a
+// "bridge" origin is kept; see the bridge package.
 func HandleTrigger(hub *Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		hub.intake.add()
+		defer hub.intake.done()
+		query := r.URL.Query()
+		wait := query.Get("wait") == "enqueue"
+		report := wait || query.Get("report") == "true"
+		timeout := defaultTriggerTimeout
+		if wait {
+			timeout = triggerTimeout(query.Get("timeout"))
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
 		if r.Method != http.MethodPost {
 			http.Error(w, "Invalid Request Method", http.StatusMethodNotAllowed)
 			return
 		}
+		if !hub.authorizedPublisher(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 
-		var message Message
-		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		if hub.triggerBodyLimit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, hub.triggerBodyLimit)
+		}
+		body, err := io.ReadAll(r.Body)
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		cloudEvent := isCloudEvent(r)
+		if err == nil && (!cloudEvent || jsonMediaType(r.Header.Get("Content-Type"))) {
+			if err := hub.jsonLimits.check(body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var req triggerRequest
+		if err == nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if cloudEvent {
+				req.Message, err = decodeCloudEvent(r)
+			} else {
+				err = json.NewDecoder(r.Body).Decode(&req)
+			}
+		}
+		if err != nil {
 			hub.log.Error("error decoding message", "err", err)
 			http.Error(w, "Invalid Request Body", http.StatusBadRequest)
 			return
 		}
 
-		select {
-		case <-ctx.Done():
-			http.Error(w, "Timeout", http.StatusRequestTimeout)
+		// Every channel of the trigger shares the message ID. Bridges keep
+		// their origin, which they use to recognize their own messages.
+		origin := Origin{Type: OriginAPI}
+		if envelope := req.Message.Envelope; envelope != nil && envelope.Origin.Type == OriginBridge {
+			origin = envelope.Origin
+		}
+		req.Message.Envelope = nil
+		req.Message = stamp(req.Message, origin)
+		w.Header().Set("Pushpop-Message-Id", req.Message.Envelope.ID)
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			id, state := hub.idempotency.claim(key, req.Message.Envelope.ID, time.Now())
+			switch state {
+			case idempotencyDone:
+				w.Header().Set("Pushpop-Message-Id", id)
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(http.StatusOK)
+				return
+			case idempotencyPending:
+				http.Error(w, "Request In Progress", http.StatusConflict)
+				return
+			}
+			recorder := &statusRecorder{ResponseWriter: w}
+			w = recorder
+			defer func() { hub.idempotency.finish(key, recorder.published()) }()
+		}
+		at, scheduled, err := req.deliverAt(time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.SocketID != "" {
+			if scheduled {
+				http.Error(w, errScheduleChannel.Error(), http.StatusBadRequest)
+				return
+			}
+			hub.TriggerSocket(req.SocketID, req.Message)
+			w.WriteHeader(http.StatusOK)
 			return
-		default:
-			hub.Trigger(message)
 		}
 
+		channels := req.channels()
+		for _, channel := range channels {
+			if channel == "" {
+				http.Error(w, "Missing Channel", http.StatusBadRequest)
+				return
+			}
+			if !hub.channelAllowed(channel) {
+				http.Error(w, "Unknown Channel", http.StatusNotFound)
+				return
+			}
+		}
+
+		if scheduled {
+			message, err := hub.Schedule(req.Message, at, channels...)
+			switch {
+			case err == nil:
+				w.Header().Set("Location", "/scheduled/"+message.ID)
+				writeJSON(w, http.StatusAccepted, message)
+			case errors.Is(err, errInvalidPayload):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case err == errUnknownChannel:
+				http.Error(w, "Unknown Channel", http.StatusNotFound)
+			case err == errPayloadTooLarge:
+				http.Error(w, "Payload Too Large", http.StatusRequestEntityTooLarge)
+			default:
+				hub.log.Error("Failed to schedule message", "err", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if query.Get("async") == "true" {
+			job := hub.jobs.start(len(channels))
+			go hub.runJob(job, req.Message, channels)
+			snapshot, _ := hub.Job(job.ID)
+			w.Header().Set("Location", "/jobs/"+job.ID)
+			writeJSON(w, http.StatusAccepted, snapshot)
+			return
+		}
+
+		fanout := Fanout{Channels: make(map[string]int, len(channels))}
+		var limited *rateLimitError
+		for i, channel := range channels {
+			message := req.Message
+			message.Channel = channel
+			result, err := hub.triggerMessage(ctx, message, report)
+			switch {
+			case err == nil:
+			case err == errUnknownChannel:
+				http.Error(w, "Unknown Channel", http.StatusNotFound)
+				return
+			case errors.Is(err, errInvalidPayload):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case err == errPayloadTooLarge:
+				http.Error(w, "Payload Too Large", http.StatusRequestEntityTooLarge)
+				return
+			case err == errHubStopped:
+				http.Error(w, "Server Shutting Down", http.StatusServiceUnavailable)
+				return
+			case ctx.Err() != nil && wait:
+				fanout.Pending = channels[i:]
+				writeJSON(w, http.StatusGatewayTimeout, fanout)
+				return
+			case ctx.Err() != nil:
+				http.Error(w, "Timeout", http.StatusRequestTimeout)
+				return
+			case errors.As(err, &limited):
+				writeRateLimited(w, limited)
+				return
+			default:
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+			fanout.Subscribers += result.enqueued
+			fanout.Channels[channel] = result.enqueued
+			if wait {
+				fanout.Failures = append(fanout.Failures, result.failures...)
+			}
+		}
+
+		if report {
+			writeJSON(w, http.StatusOK, fanout)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-// RemoveClient removes a client from all channels and the hub.
+// RemoveClient removes a client from all channels and the hub. It is safe
+// to call from any goroutine and more than once; only the first call tears
+// the client down.
+//
+// Teardown happens in a fixed order, whichever path triggers it (read error,
+// write error, slow-consumer eviction, Close, or Shutdown):
+//
+//  1. The client is removed from the hub, so no new deliveries target it.
+//  2. Its recovery window is opened, if recovery is enabled.
+//  3. Its send buffer is closed; the write pump flushes what is queued,
+//     sends a close frame, and closes the connection.
+//  4. Run removes it from each channel it was subscribed to.
+//  5. The OnDisconnect hook runs.
 func (h *Hub) RemoveClient(client *Client) {
-	client.channels.Range(func(key, _ interface{}) bool {
-		channel := key.(string)
-		h.unregister <- &Subscription{Client: client, Channel: channel}
+	if !h.detach(client) {
+		return
+	}
+	select {
+	case h.leave <- client:
+	case <-h.stopped():
+	}
+	h.disconnected(client)
+}
+
+// evict removes a client from the Run goroutine, where queuing on h.leave
+// could deadlock. It follows the same teardown order as RemoveClient.
+func (h *Hub) evict(client *Client) {
+	if !h.detach(client) {
+		return
+	}
+	h.removeSubscriptions(client)
+	h.disconnected(client)
+}
+
+// detach removes client from the hub and closes its send buffer. It reports
+// false if the client was already removed, since several disconnect paths
+// can race to remove it.
+func (h *Hub) detach(client *Client) bool {
+	if _, ok := h.clients.LoadAndDelete(client); !ok {
+		return false
+	}
+	if h.recoveryWindow > 0 {
+		h.saveRecovery(client)
+	}
+	client.closeSend()
+	return true
+}
+
+// disconnected records the departure of a removed client.
+func (h *Hub) disconnected(client *Client) {
+	h.tenants.connected(client.session.Tenant, -1)
+	h.lastSeen.disconnected(client.session.UserID, time.Now())
+	if h.hooks.OnDisconnect != nil {
+		h.safely(client, func() { h.hooks.OnDisconnect(client.session) })
+	}
+}
+
+// Disconnect closes the connection with the given socket ID on this node.
+// It reports whether such a connection was found.
+func (h *Hub) Disconnect(socketID string) bool {
+	found := false
+	h.clients.Range(func(key, _ interface{}) bool {
+		client := key.(*Client)
+		if client.id == socketID {
+			client.Close()
+			found = true
+			return false
+		}
 		return true
 	})
-
-	h.clients.Delete(client)
-	close(client.send)
+	return found
 }
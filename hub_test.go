@@ -0,0 +1,340 @@
+package pushpop
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestHub returns a running hub that is stopped when the test ends.
+func newTestHub(t *testing.T, opts ...Option) *Hub {
+	t.Helper()
+	hub := NewHub(slog.New(slog.NewTextHandler(io.Discard, nil)), opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = hub.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return hub
+}
+
+// dial connects a WebSocket client to the hub served by server and reads
+// its connection_established event.
+func dial(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if message, err := readMessage(conn); err != nil || message.Event != EventConnectionEstablished {
+		t.Fatalf("connect: got %+v, %v", message, err)
+	}
+	return conn
+}
+
+// subscribe subscribes conn to channel and waits for the acknowledgement.
+func subscribe(t *testing.T, conn *websocket.Conn, channel string) {
+	t.Helper()
+	if err := conn.WriteJSON(map[string]string{"action": "subscribe", "channel": channel}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	message, err := readMessage(conn)
+	if err != nil || message.Event != EventSubscriptionSucceeded || message.Channel != channel {
+		t.Fatalf("subscribe: got %+v, %v", message, err)
+	}
+}
+
+// readMessage reads the next message sent to conn.
+func readMessage(conn *websocket.Conn) (Message, error) {
+	var message Message
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return message, err
+	}
+	err := conn.ReadJSON(&message)
+	return message, err
+}
+
+// TestChannelOrdering checks the per-channel FIFO guarantee: messages
+// published on one channel with Trigger, POST /trigger, and by a client
+// reach every subscriber in the same order, which keeps each publisher's
+// own order. Publishers send in rounds that fit the subscribers' send
+// buffers, so no subscriber is evicted as a slow consumer.
+func TestChannelOrdering(t *testing.T) {
+	const rounds, perRound = 10, 20
+	hub := newTestHub(t)
+	server := httptest.NewServer(hub.Handler())
+	defer server.Close()
+
+	subscribers := make([]*websocket.Conn, 3)
+	for i := range subscribers {
+		subscribers[i] = dial(t, server)
+		subscribe(t, subscribers[i], "orders")
+	}
+	publisher := dial(t, server)
+
+	// Readers report every round they have received in full.
+	orders := make([][]string, len(subscribers))
+	received := make(chan struct{}, len(subscribers))
+	var readers sync.WaitGroup
+	for i, conn := range subscribers {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			next := make(map[string]int)
+			for len(orders[i]) < rounds*3*perRound {
+				message, err := readMessage(conn)
+				if err != nil {
+					t.Errorf("subscriber %d: %v after %d messages", i, err, len(orders[i]))
+					return
+				}
+				if message.Channel != "orders" {
+					continue
+				}
+				seq, _ := message.Payload.(float64)
+				if int(seq) != next[message.Event] {
+					t.Errorf("subscriber %d: got %s %v, want %d", i, message.Event, message.Payload, next[message.Event])
+					return
+				}
+				next[message.Event]++
+				orders[i] = append(orders[i], fmt.Sprintf("%s %d", message.Event, int(seq)))
+				if len(orders[i])%(3*perRound) == 0 {
+					received <- struct{}{}
+				}
+			}
+		}()
+	}
+
+	for round := 0; round < rounds; round++ {
+		first := round * perRound
+		var publishers sync.WaitGroup
+		publishers.Add(3)
+		go func() {
+			defer publishers.Done()
+			for i := first; i < first+perRound; i++ {
+				hub.Trigger(Message{Channel: "orders", Event: "trigger", Payload: i})
+			}
+		}()
+		go func() {
+			defer publishers.Done()
+			for i := first; i < first+perRound; i++ {
+				body := fmt.Sprintf(`{"channel": "orders", "event": "http", "payload": %d}`, i)
+				resp, err := http.Post(server.URL+"/trigger", "application/json", strings.NewReader(body))
+				if err != nil {
+					t.Errorf("trigger: %v", err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("trigger: status %d", resp.StatusCode)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer publishers.Done()
+			for i := first; i < first+perRound; i++ {
+				frame := map[string]interface{}{"action": "message", "channel": "orders", "payload": i}
+				if err := publisher.WriteJSON(frame); err != nil {
+					t.Errorf("publish: %v", err)
+					return
+				}
+			}
+		}()
+		publishers.Wait()
+		for range subscribers {
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("round %d was not received by every subscriber", round)
+			}
+		}
+	}
+	readers.Wait()
+
+	for i := 1; i < len(orders); i++ {
+		if !slices.Equal(orders[0], orders[i]) {
+			t.Errorf("subscribers 0 and %d received the channel's messages in different orders", i)
+		}
+	}
+}
+
+// testConn is a Conn served with ServeConn. Frames sent on in are read by
+// the hub. Writes are discarded, or, for a stalled connection, block until
+// the connection is closed, as for a client that stopped reading.
+type testConn struct {
+	in      chan []byte
+	stalled bool
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newTestConn(stalled bool) *testConn {
+	return &testConn{in: make(chan []byte), stalled: stalled, closed: make(chan struct{})}
+}
+
+func (c *testConn) ReadMessage() (int, []byte, error) {
+	select {
+	case frame := <-c.in:
+		return websocket.TextMessage, frame, nil
+	case <-c.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+func (c *testConn) WriteMessage(int, []byte) error {
+	if c.stalled {
+		<-c.closed
+		return io.ErrClosedPipe
+	}
+	select {
+	case <-c.closed:
+		return io.ErrClosedPipe
+	default:
+		return nil
+	}
+}
+
+func (c *testConn) WriteJSON(interface{}) error { return c.WriteMessage(websocket.TextMessage, nil) }
+
+func (c *testConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *testConn) RemoteAddr() net.Addr { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+
+func (c *testConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// send queues a frame for the hub, reporting false once the connection is
+// closed.
+func (c *testConn) send(frame string) bool {
+	select {
+	case c.in <- []byte(frame):
+		return true
+	case <-c.closed:
+		return false
+	}
+}
+
+// TestConcurrentTeardown runs Trigger, subscribes and unsubscribes,
+// disconnects, evictions of stalled clients, and Shutdown concurrently.
+// Run it with -race: the hub's state is owned by Run, and every teardown
+// path must remove a client exactly once.
+func TestConcurrentTeardown(t *testing.T) {
+	var mu sync.Mutex
+	disconnects := make(map[string]int)
+	hub := newTestHub(t,
+		WithShutdownPhases(ShutdownPhases{Clients: 200 * time.Millisecond}),
+		WithHooks(Hooks{OnDisconnect: func(session *Session) {
+			mu.Lock()
+			defer mu.Unlock()
+			disconnects[session.ID]++
+		}}),
+	)
+	channels := []string{"a", "b", "c"}
+
+	var conns []*testConn
+	var served sync.WaitGroup
+	for i := 0; i < 24; i++ {
+		// Every fourth client stops reading, so it is evicted once its
+		// buffers fill.
+		conn := newTestConn(i%4 == 0)
+		conns = append(conns, conn)
+		served.Add(1)
+		go func() {
+			defer served.Done()
+			_ = hub.ServeConn(conn, &Session{ID: fmt.Sprintf("socket-%d", i)})
+		}()
+	}
+
+	var work sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		work.Add(1)
+		go func() {
+			defer work.Done()
+			for n := 0; n < 2000; n++ {
+				hub.Trigger(Message{Channel: channels[n%len(channels)], Event: "tick", Payload: n})
+			}
+		}()
+	}
+	for i, conn := range conns {
+		work.Add(1)
+		go func() {
+			defer work.Done()
+			for n := 0; n < 200; n++ {
+				channel := channels[(i+n)%len(channels)]
+				if !conn.send(`{"action":"subscribe","channel":"` + channel + `"}`) {
+					return
+				}
+				if n%2 == 1 && !conn.send(`{"action":"unsubscribe","channel":"`+channel+`"}`) {
+					return
+				}
+			}
+		}()
+	}
+	work.Add(1)
+	go func() {
+		defer work.Done()
+		for i := len(conns) - 1; i >= 0; i -= 3 {
+			// Disconnect and a dropped connection race to remove the
+			// same client.
+			work.Add(1)
+			go func() {
+				defer work.Done()
+				hub.Disconnect(fmt.Sprintf("socket-%d", i))
+			}()
+			conns[i].Close()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+	work.Wait()
+
+	// Stalled writes only end when their connection is closed.
+	for _, conn := range conns {
+		conn.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		served.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("clients were not torn down")
+	}
+	if n := hub.Stats().Connections; n != 0 {
+		t.Errorf("got %d connections after shutdown, want 0", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range conns {
+		if n := disconnects[fmt.Sprintf("socket-%d", i)]; n != 1 {
+			t.Errorf("socket-%d: removed %d times, want once", i, n)
+		}
+	}
+}
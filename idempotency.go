@@ -0,0 +1,102 @@
+package pushpop
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyWindow is how long a trigger's Idempotency-Key is remembered.
+const idempotencyWindow = 10 * time.Minute
+
+// Outcomes of claiming an idempotency key.
+const (
+	// idempotencyClaimed means the key is new and the trigger publishes.
+	idempotencyClaimed = iota
+	// idempotencyPending means a trigger with the key is still publishing.
+	idempotencyPending
+	// idempotencyDone means a trigger with the key already published.
+	idempotencyDone
+)
+
+// idempotencyStore remembers the Idempotency-Key of recent triggers and the
+// message IDs they published, so retried triggers are not published twice.
+// Keys are remembered by the node that handled the trigger.
+type idempotencyStore struct {
+	mu        sync.Mutex
+	keys      map[string]idempotencyEntry
+	lastPrune time.Time
+}
+
+type idempotencyEntry struct {
+	id   string
+	at   time.Time
+	done bool
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{keys: make(map[string]idempotencyEntry)}
+}
+
+// claim reserves key for a trigger publishing message id. A key already
+// claimed within the window reports the message ID of the first trigger.
+func (s *idempotencyStore) claim(key, id string, now time.Time) (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastPrune) > time.Minute {
+		for k, entry := range s.keys {
+			if now.Sub(entry.at) > idempotencyWindow {
+				delete(s.keys, k)
+			}
+		}
+		s.lastPrune = now
+	}
+	if entry, ok := s.keys[key]; ok && now.Sub(entry.at) <= idempotencyWindow {
+		if entry.done {
+			return entry.id, idempotencyDone
+		}
+		return entry.id, idempotencyPending
+	}
+	s.keys[key] = idempotencyEntry{id: id, at: now}
+	return id, idempotencyClaimed
+}
+
+// finish settles a claimed key: a trigger that published keeps it for the
+// window, one that failed releases it so the trigger can be retried.
+func (s *idempotencyStore) finish(key string, published bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !published {
+		delete(s.keys, key)
+		return
+	}
+	if entry, ok := s.keys[key]; ok {
+		entry.done = true
+		s.keys[key] = entry
+	}
+}
+
+// statusRecorder records the status a handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// published reports whether the answer was a success.
+func (r *statusRecorder) published() bool {
+	return r.status == 0 || r.status < http.StatusMultipleChoices
+}
@@ -0,0 +1,246 @@
+package pushpop
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxIngestBodySize bounds the size of webhook bodies accepted on /ingest.
+const maxIngestBodySize = 1 << 20
+
+var (
+	errInvalidSignature = errors.New("invalid webhook signature")
+	// errNoWebhookSecret rejects webhooks to verifiers without a secret,
+	// whose signatures anyone could compute.
+	errNoWebhookSecret = errors.New("webhook secret not configured")
+)
+
+// WebhookVerifier verifies the signature of an inbound third-party webhook.
+type WebhookVerifier interface {
+	Verify(r *http.Request, body []byte) error
+}
+
+// eventNamer is implemented by verifiers that know how their source names
+// events, e.g. the X-GitHub-Event header.
+type eventNamer interface {
+	EventName(r *http.Request, payload interface{}) string
+}
+
+// IngestSource configures a webhook source served on /ingest/{source}.
+type IngestSource struct {
+	// Verifier checks the webhook signature before anything is published.
+	Verifier WebhookVerifier
+	// Channels the verified payload is republished to.
+	Channels []string
+	// Event overrides the event name. When empty the event is derived from
+	// the source where possible and falls back to "webhook".
+	Event string
+}
+
+// HandleIngest returns an HTTP handler that verifies third-party webhooks and
+// republishes their payloads onto the channels configured for the source.
+// The handler expects to be mounted on a pattern with a {source} wildcard.
+func HandleIngest(hub *Hub, sources map[string]IngestSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hub.intake.add()
+		defer hub.intake.done()
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid Request Method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("source")
+		source, ok := sources[name]
+		if !ok {
+			http.Error(w, "Unknown Source", http.StatusNotFound)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIngestBodySize+1))
+		if err != nil {
+			hub.log.Error("error reading webhook body", "source", name, "err", err)
+			http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxIngestBodySize {
+			http.Error(w, "Request Body Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if source.Verifier != nil {
+			if err := source.Verifier.Verify(r, body); err != nil {
+				hub.log.Warn("Rejected webhook", "source", name, "err", err)
+				http.Error(w, "Invalid Signature", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if jsonMediaType(r.Header.Get("Content-Type")) {
+			if err := hub.jsonLimits.check(body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var payload interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			payload = string(body)
+		}
+
+		event := source.Event
+		if event == "" {
+			if namer, ok := source.Verifier.(eventNamer); ok {
+				event = namer.EventName(r, payload)
+			}
+		}
+		if event == "" {
+			event = "webhook"
+		}
+
+		for _, channel := range source.Channels {
+			hub.Trigger(Message{Channel: channel, Event: event, Payload: payload, Envelope: &Envelope{Origin: Origin{Type: OriginWebhook, ID: name}}})
+		}
+		hub.log.Debug("Ingested webhook", "source", name, "event", event, "channels", source.Channels)
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// HMACVerifier verifies a hex-encoded HMAC-SHA256 of the body carried in the
+// given header. An optional "sha256=" prefix on the header value is accepted.
+// Verifiers with an empty secret reject every request, as do those of
+// GitHubVerifier, StripeVerifier, and EgressVerifier.
+func HMACVerifier(header, secret string) WebhookVerifier {
+	return &hmacVerifier{header: header, secret: []byte(secret)}
+}
+
+type hmacVerifier struct {
+	header string
+	secret []byte
+}
+
+func (v *hmacVerifier) Verify(r *http.Request, body []byte) error {
+	if len(v.secret) == 0 {
+		return errNoWebhookSecret
+	}
+	signature := strings.TrimPrefix(r.Header.Get(v.header), "sha256=")
+	if !validHMAC(v.secret, body, signature) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// GitHubVerifier verifies GitHub webhooks signed with X-Hub-Signature-256.
+// The event name is taken from the X-GitHub-Event header.
+func GitHubVerifier(secret string) WebhookVerifier {
+	return &githubVerifier{hmacVerifier{header: "X-Hub-Signature-256", secret: []byte(secret)}}
+}
+
+type githubVerifier struct {
+	hmacVerifier
+}
+
+func (v *githubVerifier) EventName(r *http.Request, _ interface{}) string {
+	return r.Header.Get("X-GitHub-Event")
+}
+
+// StripeVerifier verifies Stripe webhooks signed with the Stripe-Signature
+// header, rejecting events whose timestamp is outside the tolerance. A zero
+// tolerance uses Stripe's recommended five minutes. The event name is taken
+// from the event's type field.
+func StripeVerifier(secret string, tolerance time.Duration) WebhookVerifier {
+	if tolerance <= 0 {
+		tolerance = 5 * time.Minute
+	}
+	return &stripeVerifier{header: "Stripe-Signature", secret: []byte(secret), tolerance: tolerance}
+}
+
+// EgressVerifier verifies requests of an EgressWebhook signed with secret,
+// in the receiving service or on another hub's /ingest, rejecting those
+// whose timestamp is outside the tolerance. A zero tolerance uses five
+// minutes. The event name is taken from the message's event field.
+func EgressVerifier(secret string, tolerance time.Duration) WebhookVerifier {
+	if tolerance <= 0 {
+		tolerance = 5 * time.Minute
+	}
+	return &egressVerifier{stripeVerifier{header: "Pushpop-Signature", secret: []byte(secret), tolerance: tolerance}}
+}
+
+// stripeVerifier checks "t=...,v1=..." signatures of the timestamp and
+// body, as Stripe and egress webhooks send them.
+type stripeVerifier struct {
+	header    string
+	secret    []byte
+	tolerance time.Duration
+}
+
+func (v *stripeVerifier) Verify(r *http.Request, body []byte) error {
+	if len(v.secret) == 0 {
+		return errNoWebhookSecret
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(r.Header.Get(v.header), ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > v.tolerance || age < -v.tolerance {
+		return errors.New("webhook timestamp outside tolerance")
+	}
+
+	signed := append([]byte(timestamp+"."), body...)
+	for _, signature := range signatures {
+		if validHMAC(v.secret, signed, signature) {
+			return nil
+		}
+	}
+	return errInvalidSignature
+}
+
+func (v *stripeVerifier) EventName(_ *http.Request, payload interface{}) string {
+	if event, ok := payload.(map[string]interface{}); ok {
+		name, _ := event["type"].(string)
+		return name
+	}
+	return ""
+}
+
+type egressVerifier struct {
+	stripeVerifier
+}
+
+func (v *egressVerifier) EventName(_ *http.Request, payload interface{}) string {
+	if message, ok := payload.(map[string]interface{}); ok {
+		name, _ := message["event"].(string)
+		return name
+	}
+	return ""
+}
+
+// validHMAC reports whether signature is the hex-encoded HMAC-SHA256 of data.
+func validHMAC(secret, data []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return hmac.Equal(got, mac.Sum(nil))
+}
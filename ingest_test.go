@@ -0,0 +1,121 @@
+package pushpop
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sign returns the hex-encoded HMAC-SHA256 of data.
+func sign(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhook returns a request carrying body and the given headers.
+func webhook(body string, header http.Header) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/ingest/test", strings.NewReader(body))
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	return r
+}
+
+func TestHMACVerifiers(t *testing.T) {
+	const body = `{"action": "opened"}`
+	tests := []struct {
+		name     string
+		verifier WebhookVerifier
+		header   http.Header
+		err      error
+	}{
+		{"valid", HMACVerifier("X-Signature", "s3cret"), http.Header{"X-Signature": {sign("s3cret", body)}}, nil},
+		{"valid with prefix", HMACVerifier("X-Signature", "s3cret"), http.Header{"X-Signature": {"sha256=" + sign("s3cret", body)}}, nil},
+		{"wrong secret", HMACVerifier("X-Signature", "s3cret"), http.Header{"X-Signature": {sign("other", body)}}, errInvalidSignature},
+		{"tampered body", HMACVerifier("X-Signature", "s3cret"), http.Header{"X-Signature": {sign("s3cret", body+" ")}}, errInvalidSignature},
+		{"missing signature", HMACVerifier("X-Signature", "s3cret"), nil, errInvalidSignature},
+		{"not hex", HMACVerifier("X-Signature", "s3cret"), http.Header{"X-Signature": {"zz"}}, errInvalidSignature},
+		{"empty secret", HMACVerifier("X-Signature", ""), http.Header{"X-Signature": {sign("", body)}}, errNoWebhookSecret},
+		{"github", GitHubVerifier("s3cret"), http.Header{"X-Hub-Signature-256": {"sha256=" + sign("s3cret", body)}}, nil},
+		{"github wrong header", GitHubVerifier("s3cret"), http.Header{"X-Signature": {sign("s3cret", body)}}, errInvalidSignature},
+		{"github empty secret", GitHubVerifier(""), http.Header{"X-Hub-Signature-256": {"sha256=" + sign("", body)}}, errNoWebhookSecret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.verifier.Verify(webhook(body, tt.header), []byte(body)); err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTimestampedVerifiers(t *testing.T) {
+	const body = `{"type": "invoice.paid", "event": "created"}`
+	stamped := func(secret string, at time.Time, signed string) string {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		return "t=" + ts + ",v1=" + sign(secret, ts+"."+signed)
+	}
+	now := time.Now()
+	tests := []struct {
+		name      string
+		verifier  WebhookVerifier
+		header    string
+		signature string
+		valid     bool
+	}{
+		{"stripe valid", StripeVerifier("whsec", 0), "Stripe-Signature", stamped("whsec", now, body), true},
+		{"stripe second signature", StripeVerifier("whsec", 0), "Stripe-Signature", stamped("old", now, body) + ",v1=" + sign("whsec", strconv.FormatInt(now.Unix(), 10)+"."+body), true},
+		{"stripe wrong secret", StripeVerifier("whsec", 0), "Stripe-Signature", stamped("other", now, body), false},
+		{"stripe tampered body", StripeVerifier("whsec", 0), "Stripe-Signature", stamped("whsec", now, body+" "), false},
+		{"stripe expired", StripeVerifier("whsec", time.Minute), "Stripe-Signature", stamped("whsec", now.Add(-2*time.Minute), body), false},
+		{"stripe from the future", StripeVerifier("whsec", time.Minute), "Stripe-Signature", stamped("whsec", now.Add(2*time.Minute), body), false},
+		{"stripe missing timestamp", StripeVerifier("whsec", 0), "Stripe-Signature", "v1=" + sign("whsec", body), false},
+		{"stripe empty secret", StripeVerifier("", 0), "Stripe-Signature", stamped("", now, body), false},
+		{"egress valid", EgressVerifier("egress", 0), "Pushpop-Signature", stamped("egress", now, body), true},
+		{"egress empty secret", EgressVerifier("", 0), "Pushpop-Signature", stamped("", now, body), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := webhook(body, http.Header{tt.header: {tt.signature}})
+			if err := tt.verifier.Verify(r, []byte(body)); (err == nil) != tt.valid {
+				t.Errorf("got %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestIngestRejectsUnsigned(t *testing.T) {
+	hub := newTestHub(t)
+	handler := HandleIngest(hub, map[string]IngestSource{
+		"signed":   {Verifier: HMACVerifier("X-Signature", "s3cret"), Channels: []string{"audit"}},
+		"unsecret": {Verifier: HMACVerifier("X-Signature", ""), Channels: []string{"audit"}},
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/ingest/{source}", handler)
+	const body = `{"ok": true}`
+	tests := []struct {
+		source, signature string
+		status            int
+	}{
+		{"signed", sign("s3cret", body), http.StatusOK},
+		{"signed", sign("other", body), http.StatusUnauthorized},
+		{"unsecret", sign("", body), http.StatusUnauthorized},
+		{"unknown", sign("s3cret", body), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/ingest/"+tt.source, strings.NewReader(body))
+		r.Header.Set("X-Signature", tt.signature)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s with signature %s: got %d, want %d", tt.source, tt.signature, w.Code, tt.status)
+		}
+	}
+}
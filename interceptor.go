@@ -0,0 +1,28 @@
+package pushpop
+
+// Interceptor transforms or suppresses a message for a single subscriber
+// just before it is enqueued, e.g. to strip fields a user may not see or to
+// inject per-user metadata. It returns the message to deliver and whether
+// to deliver it at all. The payload is shared by every subscriber, so an
+// interceptor that changes it must return a modified copy rather than
+// mutating it in place.
+type Interceptor func(client *Client, message Message) (Message, bool)
+
+// WithInterceptor appends outbound interceptors. Interceptors run in the
+// order given; the first to suppress a message stops the chain.
+func WithInterceptor(interceptors ...Interceptor) Option {
+	return func(h *Hub) {
+		h.interceptors = append(h.interceptors, interceptors...)
+	}
+}
+
+// intercept runs the outbound interceptors for client.
+func (h *Hub) intercept(client *Client, message Message) (Message, bool) {
+	for _, interceptor := range h.interceptors {
+		var ok bool
+		if message, ok = interceptor(client, message); !ok {
+			return message, false
+		}
+	}
+	return message, true
+}
@@ -0,0 +1,137 @@
+package pushpop
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jobRetention is how long finished jobs can be looked up.
+const jobRetention = time.Hour
+
+// Job statuses.
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job is the progress of an asynchronous trigger.
+type Job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Channels is the number of channels to publish to, and Completed how
+	// many have been delivered so far.
+	Channels  int `json:"channels"`
+	Completed int `json:"completed"`
+	// Subscribers is the number of subscribers on this node the message
+	// has been enqueued to.
+	Subscribers int               `json:"subscribers"`
+	Failures    []DeliveryFailure `json:"failures,omitempty"`
+	// Errors maps channels that could not be published to the reason.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// jobStore keeps the jobs of asynchronous triggers.
+type jobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: make(map[string]*Job)}
+}
+
+// start records a new job, pruning jobs that finished long ago.
+func (s *jobStore) start(channels int) *Job {
+	now := time.Now()
+	job := &Job{ID: newToken(), Status: JobRunning, Created: now, Channels: channels}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, old := range s.jobs {
+		if old.Finished != nil && now.Sub(*old.Finished) > jobRetention {
+			delete(s.jobs, id)
+		}
+	}
+	s.jobs[job.ID] = job
+	return job
+}
+
+// update applies fn to a job under the store's lock.
+func (s *jobStore) update(job *Job, fn func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(job)
+}
+
+// get returns a copy of a job.
+func (s *jobStore) get(id string) (Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	copied := *job
+	copied.Failures = append([]DeliveryFailure(nil), job.Failures...)
+	copied.Errors = make(map[string]string, len(job.Errors))
+	for channel, reason := range job.Errors {
+		copied.Errors[channel] = reason
+	}
+	return copied, true
+}
+
+// Job returns the progress of an asynchronous trigger.
+func (h *Hub) Job(id string) (Job, bool) {
+	return h.jobs.get(id)
+}
+
+// runJob publishes message to channels one at a time, recording progress
+// on job. The job fails if any channel could not be published to.
+func (h *Hub) runJob(job *Job, message Message, channels []string) {
+	for _, channel := range channels {
+		message.Channel = channel
+		ctx, cancel := context.WithTimeout(context.Background(), maxTriggerTimeout)
+		result, err := h.triggerMessage(ctx, message, true)
+		cancel()
+
+		h.jobs.update(job, func(job *Job) {
+			job.Completed++
+			if err != nil {
+				if job.Errors == nil {
+					job.Errors = make(map[string]string)
+				}
+				job.Errors[channel] = err.Error()
+				return
+			}
+			job.Subscribers += result.enqueued
+			job.Failures = append(job.Failures, result.failures...)
+		})
+	}
+
+	h.jobs.update(job, func(job *Job) {
+		now := time.Now()
+		job.Finished = &now
+		job.Status = JobCompleted
+		if len(job.Errors) > 0 {
+			job.Status = JobFailed
+		}
+	})
+}
+
+// HandleJob returns an HTTP handler that reports the progress of the
+// asynchronous trigger named by the {id} path value.
+func HandleJob(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := hub.Job(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Unknown Job", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}
+}
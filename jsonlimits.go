@@ -0,0 +1,89 @@
+package pushpop
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// errJSONLimit wraps the limits a JSON document exceeds.
+var errJSONLimit = errors.New("JSON limit exceeded")
+
+// JSONLimits bounds the structure of inbound JSON from clients and
+// producers. Documents are scanned before they are decoded, so pathological
+// nesting or key counts are rejected without the cost of building them.
+// Zero fields are unlimited.
+type JSONLimits struct {
+	// MaxDepth is how deeply objects and arrays may nest. Defaults to 64.
+	MaxDepth int
+	// MaxKeys is how many keys a single object may have. Defaults to 1000.
+	MaxKeys int
+	// MaxStringLength is the longest string or key, in encoded bytes.
+	MaxStringLength int
+}
+
+// DefaultJSONLimits apply unless WithJSONLimits is given.
+var DefaultJSONLimits = JSONLimits{MaxDepth: 64, MaxKeys: 1000}
+
+// WithJSONLimits sets the limits for client frames, /trigger bodies, and
+// webhook payloads. Frames over the limits are dropped; HTTP requests are
+// answered with 400.
+func WithJSONLimits(limits JSONLimits) Option {
+	return func(h *Hub) {
+		h.jsonLimits = limits
+	}
+}
+
+// check scans data and returns an error if it exceeds the limits. It does
+// not validate the document; malformed JSON is left to the decoder.
+func (l JSONLimits) check(data []byte) error {
+	// keys counts the keys of each open object, and is -1 for arrays.
+	var keys []int
+	expectKey := false
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '{', '[':
+			if l.MaxDepth > 0 && len(keys) >= l.MaxDepth {
+				return fmt.Errorf("%w: nesting deeper than %d", errJSONLimit, l.MaxDepth)
+			}
+			if c == '{' {
+				keys = append(keys, 0)
+				expectKey = true
+			} else {
+				keys = append(keys, -1)
+			}
+		case '}', ']':
+			if len(keys) > 0 {
+				keys = keys[:len(keys)-1]
+			}
+			expectKey = false
+		case ',':
+			expectKey = len(keys) > 0 && keys[len(keys)-1] >= 0
+		case '"':
+			start := i + 1
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			if l.MaxStringLength > 0 && i-start > l.MaxStringLength {
+				return fmt.Errorf("%w: string longer than %d bytes", errJSONLimit, l.MaxStringLength)
+			}
+			if expectKey {
+				expectKey = false
+				if keys[len(keys)-1]++; l.MaxKeys > 0 && keys[len(keys)-1] > l.MaxKeys {
+					return fmt.Errorf("%w: object with more than %d keys", errJSONLimit, l.MaxKeys)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonMediaType reports whether a Content-Type names JSON. An empty type is
+// assumed to be JSON.
+func jsonMediaType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
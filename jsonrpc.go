@@ -0,0 +1,316 @@
+package pushpop
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// JSONRPCProtocol is the WebSocket subprotocol, and the value of the
+// protocol query parameter, that selects JSON-RPC 2.0 framing on hubs
+// built WithJSONRPC.
+const JSONRPCProtocol = "jsonrpc"
+
+// JSON-RPC 2.0 error codes. jsonrpcRefused is a server error code for
+// calls the hub refused; the error's data carries the pushpop code, such
+// as CodeSubscriptionLimit, where there is one.
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcInvalidRequest = -32600
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+	jsonrpcRefused        = -32000
+)
+
+// jsonrpcMethods maps JSON-RPC methods to the frame actions they are
+// dispatched as. "ping" is answered by the read pump.
+var jsonrpcMethods = map[string]string{
+	"subscribe":   "subscribe",
+	"unsubscribe": "unsubscribe",
+	"publish":     "message",
+	"ephemeral":   "ephemeral",
+	"request":     "request",
+	"ack":         "ack",
+	"time":        "time",
+	"members":     "members",
+	"reads":       "reads",
+	"mark_read":   "mark_read",
+}
+
+// WithJSONRPC lets clients speak JSON-RPC 2.0 instead of pushpop's own
+// frames, by requesting the JSONRPCProtocol subprotocol or connecting
+// with ?protocol=jsonrpc. Calls are the frame actions, with "publish" for
+// "message" and "ping" answered with "pong", and take the frame's fields
+// as named params. Every message the client receives arrives as an
+// "event" notification whose params are the message as it would be sent
+// otherwise.
+//
+// Calls with an id are answered once the hub has applied them; subscribe
+// is answered with the pushpop:subscription_succeeded payload, or with the
+// pushpop:subscription_error as an error, in place of those events.
+// Batches are not supported.
+func WithJSONRPC() Option {
+	return func(h *Hub) {
+		h.jsonrpc = true
+	}
+}
+
+// jsonrpcRequested reports whether an upgrade request asks for JSON-RPC
+// framing.
+func jsonrpcRequested(header http.Header, query url.Values) bool {
+	if query.Get("protocol") == JSONRPCProtocol {
+		return true
+	}
+	for _, value := range header.Values("Sec-Websocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			if strings.TrimSpace(protocol) == JSONRPCProtocol {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonrpcHeader returns the response header of an upgrade that accepts
+// the JSONRPCProtocol subprotocol, or nil if the request does not ask for
+// it.
+func (h *Hub) jsonrpcHeader(r *http.Request) http.Header {
+	if !h.jsonrpc || !jsonrpcRequested(r.Header, nil) {
+		return nil
+	}
+	return http.Header{"Sec-Websocket-Protocol": {JSONRPCProtocol}}
+}
+
+// jsonrpcRequest is a JSON-RPC 2.0 request or notification. ID is nil for
+// notifications.
+type jsonrpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonrpcResponse is a JSON-RPC 2.0 response.
+type jsonrpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonrpcError is the error of a JSON-RPC 2.0 response.
+type jsonrpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// jsonrpcNotification is a JSON-RPC 2.0 notification sent to a client.
+type jsonrpcNotification struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// jsonrpcState is the state of a JSON-RPC connection: the ids of
+// subscribe calls waiting for their acknowledgement, by channel name.
+type jsonrpcState struct {
+	mu         sync.Mutex
+	subscribes map[string][]json.RawMessage
+}
+
+// await queues the id of a subscribe call to channel.
+func (s *jsonrpcState) await(channel string, id json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribes[channel] = append(s.subscribes[channel], id)
+}
+
+// cancel removes the id of a subscribe call that was not dispatched.
+func (s *jsonrpcState) cancel(channel string, id json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.subscribes[channel]
+	for i := len(ids) - 1; i >= 0; i-- {
+		if bytes.Equal(ids[i], id) {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	s.store(channel, ids)
+}
+
+// next returns the id of the oldest subscribe call to channel waiting for
+// its acknowledgement.
+func (s *jsonrpcState) next(channel string) (json.RawMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.subscribes[channel]
+	if len(ids) == 0 {
+		return nil, false
+	}
+	s.store(channel, ids[1:])
+	return ids[0], true
+}
+
+// store sets the waiting ids of channel. The caller holds mu.
+func (s *jsonrpcState) store(channel string, ids []json.RawMessage) {
+	if len(ids) == 0 {
+		delete(s.subscribes, channel)
+		return
+	}
+	s.subscribes[channel] = ids
+}
+
+// readJSONRPC handles a JSON-RPC frame from the client.
+func (c *Client) readJSONRPC(data []byte) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		c.replyError(nil, jsonrpcInvalidRequest, "batch requests are not supported", nil)
+		return
+	}
+	var req jsonrpcRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.log.Warn("Invalid JSON from client", "client", c.conn.RemoteAddr(), "message", string(data), "err", err)
+		c.replyError(nil, jsonrpcParseError, "parse error", nil)
+		return
+	}
+	if !validJSONRPCID(req.ID) {
+		c.replyError(nil, jsonrpcInvalidRequest, "invalid id", nil)
+		return
+	}
+	if req.Version != "2.0" || req.Method == "" {
+		c.replyError(req.ID, jsonrpcInvalidRequest, "invalid request", nil)
+		return
+	}
+	params := map[string]interface{}{}
+	if len(req.Params) > 0 && !bytes.Equal(req.Params, []byte("null")) {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			c.replyError(req.ID, jsonrpcInvalidParams, "params must be an object", nil)
+			return
+		}
+	}
+	if req.Method == "ping" {
+		c.reply(req.ID, "pong")
+		return
+	}
+	action, ok := jsonrpcMethods[req.Method]
+	if !ok {
+		c.replyError(req.ID, jsonrpcMethodNotFound, "method not found", nil)
+		return
+	}
+	channel, _ := params["channel"].(string)
+	if channel == "" && (action == "unsubscribe" || action == "message") {
+		c.replyError(req.ID, jsonrpcInvalidParams, "missing channel", nil)
+		return
+	}
+
+	// Subscribe calls are answered by their acknowledgement, which the
+	// hub sends once the subscription is in place.
+	awaiting := action == "subscribe" && req.ID != nil
+	if awaiting {
+		c.rpc.await(channel, req.ID)
+	}
+	frame := &Frame{
+		Client:  c,
+		Action:  action,
+		Channel: channel,
+		Payload: params["payload"],
+		Fields:  params,
+	}
+	if err := c.hub.dispatch(frame); err != nil {
+		c.log.Warn("Dropped frame from client", "action", action, "client", c.conn.RemoteAddr(), "err", err)
+		if awaiting {
+			c.rpc.cancel(channel, req.ID)
+		}
+		code, message := refusalError(err)
+		c.replyError(req.ID, jsonrpcRefused, message, map[string]interface{}{"code": code})
+		return
+	}
+	if !awaiting {
+		c.reply(req.ID, true)
+	}
+}
+
+// validJSONRPCID reports whether id is absent, a string, a number, or
+// null.
+func validJSONRPCID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var value interface{}
+	if err := json.Unmarshal(id, &value); err != nil {
+		return false
+	}
+	switch value.(type) {
+	case string, float64, nil:
+		return true
+	}
+	return false
+}
+
+// refusalError maps an error of a dispatched frame to the code and
+// message of a JSON-RPC error. As for subscriptions, only coded errors
+// have their message passed on.
+func refusalError(err error) (code, message string) {
+	var coded interface{ Code() string }
+	if errors.As(err, &coded) {
+		return coded.Code(), err.Error()
+	}
+	return CodeForbidden, "request refused"
+}
+
+// reply answers a JSON-RPC call with result. Notifications, which have
+// no id, are not answered.
+func (c *Client) reply(id json.RawMessage, result interface{}) {
+	if id == nil {
+		return
+	}
+	c.hub.sendControl(c, Message{Priority: PriorityHigh, response: &jsonrpcResponse{Version: "2.0", Result: result, ID: id}})
+}
+
+// replyError answers a JSON-RPC call with an error. Errors for requests
+// whose id could not be read carry a null id.
+func (c *Client) replyError(id json.RawMessage, code int, message string, data interface{}) {
+	if id == nil {
+		if code != jsonrpcParseError && code != jsonrpcInvalidRequest {
+			return
+		}
+		id = json.RawMessage("null")
+	}
+	c.hub.sendControl(c, Message{Priority: PriorityHigh, response: &jsonrpcResponse{
+		Version: "2.0",
+		Error:   &jsonrpcError{Code: code, Message: message, Data: data},
+		ID:      id,
+	}})
+}
+
+// jsonrpcFrame returns what a JSON-RPC client is sent for message: a
+// queued response, the answer to a subscribe call for its
+// acknowledgement, or else an "event" notification.
+func (c *Client) jsonrpcFrame(message Message) interface{} {
+	if message.response != nil {
+		return message.response
+	}
+	switch message.Event {
+	case EventSubscriptionSucceeded, EventSubscriptionError:
+		id, ok := c.rpc.next(message.Channel)
+		if !ok {
+			break
+		}
+		if message.Event == EventSubscriptionSucceeded {
+			return &jsonrpcResponse{Version: "2.0", Result: message.Payload, ID: id}
+		}
+		payload, _ := message.Payload.(map[string]interface{})
+		reason, _ := payload["message"].(string)
+		return &jsonrpcResponse{Version: "2.0", Error: &jsonrpcError{
+			Code:    jsonrpcRefused,
+			Message: reason,
+			Data:    map[string]interface{}{"code": payload["code"]},
+		}, ID: id}
+	}
+	return jsonrpcNotification{Version: "2.0", Method: "event", Params: message}
+}
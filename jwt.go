@@ -0,0 +1,179 @@
+package pushpop
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	errMalformedToken = errors.New("malformed token")
+	errUnsupportedAlg = errors.New("unsupported token algorithm")
+	errTokenSignature = errors.New("invalid token signature")
+)
+
+// jwtHeader is the JOSE header of a signed token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// parseJWT splits a compact JWS into its header, claims, signed content,
+// and signature, without verifying it.
+func parseJWT(token string) (jwtHeader, map[string]interface{}, []byte, []byte, error) {
+	var header jwtHeader
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return header, nil, nil, nil, errMalformedToken
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header, nil, nil, nil, errMalformedToken
+	}
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return header, nil, nil, nil, errMalformedToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return header, nil, nil, nil, errMalformedToken
+	}
+	var claims map[string]interface{}
+	if json.Unmarshal(rawHeader, &header) != nil || json.Unmarshal(rawClaims, &claims) != nil {
+		return header, nil, nil, nil, errMalformedToken
+	}
+	signed := []byte(token[:len(parts[0])+1+len(parts[1])])
+	return header, claims, signed, signature, nil
+}
+
+// verifyJWS checks a signature made with one of the asymmetric algorithms
+// used by OpenID providers. Symmetric and "none" algorithms are refused.
+func verifyJWS(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if alg == "EdDSA" {
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, signed, signature) {
+			return errTokenSignature
+		}
+		return nil
+	}
+	if len(alg) != 5 {
+		return errUnsupportedAlg
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return errUnsupportedAlg
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errTokenSignature
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, nil)
+		}
+		if err != nil {
+			return errTokenSignature
+		}
+		return nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature)%2 != 0 {
+			return errTokenSignature
+		}
+		half := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:half])
+		s := new(big.Int).SetBytes(signature[half:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errTokenSignature
+		}
+		return nil
+	default:
+		return errUnsupportedAlg
+	}
+}
+
+// jwk is a JSON Web Key from a provider's key set.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key material of a signing key.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
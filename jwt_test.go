@@ -0,0 +1,159 @@
+package pushpop
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// signJWT returns a compact JWS of claims signed by key with alg.
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, err := json.Marshal(jwtHeader{Alg: alg, Kid: kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	signed := encode(header) + "." + encode(payload)
+	return signed + "." + encode(signJWS(t, alg, key, []byte(signed)))
+}
+
+// signJWS signs content the way verifyJWS checks it.
+func signJWS(t *testing.T, alg string, key crypto.Signer, content []byte) []byte {
+	t.Helper()
+	if alg == "EdDSA" {
+		return ed25519.Sign(key.(ed25519.PrivateKey), content)
+	}
+	hash := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}[alg[2:]]
+	h := hash.New()
+	h.Write(content)
+	digest := h.Sum(nil)
+	var signature []byte
+	var err error
+	switch alg[:2] {
+	case "RS":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), hash, digest)
+	case "PS":
+		signature, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), hash, digest, nil)
+	case "ES":
+		priv := key.(*ecdsa.PrivateKey)
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, priv, digest)
+		size := (priv.Curve.Params().BitSize + 7) / 8
+		signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	default:
+		t.Fatalf("cannot sign with %s", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+// testSigners returns one key of each supported type.
+func testSigners(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsaKey, ecKey, edKey
+}
+
+func TestVerifyJWS(t *testing.T) {
+	rsaKey, ecKey, edKey := testSigners(t)
+	otherRSA, otherEC, otherEd := testSigners(t)
+	content := []byte("header.claims")
+	tampered := []byte("header.claimz")
+	tests := []struct {
+		name    string
+		alg     string
+		signer  crypto.Signer
+		key     crypto.PublicKey
+		content []byte
+		err     error
+	}{
+		{"RS256", "RS256", rsaKey, rsaKey.Public(), content, nil},
+		{"RS512", "RS512", rsaKey, rsaKey.Public(), content, nil},
+		{"PS384", "PS384", rsaKey, rsaKey.Public(), content, nil},
+		{"ES256", "ES256", ecKey, ecKey.Public(), content, nil},
+		{"EdDSA", "EdDSA", edKey, edKey.Public(), content, nil},
+		{"RS256 tampered", "RS256", rsaKey, rsaKey.Public(), tampered, errTokenSignature},
+		{"PS384 tampered", "PS384", rsaKey, rsaKey.Public(), tampered, errTokenSignature},
+		{"ES256 tampered", "ES256", ecKey, ecKey.Public(), tampered, errTokenSignature},
+		{"EdDSA tampered", "EdDSA", edKey, edKey.Public(), tampered, errTokenSignature},
+		{"RS256 wrong key", "RS256", rsaKey, otherRSA.Public(), content, errTokenSignature},
+		{"ES256 wrong key", "ES256", ecKey, otherEC.Public(), content, errTokenSignature},
+		{"EdDSA wrong key", "EdDSA", edKey, otherEd.Public(), content, errTokenSignature},
+		{"key of another type", "RS256", rsaKey, ecKey.Public(), content, errTokenSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature := signJWS(t, tt.alg, tt.signer, content)
+			if err := verifyJWS(tt.alg, tt.key, tt.content, signature); err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// Symmetric and unsigned tokens are refused whatever the key, so a
+	// public key cannot be used as an HMAC secret.
+	for _, alg := range []string{"HS256", "none", "", "RS1", "ES999"} {
+		if err := verifyJWS(alg, rsaKey.Public(), content, nil); err != errUnsupportedAlg {
+			t.Errorf("%q: got %v, want %v", alg, err, errUnsupportedAlg)
+		}
+	}
+}
+
+func TestParseJWT(t *testing.T) {
+	_, _, edKey := testSigners(t)
+	token := signJWT(t, "EdDSA", "k1", edKey, map[string]interface{}{"sub": "alice"})
+	header, claims, signed, signature, err := parseJWT(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Alg != "EdDSA" || header.Kid != "k1" || claims["sub"] != "alice" {
+		t.Errorf("got header %+v, claims %v", header, claims)
+	}
+	if verifyJWS(header.Alg, edKey.Public(), signed, signature) != nil {
+		t.Error("parsed token does not verify")
+	}
+
+	parts := strings.Split(token, ".")
+	encode := base64.RawURLEncoding.EncodeToString
+	for name, token := range map[string]string{
+		"empty":                "",
+		"two parts":            parts[0] + "." + parts[1],
+		"four parts":           token + ".x",
+		"bad header":           "!." + parts[1] + "." + parts[2],
+		"bad claims":           parts[0] + ".!." + parts[2],
+		"bad signature":        parts[0] + "." + parts[1] + ".!",
+		"header not JSON":      encode([]byte("alg")) + "." + parts[1] + "." + parts[2],
+		"claims not JSON":      parts[0] + "." + encode([]byte("sub")) + "." + parts[2],
+		"claims not an object": parts[0] + "." + encode([]byte(`["sub"]`)) + "." + parts[2],
+	} {
+		if _, _, _, _, err := parseJWT(token); err != errMalformedToken {
+			t.Errorf("%s: got %v, want %v", name, err, errMalformedToken)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package pushpop
+
+import (
+	"sync"
+	"time"
+)
+
+// LastSeen records when an authenticated user was last connected and
+// active.
+type LastSeen struct {
+	UserID string `json:"user_id"`
+	// LastConnected is when the user's most recent connection was opened.
+	LastConnected time.Time `json:"last_connected"`
+	// LastActive is when the user last sent a frame or disconnected.
+	LastActive time.Time `json:"last_active"`
+	// Online reports whether the user currently has an open connection.
+	Online bool `json:"online"`
+	// Connections counts the user's open connections on this node.
+	Connections int `json:"connections"`
+}
+
+// lastSeenStore tracks LastSeen per user ID.
+type lastSeenStore struct {
+	mu          sync.RWMutex
+	users       map[string]*LastSeen
+	connections map[string]int
+}
+
+func newLastSeenStore() *lastSeenStore {
+	return &lastSeenStore{
+		users:       make(map[string]*LastSeen),
+		connections: make(map[string]int),
+	}
+}
+
+func (s *lastSeenStore) connected(userID string, at time.Time) {
+	if userID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := s.entry(userID)
+	seen.LastConnected = at
+	seen.LastActive = at
+	s.connections[userID]++
+}
+
+func (s *lastSeenStore) active(userID string, at time.Time) {
+	if userID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entry(userID).LastActive = at
+}
+
+func (s *lastSeenStore) disconnected(userID string, at time.Time) {
+	if userID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entry(userID).LastActive = at
+	if s.connections[userID]--; s.connections[userID] <= 0 {
+		delete(s.connections, userID)
+	}
+}
+
+// entry returns the record for userID, creating it. Callers hold mu.
+func (s *lastSeenStore) entry(userID string) *LastSeen {
+	seen, ok := s.users[userID]
+	if !ok {
+		seen = &LastSeen{UserID: userID}
+		s.users[userID] = seen
+	}
+	return seen
+}
+
+func (s *lastSeenStore) get(userID string) (LastSeen, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen, ok := s.users[userID]
+	if !ok {
+		return LastSeen{}, false
+	}
+	result := *seen
+	result.Connections = s.connections[userID]
+	result.Online = result.Connections > 0
+	return result, true
+}
+
+func (s *lastSeenStore) count(userID string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connections[userID]
+}
+
+// forget deletes the record of userID and reports whether there was one.
+// Open connections stay counted.
+func (s *lastSeenStore) forget(userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[userID]
+	delete(s.users, userID)
+	return ok
+}
+
+// LastSeen returns the last-connected and last-active timestamps of an
+// authenticated user.
+func (h *Hub) LastSeen(userID string) (LastSeen, bool) {
+	return h.lastSeen.get(userID)
+}
+
+// UserConnections returns how many connections an authenticated user has
+// open on this node.
+func (h *Hub) UserConnections(userID string) int {
+	return h.lastSeen.count(userID)
+}
@@ -0,0 +1,237 @@
+package pushpop
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	errHubStopped     = errors.New("hub is not running")
+	errAlreadyRunning = errors.New("hub is already running")
+)
+
+// start marks the hub as running and returns the channel to close when Run
+// returns. A hub that ran before gets a fresh channel, and the flags set by
+// Shutdown are cleared so it accepts connections and messages again.
+func (h *Hub) start(cancel context.CancelFunc) (chan struct{}, error) {
+	h.lifecycleMu.Lock()
+	defer h.lifecycleMu.Unlock()
+	if h.cancelRun != nil {
+		return nil, errAlreadyRunning
+	}
+	select {
+	case <-h.done:
+		h.done = make(chan struct{})
+	default:
+	}
+	h.cancelRun = cancel
+	h.closing.Store(false)
+	h.intakeClosed.Store(false)
+	return h.done, nil
+}
+
+// finish marks the hub as stopped.
+func (h *Hub) finish(done chan struct{}) {
+	h.lifecycleMu.Lock()
+	defer h.lifecycleMu.Unlock()
+	h.cancelRun = nil
+	close(done)
+}
+
+// stopped returns a channel that is closed once Run returns, and stays
+// closed until Run is called again.
+func (h *Hub) stopped() <-chan struct{} {
+	h.lifecycleMu.Lock()
+	defer h.lifecycleMu.Unlock()
+	return h.done
+}
+
+// EventShutdown tells clients that the server is shutting down, just before
+// their connection is closed with code 1001 (going away).
+const EventShutdown = "pushpop:shutdown"
+
+// ShutdownPhases bounds the phases of Shutdown, which run in the order of
+// the fields. A zero timeout lets a phase wait as long as Shutdown's context
+// allows; a phase that times out is logged and the next one starts.
+type ShutdownPhases struct {
+	// Upgrades is how long to wait for WebSocket handshakes in progress
+	// once new connections are refused.
+	Upgrades time.Duration
+	// Intake is how long to wait for /trigger and ingest requests in
+	// progress once new messages are refused.
+	Intake time.Duration
+	// Broadcasts is how long to wait for queued messages, including those
+	// held back by channel rate limits, to reach client buffers.
+	Broadcasts time.Duration
+	// Clients is how long to wait for clients to flush their buffers after
+	// the shutdown notice and close frame.
+	Clients time.Duration
+}
+
+// WithShutdownPhases sets the timeouts of the Shutdown phases.
+func WithShutdownPhases(phases ShutdownPhases) Option {
+	return func(h *Hub) {
+		h.shutdownPhases = phases
+	}
+}
+
+// Shutdown stops the hub in phases: new connections are refused, then new
+// messages, then queued broadcasts are delivered, and finally every client
+// is sent an EventShutdown notice and a close frame with code 1001 and
+// removed. Run is stopped once the clients' buffers are flushed and its
+// queues are drained. It returns when Run has returned or ctx is done,
+// whichever comes first; see WithShutdownPhases to bound each phase.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	phases := h.shutdownPhases
+	h.shutdownPhase(ctx, "upgrades", phases.Upgrades, func(ctx context.Context) {
+		h.closing.Store(true)
+		h.upgrades.wait(ctx)
+	})
+	h.shutdownPhase(ctx, "intake", phases.Intake, func(ctx context.Context) {
+		h.intakeClosed.Store(true)
+		h.intake.wait(ctx)
+	})
+	h.shutdownPhase(ctx, "broadcasts", phases.Broadcasts, h.waitBroadcasts)
+	h.shutdownPhase(ctx, "clients", phases.Clients, h.closeClients)
+
+	h.lifecycleMu.Lock()
+	cancel, done := h.cancelRun, h.done
+	h.lifecycleMu.Unlock()
+	if cancel == nil {
+		// Run is not running.
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdownPhase runs a phase of Shutdown, bounded by timeout if it is set.
+func (h *Hub) shutdownPhase(ctx context.Context, name string, timeout time.Duration, run func(context.Context)) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	run(ctx)
+	if ctx.Err() != nil {
+		h.log.Warn("Shutdown phase timed out", "phase", name, "elapsed", time.Since(start))
+		return
+	}
+	h.log.Debug("Shutdown phase complete", "phase", name, "elapsed", time.Since(start))
+}
+
+// waitBroadcasts waits until the broadcast queues and the rate limit queues
+// are empty. Queues are polled, as channels cannot be waited on to empty.
+func (h *Hub) waitBroadcasts(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for len(h.broadcast) > 0 || len(h.remote) > 0 || len(h.targeted) > 0 || h.limiters.draining() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.stopped():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeClients sends every client the shutdown notice and a close frame,
+// removes it, and waits for its write pump to flush.
+func (h *Hub) closeClients(ctx context.Context) {
+	var clients []*Client
+	h.clients.Range(func(key, _ interface{}) bool {
+		client := key.(*Client)
+		h.sendControl(client, Message{Event: EventShutdown, Priority: PriorityHigh})
+		client.closeCode.Store(websocket.CloseGoingAway)
+		h.RemoveClient(client)
+		clients = append(clients, client)
+		return true
+	})
+	for _, client := range clients {
+		select {
+		case <-client.flushed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// inflight counts requests in progress that a shutdown phase waits for.
+type inflight struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+// add records a request starting. Callers check whether the phase has
+// begun after add, so the phase cannot miss them.
+func (f *inflight) add() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n++
+}
+
+// done records a request finishing.
+func (f *inflight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n--; f.n == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// wait returns once no requests are in progress or ctx is done.
+func (f *inflight) wait(ctx context.Context) {
+	f.mu.Lock()
+	if f.n == 0 {
+		f.mu.Unlock()
+		return
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.mu.Unlock()
+	select {
+	case <-idle:
+	case <-ctx.Done():
+	}
+}
+
+// drain processes events that were queued before Run was stopped, so
+// pending subscriptions, removals, and broadcasts are not silently lost.
+func (h *Hub) drain() {
+	for {
+		select {
+		case sub := <-h.register:
+			h.safely(sub.Client, func() { h.subscribe(sub) })
+		case sub := <-h.unregister:
+			h.safely(sub.Client, func() { h.removeSubscription(sub) })
+		case client := <-h.leave:
+			h.safely(client, func() { h.removeSubscriptions(client) })
+		case req := <-h.resume:
+			h.safely(req.client, func() { h.resumeClient(req) })
+		case message := <-h.broadcast:
+			h.safely(nil, func() { h.broadcastMessage(message) })
+		case message := <-h.remote:
+			h.safely(nil, func() { h.broadcastMessage(message) })
+		case target := <-h.targeted:
+			h.safely(nil, func() { h.deliverTargeted(target) })
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package pushpop
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// maxTriggerBodySize is the default limit of WithTriggerBodyLimit.
+const maxTriggerBodySize = 1 << 20
+
+// errPayloadTooLarge is returned for messages whose payload exceeds the
+// hub's payload size limit.
+var errPayloadTooLarge = errors.New("payload too large")
+
+// ChannelLimits overrides the connection limits of clients subscribed to
+// matching channels.
+type ChannelLimits struct {
+	// ReadLimit is the largest inbound frame, in bytes.
+	ReadLimit int64 `json:"read_limit,omitempty"`
+	// IdleTimeout is how long a connection may go without answering a
+	// heartbeat before it is closed.
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+}
+
+// MarshalJSON writes IdleTimeout as a duration string like "30s".
+func (l ChannelLimits) MarshalJSON() ([]byte, error) {
+	type plain ChannelLimits
+	return json.Marshal(struct {
+		plain
+		IdleTimeout jsonDuration `json:"idle_timeout,omitempty"`
+	}{plain(l), jsonDuration(l.IdleTimeout)})
+}
+
+// UnmarshalJSON reads IdleTimeout as a duration string, or as nanoseconds
+// as written before.
+func (l *ChannelLimits) UnmarshalJSON(data []byte) error {
+	type plain ChannelLimits
+	v := struct {
+		*plain
+		IdleTimeout jsonDuration `json:"idle_timeout,omitempty"`
+	}{(*plain)(l), jsonDuration(l.IdleTimeout)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	l.IdleTimeout = time.Duration(v.IdleTimeout)
+	return nil
+}
+
+// readLimiter is implemented by transports that enforce frame size limits and
+// read deadlines, such as *websocket.Conn.
+type readLimiter interface {
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+}
+
+// WithReadLimit sets the largest inbound frame a client may send, in bytes.
+// Defaults to 512.
+func WithReadLimit(limit int64) Option {
+	return func(h *Hub) {
+		h.readLimit = limit
+	}
+}
+
+// WithIdleTimeout sets how long a connection may go without answering a
+// heartbeat before it is closed. Heartbeats are sent at 90% of the timeout.
+// Defaults to 30s, which zero or less leaves in place.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(h *Hub) {
+		if timeout > 0 {
+			h.idleTimeout = timeout
+		}
+	}
+}
+
+// WithTriggerBodyLimit sets the largest request body /trigger accepts, in
+// bytes; larger requests are answered with 413. Defaults to 1 MiB, and zero
+// or less removes the limit.
+func WithTriggerBodyLimit(limit int64) Option {
+	return func(h *Hub) {
+		h.triggerBodyLimit = limit
+	}
+}
+
+// WithMaxPayloadSize caps the encoded size of every published payload, in
+// bytes, whether triggered by the server or published by a client, so one
+// oversized message cannot fill every subscriber's buffer. Larger messages
+// are rejected; /trigger answers 413. Unlimited by default.
+func WithMaxPayloadSize(limit int) Option {
+	return func(h *Hub) {
+		h.maxPayloadSize = limit
+	}
+}
+
+// payloadFits reports whether message's payload is within the payload size
+// limit.
+func (h *Hub) payloadFits(message Message) bool {
+	if h.maxPayloadSize <= 0 {
+		return true
+	}
+	data, err := json.Marshal(message.Payload)
+	return err == nil && len(data) <= h.maxPayloadSize
+}
+
+// WithChannelLimits raises the limits of clients subscribed to any channel
+// starting with prefix, e.g. larger frames for "telemetry-" channels. A
+// client gets the largest limits among the hub defaults and the overrides
+// of its channels; zero fields leave the default in place. It is shorthand
+// for WithChannelDefaults with only Limits set.
+func WithChannelLimits(prefix string, limits ChannelLimits) Option {
+	return WithChannelDefaults(prefix, ChannelSettings{Limits: &limits})
+}
+
+// updateLimits recomputes a client's limits from its subscriptions. It runs
+// on the Run goroutine whenever the subscriptions change.
+func (h *Hub) updateLimits(client *Client) {
+	if !h.registry.configured() {
+		return
+	}
+	readLimit, idleTimeout := h.readLimit, h.idleTimeout
+	client.channels.Range(func(key, _ interface{}) bool {
+		if limits := h.settingsFor(key.(string)).Limits; limits != nil {
+			readLimit = max(readLimit, limits.ReadLimit)
+			idleTimeout = max(idleTimeout, limits.IdleTimeout)
+		}
+		return true
+	})
+	client.readLimit.Store(readLimit)
+	client.idleTimeout.Store(int64(idleTimeout))
+}
+
+// idle returns the client's current idle timeout.
+func (c *Client) idle() time.Duration {
+	return time.Duration(c.idleTimeout.Load())
+}
+
+// pingPeriod returns how often the write pump pings the client. It is
+// always positive, as tickers require.
+func (c *Client) pingPeriod() time.Duration {
+	return max(c.idle()*9/10, time.Millisecond)
+}
@@ -0,0 +1,128 @@
+package pushpop
+
+import "time"
+
+// EventMemberUpdated announces a presence member's status change.
+const EventMemberUpdated = "pushpop:member_updated"
+
+// Member statuses reported with presence liveness.
+const (
+	MemberOnline = "online"
+	MemberAway   = "away"
+)
+
+// PresenceLiveness marks presence members away, and finally removes them,
+// when their connection goes silent, rather than waiting for a TCP-level
+// disconnect that can take minutes to notice. Any frame or heartbeat pong
+// counts as activity, so Away should exceed the heartbeat interval.
+type PresenceLiveness struct {
+	// Away marks a member away after this long without activity, with a
+	// member_updated event. Defaults to 60s.
+	Away time.Duration
+	// Offline disconnects the member's connection after this long without
+	// activity, which emits member_removed. Defaults to twice Away.
+	Offline time.Duration
+}
+
+// WithPresenceLiveness enables liveness tracking of presence members.
+func WithPresenceLiveness(liveness PresenceLiveness) Option {
+	return func(h *Hub) {
+		if liveness.Away <= 0 {
+			liveness.Away = time.Minute
+		}
+		if liveness.Offline <= liveness.Away {
+			liveness.Offline = 2 * liveness.Away
+		}
+		h.liveness = &liveness
+		h.presence.statuses = true
+	}
+}
+
+// touch records activity on the connection.
+func (c *Client) touch(now time.Time) {
+	c.lastActive.Store(now.UnixNano())
+}
+
+// presenceEntry is a member of a presence channel and one of its
+// connections.
+type presenceEntry struct {
+	channel string
+	client  *Client
+	member  Member
+}
+
+// entries lists every member of every presence channel.
+func (s *presenceStore) entries() []presenceEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var entries []presenceEntry
+	for channel, clients := range s.channels {
+		for client, member := range clients {
+			entries = append(entries, presenceEntry{channel: channel, client: client, member: member})
+		}
+	}
+	return entries
+}
+
+// setStatus changes the status of a member's connection.
+func (s *presenceStore) setStatus(channel string, client *Client, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if member, ok := s.channels[channel][client]; ok {
+		member.Status = status
+		s.channels[channel][client] = member
+	}
+}
+
+// statusChanges settles each member's status, online if any of its
+// connections is, and returns the members whose status changed since it was
+// last announced.
+func (s *presenceStore) statusChanges() []presenceEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changed []presenceEntry
+	for channel, clients := range s.channels {
+		statuses := make(map[string]string, len(s.refs[channel]))
+		for _, member := range clients {
+			if statuses[member.ID] != MemberOnline {
+				statuses[member.ID] = member.Status
+			}
+		}
+		for _, member := range s.unique(channel) {
+			ref := s.refs[channel][member.ID]
+			if status := statuses[member.ID]; status != ref.status {
+				ref.status = status
+				member.Status = status
+				changed = append(changed, presenceEntry{channel: channel, member: member})
+			}
+		}
+	}
+	return changed
+}
+
+// checkLiveness updates the status of every presence member and
+// disconnects members that went offline. It runs on the Run goroutine.
+func (h *Hub) checkLiveness(now time.Time) {
+	offline := make(map[*Client]bool)
+	for _, entry := range h.presence.entries() {
+		idle := now.Sub(time.Unix(0, entry.client.lastActive.Load()))
+		status := MemberOnline
+		switch {
+		case idle >= h.liveness.Offline:
+			offline[entry.client] = true
+			continue
+		case idle >= h.liveness.Away:
+			status = MemberAway
+		}
+		if status != entry.member.Status {
+			h.presence.setStatus(entry.channel, entry.client, status)
+		}
+	}
+	for _, entry := range h.presence.statusChanges() {
+		h.broadcastMessage(stamp(Message{Channel: entry.channel, Event: EventMemberUpdated, Payload: entry.member}, Origin{Type: OriginServer}))
+	}
+	for client := range offline {
+		h.log.Info("Disconnecting offline presence member", "client", client.conn.RemoteAddr())
+		h.evict(client)
+	}
+}
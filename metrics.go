@@ -0,0 +1,101 @@
+package pushpop
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// rttBuckets are the upper bounds, in seconds, of the RTT histogram.
+var rttBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// metrics holds the hub's Prometheus metrics.
+type metrics struct {
+	rtt *histogram
+	// channels is nil unless per-channel metrics are enabled.
+	channels *channelMetrics
+
+	evictedCount atomic.Uint64
+	evictedAge   atomic.Uint64
+	evictedBytes atomic.Uint64
+}
+
+// historyEvicted counts history evictions.
+func (m *metrics) historyEvicted(e evictions) {
+	m.evictedCount.Add(uint64(e.count))
+	m.evictedAge.Add(uint64(e.age))
+	m.evictedBytes.Add(uint64(e.bytes))
+}
+
+func newMetrics() *metrics {
+	return &metrics{rtt: newHistogram(rttBuckets)}
+}
+
+// histogram is a cumulative Prometheus histogram.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, h.sum, name, h.count)
+}
+
+// writeGauge writes a single gauge sample.
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+}
+
+// HandleMetrics returns an HTTP handler that serves the hub's metrics in the
+// Prometheus text format.
+func HandleMetrics(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		connections := 0
+		hub.clients.Range(func(_, _ interface{}) bool {
+			connections++
+			return true
+		})
+		writeGauge(w, "pushpop_connections", "Open client connections.", float64(connections))
+		writeGauge(w, "pushpop_channels", "Occupied channels.", float64(len(hub.Channels())))
+		hub.metrics.rtt.write(w, "pushpop_connection_rtt_seconds", "Round-trip time of protocol heartbeats.")
+		writeGauge(w, "pushpop_history_messages", "Messages kept in channel history.", float64(hub.history.size()))
+		fmt.Fprintf(w, "# HELP pushpop_history_evictions_total Messages evicted from channel history by retention.\n# TYPE pushpop_history_evictions_total counter\n")
+		fmt.Fprintf(w, "pushpop_history_evictions_total{reason=\"count\"} %d\n", hub.metrics.evictedCount.Load())
+		fmt.Fprintf(w, "pushpop_history_evictions_total{reason=\"age\"} %d\n", hub.metrics.evictedAge.Load())
+		fmt.Fprintf(w, "pushpop_history_evictions_total{reason=\"bytes\"} %d\n", hub.metrics.evictedBytes.Load())
+		if hub.metrics.channels != nil {
+			hub.metrics.channels.write(w, hub)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package pushpop
+
+// Frame is an inbound client frame after it has been decoded.
+type Frame struct {
+	// Client is the connection the frame arrived on.
+	Client *Client
+	// Action is the frame's action, e.g. "subscribe" or "message".
+	Action string
+	// Channel is the channel the action applies to, if any.
+	Channel string
+	// Payload is the message payload for "message" frames.
+	Payload interface{}
+	// Fields holds every field of the decoded frame, including ones pushpop
+	// does not interpret itself.
+	Fields map[string]interface{}
+}
+
+// FrameHandler handles an inbound client frame. A returned error drops the
+// frame and is logged.
+type FrameHandler func(frame *Frame) error
+
+// Middleware wraps a FrameHandler, in the style of net/http middleware, to
+// add behavior such as authorization, validation, rate limiting, or
+// metrics to every inbound frame before it reaches the hub.
+type Middleware func(next FrameHandler) FrameHandler
+
+// WithMiddleware appends middleware to the inbound frame chain. Middleware
+// runs in the order given, so the first middleware sees each frame first.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(h *Hub) {
+		h.middleware = append(h.middleware, middleware...)
+	}
+}
+
+// buildFrameChain wraps the hub's frame handler in the configured
+// middleware.
+func (h *Hub) buildFrameChain() {
+	handler := FrameHandler(h.handleFrame)
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		handler = h.middleware[i](handler)
+	}
+	h.dispatch = handler
+}
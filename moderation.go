@@ -0,0 +1,141 @@
+package pushpop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// moderationTimeout bounds a moderation decision; clients wait for it
+// before their message is broadcast.
+const moderationTimeout = 5 * time.Second
+
+// EventPublishRejected tells a client that a message it published was
+// rejected by moderation, with the reason.
+const EventPublishRejected = "pushpop:publish_rejected"
+
+var errModerationUnavailable = errors.New("moderation unavailable")
+
+// Moderator reviews every message a client publishes, including ephemeral
+// events, before it is broadcast. It returns the payload to broadcast,
+// which may be rewritten, e.g. with profanity masked, or an error to
+// reject the message; the error's text is sent to the publisher as the
+// reason.
+type Moderator interface {
+	Moderate(ctx context.Context, session *Session, message Message) (interface{}, error)
+}
+
+// ModeratorFunc adapts a function to a Moderator.
+type ModeratorFunc func(ctx context.Context, session *Session, message Message) (interface{}, error)
+
+// Moderate calls f.
+func (f ModeratorFunc) Moderate(ctx context.Context, session *Session, message Message) (interface{}, error) {
+	return f(ctx, session, message)
+}
+
+// WithModerator reviews client messages with m. Messages published through
+// /trigger or Trigger are not moderated.
+func WithModerator(m Moderator) Option {
+	return func(h *Hub) {
+		h.moderator = m
+	}
+}
+
+// HTTPModerator is a Moderator that asks a moderation service. URL
+// receives a POST of
+//
+//	{"channel": "chat-42", "event": "message", "payload": {...}, "ephemeral": false, "user_id": "u42", "socket_id": "..."}
+//
+// and answers {"allow": true}, optionally with a rewritten "payload", or
+// {"allow": false, "reason": "..."}. An unreachable service or any status
+// but 200 rejects the message.
+type HTTPModerator struct {
+	URL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Moderate asks the moderation service.
+func (m *HTTPModerator) Moderate(ctx context.Context, session *Session, message Message) (interface{}, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"channel":   message.Channel,
+		"event":     message.Event,
+		"payload":   message.Payload,
+		"ephemeral": message.Ephemeral,
+		"user_id":   session.UserID,
+		"socket_id": session.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errModerationUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status %s", errModerationUnavailable, resp.Status)
+	}
+	var decision struct {
+		Allow   bool            `json:"allow"`
+		Payload json.RawMessage `json:"payload"`
+		Reason  string          `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return nil, fmt.Errorf("%w: %v", errModerationUnavailable, err)
+	}
+	if !decision.Allow {
+		if decision.Reason == "" {
+			decision.Reason = "rejected by moderation"
+		}
+		return nil, errors.New(decision.Reason)
+	}
+	if len(decision.Payload) == 0 {
+		return message.Payload, nil
+	}
+	var payload interface{}
+	if err := json.Unmarshal(decision.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", errModerationUnavailable, err)
+	}
+	return payload, nil
+}
+
+// moderate passes a client's message through the moderator, telling the
+// client why if it is rejected.
+func (h *Hub) moderate(client *Client, message Message) (Message, error) {
+	if h.moderator == nil {
+		return message, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), moderationTimeout)
+	defer cancel()
+	payload, err := h.moderator.Moderate(ctx, client.session, message)
+	if err != nil {
+		reason := err.Error()
+		if errors.Is(err, errModerationUnavailable) {
+			// Do not leak the moderation service's details.
+			reason = errModerationUnavailable.Error()
+		}
+		h.sendControl(client, Message{
+			Channel:  message.Channel,
+			Event:    EventPublishRejected,
+			Payload:  map[string]interface{}{"event": message.Event, "reason": reason},
+			Priority: PriorityHigh,
+		})
+		return message, err
+	}
+	message.Payload = payload
+	return message, nil
+}
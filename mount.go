@@ -0,0 +1,51 @@
+package pushpop
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Mount serves hub's endpoints on mux under prefix, so several hubs with
+// their own options, e.g. "/realtime/chat" and "/realtime/metrics", can run
+// in one process with isolated state and limits:
+//
+//	mux := http.NewServeMux()
+//	pushpop.Mount(mux, "/realtime/chat", chat)
+//	pushpop.Mount(mux, "/realtime/metrics", metrics)
+//
+// See Handler for the endpoints.
+func Mount(mux *http.ServeMux, prefix string, hub *Hub) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, hub.Handler()))
+}
+
+// Handler returns a handler serving the hub's endpoints at the root, for
+// embedding in an existing router and middleware stack; strip any prefix
+// with http.StripPrefix. The endpoints are those of the server binary:
+// /ws, /trigger, /trigger/batch, /sockjs/, /jobs/{id},
+// /channels/{name}/history, /channels/{name}/reads, /messages/{id}/receipts,
+// /scheduled/{id}, /federation, /metrics, /time, /healthz, /readyz, and
+// /admin/ if the hub has an admin token.
+// Webhook ingest needs its sources, so serve HandleIngest separately.
+func (h *Hub) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", ServeWs(h))
+	mux.HandleFunc("/trigger", HandleTrigger(h))
+	mux.HandleFunc("/trigger/batch", HandleTriggerBatch(h))
+	mux.Handle("/sockjs/", HandleSockJS(h, "/sockjs"))
+	mux.HandleFunc("GET /jobs/{id}", HandleJob(h))
+	mux.HandleFunc("GET /channels/{name}/history", HandleHistory(h))
+	mux.HandleFunc("GET /channels/{name}/reads", HandleReads(h))
+	mux.HandleFunc("GET /messages/{id}/receipts", HandleReceipts(h))
+	mux.HandleFunc("GET /scheduled/{id}", HandleScheduled(h))
+	mux.HandleFunc("DELETE /scheduled/{id}", HandleCancelScheduled(h))
+	mux.HandleFunc("/federation", HandleFederation(h))
+	mux.HandleFunc("/metrics", HandleMetrics(h))
+	mux.HandleFunc("/time", HandleTime())
+	mux.HandleFunc("/healthz", HandleHealth(h))
+	mux.HandleFunc("/readyz", HandleReady(h))
+	if h.adminToken.Get() != "" {
+		mux.Handle("/admin/", HandleAdmin(h))
+	}
+	return mux
+}
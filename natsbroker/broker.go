@@ -0,0 +1,95 @@
+// Package natsbroker implements a pushpop Broker on NATS core pub/sub, either
+// against an external NATS deployment or a server embedded in the pushpop
+// process.
+package natsbroker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/biohackerellie/pushpop"
+	"github.com/nats-io/nats.go"
+)
+
+// Config configures a Broker.
+type Config struct {
+	// URL is the NATS server URL, e.g. nats://localhost:4222. Several URLs
+	// may be given separated by commas.
+	URL string
+	// Subject is the NATS subject used for relaying. Defaults to "pushpop".
+	Subject string
+	// Options are passed to nats.Connect.
+	Options []nats.Option
+}
+
+// Broker relays hub broadcasts over NATS.
+type Broker struct {
+	conn    *nats.Conn
+	subject string
+	node    string
+}
+
+// envelope tags relayed messages with the publishing node so a node can
+// ignore its own messages.
+type envelope struct {
+	Node    string          `json:"node"`
+	Message pushpop.Message `json:"message"`
+}
+
+// New connects to NATS. The connection reconnects indefinitely and keeps
+// its subscriptions across reconnects.
+func New(cfg Config) (*Broker, error) {
+	if cfg.Subject == "" {
+		cfg.Subject = "pushpop"
+	}
+	opts := append([]nats.Option{nats.Name("pushpop"), nats.MaxReconnects(-1)}, cfg.Options...)
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Broker{conn: conn, subject: cfg.Subject, node: newNodeID()}, nil
+}
+
+// Publish relays message to the other nodes.
+func (b *Broker) Publish(_ context.Context, message pushpop.Message) error {
+	data, err := json.Marshal(envelope{Node: b.node, Message: message})
+	if err != nil {
+		return err
+	}
+	return b.conn.Publish(b.subject, data)
+}
+
+// Ping round-trips to the NATS server.
+func (b *Broker) Ping(ctx context.Context) error {
+	return b.conn.FlushWithContext(ctx)
+}
+
+// Subscribe delivers messages from other nodes to handler until ctx is
+// cancelled.
+func (b *Broker) Subscribe(ctx context.Context, handler func(pushpop.Message)) error {
+	sub, err := b.conn.Subscribe(b.subject, func(msg *nats.Msg) {
+		var env envelope
+		if err := json.Unmarshal(msg.Data, &env); err != nil || env.Node == b.node {
+			return
+		}
+		handler(env.Message)
+	})
+	if err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return sub.Unsubscribe()
+}
+
+// Close drains and closes the NATS connection.
+func (b *Broker) Close() error {
+	return b.conn.Drain()
+}
+
+func newNodeID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,37 @@
+package natsbroker
+
+import "errors"
+
+// ErrEmbeddedUnavailable is returned by StartEmbedded in builds without the
+// embednats build tag.
+var ErrEmbeddedUnavailable = errors.New("natsbroker: built without the embednats tag")
+
+// EmbeddedConfig configures a NATS server embedded in the pushpop process.
+type EmbeddedConfig struct {
+	// Host and Port are the client listen address. Defaults to
+	// 127.0.0.1:4222.
+	Host string
+	Port int
+	// ClusterName, ClusterPort, and Routes join embedded servers on
+	// several pushpop nodes into a NATS cluster. Routes are
+	// nats-route://host:port URLs of the other nodes.
+	ClusterName string
+	ClusterPort int
+	Routes      []string
+}
+
+// Embedded is a running embedded NATS server.
+type Embedded struct {
+	url      string
+	shutdown func()
+}
+
+// ClientURL returns the URL brokers should connect to.
+func (e *Embedded) ClientURL() string {
+	return e.url
+}
+
+// Shutdown stops the embedded server.
+func (e *Embedded) Shutdown() {
+	e.shutdown()
+}
@@ -0,0 +1,53 @@
+//go:build embednats
+
+package natsbroker
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// StartEmbedded starts a NATS server inside the pushpop process, so
+// multi-node fan-out works without external infrastructure.
+func StartEmbedded(cfg EmbeddedConfig) (*Embedded, error) {
+	opts := &server.Options{
+		ServerName: "pushpop",
+		Host:       cfg.Host,
+		Port:       cfg.Port,
+		NoSigs:     true,
+	}
+	if opts.Host == "" {
+		opts.Host = "127.0.0.1"
+	}
+	if opts.Port == 0 {
+		opts.Port = 4222
+	}
+	if cfg.ClusterPort != 0 {
+		opts.Cluster = server.ClusterOpts{
+			Name: cfg.ClusterName,
+			Host: "0.0.0.0",
+			Port: cfg.ClusterPort,
+		}
+		for _, route := range cfg.Routes {
+			u, err := url.Parse(route)
+			if err != nil {
+				return nil, err
+			}
+			opts.Routes = append(opts.Routes, u)
+		}
+	}
+
+	srv, err := server.NewServer(opts)
+	if err != nil {
+		return nil, err
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(10 * time.Second) {
+		srv.Shutdown()
+		return nil, errors.New("natsbroker: embedded server did not start")
+	}
+	return &Embedded{url: srv.ClientURL(), shutdown: srv.Shutdown}, nil
+}
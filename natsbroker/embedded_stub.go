@@ -0,0 +1,9 @@
+//go:build !embednats
+
+package natsbroker
+
+// StartEmbedded is unavailable unless pushpop is built with the embednats
+// tag, which keeps the NATS server out of default builds.
+func StartEmbedded(EmbeddedConfig) (*Embedded, error) {
+	return nil, ErrEmbeddedUnavailable
+}
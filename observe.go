@@ -0,0 +1,44 @@
+package pushpop
+
+import "time"
+
+// MessageRecord describes the fan-out of a message on a channel by this
+// node, for traffic analysis; see WithMessageObserver.
+type MessageRecord struct {
+	// Message is the message as subscribers received it, after any
+	// transform.
+	Message Message
+	// Enqueued is how many subscribers the message was enqueued to, and
+	// Failed how many it was not, e.g. because their buffers were full.
+	Enqueued int
+	Failed   int
+	// FannedOutAt is when the node fanned the message out; the envelope
+	// timestamp is when it was published.
+	FannedOutAt time.Time
+}
+
+// WithMessageObserver calls observe with a record of every message the hub
+// fans out on a channel, including messages from other nodes, but not
+// global broadcasts or messages to a single connection. It runs on the
+// hub's dispatch goroutine and must not block; hand the records off to
+// another goroutine, as the analytics package does.
+func WithMessageObserver(observe func(MessageRecord)) Option {
+	return func(h *Hub) {
+		h.observers = append(h.observers, observe)
+	}
+}
+
+// observe reports a message's fan-out to the observers.
+func (h *Hub) observe(message Message, report *deliveryReport) {
+	record := MessageRecord{
+		Message:     message,
+		Enqueued:    report.enqueued,
+		Failed:      len(report.failures),
+		FannedOutAt: time.Now(),
+	}
+	record.Message.fanout = nil
+	record.Message.peer = nil
+	for _, observe := range h.observers {
+		h.safely(nil, func() { observe(record) })
+	}
+}
@@ -0,0 +1,260 @@
+package pushpop
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// oidcTimeout bounds fetching the provider's configuration and keys.
+	oidcTimeout = 10 * time.Second
+	// jwksMaxAge is how long fetched keys are trusted before refetching,
+	// and jwksMinRefresh the least time between fetches prompted by an
+	// unknown key ID.
+	jwksMaxAge     = time.Hour
+	jwksMinRefresh = 30 * time.Second
+)
+
+var (
+	errMissingToken = errors.New("missing access token")
+	errTokenExpired = errors.New("token expired")
+	errTokenClaims  = errors.New("invalid token claims")
+	errUnknownKey   = errors.New("unknown token signing key")
+)
+
+// OIDCConfig validates OpenID Connect access tokens at connect time.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL, e.g.
+	// "https://accounts.example.com". Its discovery document supplies the
+	// key set unless JWKSURL is set.
+	Issuer string
+	// Audience must be listed in the token's aud claim, if set.
+	Audience string
+	JWKSURL  string
+	// UserClaim is the claim used as Session.UserID; defaults to "sub".
+	UserClaim string
+	// TagClaims copies string claims, such as "org" or "role", into
+	// session tags of the same name for selectors and policies.
+	TagClaims []string
+	// Optional admits connections without a token as anonymous. Invalid
+	// tokens are always rejected.
+	Optional bool
+	// Leeway tolerates clock skew in exp and nbf; defaults to 1m.
+	Leeway time.Duration
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// WithOIDC authenticates connections with OIDC access tokens, sent as an
+// "Authorization: Bearer" header or an access_token query parameter, as
+// browsers cannot set WebSocket headers. The verified token sets the
+// session's UserID and UserInfo, from the name, email, and picture claims,
+// and the claims are stored under the "claims" session value, before the
+// OnConnect hook runs.
+func WithOIDC(config OIDCConfig) Option {
+	return func(h *Hub) {
+		if config.UserClaim == "" {
+			config.UserClaim = "sub"
+		}
+		if config.Leeway <= 0 {
+			config.Leeway = time.Minute
+		}
+		if config.Client == nil {
+			config.Client = http.DefaultClient
+		}
+		h.oidc = &oidcVerifier{config: config}
+	}
+}
+
+// oidcVerifier validates tokens against a provider's cached key set.
+type oidcVerifier struct {
+	config OIDCConfig
+
+	mu      sync.Mutex
+	jwksURL string
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// authenticate validates the session's token and maps its claims.
+func (v *oidcVerifier) authenticate(session *Session) error {
+	token := session.Query.Get("access_token")
+	if bearer, ok := strings.CutPrefix(session.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	if token == "" {
+		if v.config.Optional {
+			return nil
+		}
+		return errMissingToken
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcTimeout)
+	defer cancel()
+	claims, err := v.verify(ctx, token, time.Now())
+	if err != nil {
+		return err
+	}
+
+	userID, _ := claims[v.config.UserClaim].(string)
+	if userID == "" {
+		return errTokenClaims
+	}
+	session.UserID = userID
+	info := make(map[string]string)
+	for _, claim := range []string{"name", "email", "picture"} {
+		if value, ok := claims[claim].(string); ok {
+			info[claim] = value
+		}
+	}
+	if len(info) > 0 {
+		session.UserInfo = info
+	}
+	for _, claim := range v.config.TagClaims {
+		if value, ok := claims[claim].(string); ok {
+			session.SetTag(claim, value)
+		}
+	}
+	session.Set("claims", claims)
+	return nil
+}
+
+// verify checks a token's signature, issuer, audience, and validity period
+// and returns its claims.
+func (v *oidcVerifier) verify(ctx context.Context, token string, now time.Time) (map[string]interface{}, error) {
+	header, claims, signed, signature, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	key, err := v.key(ctx, header.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWS(header.Alg, key, signed, signature); err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+		return nil, errTokenClaims
+	}
+	if v.config.Audience != "" && !audienceIncludes(claims["aud"], v.config.Audience) {
+		return nil, errTokenClaims
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errTokenClaims
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.config.Leeway)) {
+		return nil, errTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-v.config.Leeway)) {
+		return nil, errTokenClaims
+	}
+	return claims, nil
+}
+
+// audienceIncludes reports whether an aud claim, a string or a list of
+// strings, names audience.
+func audienceIncludes(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		return slices.Contains(aud, interface{}(audience))
+	default:
+		return false
+	}
+}
+
+// key returns the signing key with the given ID, refetching the key set
+// when it is stale or the ID is unknown, e.g. after the provider rotated
+// its keys.
+func (v *oidcVerifier) key(ctx context.Context, kid string, now time.Time) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	key, ok := v.keys[kid]
+	stale := now.Sub(v.fetched) > jwksMaxAge
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && now.Sub(v.fetched) < jwksMinRefresh {
+		return nil, errUnknownKey
+	}
+	// Failed fetches are not retried for jwksMinRefresh either.
+	v.fetched = now
+	if err := v.fetchKeys(ctx); err != nil {
+		if ok {
+			// Keep using a known key while the provider is unreachable.
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, ok = v.keys[kid]; !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// fetchKeys fetches the provider's key set, discovering its URL first if
+// needed. Callers hold mu.
+func (v *oidcVerifier) fetchKeys(ctx context.Context) error {
+	if v.jwksURL == "" {
+		v.jwksURL = v.config.JWKSURL
+	}
+	if v.jwksURL == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		url := strings.TrimSuffix(v.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.getJSON(ctx, url, &discovery); err != nil {
+			return err
+		}
+		if discovery.Issuer != v.config.Issuer || discovery.JWKSURI == "" {
+			return fmt.Errorf("oidc: discovery document does not match issuer %s", v.config.Issuer)
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := v.getJSON(ctx, v.jwksURL, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	v.keys = keys
+	return nil
+}
+
+func (v *oidcVerifier) getJSON(ctx context.Context, url string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
@@ -0,0 +1,248 @@
+package pushpop
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publicJWK returns the JSON Web Key of pub.
+func publicJWK(kid string, pub crypto.PublicKey) jwk {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return jwk{Kid: kid, Kty: "RSA", Use: "sig", N: encode(pub.N.Bytes()), E: encode(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return jwk{Kid: kid, Kty: "EC", Crv: pub.Curve.Params().Name, X: encode(pub.X.FillBytes(make([]byte, size))), Y: encode(pub.Y.FillBytes(make([]byte, size)))}
+	case ed25519.PublicKey:
+		return jwk{Kid: kid, Kty: "OKP", Crv: "Ed25519", X: encode(pub)}
+	}
+	panic("unsupported key type")
+}
+
+// testProvider is an OpenID provider serving a discovery document and a
+// key set that tests can rotate.
+type testProvider struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    []jwk
+	fetches int
+	down    bool
+}
+
+func newTestProvider(t *testing.T, keys ...jwk) *testProvider {
+	p := &testProvider{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": p.URL, "jwks_uri": p.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.fetches++
+		if p.down {
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]jwk{"keys": p.keys})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// rotate replaces the provider's key set.
+func (p *testProvider) rotate(keys ...jwk) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+}
+
+// newOIDCVerifier returns the verifier WithOIDC configures.
+func newOIDCVerifier(config OIDCConfig) *oidcVerifier {
+	h := &Hub{}
+	WithOIDC(config)(h)
+	return h.oidc
+}
+
+func TestOIDCVerify(t *testing.T) {
+	rsaKey, ecKey, edKey := testSigners(t)
+	provider := newTestProvider(t, publicJWK("rsa", rsaKey.Public()), publicJWK("ec", ecKey.Public()), publicJWK("ed", edKey.Public()))
+	verifier := newOIDCVerifier(OIDCConfig{Issuer: provider.URL, Audience: "pushpop"})
+
+	now := time.Now()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": provider.URL, "aud": "pushpop", "sub": "alice", "exp": now.Add(time.Hour).Unix()}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+			} else {
+				c[name] = value
+			}
+		}
+		return c
+	}
+	valid := signJWT(t, "RS256", "rsa", rsaKey, claims(nil))
+	parts := strings.Split(valid, ".")
+	other := strings.Split(signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"sub": "mallory"})), ".")
+	// unsigned returns a token with alg and an HMAC-SHA256 signature made
+	// with an empty secret, which an HS256 verifier might accept.
+	unsigned := func(alg string) string {
+		header, _ := json.Marshal(jwtHeader{Alg: alg, Kid: "rsa"})
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + parts[1]
+		mac := hmac.New(sha256.New, nil)
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"RS256", valid, nil},
+		{"ES256", signJWT(t, "ES256", "ec", ecKey, claims(nil)), nil},
+		{"EdDSA", signJWT(t, "EdDSA", "ed", edKey, claims(nil)), nil},
+		{"audience list", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": []string{"other", "pushpop"}})), nil},
+		{"tampered claims", parts[0] + "." + other[1] + "." + parts[2], errTokenSignature},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + other[2], errTokenSignature},
+		{"signed by another key", signJWT(t, "ES256", "rsa", ecKey, claims(nil)), errTokenSignature},
+		{"empty HMAC secret", unsigned("HS256"), errUnsupportedAlg},
+		{"alg none", unsigned("none"), errUnsupportedAlg},
+		{"unknown key", signJWT(t, "RS256", "gone", rsaKey, claims(nil)), errUnknownKey},
+		{"malformed", "not.a.token", errMalformedToken},
+		{"wrong issuer", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})), errTokenClaims},
+		{"wrong audience", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"})), errTokenClaims},
+		{"no audience", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": nil})), errTokenClaims},
+		{"expired", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()})), errTokenExpired},
+		{"expired within leeway", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()})), nil},
+		{"no expiry", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": nil})), errTokenClaims},
+		{"not yet valid", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()})), errTokenClaims},
+		{"valid within leeway", signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": now.Add(30 * time.Second).Unix()})), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.verify(context.Background(), tt.token, now); err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	oldKey, newKey, _ := testSigners(t)
+	provider := newTestProvider(t, publicJWK("old", oldKey.Public()))
+	verifier := newOIDCVerifier(OIDCConfig{Issuer: provider.URL})
+
+	now := time.Now()
+	claims := map[string]interface{}{"iss": provider.URL, "sub": "alice", "exp": now.Add(3 * time.Hour).Unix()}
+	oldToken := signJWT(t, "RS256", "old", oldKey, claims)
+	newToken := signJWT(t, "ES256", "new", newKey, claims)
+
+	rotate := func() { provider.rotate(publicJWK("new", newKey.Public())) }
+	down := func() {
+		provider.mu.Lock()
+		defer provider.mu.Unlock()
+		provider.down = true
+	}
+	steps := []struct {
+		name    string
+		before  func()
+		token   string
+		after   time.Duration
+		err     error
+		fetches int
+	}{
+		{"old key", nil, oldToken, 0, nil, 1},
+		{"cached old key", nil, oldToken, time.Second, nil, 1},
+		{"rotated too soon", rotate, newToken, 10 * time.Second, errUnknownKey, 1},
+		{"rotated", nil, newToken, time.Minute, nil, 2},
+		{"retired old key", nil, oldToken, time.Minute, errUnknownKey, 2},
+		{"stale while provider down", down, newToken, 2 * time.Hour, nil, 3},
+	}
+	for i, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		if _, err := verifier.verify(context.Background(), step.token, now.Add(step.after)); err != step.err {
+			t.Errorf("step %d (%s): got %v, want %v", i, step.name, err, step.err)
+		}
+		provider.mu.Lock()
+		fetches := provider.fetches
+		provider.mu.Unlock()
+		if fetches != step.fetches {
+			t.Errorf("step %d (%s): %d key set fetches, want %d", i, step.name, fetches, step.fetches)
+		}
+	}
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	_, _, key := testSigners(t)
+	provider := newTestProvider(t, publicJWK("k1", key.Public()))
+	claims := map[string]interface{}{
+		"iss":   provider.URL,
+		"sub":   "alice",
+		"email": "alice@example.com",
+		"org":   "acme",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	token := signJWT(t, "EdDSA", "k1", key, claims)
+	delete(claims, "sub")
+	noSubject := signJWT(t, "EdDSA", "k1", key, claims)
+
+	tests := []struct {
+		name     string
+		optional bool
+		header   http.Header
+		query    url.Values
+		user     string
+		err      error
+	}{
+		{"bearer", false, http.Header{"Authorization": {"Bearer " + token}}, nil, "alice", nil},
+		{"query", false, nil, url.Values{"access_token": {token}}, "alice", nil},
+		{"missing", false, nil, nil, "", errMissingToken},
+		{"optional missing", true, nil, nil, "", nil},
+		{"optional invalid", true, nil, url.Values{"access_token": {"garbage"}}, "", errMalformedToken},
+		{"no subject", false, http.Header{"Authorization": {"Bearer " + noSubject}}, nil, "", errTokenClaims},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := newOIDCVerifier(OIDCConfig{Issuer: provider.URL, TagClaims: []string{"org"}, Optional: tt.optional})
+			session := &Session{Header: tt.header, Query: tt.query}
+			if err := verifier.authenticate(session); err != tt.err {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if session.UserID != tt.user {
+				t.Errorf("user %q, want %q", session.UserID, tt.user)
+			}
+			if tt.user == "" {
+				return
+			}
+			if info, _ := session.UserInfo.(map[string]string); info["email"] != "alice@example.com" {
+				t.Errorf("user info %v", session.UserInfo)
+			}
+			if org, _ := session.Tag("org"); org != "acme" {
+				t.Errorf("org tag %q", org)
+			}
+			if _, ok := session.Get("claims"); !ok {
+				t.Error("claims not stored")
+			}
+		})
+	}
+}
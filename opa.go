@@ -0,0 +1,73 @@
+package pushpop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// OPAPolicy is a Policy that asks an Open Policy Agent server through its
+// data API. URL names a boolean rule, e.g.
+// "http://localhost:8181/v1/data/pushpop/allow", which is queried with the
+// input
+//
+//	{"action": "subscribe", "channel": "orders", "user_id": "u42", "tags": {"org": "acme"}, "remote_ip": "10.0.0.7"}
+//
+// An undefined or false result denies, and so does an unreachable server.
+type OPAPolicy struct {
+	URL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// opaInput is the input document of an OPA query.
+type opaInput struct {
+	Action   Action            `json:"action"`
+	Channel  string            `json:"channel"`
+	UserID   string            `json:"user_id,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	RemoteIP string            `json:"remote_ip,omitempty"`
+}
+
+// Authorize queries the OPA rule.
+func (p *OPAPolicy) Authorize(ctx context.Context, session *Session, action Action, channel string) error {
+	body, err := json.Marshal(map[string]opaInput{"input": {
+		Action:   action,
+		Channel:  channel,
+		UserID:   session.UserID,
+		Tags:     session.Tags(),
+		RemoteIP: session.RemoteIP,
+	}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPolicyUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: opa: unexpected status %s", errPolicyUnavailable, resp.Status)
+	}
+	var decision struct {
+		Result bool `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return fmt.Errorf("%w: %v", errPolicyUnavailable, err)
+	}
+	if !decision.Result {
+		return errPolicyDenied
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package pushpop
+
+import "time"
+
+// Option configures optional Hub behavior.
+type Option func(*Hub)
+
+// WithRecoveryWindow keeps the subscriptions of a disconnected client for the
+// given window and buffers up to bufferSize messages published to them. A
+// client that reconnects with its resume token inside the window has its
+// subscriptions and missed messages restored automatically.
+func WithRecoveryWindow(window time.Duration, bufferSize int) Option {
+	return func(h *Hub) {
+		h.recoveryWindow = window
+		h.recoveryBuffer = bufferSize
+	}
+}
@@ -0,0 +1,24 @@
+package pushpop
+
+// Ownership reports which cluster node owns a channel's state, such as
+// history, presence, and sequencing, so that state can be sharded across
+// nodes instead of kept in a global store.
+type Ownership interface {
+	// Owner returns the name of the node that owns channel.
+	Owner(channel string) string
+	// IsLocal reports whether this node owns channel.
+	IsLocal(channel string) bool
+}
+
+// WithOwnership shards per-channel state across cluster nodes.
+func WithOwnership(ownership Ownership) Option {
+	return func(h *Hub) {
+		h.ownership = ownership
+	}
+}
+
+// OwnsChannel reports whether this hub owns the state of channel. Without a
+// configured Ownership every hub owns every channel.
+func (h *Hub) OwnsChannel(channel string) bool {
+	return h.ownership == nil || h.ownership.IsLocal(channel)
+}
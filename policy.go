@@ -0,0 +1,189 @@
+package pushpop
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Action is an operation authorized by a Policy.
+type Action string
+
+// Actions checked against the policy.
+const (
+	ActionSubscribe Action = "subscribe"
+	ActionPublish   Action = "publish"
+)
+
+// policyTimeout bounds each policy decision.
+const policyTimeout = 5 * time.Second
+
+var (
+	errPolicyDenied = errors.New("denied by policy")
+	// errPolicyUnavailable wraps failures to reach a decision, which
+	// clients may retry.
+	errPolicyUnavailable = errors.New("policy unavailable")
+)
+
+// Policy decides whether a session may subscribe or publish to a channel,
+// for organization-wide rules that would be awkward to hand-code in hooks.
+// Returning an error denies the action. An error with a Code() string
+// method chooses the code of the resulting subscription error.
+type Policy interface {
+	Authorize(ctx context.Context, session *Session, action Action, channel string) error
+}
+
+// PolicyFunc adapts a function to a Policy, e.g. to consult a Casbin
+// enforcer:
+//
+//	pushpop.PolicyFunc(func(ctx context.Context, s *pushpop.Session, action pushpop.Action, channel string) error {
+//		if ok, err := enforcer.Enforce(s.UserID, channel, string(action)); err != nil || !ok {
+//			return errors.New("forbidden")
+//		}
+//		return nil
+//	})
+type PolicyFunc func(ctx context.Context, session *Session, action Action, channel string) error
+
+// Authorize calls f.
+func (f PolicyFunc) Authorize(ctx context.Context, session *Session, action Action, channel string) error {
+	return f(ctx, session, action, channel)
+}
+
+// WithPolicy delegates subscribe and client publish authorization to
+// policy. It is consulted after the OnSubscribe hook, which may still deny
+// first, and before a client's message is accepted.
+func WithPolicy(policy Policy) Option {
+	return func(h *Hub) {
+		h.policy = policy
+	}
+}
+
+// authorize asks the policy, if any, whether session may perform action.
+func (h *Hub) authorize(session *Session, action Action, channel string) error {
+	if h.policy == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), policyTimeout)
+	defer cancel()
+	return h.policy.Authorize(ctx, session, action, channel)
+}
+
+// Rule allows, or with Deny denies, actions on channels. Empty fields match
+// anything.
+type Rule struct {
+	Actions []Action `json:"actions,omitempty"`
+	// Channels are patterns in which "*" matches any run of characters.
+	// "{user}" is replaced by the session's user ID and "{tag:name}" by the
+	// value of its tag, e.g. "org-{tag:org}-*"; a pattern whose variable is
+	// unset matches nothing.
+	Channels []string `json:"channels,omitempty"`
+	// Users lists user IDs; "*" matches any authenticated user.
+	Users []string `json:"users,omitempty"`
+	// Tags selects sessions carrying every tag.
+	Tags Selector `json:"tags,omitempty"`
+	Deny bool     `json:"deny,omitempty"`
+}
+
+// RulePolicy is a built-in Policy that applies the first matching rule.
+// Actions no rule matches are allowed, or denied with DefaultDeny.
+type RulePolicy struct {
+	Rules       []Rule `json:"rules"`
+	DefaultDeny bool   `json:"default_deny,omitempty"`
+}
+
+// Authorize applies the first rule matching the action.
+func (p *RulePolicy) Authorize(_ context.Context, session *Session, action Action, channel string) error {
+	for _, rule := range p.Rules {
+		if rule.matches(session, action, channel) {
+			if rule.Deny {
+				return errPolicyDenied
+			}
+			return nil
+		}
+	}
+	if p.DefaultDeny {
+		return errPolicyDenied
+	}
+	return nil
+}
+
+func (r *Rule) matches(session *Session, action Action, channel string) bool {
+	if len(r.Actions) > 0 && !slices.Contains(r.Actions, action) {
+		return false
+	}
+	if len(r.Users) > 0 && !slices.Contains(r.Users, session.UserID) &&
+		!(session.UserID != "" && slices.Contains(r.Users, "*")) {
+		return false
+	}
+	if len(r.Tags) > 0 && !r.Tags.Matches(session) {
+		return false
+	}
+	if len(r.Channels) == 0 {
+		return true
+	}
+	for _, pattern := range r.Channels {
+		if pattern, ok := expandPattern(pattern, session); ok && matchPattern(pattern, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPattern replaces the session variables in a channel pattern. It
+// returns false if a variable is unset.
+func expandPattern(pattern string, session *Session) (string, bool) {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			b.WriteString(pattern)
+			return b.String(), true
+		}
+		end := strings.IndexByte(pattern[start:], '}')
+		if end < 0 {
+			b.WriteString(pattern)
+			return b.String(), true
+		}
+		end += start
+		b.WriteString(pattern[:start])
+
+		var value string
+		switch name := pattern[start+1 : end]; {
+		case name == "user":
+			value = session.UserID
+		case strings.HasPrefix(name, "tag:"):
+			value, _ = session.Tag(strings.TrimPrefix(name, "tag:"))
+		default:
+			value = pattern[start : end+1]
+		}
+		if value == "" {
+			return "", false
+		}
+		b.WriteString(value)
+		pattern = pattern[end+1:]
+	}
+}
+
+// matchPattern reports whether s matches pattern, in which "*" matches any
+// run of characters.
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
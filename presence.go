@@ -0,0 +1,290 @@
+package pushpop
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PresencePrefix marks presence channels. Subscribers of a presence channel
+// are tracked as members, and member changes are announced on the channel.
+const PresencePrefix = "presence-"
+
+// Presence events.
+const (
+	EventMemberAdded   = "pushpop:member_added"
+	EventMemberRemoved = "pushpop:member_removed"
+	EventMembers       = "pushpop:members"
+)
+
+// Member is a subscriber of a presence channel.
+type Member struct {
+	// ID is the member's user ID, or its socket ID for anonymous sessions.
+	ID string `json:"id"`
+	// UserInfo is the application data attached to the session by hooks,
+	// such as a display name and avatar.
+	UserInfo interface{} `json:"user_info,omitempty"`
+	// LastActive is when an authenticated member last sent a frame.
+	LastActive *time.Time `json:"last_active,omitempty"`
+	// Status is "online" or "away" when presence liveness is enabled. A
+	// member is away only once all of its connections are.
+	Status string `json:"status,omitempty"`
+	// Connections counts the member's connections subscribed to the
+	// channel on this node, e.g. one per open browser tab or device.
+	Connections int `json:"connections,omitempty"`
+}
+
+// IsPresenceChannel reports whether channel is a presence channel.
+func IsPresenceChannel(channel string) bool {
+	return strings.HasPrefix(channel, PresencePrefix)
+}
+
+// presenceStore tracks the members of presence channels. A user with
+// several connections is one member, counted in refs.
+type presenceStore struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Client]Member
+	refs     map[string]map[string]*presenceRef
+	// statuses marks new members online, for presence liveness.
+	statuses bool
+
+	// restored holds members loaded from a snapshot, by channel and member
+	// ID, until they reconnect or restoredUntil passes.
+	restored      map[string]map[string]Member
+	restoredUntil time.Time
+}
+
+// presenceRef counts a member's connections to a channel.
+type presenceRef struct {
+	connections int
+	// status is the member's last announced status.
+	status string
+}
+
+func newPresenceStore() *presenceStore {
+	return &presenceStore{
+		channels: make(map[string]map[*Client]Member),
+		refs:     make(map[string]map[string]*presenceRef),
+	}
+}
+
+// add records client as a member of channel and returns the member, or false
+// if the member is not new: the client was already subscribed, or the same
+// user has another connection to the channel. A member reclaiming its
+// restored membership also returns false, since other members never saw it
+// leave.
+func (s *presenceStore) add(channel string, client *Client, member Member) (Member, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.channels[channel][client]; ok {
+		return Member{}, false
+	}
+	if s.statuses {
+		member.Status = MemberOnline
+	}
+	if s.channels[channel] == nil {
+		s.channels[channel] = make(map[*Client]Member)
+	}
+	s.channels[channel][client] = member
+	if s.refs[channel] == nil {
+		s.refs[channel] = make(map[string]*presenceRef)
+	}
+	ref := s.refs[channel][member.ID]
+	if ref == nil {
+		ref = &presenceRef{status: member.Status}
+		s.refs[channel][member.ID] = ref
+	}
+	ref.connections++
+	member.Connections = ref.connections
+	if ref.connections > 1 {
+		return member, false
+	}
+	if _, ok := s.restored[channel][member.ID]; ok {
+		delete(s.restored[channel], member.ID)
+		if len(s.restored[channel]) == 0 {
+			delete(s.restored, channel)
+		}
+		return member, false
+	}
+	return member, true
+}
+
+// remove drops client from channel's members and returns the member it
+// held, or false unless it was the member's last connection.
+func (s *presenceStore) remove(channel string, client *Client) (Member, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	member, ok := s.channels[channel][client]
+	if !ok {
+		return Member{}, false
+	}
+	delete(s.channels[channel], client)
+	if len(s.channels[channel]) == 0 {
+		delete(s.channels, channel)
+	}
+	ref := s.refs[channel][member.ID]
+	if ref.connections--; ref.connections > 0 {
+		return Member{}, false
+	}
+	delete(s.refs[channel], member.ID)
+	if len(s.refs[channel]) == 0 {
+		delete(s.refs, channel)
+	}
+	return member, true
+}
+
+// members lists channel's current members, once per ID.
+func (s *presenceStore) members(channel string) []Member {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	members := s.unique(channel)
+	for _, member := range s.restored[channel] {
+		members = append(members, member)
+	}
+	return members
+}
+
+// unique lists channel's connected members once per ID, with their
+// connection count and announced status. Callers hold mu.
+func (s *presenceStore) unique(channel string) []Member {
+	refs := s.refs[channel]
+	members := make([]Member, 0, len(refs))
+	seen := make(map[string]bool, len(refs))
+	for _, member := range s.channels[channel] {
+		if seen[member.ID] {
+			continue
+		}
+		seen[member.ID] = true
+		ref := refs[member.ID]
+		member.Connections = ref.connections
+		member.Status = ref.status
+		members = append(members, member)
+	}
+	return members
+}
+
+// restore holds members from a snapshot until deadline.
+func (s *presenceStore) restore(channels map[string][]Member, deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restored = make(map[string]map[string]Member, len(channels))
+	for channel, members := range channels {
+		s.restored[channel] = make(map[string]Member, len(members))
+		for _, member := range members {
+			member.LastActive = nil
+			member.Connections = 0
+			s.restored[channel][member.ID] = member
+		}
+	}
+	s.restoredUntil = deadline
+}
+
+// expireRestored drops the restored members that did not reconnect and
+// returns them by channel.
+func (s *presenceStore) expireRestored() map[string]map[string]Member {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expired := s.restored
+	s.restored = nil
+	return expired
+}
+
+// forgetRestored drops the restored memberships of member id and returns
+// their channels.
+func (s *presenceStore) forgetRestored(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var channels []string
+	for channel, members := range s.restored {
+		if _, ok := members[id]; ok {
+			delete(members, id)
+			if len(members) == 0 {
+				delete(s.restored, channel)
+			}
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// channelsOf lists the channels member id is connected to, in order.
+func (s *presenceStore) channelsOf(id string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var channels []string
+	for channel, refs := range s.refs {
+		if ref, ok := refs[id]; ok && ref.connections > 0 {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// snapshot lists the members of every presence channel, once per ID.
+func (s *presenceStore) snapshot() map[string][]Member {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	channels := make(map[string][]Member, len(s.channels))
+	for channel := range s.channels {
+		channels[channel] = s.unique(channel)
+	}
+	return channels
+}
+
+// memberOf returns the presence member of session. Hooks may set the
+// session's UserID and UserInfo on the client's read goroutine, so it is
+// called there and the result handed to Run with the subscription.
+func memberOf(session *Session) Member {
+	id := session.UserID
+	if id == "" {
+		id = session.ID
+	}
+	return Member{ID: id, UserInfo: session.UserInfo}
+}
+
+// Members returns the current members of a presence channel, including
+// the last-active time of authenticated members.
+func (h *Hub) Members(channel string) []Member {
+	members := h.presence.members(channel)
+	for i := range members {
+		if seen, ok := h.lastSeen.get(members[i].ID); ok {
+			members[i].LastActive = &seen.LastActive
+		}
+	}
+	return members
+}
+
+// joinPresence records a presence member's connection and announces the
+// member on its first connection.
+func (h *Hub) joinPresence(channel string, client *Client, member Member) {
+	if member, ok := h.presence.add(channel, client, member); ok {
+		h.broadcastMessage(stamp(Message{Channel: channel, Event: EventMemberAdded, Payload: member}, Origin{Type: OriginServer}))
+	}
+}
+
+// expireRestoredPresence announces the departure of restored members that
+// did not reconnect in time.
+func (h *Hub) expireRestoredPresence() {
+	channels := h.presence.expireRestored()
+	names := make([]string, 0, len(channels))
+	for channel := range channels {
+		names = append(names, channel)
+	}
+	sort.Strings(names)
+	for _, channel := range names {
+		for _, member := range channels[channel] {
+			h.broadcastMessage(stamp(Message{Channel: channel, Event: EventMemberRemoved, Payload: member}, Origin{Type: OriginServer}))
+		}
+	}
+}
+
+// leavePresence removes a presence member's connection and announces the
+// member's departure with its last connection.
+func (h *Hub) leavePresence(channel string, client *Client) {
+	if member, ok := h.presence.remove(channel, client); ok {
+		h.broadcastMessage(stamp(Message{Channel: channel, Event: EventMemberRemoved, Payload: member}, Origin{Type: OriginServer}))
+	}
+}
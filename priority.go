@@ -0,0 +1,33 @@
+package pushpop
+
+// Priority orders a client's queued messages. On a slow connection, queued
+// high priority messages are written before normal ones, and normal before
+// low, so alerts and control messages are not stuck behind a backlog of
+// telemetry.
+type Priority string
+
+// Message priorities. Unknown priorities are treated as normal.
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = ""
+	PriorityLow    Priority = "low"
+)
+
+// Queue sizes for high and low priority messages; normal messages use the
+// 256 message send buffer.
+const (
+	highQueueSize = 64
+	lowQueueSize  = 256
+)
+
+// queue returns the buffer for messages of priority p.
+func (c *Client) queue(p Priority) chan Message {
+	switch p {
+	case PriorityHigh:
+		return c.high
+	case PriorityLow:
+		return c.low
+	default:
+		return c.send
+	}
+}
@@ -0,0 +1,498 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: pushpop/v1/publish.proto
+
+package pushpopv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Message is a message to publish.
+type Message struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// channel is the channel to publish to, unless channels is set.
+	Channel string `protobuf:"bytes,1,opt,name=channel,proto3" json:"channel,omitempty"`
+	// channels publishes the message to each channel, sharing one ID.
+	Channels []string        `protobuf:"bytes,2,rep,name=channels,proto3" json:"channels,omitempty"`
+	Event    string          `protobuf:"bytes,3,opt,name=event,proto3" json:"event,omitempty"`
+	Payload  *structpb.Value `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	// idempotency_key publishes the message once: publishing again with the
+	// key within 10 minutes returns the first message's ID.
+	IdempotencyKey string `protobuf:"bytes,5,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_pushpop_v1_publish_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_pushpop_v1_publish_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_pushpop_v1_publish_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Message) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *Message) GetChannels() []string {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
+}
+
+func (x *Message) GetEvent() string {
+	if x != nil {
+		return x.Event
+	}
+	return ""
+}
+
+func (x *Message) GetPayload() *structpb.Value {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Message) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+type PublishRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message *Message               `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// report waits for the message to be fanned out and reports the
+	// subscribers on the node that handled the call it was enqueued to.
+	Report        bool `protobuf:"varint,2,opt,name=report,proto3" json:"report,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishRequest) Reset() {
+	*x = PublishRequest{}
+	mi := &file_pushpop_v1_publish_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishRequest) ProtoMessage() {}
+
+func (x *PublishRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pushpop_v1_publish_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishRequest.ProtoReflect.Descriptor instead.
+func (*PublishRequest) Descriptor() ([]byte, []int) {
+	return file_pushpop_v1_publish_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PublishRequest) GetMessage() *Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *PublishRequest) GetReport() bool {
+	if x != nil {
+		return x.Report
+	}
+	return false
+}
+
+type PublishResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// duplicate reports that the idempotency key was already used, and id
+	// is the first message's.
+	Duplicate bool `protobuf:"varint,2,opt,name=duplicate,proto3" json:"duplicate,omitempty"`
+	// subscribers and channels are set with report.
+	Subscribers   int32            `protobuf:"varint,3,opt,name=subscribers,proto3" json:"subscribers,omitempty"`
+	Channels      map[string]int32 `protobuf:"bytes,4,rep,name=channels,proto3" json:"channels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishResponse) Reset() {
+	*x = PublishResponse{}
+	mi := &file_pushpop_v1_publish_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishResponse) ProtoMessage() {}
+
+func (x *PublishResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pushpop_v1_publish_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishResponse.ProtoReflect.Descriptor instead.
+func (*PublishResponse) Descriptor() ([]byte, []int) {
+	return file_pushpop_v1_publish_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PublishResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PublishResponse) GetDuplicate() bool {
+	if x != nil {
+		return x.Duplicate
+	}
+	return false
+}
+
+func (x *PublishResponse) GetSubscribers() int32 {
+	if x != nil {
+		return x.Subscribers
+	}
+	return 0
+}
+
+func (x *PublishResponse) GetChannels() map[string]int32 {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
+}
+
+type PublishBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*Message             `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishBatchRequest) Reset() {
+	*x = PublishBatchRequest{}
+	mi := &file_pushpop_v1_publish_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishBatchRequest) ProtoMessage() {}
+
+func (x *PublishBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pushpop_v1_publish_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishBatchRequest.ProtoReflect.Descriptor instead.
+func (*PublishBatchRequest) Descriptor() ([]byte, []int) {
+	return file_pushpop_v1_publish_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PublishBatchRequest) GetMessages() []*Message {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+type PublishBatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*PublishResult       `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishBatchResponse) Reset() {
+	*x = PublishBatchResponse{}
+	mi := &file_pushpop_v1_publish_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishBatchResponse) ProtoMessage() {}
+
+func (x *PublishBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pushpop_v1_publish_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishBatchResponse.ProtoReflect.Descriptor instead.
+func (*PublishBatchResponse) Descriptor() ([]byte, []int) {
+	return file_pushpop_v1_publish_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PublishBatchResponse) GetResults() []*PublishResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// PublishResult is the outcome of a message of a batch.
+type PublishResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// code is the gRPC status code Publish would have failed the message
+	// with, or 0 (OK).
+	Code  int32  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// retry_after_seconds is set for rate limited messages.
+	RetryAfterSeconds int32 `protobuf:"varint,4,opt,name=retry_after_seconds,json=retryAfterSeconds,proto3" json:"retry_after_seconds,omitempty"`
+	Duplicate         bool  `protobuf:"varint,5,opt,name=duplicate,proto3" json:"duplicate,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *PublishResult) Reset() {
+	*x = PublishResult{}
+	mi := &file_pushpop_v1_publish_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishResult) ProtoMessage() {}
+
+func (x *PublishResult) ProtoReflect() protoreflect.Message {
+	mi := &file_pushpop_v1_publish_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishResult.ProtoReflect.Descriptor instead.
+func (*PublishResult) Descriptor() ([]byte, []int) {
+	return file_pushpop_v1_publish_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PublishResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PublishResult) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *PublishResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *PublishResult) GetRetryAfterSeconds() int32 {
+	if x != nil {
+		return x.RetryAfterSeconds
+	}
+	return 0
+}
+
+func (x *PublishResult) GetDuplicate() bool {
+	if x != nil {
+		return x.Duplicate
+	}
+	return false
+}
+
+var File_pushpop_v1_publish_proto protoreflect.FileDescriptor
+
+const file_pushpop_v1_publish_proto_rawDesc = "" +
+	"\n" +
+	"\x18pushpop/v1/publish.proto\x12\n" +
+	"pushpop.v1\x1a\x1cgoogle/protobuf/struct.proto\"\xb0\x01\n" +
+	"\aMessage\x12\x18\n" +
+	"\achannel\x18\x01 \x01(\tR\achannel\x12\x1a\n" +
+	"\bchannels\x18\x02 \x03(\tR\bchannels\x12\x14\n" +
+	"\x05event\x18\x03 \x01(\tR\x05event\x120\n" +
+	"\apayload\x18\x04 \x01(\v2\x16.google.protobuf.ValueR\apayload\x12'\n" +
+	"\x0fidempotency_key\x18\x05 \x01(\tR\x0eidempotencyKey\"W\n" +
+	"\x0ePublishRequest\x12-\n" +
+	"\amessage\x18\x01 \x01(\v2\x13.pushpop.v1.MessageR\amessage\x12\x16\n" +
+	"\x06report\x18\x02 \x01(\bR\x06report\"\xe5\x01\n" +
+	"\x0fPublishResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1c\n" +
+	"\tduplicate\x18\x02 \x01(\bR\tduplicate\x12 \n" +
+	"\vsubscribers\x18\x03 \x01(\x05R\vsubscribers\x12E\n" +
+	"\bchannels\x18\x04 \x03(\v2).pushpop.v1.PublishResponse.ChannelsEntryR\bchannels\x1a;\n" +
+	"\rChannelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\"F\n" +
+	"\x13PublishBatchRequest\x12/\n" +
+	"\bmessages\x18\x01 \x03(\v2\x13.pushpop.v1.MessageR\bmessages\"K\n" +
+	"\x14PublishBatchResponse\x123\n" +
+	"\aresults\x18\x01 \x03(\v2\x19.pushpop.v1.PublishResultR\aresults\"\x97\x01\n" +
+	"\rPublishResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12.\n" +
+	"\x13retry_after_seconds\x18\x04 \x01(\x05R\x11retryAfterSeconds\x12\x1c\n" +
+	"\tduplicate\x18\x05 \x01(\bR\tduplicate2\xa7\x01\n" +
+	"\x0ePublishService\x12B\n" +
+	"\aPublish\x12\x1a.pushpop.v1.PublishRequest\x1a\x1b.pushpop.v1.PublishResponse\x12Q\n" +
+	"\fPublishBatch\x12\x1f.pushpop.v1.PublishBatchRequest\x1a .pushpop.v1.PublishBatchResponseB>Z<github.com/biohackerellie/pushpop/proto/pushpop/v1;pushpopv1b\x06proto3"
+
+var (
+	file_pushpop_v1_publish_proto_rawDescOnce sync.Once
+	file_pushpop_v1_publish_proto_rawDescData []byte
+)
+
+func file_pushpop_v1_publish_proto_rawDescGZIP() []byte {
+	file_pushpop_v1_publish_proto_rawDescOnce.Do(func() {
+		file_pushpop_v1_publish_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pushpop_v1_publish_proto_rawDesc), len(file_pushpop_v1_publish_proto_rawDesc)))
+	})
+	return file_pushpop_v1_publish_proto_rawDescData
+}
+
+var file_pushpop_v1_publish_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_pushpop_v1_publish_proto_goTypes = []any{
+	(*Message)(nil),              // 0: pushpop.v1.Message
+	(*PublishRequest)(nil),       // 1: pushpop.v1.PublishRequest
+	(*PublishResponse)(nil),      // 2: pushpop.v1.PublishResponse
+	(*PublishBatchRequest)(nil),  // 3: pushpop.v1.PublishBatchRequest
+	(*PublishBatchResponse)(nil), // 4: pushpop.v1.PublishBatchResponse
+	(*PublishResult)(nil),        // 5: pushpop.v1.PublishResult
+	nil,                          // 6: pushpop.v1.PublishResponse.ChannelsEntry
+	(*structpb.Value)(nil),       // 7: google.protobuf.Value
+}
+var file_pushpop_v1_publish_proto_depIdxs = []int32{
+	7, // 0: pushpop.v1.Message.payload:type_name -> google.protobuf.Value
+	0, // 1: pushpop.v1.PublishRequest.message:type_name -> pushpop.v1.Message
+	6, // 2: pushpop.v1.PublishResponse.channels:type_name -> pushpop.v1.PublishResponse.ChannelsEntry
+	0, // 3: pushpop.v1.PublishBatchRequest.messages:type_name -> pushpop.v1.Message
+	5, // 4: pushpop.v1.PublishBatchResponse.results:type_name -> pushpop.v1.PublishResult
+	1, // 5: pushpop.v1.PublishService.Publish:input_type -> pushpop.v1.PublishRequest
+	3, // 6: pushpop.v1.PublishService.PublishBatch:input_type -> pushpop.v1.PublishBatchRequest
+	2, // 7: pushpop.v1.PublishService.Publish:output_type -> pushpop.v1.PublishResponse
+	4, // 8: pushpop.v1.PublishService.PublishBatch:output_type -> pushpop.v1.PublishBatchResponse
+	7, // [7:9] is the sub-list for method output_type
+	5, // [5:7] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_pushpop_v1_publish_proto_init() }
+func file_pushpop_v1_publish_proto_init() {
+	if File_pushpop_v1_publish_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pushpop_v1_publish_proto_rawDesc), len(file_pushpop_v1_publish_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pushpop_v1_publish_proto_goTypes,
+		DependencyIndexes: file_pushpop_v1_publish_proto_depIdxs,
+		MessageInfos:      file_pushpop_v1_publish_proto_msgTypes,
+	}.Build()
+	File_pushpop_v1_publish_proto = out.File
+	file_pushpop_v1_publish_proto_goTypes = nil
+	file_pushpop_v1_publish_proto_depIdxs = nil
+}
@@ -0,0 +1,183 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: pushpop/v1/publish.proto
+
+package pushpopv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PublishService_Publish_FullMethodName      = "/pushpop.v1.PublishService/Publish"
+	PublishService_PublishBatch_FullMethodName = "/pushpop.v1.PublishService/PublishBatch"
+)
+
+// PublishServiceClient is the client API for PublishService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PublishService publishes messages to a hub, like POST /trigger and
+// POST /trigger/batch. Calls are authorized with an "authorization:
+// Bearer <key>" metadata entry once the hub has publish keys, and the
+// call's deadline bounds how long the hub waits to accept a message.
+type PublishServiceClient interface {
+	// Publish publishes a message. Refused messages fail with
+	// INVALID_ARGUMENT, NOT_FOUND for an unknown channel, ABORTED
+	// while a message with the same idempotency key is in progress,
+	// RESOURCE_EXHAUSTED when rate limited, with a "retry-after" trailer in
+	// seconds, DEADLINE_EXCEEDED, or UNAVAILABLE while the hub shuts down.
+	Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResponse, error)
+	// PublishBatch publishes up to 1000 messages and returns a result per
+	// message, in order; a message failing does not fail the rest.
+	PublishBatch(ctx context.Context, in *PublishBatchRequest, opts ...grpc.CallOption) (*PublishBatchResponse, error)
+}
+
+type publishServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPublishServiceClient(cc grpc.ClientConnInterface) PublishServiceClient {
+	return &publishServiceClient{cc}
+}
+
+func (c *publishServiceClient) Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PublishResponse)
+	err := c.cc.Invoke(ctx, PublishService_Publish_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *publishServiceClient) PublishBatch(ctx context.Context, in *PublishBatchRequest, opts ...grpc.CallOption) (*PublishBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PublishBatchResponse)
+	err := c.cc.Invoke(ctx, PublishService_PublishBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PublishServiceServer is the server API for PublishService service.
+// All implementations must embed UnimplementedPublishServiceServer
+// for forward compatibility.
+//
+// PublishService publishes messages to a hub, like POST /trigger and
+// POST /trigger/batch. Calls are authorized with an "authorization:
+// Bearer <key>" metadata entry once the hub has publish keys, and the
+// call's deadline bounds how long the hub waits to accept a message.
+type PublishServiceServer interface {
+	// Publish publishes a message. Refused messages fail with
+	// INVALID_ARGUMENT, NOT_FOUND for an unknown channel, ABORTED
+	// while a message with the same idempotency key is in progress,
+	// RESOURCE_EXHAUSTED when rate limited, with a "retry-after" trailer in
+	// seconds, DEADLINE_EXCEEDED, or UNAVAILABLE while the hub shuts down.
+	Publish(context.Context, *PublishRequest) (*PublishResponse, error)
+	// PublishBatch publishes up to 1000 messages and returns a result per
+	// message, in order; a message failing does not fail the rest.
+	PublishBatch(context.Context, *PublishBatchRequest) (*PublishBatchResponse, error)
+	mustEmbedUnimplementedPublishServiceServer()
+}
+
+// UnimplementedPublishServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPublishServiceServer struct{}
+
+func (UnimplementedPublishServiceServer) Publish(context.Context, *PublishRequest) (*PublishResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Publish not implemented")
+}
+func (UnimplementedPublishServiceServer) PublishBatch(context.Context, *PublishBatchRequest) (*PublishBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishBatch not implemented")
+}
+func (UnimplementedPublishServiceServer) mustEmbedUnimplementedPublishServiceServer() {}
+func (UnimplementedPublishServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafePublishServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PublishServiceServer will
+// result in compilation errors.
+type UnsafePublishServiceServer interface {
+	mustEmbedUnimplementedPublishServiceServer()
+}
+
+func RegisterPublishServiceServer(s grpc.ServiceRegistrar, srv PublishServiceServer) {
+	// If the following call pancis, it indicates UnimplementedPublishServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PublishService_ServiceDesc, srv)
+}
+
+func _PublishService_Publish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PublishServiceServer).Publish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PublishService_Publish_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PublishServiceServer).Publish(ctx, req.(*PublishRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PublishService_PublishBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PublishServiceServer).PublishBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PublishService_PublishBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PublishServiceServer).PublishBatch(ctx, req.(*PublishBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PublishService_ServiceDesc is the grpc.ServiceDesc for PublishService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PublishService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pushpop.v1.PublishService",
+	HandlerType: (*PublishServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Publish",
+			Handler:    _PublishService_Publish_Handler,
+		},
+		{
+			MethodName: "PublishBatch",
+			Handler:    _PublishService_PublishBatch_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pushpop/v1/publish.proto",
+}
@@ -0,0 +1,604 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: pushpop/v1/admin.proto
+
+package pushpopv1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "github.com/biohackerellie/pushpop/proto/pushpop/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// AdminServiceName is the fully-qualified name of the AdminService service.
+	AdminServiceName = "pushpop.v1.AdminService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// AdminServiceGetStatsProcedure is the fully-qualified name of the AdminService's GetStats RPC.
+	AdminServiceGetStatsProcedure = "/pushpop.v1.AdminService/GetStats"
+	// AdminServiceListChannelsProcedure is the fully-qualified name of the AdminService's ListChannels
+	// RPC.
+	AdminServiceListChannelsProcedure = "/pushpop.v1.AdminService/ListChannels"
+	// AdminServiceListConnectionsProcedure is the fully-qualified name of the AdminService's
+	// ListConnections RPC.
+	AdminServiceListConnectionsProcedure = "/pushpop.v1.AdminService/ListConnections"
+	// AdminServiceDisconnectProcedure is the fully-qualified name of the AdminService's Disconnect RPC.
+	AdminServiceDisconnectProcedure = "/pushpop.v1.AdminService/Disconnect"
+	// AdminServiceBroadcastProcedure is the fully-qualified name of the AdminService's Broadcast RPC.
+	AdminServiceBroadcastProcedure = "/pushpop.v1.AdminService/Broadcast"
+	// AdminServiceDrainProcedure is the fully-qualified name of the AdminService's Drain RPC.
+	AdminServiceDrainProcedure = "/pushpop.v1.AdminService/Drain"
+	// AdminServiceResumeProcedure is the fully-qualified name of the AdminService's Resume RPC.
+	AdminServiceResumeProcedure = "/pushpop.v1.AdminService/Resume"
+	// AdminServiceGetBlocklistProcedure is the fully-qualified name of the AdminService's GetBlocklist
+	// RPC.
+	AdminServiceGetBlocklistProcedure = "/pushpop.v1.AdminService/GetBlocklist"
+	// AdminServiceBlockProcedure is the fully-qualified name of the AdminService's Block RPC.
+	AdminServiceBlockProcedure = "/pushpop.v1.AdminService/Block"
+	// AdminServiceUnblockProcedure is the fully-qualified name of the AdminService's Unblock RPC.
+	AdminServiceUnblockProcedure = "/pushpop.v1.AdminService/Unblock"
+	// AdminServiceListAPIKeysProcedure is the fully-qualified name of the AdminService's ListAPIKeys
+	// RPC.
+	AdminServiceListAPIKeysProcedure = "/pushpop.v1.AdminService/ListAPIKeys"
+	// AdminServiceCreateAPIKeyProcedure is the fully-qualified name of the AdminService's CreateAPIKey
+	// RPC.
+	AdminServiceCreateAPIKeyProcedure = "/pushpop.v1.AdminService/CreateAPIKey"
+	// AdminServiceRotateAPIKeyProcedure is the fully-qualified name of the AdminService's RotateAPIKey
+	// RPC.
+	AdminServiceRotateAPIKeyProcedure = "/pushpop.v1.AdminService/RotateAPIKey"
+	// AdminServiceRevokeAPIKeyProcedure is the fully-qualified name of the AdminService's RevokeAPIKey
+	// RPC.
+	AdminServiceRevokeAPIKeyProcedure = "/pushpop.v1.AdminService/RevokeAPIKey"
+	// AdminServiceListReplaysProcedure is the fully-qualified name of the AdminService's ListReplays
+	// RPC.
+	AdminServiceListReplaysProcedure = "/pushpop.v1.AdminService/ListReplays"
+	// AdminServiceGetReplayProcedure is the fully-qualified name of the AdminService's GetReplay RPC.
+	AdminServiceGetReplayProcedure = "/pushpop.v1.AdminService/GetReplay"
+	// AdminServiceStartReplayProcedure is the fully-qualified name of the AdminService's StartReplay
+	// RPC.
+	AdminServiceStartReplayProcedure = "/pushpop.v1.AdminService/StartReplay"
+	// AdminServiceCancelReplayProcedure is the fully-qualified name of the AdminService's CancelReplay
+	// RPC.
+	AdminServiceCancelReplayProcedure = "/pushpop.v1.AdminService/CancelReplay"
+)
+
+// AdminServiceClient is a client for the pushpop.v1.AdminService service.
+type AdminServiceClient interface {
+	GetStats(context.Context, *connect.Request[v1.GetStatsRequest]) (*connect.Response[v1.GetStatsResponse], error)
+	ListChannels(context.Context, *connect.Request[v1.ListChannelsRequest]) (*connect.Response[v1.ListChannelsResponse], error)
+	ListConnections(context.Context, *connect.Request[v1.ListConnectionsRequest]) (*connect.Response[v1.ListConnectionsResponse], error)
+	// Disconnect kicks a connection, failing with NOT_FOUND if it is gone.
+	Disconnect(context.Context, *connect.Request[v1.DisconnectRequest]) (*connect.Response[v1.DisconnectResponse], error)
+	// Broadcast sends an event to every connected client.
+	Broadcast(context.Context, *connect.Request[v1.BroadcastRequest]) (*connect.Response[v1.BroadcastResponse], error)
+	// Drain puts the hub in maintenance mode for a rolling restart.
+	Drain(context.Context, *connect.Request[v1.DrainRequest]) (*connect.Response[v1.DrainResponse], error)
+	Resume(context.Context, *connect.Request[v1.ResumeRequest]) (*connect.Response[v1.ResumeResponse], error)
+	GetBlocklist(context.Context, *connect.Request[v1.GetBlocklistRequest]) (*connect.Response[v1.GetBlocklistResponse], error)
+	Block(context.Context, *connect.Request[v1.BlockRequest]) (*connect.Response[v1.BlockResponse], error)
+	Unblock(context.Context, *connect.Request[v1.UnblockRequest]) (*connect.Response[v1.UnblockResponse], error)
+	ListAPIKeys(context.Context, *connect.Request[v1.ListAPIKeysRequest]) (*connect.Response[v1.ListAPIKeysResponse], error)
+	// CreateAPIKey and RotateAPIKey return the key's secret, which is not
+	// returned again.
+	CreateAPIKey(context.Context, *connect.Request[v1.CreateAPIKeyRequest]) (*connect.Response[v1.CreateAPIKeyResponse], error)
+	RotateAPIKey(context.Context, *connect.Request[v1.RotateAPIKeyRequest]) (*connect.Response[v1.RotateAPIKeyResponse], error)
+	RevokeAPIKey(context.Context, *connect.Request[v1.RevokeAPIKeyRequest]) (*connect.Response[v1.RevokeAPIKeyResponse], error)
+	ListReplays(context.Context, *connect.Request[v1.ListReplaysRequest]) (*connect.Response[v1.ListReplaysResponse], error)
+	GetReplay(context.Context, *connect.Request[v1.GetReplayRequest]) (*connect.Response[v1.GetReplayResponse], error)
+	StartReplay(context.Context, *connect.Request[v1.StartReplayRequest]) (*connect.Response[v1.StartReplayResponse], error)
+	CancelReplay(context.Context, *connect.Request[v1.CancelReplayRequest]) (*connect.Response[v1.CancelReplayResponse], error)
+}
+
+// NewAdminServiceClient constructs a client for the pushpop.v1.AdminService service. By default, it
+// uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewAdminServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) AdminServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	adminServiceMethods := v1.File_pushpop_v1_admin_proto.Services().ByName("AdminService").Methods()
+	return &adminServiceClient{
+		getStats: connect.NewClient[v1.GetStatsRequest, v1.GetStatsResponse](
+			httpClient,
+			baseURL+AdminServiceGetStatsProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("GetStats")),
+			connect.WithClientOptions(opts...),
+		),
+		listChannels: connect.NewClient[v1.ListChannelsRequest, v1.ListChannelsResponse](
+			httpClient,
+			baseURL+AdminServiceListChannelsProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("ListChannels")),
+			connect.WithClientOptions(opts...),
+		),
+		listConnections: connect.NewClient[v1.ListConnectionsRequest, v1.ListConnectionsResponse](
+			httpClient,
+			baseURL+AdminServiceListConnectionsProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("ListConnections")),
+			connect.WithClientOptions(opts...),
+		),
+		disconnect: connect.NewClient[v1.DisconnectRequest, v1.DisconnectResponse](
+			httpClient,
+			baseURL+AdminServiceDisconnectProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("Disconnect")),
+			connect.WithClientOptions(opts...),
+		),
+		broadcast: connect.NewClient[v1.BroadcastRequest, v1.BroadcastResponse](
+			httpClient,
+			baseURL+AdminServiceBroadcastProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("Broadcast")),
+			connect.WithClientOptions(opts...),
+		),
+		drain: connect.NewClient[v1.DrainRequest, v1.DrainResponse](
+			httpClient,
+			baseURL+AdminServiceDrainProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("Drain")),
+			connect.WithClientOptions(opts...),
+		),
+		resume: connect.NewClient[v1.ResumeRequest, v1.ResumeResponse](
+			httpClient,
+			baseURL+AdminServiceResumeProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("Resume")),
+			connect.WithClientOptions(opts...),
+		),
+		getBlocklist: connect.NewClient[v1.GetBlocklistRequest, v1.GetBlocklistResponse](
+			httpClient,
+			baseURL+AdminServiceGetBlocklistProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("GetBlocklist")),
+			connect.WithClientOptions(opts...),
+		),
+		block: connect.NewClient[v1.BlockRequest, v1.BlockResponse](
+			httpClient,
+			baseURL+AdminServiceBlockProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("Block")),
+			connect.WithClientOptions(opts...),
+		),
+		unblock: connect.NewClient[v1.UnblockRequest, v1.UnblockResponse](
+			httpClient,
+			baseURL+AdminServiceUnblockProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("Unblock")),
+			connect.WithClientOptions(opts...),
+		),
+		listAPIKeys: connect.NewClient[v1.ListAPIKeysRequest, v1.ListAPIKeysResponse](
+			httpClient,
+			baseURL+AdminServiceListAPIKeysProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("ListAPIKeys")),
+			connect.WithClientOptions(opts...),
+		),
+		createAPIKey: connect.NewClient[v1.CreateAPIKeyRequest, v1.CreateAPIKeyResponse](
+			httpClient,
+			baseURL+AdminServiceCreateAPIKeyProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("CreateAPIKey")),
+			connect.WithClientOptions(opts...),
+		),
+		rotateAPIKey: connect.NewClient[v1.RotateAPIKeyRequest, v1.RotateAPIKeyResponse](
+			httpClient,
+			baseURL+AdminServiceRotateAPIKeyProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("RotateAPIKey")),
+			connect.WithClientOptions(opts...),
+		),
+		revokeAPIKey: connect.NewClient[v1.RevokeAPIKeyRequest, v1.RevokeAPIKeyResponse](
+			httpClient,
+			baseURL+AdminServiceRevokeAPIKeyProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("RevokeAPIKey")),
+			connect.WithClientOptions(opts...),
+		),
+		listReplays: connect.NewClient[v1.ListReplaysRequest, v1.ListReplaysResponse](
+			httpClient,
+			baseURL+AdminServiceListReplaysProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("ListReplays")),
+			connect.WithClientOptions(opts...),
+		),
+		getReplay: connect.NewClient[v1.GetReplayRequest, v1.GetReplayResponse](
+			httpClient,
+			baseURL+AdminServiceGetReplayProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("GetReplay")),
+			connect.WithClientOptions(opts...),
+		),
+		startReplay: connect.NewClient[v1.StartReplayRequest, v1.StartReplayResponse](
+			httpClient,
+			baseURL+AdminServiceStartReplayProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("StartReplay")),
+			connect.WithClientOptions(opts...),
+		),
+		cancelReplay: connect.NewClient[v1.CancelReplayRequest, v1.CancelReplayResponse](
+			httpClient,
+			baseURL+AdminServiceCancelReplayProcedure,
+			connect.WithSchema(adminServiceMethods.ByName("CancelReplay")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// adminServiceClient implements AdminServiceClient.
+type adminServiceClient struct {
+	getStats        *connect.Client[v1.GetStatsRequest, v1.GetStatsResponse]
+	listChannels    *connect.Client[v1.ListChannelsRequest, v1.ListChannelsResponse]
+	listConnections *connect.Client[v1.ListConnectionsRequest, v1.ListConnectionsResponse]
+	disconnect      *connect.Client[v1.DisconnectRequest, v1.DisconnectResponse]
+	broadcast       *connect.Client[v1.BroadcastRequest, v1.BroadcastResponse]
+	drain           *connect.Client[v1.DrainRequest, v1.DrainResponse]
+	resume          *connect.Client[v1.ResumeRequest, v1.ResumeResponse]
+	getBlocklist    *connect.Client[v1.GetBlocklistRequest, v1.GetBlocklistResponse]
+	block           *connect.Client[v1.BlockRequest, v1.BlockResponse]
+	unblock         *connect.Client[v1.UnblockRequest, v1.UnblockResponse]
+	listAPIKeys     *connect.Client[v1.ListAPIKeysRequest, v1.ListAPIKeysResponse]
+	createAPIKey    *connect.Client[v1.CreateAPIKeyRequest, v1.CreateAPIKeyResponse]
+	rotateAPIKey    *connect.Client[v1.RotateAPIKeyRequest, v1.RotateAPIKeyResponse]
+	revokeAPIKey    *connect.Client[v1.RevokeAPIKeyRequest, v1.RevokeAPIKeyResponse]
+	listReplays     *connect.Client[v1.ListReplaysRequest, v1.ListReplaysResponse]
+	getReplay       *connect.Client[v1.GetReplayRequest, v1.GetReplayResponse]
+	startReplay     *connect.Client[v1.StartReplayRequest, v1.StartReplayResponse]
+	cancelReplay    *connect.Client[v1.CancelReplayRequest, v1.CancelReplayResponse]
+}
+
+// GetStats calls pushpop.v1.AdminService.GetStats.
+func (c *adminServiceClient) GetStats(ctx context.Context, req *connect.Request[v1.GetStatsRequest]) (*connect.Response[v1.GetStatsResponse], error) {
+	return c.getStats.CallUnary(ctx, req)
+}
+
+// ListChannels calls pushpop.v1.AdminService.ListChannels.
+func (c *adminServiceClient) ListChannels(ctx context.Context, req *connect.Request[v1.ListChannelsRequest]) (*connect.Response[v1.ListChannelsResponse], error) {
+	return c.listChannels.CallUnary(ctx, req)
+}
+
+// ListConnections calls pushpop.v1.AdminService.ListConnections.
+func (c *adminServiceClient) ListConnections(ctx context.Context, req *connect.Request[v1.ListConnectionsRequest]) (*connect.Response[v1.ListConnectionsResponse], error) {
+	return c.listConnections.CallUnary(ctx, req)
+}
+
+// Disconnect calls pushpop.v1.AdminService.Disconnect.
+func (c *adminServiceClient) Disconnect(ctx context.Context, req *connect.Request[v1.DisconnectRequest]) (*connect.Response[v1.DisconnectResponse], error) {
+	return c.disconnect.CallUnary(ctx, req)
+}
+
+// Broadcast calls pushpop.v1.AdminService.Broadcast.
+func (c *adminServiceClient) Broadcast(ctx context.Context, req *connect.Request[v1.BroadcastRequest]) (*connect.Response[v1.BroadcastResponse], error) {
+	return c.broadcast.CallUnary(ctx, req)
+}
+
+// Drain calls pushpop.v1.AdminService.Drain.
+func (c *adminServiceClient) Drain(ctx context.Context, req *connect.Request[v1.DrainRequest]) (*connect.Response[v1.DrainResponse], error) {
+	return c.drain.CallUnary(ctx, req)
+}
+
+// Resume calls pushpop.v1.AdminService.Resume.
+func (c *adminServiceClient) Resume(ctx context.Context, req *connect.Request[v1.ResumeRequest]) (*connect.Response[v1.ResumeResponse], error) {
+	return c.resume.CallUnary(ctx, req)
+}
+
+// GetBlocklist calls pushpop.v1.AdminService.GetBlocklist.
+func (c *adminServiceClient) GetBlocklist(ctx context.Context, req *connect.Request[v1.GetBlocklistRequest]) (*connect.Response[v1.GetBlocklistResponse], error) {
+	return c.getBlocklist.CallUnary(ctx, req)
+}
+
+// Block calls pushpop.v1.AdminService.Block.
+func (c *adminServiceClient) Block(ctx context.Context, req *connect.Request[v1.BlockRequest]) (*connect.Response[v1.BlockResponse], error) {
+	return c.block.CallUnary(ctx, req)
+}
+
+// Unblock calls pushpop.v1.AdminService.Unblock.
+func (c *adminServiceClient) Unblock(ctx context.Context, req *connect.Request[v1.UnblockRequest]) (*connect.Response[v1.UnblockResponse], error) {
+	return c.unblock.CallUnary(ctx, req)
+}
+
+// ListAPIKeys calls pushpop.v1.AdminService.ListAPIKeys.
+func (c *adminServiceClient) ListAPIKeys(ctx context.Context, req *connect.Request[v1.ListAPIKeysRequest]) (*connect.Response[v1.ListAPIKeysResponse], error) {
+	return c.listAPIKeys.CallUnary(ctx, req)
+}
+
+// CreateAPIKey calls pushpop.v1.AdminService.CreateAPIKey.
+func (c *adminServiceClient) CreateAPIKey(ctx context.Context, req *connect.Request[v1.CreateAPIKeyRequest]) (*connect.Response[v1.CreateAPIKeyResponse], error) {
+	return c.createAPIKey.CallUnary(ctx, req)
+}
+
+// RotateAPIKey calls pushpop.v1.AdminService.RotateAPIKey.
+func (c *adminServiceClient) RotateAPIKey(ctx context.Context, req *connect.Request[v1.RotateAPIKeyRequest]) (*connect.Response[v1.RotateAPIKeyResponse], error) {
+	return c.rotateAPIKey.CallUnary(ctx, req)
+}
+
+// RevokeAPIKey calls pushpop.v1.AdminService.RevokeAPIKey.
+func (c *adminServiceClient) RevokeAPIKey(ctx context.Context, req *connect.Request[v1.RevokeAPIKeyRequest]) (*connect.Response[v1.RevokeAPIKeyResponse], error) {
+	return c.revokeAPIKey.CallUnary(ctx, req)
+}
+
+// ListReplays calls pushpop.v1.AdminService.ListReplays.
+func (c *adminServiceClient) ListReplays(ctx context.Context, req *connect.Request[v1.ListReplaysRequest]) (*connect.Response[v1.ListReplaysResponse], error) {
+	return c.listReplays.CallUnary(ctx, req)
+}
+
+// GetReplay calls pushpop.v1.AdminService.GetReplay.
+func (c *adminServiceClient) GetReplay(ctx context.Context, req *connect.Request[v1.GetReplayRequest]) (*connect.Response[v1.GetReplayResponse], error) {
+	return c.getReplay.CallUnary(ctx, req)
+}
+
+// StartReplay calls pushpop.v1.AdminService.StartReplay.
+func (c *adminServiceClient) StartReplay(ctx context.Context, req *connect.Request[v1.StartReplayRequest]) (*connect.Response[v1.StartReplayResponse], error) {
+	return c.startReplay.CallUnary(ctx, req)
+}
+
+// CancelReplay calls pushpop.v1.AdminService.CancelReplay.
+func (c *adminServiceClient) CancelReplay(ctx context.Context, req *connect.Request[v1.CancelReplayRequest]) (*connect.Response[v1.CancelReplayResponse], error) {
+	return c.cancelReplay.CallUnary(ctx, req)
+}
+
+// AdminServiceHandler is an implementation of the pushpop.v1.AdminService service.
+type AdminServiceHandler interface {
+	GetStats(context.Context, *connect.Request[v1.GetStatsRequest]) (*connect.Response[v1.GetStatsResponse], error)
+	ListChannels(context.Context, *connect.Request[v1.ListChannelsRequest]) (*connect.Response[v1.ListChannelsResponse], error)
+	ListConnections(context.Context, *connect.Request[v1.ListConnectionsRequest]) (*connect.Response[v1.ListConnectionsResponse], error)
+	// Disconnect kicks a connection, failing with NOT_FOUND if it is gone.
+	Disconnect(context.Context, *connect.Request[v1.DisconnectRequest]) (*connect.Response[v1.DisconnectResponse], error)
+	// Broadcast sends an event to every connected client.
+	Broadcast(context.Context, *connect.Request[v1.BroadcastRequest]) (*connect.Response[v1.BroadcastResponse], error)
+	// Drain puts the hub in maintenance mode for a rolling restart.
+	Drain(context.Context, *connect.Request[v1.DrainRequest]) (*connect.Response[v1.DrainResponse], error)
+	Resume(context.Context, *connect.Request[v1.ResumeRequest]) (*connect.Response[v1.ResumeResponse], error)
+	GetBlocklist(context.Context, *connect.Request[v1.GetBlocklistRequest]) (*connect.Response[v1.GetBlocklistResponse], error)
+	Block(context.Context, *connect.Request[v1.BlockRequest]) (*connect.Response[v1.BlockResponse], error)
+	Unblock(context.Context, *connect.Request[v1.UnblockRequest]) (*connect.Response[v1.UnblockResponse], error)
+	ListAPIKeys(context.Context, *connect.Request[v1.ListAPIKeysRequest]) (*connect.Response[v1.ListAPIKeysResponse], error)
+	// CreateAPIKey and RotateAPIKey return the key's secret, which is not
+	// returned again.
+	CreateAPIKey(context.Context, *connect.Request[v1.CreateAPIKeyRequest]) (*connect.Response[v1.CreateAPIKeyResponse], error)
+	RotateAPIKey(context.Context, *connect.Request[v1.RotateAPIKeyRequest]) (*connect.Response[v1.RotateAPIKeyResponse], error)
+	RevokeAPIKey(context.Context, *connect.Request[v1.RevokeAPIKeyRequest]) (*connect.Response[v1.RevokeAPIKeyResponse], error)
+	ListReplays(context.Context, *connect.Request[v1.ListReplaysRequest]) (*connect.Response[v1.ListReplaysResponse], error)
+	GetReplay(context.Context, *connect.Request[v1.GetReplayRequest]) (*connect.Response[v1.GetReplayResponse], error)
+	StartReplay(context.Context, *connect.Request[v1.StartReplayRequest]) (*connect.Response[v1.StartReplayResponse], error)
+	CancelReplay(context.Context, *connect.Request[v1.CancelReplayRequest]) (*connect.Response[v1.CancelReplayResponse], error)
+}
+
+// NewAdminServiceHandler builds an HTTP handler from the service implementation. It returns the
+// path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewAdminServiceHandler(svc AdminServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	adminServiceMethods := v1.File_pushpop_v1_admin_proto.Services().ByName("AdminService").Methods()
+	adminServiceGetStatsHandler := connect.NewUnaryHandler(
+		AdminServiceGetStatsProcedure,
+		svc.GetStats,
+		connect.WithSchema(adminServiceMethods.ByName("GetStats")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceListChannelsHandler := connect.NewUnaryHandler(
+		AdminServiceListChannelsProcedure,
+		svc.ListChannels,
+		connect.WithSchema(adminServiceMethods.ByName("ListChannels")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceListConnectionsHandler := connect.NewUnaryHandler(
+		AdminServiceListConnectionsProcedure,
+		svc.ListConnections,
+		connect.WithSchema(adminServiceMethods.ByName("ListConnections")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceDisconnectHandler := connect.NewUnaryHandler(
+		AdminServiceDisconnectProcedure,
+		svc.Disconnect,
+		connect.WithSchema(adminServiceMethods.ByName("Disconnect")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceBroadcastHandler := connect.NewUnaryHandler(
+		AdminServiceBroadcastProcedure,
+		svc.Broadcast,
+		connect.WithSchema(adminServiceMethods.ByName("Broadcast")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceDrainHandler := connect.NewUnaryHandler(
+		AdminServiceDrainProcedure,
+		svc.Drain,
+		connect.WithSchema(adminServiceMethods.ByName("Drain")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceResumeHandler := connect.NewUnaryHandler(
+		AdminServiceResumeProcedure,
+		svc.Resume,
+		connect.WithSchema(adminServiceMethods.ByName("Resume")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceGetBlocklistHandler := connect.NewUnaryHandler(
+		AdminServiceGetBlocklistProcedure,
+		svc.GetBlocklist,
+		connect.WithSchema(adminServiceMethods.ByName("GetBlocklist")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceBlockHandler := connect.NewUnaryHandler(
+		AdminServiceBlockProcedure,
+		svc.Block,
+		connect.WithSchema(adminServiceMethods.ByName("Block")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceUnblockHandler := connect.NewUnaryHandler(
+		AdminServiceUnblockProcedure,
+		svc.Unblock,
+		connect.WithSchema(adminServiceMethods.ByName("Unblock")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceListAPIKeysHandler := connect.NewUnaryHandler(
+		AdminServiceListAPIKeysProcedure,
+		svc.ListAPIKeys,
+		connect.WithSchema(adminServiceMethods.ByName("ListAPIKeys")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceCreateAPIKeyHandler := connect.NewUnaryHandler(
+		AdminServiceCreateAPIKeyProcedure,
+		svc.CreateAPIKey,
+		connect.WithSchema(adminServiceMethods.ByName("CreateAPIKey")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceRotateAPIKeyHandler := connect.NewUnaryHandler(
+		AdminServiceRotateAPIKeyProcedure,
+		svc.RotateAPIKey,
+		connect.WithSchema(adminServiceMethods.ByName("RotateAPIKey")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceRevokeAPIKeyHandler := connect.NewUnaryHandler(
+		AdminServiceRevokeAPIKeyProcedure,
+		svc.RevokeAPIKey,
+		connect.WithSchema(adminServiceMethods.ByName("RevokeAPIKey")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceListReplaysHandler := connect.NewUnaryHandler(
+		AdminServiceListReplaysProcedure,
+		svc.ListReplays,
+		connect.WithSchema(adminServiceMethods.ByName("ListReplays")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceGetReplayHandler := connect.NewUnaryHandler(
+		AdminServiceGetReplayProcedure,
+		svc.GetReplay,
+		connect.WithSchema(adminServiceMethods.ByName("GetReplay")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceStartReplayHandler := connect.NewUnaryHandler(
+		AdminServiceStartReplayProcedure,
+		svc.StartReplay,
+		connect.WithSchema(adminServiceMethods.ByName("StartReplay")),
+		connect.WithHandlerOptions(opts...),
+	)
+	adminServiceCancelReplayHandler := connect.NewUnaryHandler(
+		AdminServiceCancelReplayProcedure,
+		svc.CancelReplay,
+		connect.WithSchema(adminServiceMethods.ByName("CancelReplay")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/pushpop.v1.AdminService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case AdminServiceGetStatsProcedure:
+			adminServiceGetStatsHandler.ServeHTTP(w, r)
+		case AdminServiceListChannelsProcedure:
+			adminServiceListChannelsHandler.ServeHTTP(w, r)
+		case AdminServiceListConnectionsProcedure:
+			adminServiceListConnectionsHandler.ServeHTTP(w, r)
+		case AdminServiceDisconnectProcedure:
+			adminServiceDisconnectHandler.ServeHTTP(w, r)
+		case AdminServiceBroadcastProcedure:
+			adminServiceBroadcastHandler.ServeHTTP(w, r)
+		case AdminServiceDrainProcedure:
+			adminServiceDrainHandler.ServeHTTP(w, r)
+		case AdminServiceResumeProcedure:
+			adminServiceResumeHandler.ServeHTTP(w, r)
+		case AdminServiceGetBlocklistProcedure:
+			adminServiceGetBlocklistHandler.ServeHTTP(w, r)
+		case AdminServiceBlockProcedure:
+			adminServiceBlockHandler.ServeHTTP(w, r)
+		case AdminServiceUnblockProcedure:
+			adminServiceUnblockHandler.ServeHTTP(w, r)
+		case AdminServiceListAPIKeysProcedure:
+			adminServiceListAPIKeysHandler.ServeHTTP(w, r)
+		case AdminServiceCreateAPIKeyProcedure:
+			adminServiceCreateAPIKeyHandler.ServeHTTP(w, r)
+		case AdminServiceRotateAPIKeyProcedure:
+			adminServiceRotateAPIKeyHandler.ServeHTTP(w, r)
+		case AdminServiceRevokeAPIKeyProcedure:
+			adminServiceRevokeAPIKeyHandler.ServeHTTP(w, r)
+		case AdminServiceListReplaysProcedure:
+			adminServiceListReplaysHandler.ServeHTTP(w, r)
+		case AdminServiceGetReplayProcedure:
+			adminServiceGetReplayHandler.ServeHTTP(w, r)
+		case AdminServiceStartReplayProcedure:
+			adminServiceStartReplayHandler.ServeHTTP(w, r)
+		case AdminServiceCancelReplayProcedure:
+			adminServiceCancelReplayHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedAdminServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedAdminServiceHandler struct{}
+
+func (UnimplementedAdminServiceHandler) GetStats(context.Context, *connect.Request[v1.GetStatsRequest]) (*connect.Response[v1.GetStatsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.GetStats is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) ListChannels(context.Context, *connect.Request[v1.ListChannelsRequest]) (*connect.Response[v1.ListChannelsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.ListChannels is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) ListConnections(context.Context, *connect.Request[v1.ListConnectionsRequest]) (*connect.Response[v1.ListConnectionsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.ListConnections is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) Disconnect(context.Context, *connect.Request[v1.DisconnectRequest]) (*connect.Response[v1.DisconnectResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.Disconnect is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) Broadcast(context.Context, *connect.Request[v1.BroadcastRequest]) (*connect.Response[v1.BroadcastResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.Broadcast is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) Drain(context.Context, *connect.Request[v1.DrainRequest]) (*connect.Response[v1.DrainResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.Drain is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) Resume(context.Context, *connect.Request[v1.ResumeRequest]) (*connect.Response[v1.ResumeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.Resume is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) GetBlocklist(context.Context, *connect.Request[v1.GetBlocklistRequest]) (*connect.Response[v1.GetBlocklistResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.GetBlocklist is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) Block(context.Context, *connect.Request[v1.BlockRequest]) (*connect.Response[v1.BlockResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.Block is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) Unblock(context.Context, *connect.Request[v1.UnblockRequest]) (*connect.Response[v1.UnblockResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.Unblock is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) ListAPIKeys(context.Context, *connect.Request[v1.ListAPIKeysRequest]) (*connect.Response[v1.ListAPIKeysResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.ListAPIKeys is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) CreateAPIKey(context.Context, *connect.Request[v1.CreateAPIKeyRequest]) (*connect.Response[v1.CreateAPIKeyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.CreateAPIKey is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) RotateAPIKey(context.Context, *connect.Request[v1.RotateAPIKeyRequest]) (*connect.Response[v1.RotateAPIKeyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.RotateAPIKey is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) RevokeAPIKey(context.Context, *connect.Request[v1.RevokeAPIKeyRequest]) (*connect.Response[v1.RevokeAPIKeyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.RevokeAPIKey is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) ListReplays(context.Context, *connect.Request[v1.ListReplaysRequest]) (*connect.Response[v1.ListReplaysResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.ListReplays is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) GetReplay(context.Context, *connect.Request[v1.GetReplayRequest]) (*connect.Response[v1.GetReplayResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.GetReplay is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) StartReplay(context.Context, *connect.Request[v1.StartReplayRequest]) (*connect.Response[v1.StartReplayResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.StartReplay is not implemented"))
+}
+
+func (UnimplementedAdminServiceHandler) CancelReplay(context.Context, *connect.Request[v1.CancelReplayRequest]) (*connect.Response[v1.CancelReplayResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.AdminService.CancelReplay is not implemented"))
+}
@@ -0,0 +1,151 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: pushpop/v1/publish.proto
+
+package pushpopv1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "github.com/biohackerellie/pushpop/proto/pushpop/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// PublishServiceName is the fully-qualified name of the PublishService service.
+	PublishServiceName = "pushpop.v1.PublishService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// PublishServicePublishProcedure is the fully-qualified name of the PublishService's Publish RPC.
+	PublishServicePublishProcedure = "/pushpop.v1.PublishService/Publish"
+	// PublishServicePublishBatchProcedure is the fully-qualified name of the PublishService's
+	// PublishBatch RPC.
+	PublishServicePublishBatchProcedure = "/pushpop.v1.PublishService/PublishBatch"
+)
+
+// PublishServiceClient is a client for the pushpop.v1.PublishService service.
+type PublishServiceClient interface {
+	// Publish publishes a message. Refused messages fail with
+	// INVALID_ARGUMENT, NOT_FOUND for an unknown channel, ABORTED
+	// while a message with the same idempotency key is in progress,
+	// RESOURCE_EXHAUSTED when rate limited, with a "retry-after" trailer in
+	// seconds, DEADLINE_EXCEEDED, or UNAVAILABLE while the hub shuts down.
+	Publish(context.Context, *connect.Request[v1.PublishRequest]) (*connect.Response[v1.PublishResponse], error)
+	// PublishBatch publishes up to 1000 messages and returns a result per
+	// message, in order; a message failing does not fail the rest.
+	PublishBatch(context.Context, *connect.Request[v1.PublishBatchRequest]) (*connect.Response[v1.PublishBatchResponse], error)
+}
+
+// NewPublishServiceClient constructs a client for the pushpop.v1.PublishService service. By
+// default, it uses the Connect protocol with the binary Protobuf Codec, asks for gzipped responses,
+// and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the
+// connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewPublishServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) PublishServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	publishServiceMethods := v1.File_pushpop_v1_publish_proto.Services().ByName("PublishService").Methods()
+	return &publishServiceClient{
+		publish: connect.NewClient[v1.PublishRequest, v1.PublishResponse](
+			httpClient,
+			baseURL+PublishServicePublishProcedure,
+			connect.WithSchema(publishServiceMethods.ByName("Publish")),
+			connect.WithClientOptions(opts...),
+		),
+		publishBatch: connect.NewClient[v1.PublishBatchRequest, v1.PublishBatchResponse](
+			httpClient,
+			baseURL+PublishServicePublishBatchProcedure,
+			connect.WithSchema(publishServiceMethods.ByName("PublishBatch")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// publishServiceClient implements PublishServiceClient.
+type publishServiceClient struct {
+	publish      *connect.Client[v1.PublishRequest, v1.PublishResponse]
+	publishBatch *connect.Client[v1.PublishBatchRequest, v1.PublishBatchResponse]
+}
+
+// Publish calls pushpop.v1.PublishService.Publish.
+func (c *publishServiceClient) Publish(ctx context.Context, req *connect.Request[v1.PublishRequest]) (*connect.Response[v1.PublishResponse], error) {
+	return c.publish.CallUnary(ctx, req)
+}
+
+// PublishBatch calls pushpop.v1.PublishService.PublishBatch.
+func (c *publishServiceClient) PublishBatch(ctx context.Context, req *connect.Request[v1.PublishBatchRequest]) (*connect.Response[v1.PublishBatchResponse], error) {
+	return c.publishBatch.CallUnary(ctx, req)
+}
+
+// PublishServiceHandler is an implementation of the pushpop.v1.PublishService service.
+type PublishServiceHandler interface {
+	// Publish publishes a message. Refused messages fail with
+	// INVALID_ARGUMENT, NOT_FOUND for an unknown channel, ABORTED
+	// while a message with the same idempotency key is in progress,
+	// RESOURCE_EXHAUSTED when rate limited, with a "retry-after" trailer in
+	// seconds, DEADLINE_EXCEEDED, or UNAVAILABLE while the hub shuts down.
+	Publish(context.Context, *connect.Request[v1.PublishRequest]) (*connect.Response[v1.PublishResponse], error)
+	// PublishBatch publishes up to 1000 messages and returns a result per
+	// message, in order; a message failing does not fail the rest.
+	PublishBatch(context.Context, *connect.Request[v1.PublishBatchRequest]) (*connect.Response[v1.PublishBatchResponse], error)
+}
+
+// NewPublishServiceHandler builds an HTTP handler from the service implementation. It returns the
+// path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewPublishServiceHandler(svc PublishServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	publishServiceMethods := v1.File_pushpop_v1_publish_proto.Services().ByName("PublishService").Methods()
+	publishServicePublishHandler := connect.NewUnaryHandler(
+		PublishServicePublishProcedure,
+		svc.Publish,
+		connect.WithSchema(publishServiceMethods.ByName("Publish")),
+		connect.WithHandlerOptions(opts...),
+	)
+	publishServicePublishBatchHandler := connect.NewUnaryHandler(
+		PublishServicePublishBatchProcedure,
+		svc.PublishBatch,
+		connect.WithSchema(publishServiceMethods.ByName("PublishBatch")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/pushpop.v1.PublishService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case PublishServicePublishProcedure:
+			publishServicePublishHandler.ServeHTTP(w, r)
+		case PublishServicePublishBatchProcedure:
+			publishServicePublishBatchHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedPublishServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedPublishServiceHandler struct{}
+
+func (UnimplementedPublishServiceHandler) Publish(context.Context, *connect.Request[v1.PublishRequest]) (*connect.Response[v1.PublishResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.PublishService.Publish is not implemented"))
+}
+
+func (UnimplementedPublishServiceHandler) PublishBatch(context.Context, *connect.Request[v1.PublishBatchRequest]) (*connect.Response[v1.PublishBatchResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("pushpop.v1.PublishService.PublishBatch is not implemented"))
+}
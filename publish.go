@@ -0,0 +1,129 @@
+package pushpop
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+)
+
+// PublishOptions configure Hub.Publish.
+type PublishOptions struct {
+	// Channels publishes the message to each channel, in place of its
+	// Channel, sharing one message ID.
+	Channels []string
+	// IdempotencyKey publishes the message once: publishing again with the
+	// key within 10 minutes returns the first message's ID, like a /trigger
+	// with an Idempotency-Key header.
+	IdempotencyKey string
+	// Report waits for the message to be fanned out and reports the
+	// subscribers on this node it was enqueued to.
+	Report bool
+}
+
+// PublishResult is the outcome of Hub.Publish.
+type PublishResult struct {
+	ID string
+	// Duplicate reports that the idempotency key was already used, and ID
+	// is the first message's.
+	Duplicate bool
+	// Fanout is set with PublishOptions.Report.
+	Fanout Fanout
+}
+
+// PublishError is a message Hub.Publish refused.
+type PublishError struct {
+	// Status is the HTTP status /trigger answers the message with, e.g.
+	// 404 for an unknown channel or 429 when rate limited.
+	Status  int
+	Message string
+	// RetryAfter is how long a rate limited message should wait before it
+	// is retried.
+	RetryAfter time.Duration
+}
+
+func (e *PublishError) Error() string { return e.Message }
+
+// Publish publishes a message the way POST /trigger does, for producers
+// reaching the hub other than over HTTP, e.g. the gRPC API. Messages are
+// stamped with the API origin, keeping a bridge's. Without a deadline on
+// ctx, Publish waits up to 5s for the hub to accept each channel's message.
+// Refused messages return a *PublishError; scheduled and socket messages
+// are not supported.
+func (h *Hub) Publish(ctx context.Context, message Message, opts PublishOptions) (result PublishResult, err error) {
+	h.intake.add()
+	defer h.intake.done()
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTriggerTimeout)
+		defer cancel()
+	}
+
+	origin := Origin{Type: OriginAPI}
+	if envelope := message.Envelope; envelope != nil && envelope.Origin.Type == OriginBridge {
+		origin = envelope.Origin
+	}
+	message.Envelope = nil
+	message = stamp(message, origin)
+	result.ID = message.Envelope.ID
+	if message.SocketID != "" {
+		return result, &PublishError{Status: http.StatusBadRequest, Message: "socket messages cannot be published"}
+	}
+	channels := opts.Channels
+	if len(channels) == 0 {
+		channels = []string{message.Channel}
+	}
+
+	if key := opts.IdempotencyKey; key != "" {
+		id, state := h.idempotency.claim(key, result.ID, time.Now())
+		switch state {
+		case idempotencyDone:
+			return PublishResult{ID: id, Duplicate: true}, nil
+		case idempotencyPending:
+			return PublishResult{ID: id}, &PublishError{Status: http.StatusConflict, Message: "request in progress"}
+		}
+		defer func() { h.idempotency.finish(key, err == nil) }()
+	}
+
+	if opts.Report {
+		result.Fanout.Channels = make(map[string]int, len(channels))
+	}
+	for _, channel := range channels {
+		if channel == "" {
+			return result, &PublishError{Status: http.StatusBadRequest, Message: "missing channel"}
+		}
+		message.Channel = channel
+		report, err := h.triggerMessage(ctx, message, opts.Report)
+		if err != nil {
+			return result, publishError(ctx, err)
+		}
+		if opts.Report {
+			result.Fanout.Subscribers += report.enqueued
+			result.Fanout.Channels[channel] = report.enqueued
+		}
+	}
+	return result, nil
+}
+
+// publishError turns a failed publish into the PublishError /trigger
+// answers with.
+func publishError(ctx context.Context, err error) *PublishError {
+	var limited *rateLimitError
+	switch {
+	case err == errUnknownChannel:
+		return &PublishError{Status: http.StatusNotFound, Message: "unknown channel"}
+	case errors.Is(err, errInvalidPayload):
+		return &PublishError{Status: http.StatusBadRequest, Message: err.Error()}
+	case err == errPayloadTooLarge:
+		return &PublishError{Status: http.StatusRequestEntityTooLarge, Message: "payload too large"}
+	case err == errHubStopped:
+		return &PublishError{Status: http.StatusServiceUnavailable, Message: "server shutting down"}
+	case ctx.Err() != nil:
+		return &PublishError{Status: http.StatusRequestTimeout, Message: "timeout"}
+	case errors.As(err, &limited):
+		retryAfter := time.Duration(max(1, math.Ceil(limited.reset.Seconds()))) * time.Second
+		return &PublishError{Status: http.StatusTooManyRequests, Message: err.Error(), RetryAfter: retryAfter}
+	}
+	return &PublishError{Status: http.StatusTooManyRequests, Message: "too many requests"}
+}
@@ -0,0 +1,48 @@
+package publisher
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker. It opens after threshold failed requests
+// in a row, refusing requests for cooldown, then lets one request probe the
+// hub: its success closes the breaker and its failure opens it again.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports whether a request may be made at now.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || now.Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of a request allowed at now.
+func (b *breaker) record(ok bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = now
+	}
+}
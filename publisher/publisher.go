@@ -0,0 +1,505 @@
+// Package publisher publishes messages to a pushpop hub over its trigger
+// API, for producing services that want more than http.Post: pooled
+// connections, batching, retries that cannot publish a message twice, and a
+// circuit breaker that fails fast while the hub is down.
+//
+//	p, err := publisher.New(publisher.Config{URL: "https://push.example.com", Token: key})
+//	if err != nil {
+//		return err
+//	}
+//	defer p.Close(ctx)
+//	id, err := p.Publish(ctx, pushpop.Message{Channel: "orders", Event: "created", Payload: order})
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+)
+
+var (
+	// ErrCircuitOpen is returned without a request while the circuit
+	// breaker is open.
+	ErrCircuitOpen = errors.New("publisher: circuit open")
+	// ErrClosed is returned by Send after Close.
+	ErrClosed = errors.New("publisher: closed")
+	// ErrBufferFull is returned by Send when the buffer is full.
+	ErrBufferFull = errors.New("publisher: buffer full")
+)
+
+// maxBackoff caps the delay between attempts.
+const maxBackoff = 5 * time.Second
+
+// Error is a message the hub refused.
+type Error struct {
+	// StatusCode is the HTTP status the hub answered the message with.
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("publisher: %d %s", e.StatusCode, e.Message)
+}
+
+// Config configures a Publisher.
+type Config struct {
+	// URL is the base URL of the hub, e.g. "https://push.example.com";
+	// messages are POSTed to /trigger and /trigger/batch under it.
+	URL string
+	// Token is an API key with the publish scope, if the hub requires one.
+	Token string
+	// Client defaults to a client keeping up to 100 idle connections to
+	// the hub.
+	Client *http.Client
+	// MaxAttempts bounds the requests made for a message. Network errors,
+	// 408, 429, and 5xx answers are retried with exponential backoff,
+	// waiting at least as long as a Retry-After header asks. Defaults to 4.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. Defaults to 100ms.
+	Backoff time.Duration
+	// BatchSize is how many messages Send and PublishBatch publish per
+	// request. Defaults to 100, at most 1000.
+	BatchSize int
+	// FlushInterval is how long Send waits to fill a batch. Defaults to
+	// 10ms.
+	FlushInterval time.Duration
+	// BufferSize bounds the messages Send has not published yet. Defaults
+	// to 10000.
+	BufferSize int
+	// BreakerThreshold is how many requests in a row must fail, after
+	// retries, for the circuit breaker to open. Defaults to 5.
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before a request
+	// probes the hub again. Defaults to 10s.
+	BreakerCooldown time.Duration
+	// OnError is called with the messages Send could not publish.
+	OnError func(message pushpop.Message, err error)
+}
+
+// Result is the outcome of a message of a batch.
+type Result struct {
+	// ID is the message ID the hub assigned.
+	ID  string
+	Err error
+}
+
+// Publisher publishes messages to a hub. It is safe for concurrent use.
+type Publisher struct {
+	cfg      Config
+	trigger  string
+	batch    string
+	breaker  *breaker
+	in       chan pushpop.Message
+	mu       sync.RWMutex
+	closed   bool
+	done     chan struct{}
+	flushReq chan chan struct{}
+}
+
+// New creates a Publisher and starts its background batcher; call Close to
+// stop it.
+func New(cfg Config) (*Publisher, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("publisher: invalid URL %q", cfg.URL)
+	}
+	if cfg.Client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = 100
+		transport.MaxIdleConnsPerHost = 100
+		cfg.Client = &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 4
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 100 * time.Millisecond
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	cfg.BatchSize = min(cfg.BatchSize, 1000)
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 10 * time.Millisecond
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = 5
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = 10 * time.Second
+	}
+	trigger := strings.TrimSuffix(base.String(), "/") + "/trigger"
+	p := &Publisher{
+		cfg:      cfg,
+		trigger:  trigger,
+		batch:    trigger + "/batch",
+		breaker:  &breaker{threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown},
+		in:       make(chan pushpop.Message, cfg.BufferSize),
+		done:     make(chan struct{}),
+		flushReq: make(chan chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// Publish publishes a message and returns its ID. Retries carry the same
+// idempotency key, so the hub publishes the message at most once.
+func (p *Publisher) Publish(ctx context.Context, message pushpop.Message) (string, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	key := newKey()
+	var id string
+	err = p.retry(ctx, func() (time.Duration, error) {
+		resp, err := p.post(ctx, p.trigger, body, key)
+		if err != nil {
+			return 0, err
+		}
+		defer drain(resp)
+		if resp.StatusCode != http.StatusOK {
+			return retryAfter(resp), responseError(resp)
+		}
+		id = resp.Header.Get("Pushpop-Message-Id")
+		return 0, nil
+	})
+	return id, err
+}
+
+// PublishBatch publishes messages, BatchSize per request, and returns a
+// result per message in order. Messages failing with a retryable status
+// are retried with the next attempt. If a request fails altogether, e.g.
+// with ErrCircuitOpen, the messages left fail with the returned error.
+func (p *Publisher) PublishBatch(ctx context.Context, messages []pushpop.Message) ([]Result, error) {
+	results := make([]Result, len(messages))
+	for start := 0; start < len(messages); start += p.cfg.BatchSize {
+		end := min(start+p.cfg.BatchSize, len(messages))
+		if err := p.publishBatch(ctx, messages[start:end], results[start:end]); err != nil {
+			for i := start; i < len(messages); i++ {
+				if results[i].ID == "" && results[i].Err == nil {
+					results[i].Err = err
+				}
+			}
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// batchItem is a message of a /trigger/batch request.
+type batchItem struct {
+	pushpop.Message
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// batchResult is the hub's result for a batch item.
+type batchResult struct {
+	ID         string `json:"id"`
+	Status     int    `json:"status"`
+	Error      string `json:"error"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+// publishBatch publishes a batch of at most BatchSize messages into
+// results.
+func (p *Publisher) publishBatch(ctx context.Context, messages []pushpop.Message, results []Result) error {
+	items := make([]batchItem, len(messages))
+	for i, message := range messages {
+		items[i] = batchItem{Message: message, IdempotencyKey: newKey()}
+	}
+	// pending holds the indexes of the messages still to publish.
+	pending := make([]int, len(messages))
+	for i := range pending {
+		pending[i] = i
+	}
+	// answered is set once the hub returned results, which then carry
+	// the errors of the messages that could not be published.
+	answered := false
+	err := p.retry(ctx, func() (time.Duration, error) {
+		batch := make([]batchItem, len(pending))
+		for i, index := range pending {
+			batch[i] = items[index]
+		}
+		body, err := json.Marshal(map[string]interface{}{"messages": batch})
+		if err != nil {
+			return 0, &Error{StatusCode: http.StatusBadRequest, Message: err.Error()}
+		}
+		resp, err := p.post(ctx, p.batch, body, "")
+		if err != nil {
+			return 0, err
+		}
+		defer drain(resp)
+		if resp.StatusCode != http.StatusOK {
+			return retryAfter(resp), responseError(resp)
+		}
+		var answer struct {
+			Results []batchResult `json:"results"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil || len(answer.Results) != len(pending) {
+			return 0, &Error{StatusCode: http.StatusBadGateway, Message: "invalid batch response"}
+		}
+
+		answered = true
+		var retryable []int
+		var wait time.Duration
+		var last error
+		for i, result := range answer.Results {
+			index := pending[i]
+			results[index].ID = result.ID
+			if result.Status == http.StatusOK {
+				results[index].Err = nil
+				continue
+			}
+			results[index].Err = &Error{StatusCode: result.Status, Message: result.Error}
+			if retryableStatus(result.Status) {
+				retryable = append(retryable, index)
+				wait = max(wait, time.Duration(result.RetryAfter)*time.Second)
+				last = results[index].Err
+			}
+		}
+		pending = retryable
+		if len(pending) > 0 {
+			// The request went through, so the breaker is not tripped.
+			return wait, &partialError{last}
+		}
+		return 0, nil
+	})
+	if answered {
+		return nil
+	}
+	return err
+}
+
+// partialError is a batch request that succeeded with messages left to
+// retry.
+type partialError struct{ err error }
+
+func (e *partialError) Error() string { return e.err.Error() }
+
+// Send queues a message to be published in the background, batched with
+// others. Messages that cannot be published go to OnError.
+func (p *Publisher) Send(message pushpop.Message) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	select {
+	case p.in <- message:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+// Flush publishes the messages queued by Send so far and waits for them.
+func (p *Publisher) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case p.flushReq <- done:
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close publishes the messages queued by Send and stops the batcher,
+// waiting until it is done or ctx is cancelled.
+func (p *Publisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.in)
+	}
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run batches the messages queued by Send until Close.
+func (p *Publisher) run() {
+	defer close(p.done)
+	batch := make([]pushpop.Message, 0, p.cfg.BatchSize)
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-p.in:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, message)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			p.flush(batch)
+			batch = batch[:0]
+		case done := <-p.flushReq:
+			for n := len(p.in); n > 0; n-- {
+				batch = append(batch, <-p.in)
+				if len(batch) >= p.cfg.BatchSize {
+					p.flush(batch)
+					batch = batch[:0]
+				}
+			}
+			p.flush(batch)
+			batch = batch[:0]
+			close(done)
+		}
+	}
+}
+
+// flush publishes a batch queued by Send, reporting failures to OnError.
+func (p *Publisher) flush(batch []pushpop.Message) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results, _ := p.PublishBatch(ctx, batch)
+	if p.cfg.OnError == nil {
+		return
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			p.cfg.OnError(batch[i], result.Err)
+		}
+	}
+}
+
+// retry calls attempt until it succeeds, fails for good, or runs out of
+// attempts. attempt returns how long the hub asked to wait before a retry.
+func (p *Publisher) retry(ctx context.Context, attempt func() (time.Duration, error)) error {
+	backoff := p.cfg.Backoff
+	for n := 1; ; n++ {
+		if !p.breaker.allow(time.Now()) {
+			return ErrCircuitOpen
+		}
+		wait, err := attempt()
+		var partial *partialError
+		if errors.As(err, &partial) {
+			p.breaker.record(true, time.Now())
+			err = partial.err
+		} else {
+			p.breaker.record(!tripping(err), time.Now())
+		}
+		if err == nil || !retryable(err) || n >= p.cfg.MaxAttempts {
+			return err
+		}
+		wait = max(wait, backoff)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// post sends a request to the hub.
+func (p *Publisher) post(ctx context.Context, target string, body []byte, key string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	return p.cfg.Client.Do(req)
+}
+
+// retryable reports whether a failed request may be retried.
+func retryable(err error) bool {
+	var refused *Error
+	if errors.As(err, &refused) {
+		return retryableStatus(refused.StatusCode)
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryableStatus reports whether a message refused with status may be
+// retried: on timeouts, rate limits, a duplicate still in progress, and
+// server errors.
+func retryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusConflict ||
+		status == http.StatusTooManyRequests || status >= 500
+}
+
+// tripping reports whether a failed request counts against the circuit
+// breaker: network errors and server errors do, refused messages do not.
+func tripping(err error) bool {
+	if err == nil {
+		return false
+	}
+	var refused *Error
+	if errors.As(err, &refused) {
+		return refused.StatusCode >= 500
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+// responseError turns an answer other than 200 into an Error.
+func responseError(resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &Error{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(detail))}
+}
+
+// retryAfter returns the wait a Retry-After header asks for, in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// drain reads the rest of a response so its connection can be reused.
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// newKey returns a random idempotency key.
+func newKey() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never fails.
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,130 @@
+package pushpop
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// PurgeReport counts what PurgeUser deleted and lists what it could not.
+type PurgeReport struct {
+	HistoryMessages int `json:"history_messages"`
+	// BufferedMessages counts the user's messages dropped from the buffers
+	// kept for other users' disconnected connections.
+	BufferedMessages int  `json:"buffered_messages"`
+	Recoveries       int  `json:"recoveries"`
+	PresenceTraces   int  `json:"presence_traces"`
+	LastSeen         bool `json:"last_seen"`
+	ReadPositions    int  `json:"read_positions"`
+	// ScheduledMessages counts the scheduled messages that were cancelled,
+	// or readdressed to their remaining channels.
+	ScheduledMessages int `json:"scheduled_messages"`
+
+	// Complete reports whether Retained is empty, so nothing the hub knows
+	// of is left.
+	Complete bool          `json:"complete"`
+	Retained PurgeRetained `json:"retained"`
+}
+
+// PurgeRetained describes the data about a user that PurgeUser left in
+// place, which the caller has to erase by other means.
+type PurgeRetained struct {
+	// Connections counts the user's open connections on this node. Their
+	// sessions stay until they disconnect; disconnect or block the user
+	// and purge again.
+	Connections int `json:"connections"`
+	// PresenceChannels lists the presence channels the user is a live
+	// member of through those connections.
+	PresenceChannels []string `json:"presence_channels,omitempty"`
+	// ScheduleError is set when the schedule store failed to save the
+	// purged scheduled messages, which it may still hold.
+	ScheduleError string `json:"schedule_error,omitempty"`
+	// ReplaySources lists the replay sources besides history, such as an
+	// archive in object storage, that may hold copies of the purged
+	// messages. The hub cannot delete from them.
+	ReplaySources []string `json:"replay_sources,omitempty"`
+}
+
+// empty reports whether nothing was retained.
+func (r PurgeRetained) empty() bool {
+	return r.Connections == 0 && len(r.PresenceChannels) == 0 && r.ScheduleError == "" && len(r.ReplaySources) == 0
+}
+
+// PurgeUser deletes the data this node keeps about a user, for erasure
+// requests under GDPR or CCPA: the history of the user's own channel and
+// of the channels matching patterns, the messages the user's clients
+// published to any other channel, in history and in the buffers of
+// disconnected connections, the messages buffered for the user's own
+// disconnected connections, the user's last-seen record and read
+// positions, memberships restored from a snapshot, and scheduled messages
+// to the purged channels. Patterns use the syntax of Rule.Channels, with
+// {user} standing for userID, e.g. "dm-{user}-*".
+//
+// Messages published before their sender was recorded are only purged by
+// naming their channels. What cannot be purged is listed in the report's
+// Retained, and Complete is false: the user's open connections and their
+// presence, and copies in replay sources such as an archive. Snapshots
+// saved earlier and messages already delivered to subscribers, webhooks,
+// brokers, or other nodes are out of the hub's reach; purge every node.
+func (h *Hub) PurgeUser(userID string, patterns ...string) PurgeReport {
+	session := &Session{UserID: userID}
+	expanded := []string{UserChannel(userID)}
+	for _, pattern := range patterns {
+		if pattern, ok := expandPattern(pattern, session); ok {
+			expanded = append(expanded, pattern)
+		}
+	}
+	match := func(channel string) bool {
+		for _, pattern := range expanded {
+			if matchPattern(pattern, channel) {
+				return true
+			}
+		}
+		return false
+	}
+
+	report := PurgeReport{
+		HistoryMessages:  h.history.purge(match, userID),
+		BufferedMessages: h.recoveries.purgeMessages(userID),
+		Recoveries:       h.recoveries.purgeUser(userID),
+		LastSeen:         h.lastSeen.forget(userID),
+		ReadPositions:    h.history.forgetReads(userID),
+	}
+	scheduled, err := h.schedule.purge(match)
+	report.ScheduledMessages = scheduled
+	if err != nil {
+		h.log.Error("Failed to purge scheduled messages", "user", userID, "err", err)
+		report.Retained.ScheduleError = err.Error()
+	}
+	for _, channel := range h.presence.forgetRestored(userID) {
+		report.PresenceTraces++
+		select {
+		case h.broadcast <- Message{Channel: channel, Event: EventMemberRemoved, Payload: Member{ID: userID}}:
+		case <-h.stopped():
+		}
+	}
+
+	h.clients.Range(func(key, _ interface{}) bool {
+		if key.(*Client).session.UserID == userID {
+			report.Retained.Connections++
+		}
+		return true
+	})
+	report.Retained.PresenceChannels = h.presence.channelsOf(userID)
+	for name := range h.replays.sources {
+		report.Retained.ReplaySources = append(report.Retained.ReplaySources, name)
+	}
+	sort.Strings(report.Retained.ReplaySources)
+	report.Complete = report.Retained.empty()
+	return report
+}
+
+// handleAdminPurgeUser deletes a user's data. The optional channels query
+// parameter lists further channel patterns, separated by commas.
+func (h *Hub) handleAdminPurgeUser(w http.ResponseWriter, r *http.Request) {
+	var patterns []string
+	if channels := r.URL.Query().Get("channels"); channels != "" {
+		patterns = strings.Split(channels, ",")
+	}
+	writeJSON(w, http.StatusOK, h.PurgeUser(r.PathValue("id"), patterns...))
+}
@@ -0,0 +1,338 @@
+package pushpop
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errRateLimited is returned when a channel's publish rate is exceeded.
+var errRateLimited = errors.New("channel rate limit exceeded")
+
+// Overflow selects what happens to messages published faster than a
+// channel's rate limit allows.
+type Overflow int
+
+const (
+	// OverflowReject refuses excess messages: HandleTrigger answers 429 and
+	// client publishes are dropped with an error.
+	OverflowReject Overflow = iota
+	// OverflowSample accepts excess messages but silently drops them, so
+	// subscribers see a sample of the stream.
+	OverflowSample
+	// OverflowQueue delays excess messages until the rate allows, up to
+	// QueueSize messages, and rejects them beyond that.
+	OverflowQueue
+)
+
+// RateLimit caps how fast messages may be published to a channel,
+// aggregated across every producer on this node.
+type RateLimit struct {
+	// PerSecond is the sustained rate.
+	PerSecond float64 `json:"per_second"`
+	// Burst is how many messages may be published at once. Defaults to
+	// one second's worth.
+	Burst int `json:"burst,omitempty"`
+	// Overflow selects what happens to excess messages.
+	Overflow Overflow `json:"overflow,omitempty"`
+	// QueueSize bounds the queue of OverflowQueue. Defaults to 100.
+	QueueSize int `json:"queue_size,omitempty"`
+}
+
+// validate checks that the limit has a positive, finite rate.
+func (l RateLimit) validate() error {
+	if !(l.PerSecond > 0) || math.IsInf(l.PerSecond, 1) {
+		return fmt.Errorf("per_second must be positive, got %v", l.PerSecond)
+	}
+	return nil
+}
+
+// withDefaults fills in the defaulted fields.
+func (l RateLimit) withDefaults() RateLimit {
+	if l.Burst <= 0 {
+		l.Burst = max(1, int(l.PerSecond))
+	}
+	if l.QueueSize <= 0 {
+		l.QueueSize = 100
+	}
+	return l
+}
+
+// MarshalText encodes the mode as "reject", "sample", or "queue".
+func (o Overflow) MarshalText() ([]byte, error) {
+	switch o {
+	case OverflowSample:
+		return []byte("sample"), nil
+	case OverflowQueue:
+		return []byte("queue"), nil
+	default:
+		return []byte("reject"), nil
+	}
+}
+
+// UnmarshalText decodes "reject", "sample", or "queue".
+func (o *Overflow) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "reject", "":
+		*o = OverflowReject
+	case "sample":
+		*o = OverflowSample
+	case "queue":
+		*o = OverflowQueue
+	default:
+		return fmt.Errorf("unknown overflow mode %q", text)
+	}
+	return nil
+}
+
+// WithChannelRateLimit limits the publish rate of every channel starting
+// with prefix. Each matching channel gets its own budget, so one noisy
+// channel cannot starve the broadcast path for everyone else. It is
+// shorthand for WithChannelDefaults with only RateLimit set.
+func WithChannelRateLimit(prefix string, limit RateLimit) Option {
+	return WithChannelDefaults(prefix, ChannelSettings{RateLimit: &limit})
+}
+
+// channelLimiter is a token bucket with an optional overflow queue.
+type channelLimiter struct {
+	limit RateLimit
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	queue  []Message
+	// draining is set while drainLimiter runs, until it has sent the last
+	// queued message.
+	draining bool
+}
+
+// refill adds the tokens earned since the last call. Callers hold mu.
+func (l *channelLimiter) refill(now time.Time) {
+	l.tokens = min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.PerSecond)
+	l.last = now
+}
+
+// allow takes a token if one is available, without queueing.
+func (l *channelLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(now)
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// rejection describes a message rejected on channel, with the time until
+// the limiter, after its queue, has a token again. Callers hold mu.
+func (l *channelLimiter) rejection(channel string) error {
+	need := float64(len(l.queue)) + 1 - l.tokens
+	return &rateLimitError{
+		channel: channel,
+		limit:   l.limit.Burst,
+		reset:   time.Duration(need / l.limit.PerSecond * float64(time.Second)),
+	}
+}
+
+// rateLimitError is errRateLimited with the state of the channel's
+// limiter, for the RateLimit headers of HandleTrigger.
+type rateLimitError struct {
+	channel string
+	limit   int
+	reset   time.Duration
+}
+
+func (e *rateLimitError) Error() string { return errRateLimited.Error() }
+
+func (e *rateLimitError) Unwrap() error { return errRateLimited }
+
+// writeRateLimited answers 429 with the RateLimit-Limit, RateLimit-Remaining,
+// and RateLimit-Reset headers of the IETF draft, a Retry-After header, and
+// a JSON body with the same hint, so producers can back off without
+// parsing the error.
+func writeRateLimited(w http.ResponseWriter, err *rateLimitError) {
+	reset := max(1, int(math.Ceil(err.reset.Seconds())))
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(err.limit))
+	header.Set("RateLimit-Remaining", "0")
+	header.Set("RateLimit-Reset", strconv.Itoa(reset))
+	header.Set("Retry-After", strconv.Itoa(reset))
+	writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+		"error":       "rate_limited",
+		"message":     err.Error(),
+		"channel":     err.channel,
+		"retry_after": reset,
+	})
+}
+
+// idle reports whether the bucket is full and nothing is queued, so the
+// limiter can be dropped without changing behavior. Callers hold mu.
+func (l *channelLimiter) idle(now time.Time) bool {
+	l.refill(now)
+	return !l.draining && l.tokens >= float64(l.limit.Burst)
+}
+
+// rateLimiters holds the limiters of rate-limited channels.
+type rateLimiters struct {
+	mu       sync.Mutex
+	channels map[string]*channelLimiter
+}
+
+// draining reports whether any limiter is still releasing queued messages.
+func (r *rateLimiters) draining() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.channels {
+		l.mu.Lock()
+		draining := l.draining
+		l.mu.Unlock()
+		if draining {
+			return true
+		}
+	}
+	return false
+}
+
+// limiter returns the limiter for channel, or nil if it is not rate limited.
+func (h *Hub) limiter(channel string) *channelLimiter {
+	configured := h.settingsFor(channel).RateLimit
+	if configured == nil {
+		return nil
+	}
+	limit := configured.withDefaults()
+
+	h.limiters.mu.Lock()
+	defer h.limiters.mu.Unlock()
+	if h.limiters.channels == nil {
+		h.limiters.channels = make(map[string]*channelLimiter)
+	}
+	if l, ok := h.limiters.channels[channel]; ok {
+		return l
+	}
+	now := time.Now()
+	if len(h.limiters.channels) >= 1024 {
+		// Forget limiters that have fully recovered, so channels that come
+		// and go do not accumulate.
+		for name, l := range h.limiters.channels {
+			l.mu.Lock()
+			if l.idle(now) {
+				delete(h.limiters.channels, name)
+			}
+			l.mu.Unlock()
+		}
+	}
+	l := &channelLimiter{limit: limit, tokens: float64(limit.Burst), last: now}
+	h.limiters.channels[channel] = l
+	return l
+}
+
+// admit checks that the hub is taking messages, that message's channel is
+// declared, and that its payload is valid and within the size limit, and
+// applies its rate limit. It reports whether the caller should queue the
+// message for broadcast now; when it returns false with a nil error the
+// message was sampled out or queued for later.
+func (h *Hub) admit(message Message) (bool, error) {
+	if h.intakeClosed.Load() {
+		return false, errHubStopped
+	}
+	if !h.channelAllowed(message.Channel) {
+		return false, errUnknownChannel
+	}
+	if !h.payloadFits(message) {
+		return false, errPayloadTooLarge
+	}
+	if err := h.validatePayload(message); err != nil {
+		return false, err
+	}
+	l := h.limiter(message.Channel)
+	if l == nil {
+		return true, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	// Queued messages go first to keep per-channel order, including one
+	// the drainer has dequeued but is still sending.
+	if !l.draining && l.tokens >= 1 {
+		l.tokens--
+		return true, nil
+	}
+
+	switch l.limit.Overflow {
+	case OverflowSample:
+		return false, nil
+	case OverflowQueue:
+		if len(l.queue) >= l.limit.QueueSize {
+			return false, l.rejection(message.Channel)
+		}
+		l.queue = append(l.queue, message)
+		if !l.draining {
+			l.draining = true
+			go h.drainLimiter(l)
+		}
+		return false, nil
+	default:
+		return false, l.rejection(message.Channel)
+	}
+}
+
+// drainLimiter releases a limiter's queued messages as the rate allows.
+func (h *Hub) drainLimiter(l *channelLimiter) {
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 {
+			l.draining = false
+			l.mu.Unlock()
+			return
+		}
+		l.refill(time.Now())
+		if l.tokens < 1 {
+			wait := time.Duration((1 - l.tokens) / l.limit.PerSecond * float64(time.Second))
+			l.mu.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		l.tokens--
+		message := l.queue[0]
+		l.queue = l.queue[1:]
+		l.mu.Unlock()
+
+		select {
+		case h.broadcast <- message:
+		case <-h.stopped():
+			l.mu.Lock()
+			l.queue, l.draining = nil, false
+			l.mu.Unlock()
+			return
+		}
+	}
+}
+
+// resetLimiter forgets the limiter of channel so changed settings apply.
+func (h *Hub) resetLimiter(channel string) {
+	h.limiters.mu.Lock()
+	defer h.limiters.mu.Unlock()
+	delete(h.limiters.channels, channel)
+}
+
+// accept rate limits message and queues it for broadcast.
+func (h *Hub) accept(message Message) error {
+	message.Channel = h.resolveChannel(message.Channel)
+	message = stamp(message, Origin{Type: OriginServer})
+	send, err := h.admit(message)
+	if err != nil || !send {
+		return err
+	}
+	select {
+	case h.broadcast <- message:
+		return nil
+	case <-h.stopped():
+		return errHubStopped
+	}
+}
@@ -0,0 +1,30 @@
+package pushpop
+
+import "testing"
+
+// TestRateLimitQueueOrder checks that a message is queued, even with
+// tokens to spare, while the drainer is still sending the last queued one,
+// so it cannot overtake it.
+func TestRateLimitQueueOrder(t *testing.T) {
+	hub := newTestHub(t, WithChannelRateLimit("limited", RateLimit{PerSecond: 10, Burst: 10, Overflow: OverflowQueue}))
+	l := hub.limiter("limited")
+
+	message := Message{Channel: "limited", Event: "count", Payload: 1}
+	if now, err := hub.admit(message); !now || err != nil {
+		t.Fatalf("idle limiter: got %v, %v", now, err)
+	}
+
+	// The drainer has dequeued its last message and is sending it.
+	l.mu.Lock()
+	l.draining = true
+	l.mu.Unlock()
+	message.Payload = 2
+	if now, err := hub.admit(message); now || err != nil {
+		t.Fatalf("draining limiter: got %v, %v", now, err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) != 1 || l.queue[0].Payload != 2 {
+		t.Errorf("got queue %v", l.queue)
+	}
+}
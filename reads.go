@@ -0,0 +1,157 @@
+package pushpop
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Read position events. EventRead announces a moved read position to the
+// channel; EventReads answers a client's reads action.
+const (
+	EventRead  = "pushpop:read"
+	EventReads = "pushpop:reads"
+)
+
+// ReadPosition is how far a user has read a channel.
+type ReadPosition struct {
+	UserID string `json:"user_id"`
+	// MessageID is the envelope ID of the last message the user read.
+	MessageID string    `json:"message_id"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+// markRead moves a user's read position on channel forward to position. It
+// reports false if the position was already there or further.
+func (s *historyStore) markRead(channel string, position ReadPosition) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history, ok := s.channels[channel]
+	if !ok {
+		history = &channelHistory{}
+		s.channels[channel] = history
+	}
+	// Envelope IDs are ULIDs, which sort by time.
+	if current, ok := history.reads[position.UserID]; ok && current.MessageID >= position.MessageID {
+		return false
+	}
+	if history.reads == nil {
+		history.reads = make(map[string]ReadPosition)
+	}
+	history.reads[position.UserID] = position
+	return true
+}
+
+// readPositions returns the read positions of channel, by user ID.
+func (s *historyStore) readPositions(channel string) []ReadPosition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	positions := []ReadPosition{}
+	if history, ok := s.channels[channel]; ok {
+		for _, position := range history.reads {
+			positions = append(positions, position)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].UserID < positions[j].UserID })
+	return positions
+}
+
+// allReads returns the read positions of every channel, for a Snapshot.
+func (s *historyStore) allReads() map[string][]ReadPosition {
+	s.mu.RLock()
+	channels := make([]string, 0, len(s.channels))
+	for channel, history := range s.channels {
+		if len(history.reads) > 0 {
+			channels = append(channels, channel)
+		}
+	}
+	s.mu.RUnlock()
+	reads := make(map[string][]ReadPosition, len(channels))
+	for _, channel := range channels {
+		reads[channel] = s.readPositions(channel)
+	}
+	return reads
+}
+
+// restoreReads loads the read positions of a Snapshot.
+func (s *historyStore) restoreReads(reads map[string][]ReadPosition) {
+	for channel, positions := range reads {
+		for _, position := range positions {
+			s.markRead(channel, position)
+		}
+	}
+}
+
+// forgetReads deletes a user's read positions and returns how many there
+// were.
+func (s *historyStore) forgetReads(userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	forgotten := 0
+	for _, history := range s.channels {
+		if _, ok := history.reads[userID]; ok {
+			delete(history.reads, userID)
+			forgotten++
+		}
+	}
+	return forgotten
+}
+
+// MarkRead moves userID's read position on channel forward to the message
+// with envelope ID messageID and announces it to the channel with an
+// EventRead. Positions are only tracked on channels that keep history, and
+// never move backwards; MarkRead reports whether the position moved.
+func (h *Hub) MarkRead(channel, userID, messageID string) bool {
+	channel = h.resolveChannel(channel)
+	if _, ok := h.retention(channel); !ok || userID == "" || !validULID(messageID) {
+		return false
+	}
+	position := ReadPosition{UserID: userID, MessageID: messageID, ReadAt: time.Now()}
+	if !h.history.markRead(channel, position) {
+		return false
+	}
+	select {
+	case h.broadcast <- Message{Channel: channel, Event: EventRead, Payload: position, Ephemeral: true}:
+	case <-h.stopped():
+	}
+	return true
+}
+
+// ReadPositions returns the read position of every user who has marked
+// channel read, sorted by user ID.
+func (h *Hub) ReadPositions(channel string) []ReadPosition {
+	return h.history.readPositions(h.resolveChannel(channel))
+}
+
+// validULID reports whether id is written like a ULID.
+func validULID(id string) bool {
+	if len(id) != 26 || id[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !strings.ContainsRune(crockford, rune(id[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// HandleReads returns an HTTP handler that serves the read positions of a
+// channel as JSON. Mount it on "GET /channels/{name}/reads". Requests are
+// authorized like HandleHistory.
+func HandleReads(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channel := hub.resolveChannel(r.PathValue("name"))
+		session := newSession(r)
+		if err := hub.connect(session); err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err := hub.authorizeSubscribe(session, channel); err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"channel": channel, "reads": hub.ReadPositions(channel)})
+	}
+}
@@ -0,0 +1,278 @@
+package pushpop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultReceiptTimeout is how long subscribers have to ack a message
+	// unless another timeout is given.
+	defaultReceiptTimeout = 30 * time.Second
+	// receiptRetention is how long completed receipts can be looked up.
+	receiptRetention = time.Hour
+	// receiptWebhookTimeout bounds posting a receipt to its webhook.
+	receiptWebhookTimeout = 10 * time.Second
+)
+
+// Receipts turns on delivery receipts for a channel. Its messages are sent
+// with "ack": true, clients answer with {"action": "ack", "id": ...}
+// naming the message's envelope ID, and the hub reports how many
+// subscribers acknowledged the message in time.
+type Receipts struct {
+	// Timeout is how long subscribers have to ack a message before they
+	// count as expired. Defaults to 30s.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Webhook receives the DeliveryReceipt as a JSON POST once every
+	// subscriber has acked the message or the timeout has passed.
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// MarshalJSON writes Timeout as a duration string like "30s".
+func (r Receipts) MarshalJSON() ([]byte, error) {
+	type plain Receipts
+	return json.Marshal(struct {
+		plain
+		Timeout jsonDuration `json:"timeout,omitempty"`
+	}{plain(r), jsonDuration(r.Timeout)})
+}
+
+// UnmarshalJSON reads Timeout as a duration string, or as nanoseconds as
+// written before.
+func (r *Receipts) UnmarshalJSON(data []byte) error {
+	type plain Receipts
+	v := struct {
+		*plain
+		Timeout jsonDuration `json:"timeout,omitempty"`
+	}{(*plain)(r), jsonDuration(r.Timeout)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	r.Timeout = time.Duration(v.Timeout)
+	return nil
+}
+
+// DeliveryReceipt reports the acks collected for a message from its
+// subscribers on this node. Messages published to several channels at
+// once share an ID and a receipt.
+type DeliveryReceipt struct {
+	MessageID string    `json:"message_id"`
+	Channels  []string  `json:"channels"`
+	Event     string    `json:"event"`
+	SentAt    time.Time `json:"sent_at"`
+	// Recipients is how many subscribers the message was enqueued to.
+	Recipients int `json:"recipients"`
+	// Delivered counts the subscribers that acked the message, Expired
+	// those that did not before the timeout, and Pending those still
+	// within it.
+	Delivered int `json:"delivered"`
+	Expired   int `json:"expired"`
+	Pending   int `json:"pending"`
+	// CompletedAt is set once no acks are pending.
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// receipt collects the acks of a message.
+type receipt struct {
+	DeliveryReceipt
+	webhook string
+	pending map[string]bool
+	timer   *time.Timer
+	// broadcasting counts the channels still enqueueing the message; the
+	// receipt cannot complete before they are done.
+	broadcasting int
+}
+
+// receiptStore keeps the receipts of messages on channels with Receipts.
+type receiptStore struct {
+	mu       sync.Mutex
+	receipts map[string]*receipt
+}
+
+func newReceiptStore() *receiptStore {
+	return &receiptStore{receipts: make(map[string]*receipt)}
+}
+
+// open returns the receipt of message for a broadcast on one of its
+// channels, starting it and its timeout for the first, and pruning receipts
+// completed long ago. Every open is followed by a seal.
+func (s *receiptStore) open(h *Hub, message Message, settings Receipts) *receipt {
+	now := time.Now()
+	id := message.Envelope.ID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.receipts[id]; ok {
+		r.Channels = append(r.Channels, message.Channel)
+		r.broadcasting++
+		return r
+	}
+	for old, r := range s.receipts {
+		if r.CompletedAt != nil && now.Sub(*r.CompletedAt) > receiptRetention {
+			delete(s.receipts, old)
+		}
+	}
+
+	timeout := settings.Timeout
+	if timeout <= 0 {
+		timeout = defaultReceiptTimeout
+	}
+	r := &receipt{
+		DeliveryReceipt: DeliveryReceipt{
+			MessageID: id,
+			Channels:  []string{message.Channel},
+			Event:     message.Event,
+			SentAt:    now,
+		},
+		webhook:      settings.Webhook,
+		pending:      make(map[string]bool),
+		broadcasting: 1,
+	}
+	r.timer = time.AfterFunc(timeout, func() { s.expire(h, r) })
+	s.receipts[id] = r
+	return r
+}
+
+// expect records a subscriber the message is about to be enqueued to, so
+// its ack cannot overtake the record. With expected false it removes a
+// subscriber the message could not be enqueued to after all.
+func (s *receiptStore) expect(r *receipt, socketID string, expected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.CompletedAt != nil {
+		return
+	}
+	if expected && !r.pending[socketID] {
+		r.pending[socketID] = true
+		r.Recipients++
+		r.Pending++
+	} else if !expected && r.pending[socketID] {
+		delete(r.pending, socketID)
+		r.Recipients--
+		r.Pending--
+	}
+}
+
+// seal ends a broadcast of the receipt's message, completing the receipt if
+// every subscriber has already acked it or there were none.
+func (s *receiptStore) seal(h *Hub, r *receipt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.broadcasting--
+	if r.broadcasting == 0 && r.Pending == 0 && r.CompletedAt == nil {
+		r.timer.Stop()
+		s.complete(h, r)
+	}
+}
+
+// ack records a subscriber's ack of a message.
+func (s *receiptStore) ack(h *Hub, id, socketID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.receipts[id]
+	if !ok || !r.pending[socketID] {
+		return
+	}
+	delete(r.pending, socketID)
+	r.Delivered++
+	r.Pending--
+	if r.Pending == 0 && r.broadcasting == 0 {
+		r.timer.Stop()
+		s.complete(h, r)
+	}
+}
+
+// expire counts the subscribers still pending at the timeout as expired.
+func (s *receiptStore) expire(h *Hub, r *receipt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.CompletedAt != nil {
+		return
+	}
+	r.Expired += r.Pending
+	r.Pending = 0
+	r.pending = nil
+	s.complete(h, r)
+}
+
+// complete marks a receipt complete and posts it to its webhook. Callers
+// hold mu.
+func (s *receiptStore) complete(h *Hub, r *receipt) {
+	now := time.Now()
+	r.CompletedAt = &now
+	if r.webhook != "" {
+		go h.postReceipt(r.webhook, r.snapshot())
+	}
+}
+
+// snapshot copies the report of a receipt. Callers hold mu.
+func (r *receipt) snapshot() DeliveryReceipt {
+	report := r.DeliveryReceipt
+	report.Channels = append([]string(nil), r.Channels...)
+	return report
+}
+
+// get returns the report of a receipt.
+func (s *receiptStore) get(id string) (DeliveryReceipt, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.receipts[id]
+	if !ok {
+		return DeliveryReceipt{}, false
+	}
+	return r.snapshot(), true
+}
+
+// postReceipt sends a completed receipt to a webhook.
+func (h *Hub) postReceipt(url string, report DeliveryReceipt) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), receiptWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		h.log.Error("Invalid receipt webhook", "url", url, "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("%s", resp.Status)
+		}
+	}
+	if err != nil {
+		h.log.Warn("Failed to post delivery receipt", "message", report.MessageID, "url", url, "err", err)
+	}
+}
+
+// Receipt returns the delivery receipt of a message on a channel with
+// Receipts, by its envelope ID.
+func (h *Hub) Receipt(id string) (DeliveryReceipt, bool) {
+	return h.receipts.get(id)
+}
+
+// HandleReceipts returns an HTTP handler that reports the delivery receipt
+// of the message named by the {id} path value. Once publish API keys exist
+// it requires one, like /trigger.
+func HandleReceipts(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hub.authorizedPublisher(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		receipt, ok := hub.Receipt(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Unknown Message", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, receipt)
+	}
+}
@@ -0,0 +1,213 @@
+package pushpop
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Events sent to clients about their connection and recovery state.
+const (
+	EventConnectionEstablished = "pushpop:connection_established"
+	EventResumed               = "pushpop:resumed"
+	EventResumeFailed          = "pushpop:resume_failed"
+)
+
+// recovery holds the state of a disconnected client while its recovery
+// window is open.
+type recovery struct {
+	userID   string
+	channels []string
+	// memberships holds the event filters and aliases of the channels
+	// that had one.
+	memberships map[string]membership
+	buffer      []Message
+	truncated   bool
+	timer       *time.Timer
+}
+
+// recoveryStore indexes recoveries by resume token and by channel so
+// broadcasts can be buffered for disconnected subscribers.
+type recoveryStore struct {
+	mu        sync.Mutex
+	byToken   map[string]*recovery
+	byChannel map[string]map[*recovery]struct{}
+}
+
+func newRecoveryStore() *recoveryStore {
+	return &recoveryStore{
+		byToken:   make(map[string]*recovery),
+		byChannel: make(map[string]map[*recovery]struct{}),
+	}
+}
+
+// save opens a recovery window for token. Saving a token that is already
+// held is a no-op.
+func (s *recoveryStore) save(token, userID string, channels []string, memberships map[string]membership, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byToken[token]; ok {
+		return
+	}
+	rec := &recovery{userID: userID, channels: channels, memberships: memberships}
+	s.byToken[token] = rec
+	for _, channel := range channels {
+		if s.byChannel[channel] == nil {
+			s.byChannel[channel] = make(map[*recovery]struct{})
+		}
+		s.byChannel[channel][rec] = struct{}{}
+	}
+	rec.timer = time.AfterFunc(window, func() { s.take(token) })
+}
+
+// take removes and returns the recovery for token, or nil if the window
+// has closed.
+func (s *recoveryStore) take(token string) *recovery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.takeLocked(token)
+}
+
+// takeLocked is take for callers holding mu.
+func (s *recoveryStore) takeLocked(token string) *recovery {
+	rec, ok := s.byToken[token]
+	if !ok {
+		return nil
+	}
+	rec.timer.Stop()
+	delete(s.byToken, token)
+	for _, channel := range rec.channels {
+		delete(s.byChannel[channel], rec)
+		if len(s.byChannel[channel]) == 0 {
+			delete(s.byChannel, channel)
+		}
+	}
+	return rec
+}
+
+// purgeUser discards the recoveries of a user's connections, with the
+// messages buffered for them, and returns how many there were.
+func (s *recoveryStore) purgeUser(userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := 0
+	for token, rec := range s.byToken {
+		if rec.userID == userID {
+			s.takeLocked(token)
+			purged++
+		}
+	}
+	return purged
+}
+
+// purgeMessages drops the messages clients of user published from the
+// buffers of every recovery and returns how many there were.
+func (s *recoveryStore) purgeMessages(user string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := 0
+	for _, rec := range s.byToken {
+		kept := rec.buffer[:0]
+		for _, message := range rec.buffer {
+			if publishedBy(message, user) {
+				purged++
+				continue
+			}
+			kept = append(kept, message)
+		}
+		clear(rec.buffer[len(kept):])
+		rec.buffer = kept
+	}
+	return purged
+}
+
+// buffer records message for every recovery subscribed to its channel,
+// dropping the oldest buffered message once limit is reached.
+func (s *recoveryStore) buffer(message Message, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for rec := range s.byChannel[message.Channel] {
+		if !rec.memberships[message.Channel].filter.allows(message.Event) {
+			continue
+		}
+		if len(rec.buffer) >= limit {
+			rec.buffer = rec.buffer[1:]
+			rec.truncated = true
+		}
+		rec.buffer = append(rec.buffer, message)
+	}
+}
+
+// resumeRequest asks Run to restore a recovery onto a reconnected client.
+type resumeRequest struct {
+	client *Client
+	token  string
+	// member is the client's presence member as of the upgrade.
+	member Member
+}
+
+// saveRecovery opens a recovery window for a client that is being removed.
+func (h *Hub) saveRecovery(client *Client) {
+	var channels []string
+	memberships := make(map[string]membership)
+	client.channels.Range(func(key, m interface{}) bool {
+		channels = append(channels, key.(string))
+		if m := m.(membership); m.filter != nil || m.alias != "" {
+			memberships[key.(string)] = m
+		}
+		return true
+	})
+	h.recoveries.save(client.token, client.session.UserID, channels, memberships, h.recoveryWindow)
+}
+
+// resumeClient restores the subscriptions and missed messages held for
+// req.token onto req.client. It runs on the Run goroutine so no broadcast
+// can slip between the buffered messages and the live subscription.
+func (h *Hub) resumeClient(req *resumeRequest) {
+	rec := h.recoveries.take(req.token)
+	if rec == nil {
+		h.sendControl(req.client, Message{Event: EventResumeFailed, Priority: PriorityHigh})
+		return
+	}
+
+	names := make([]string, 0, len(rec.channels))
+	for _, channel := range rec.channels {
+		sub := &Subscription{Client: req.client, Channel: channel, member: req.member}
+		if m, ok := rec.memberships[channel]; ok {
+			sub.Events, sub.Alias = m.filter.events(), m.alias
+		}
+		h.addSubscription(sub)
+		names = append(names, sub.name())
+	}
+	h.sendControl(req.client, Message{
+		Event:    EventResumed,
+		Priority: PriorityHigh,
+		Payload: map[string]interface{}{
+			"channels":  names,
+			"missed":    len(rec.buffer),
+			"truncated": rec.truncated,
+		},
+	})
+	for _, message := range rec.buffer {
+		if message, ok := h.intercept(req.client, message); ok {
+			h.sendControl(req.client, req.client.label(message))
+		}
+	}
+	h.log.Debug("Client resumed session", "client", req.client.conn.RemoteAddr(), "channels", rec.channels, "missed", len(rec.buffer))
+}
+
+// sendControl queues a message directly onto a client's send buffer,
+// dropping it if the buffer is full.
+func (h *Hub) sendControl(client *Client, message Message) {
+	if !client.enqueue(message) {
+		h.log.Warn("Dropped control message for slow client", "client", client.conn.RemoteAddr(), "event", message.Event)
+	}
+}
+
+// newToken returns a random hex token.
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,145 @@
+// Package redisbroker implements a pushpop Broker on Redis pub/sub. It works
+// against a standalone node, a Sentinel-managed primary, or a Redis Cluster,
+// and follows failovers by reconnecting and resubscribing automatically.
+package redisbroker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/biohackerellie/pushpop"
+	"github.com/redis/go-redis/v9"
+)
+
+// Config configures a Broker. The topology is chosen from the fields set:
+// MasterName selects Sentinel, more than one address selects Cluster, and a
+// single address connects to a standalone node.
+type Config struct {
+	// Addrs are host:port addresses of the node, the Sentinels, or the
+	// cluster seed nodes.
+	Addrs []string
+	// MasterName is the Sentinel master name.
+	MasterName string
+	// SentinelPassword authenticates against the Sentinels themselves.
+	SentinelPassword string
+	Username         string
+	Password         string
+	// DB selects the database on standalone and Sentinel topologies.
+	DB int
+	// Channel is the Redis pub/sub channel used for relaying. Defaults to
+	// "pushpop".
+	Channel string
+	// TLS enables TLS when set.
+	TLS *tls.Config
+	// RetryDelay is the wait before resubscribing after the subscription
+	// drops. Defaults to 1s.
+	RetryDelay time.Duration
+}
+
+// Broker relays hub broadcasts over Redis pub/sub.
+type Broker struct {
+	client  redis.UniversalClient
+	channel string
+	node    string
+	retry   time.Duration
+}
+
+// envelope tags relayed messages with the publishing node so a node can
+// ignore its own messages.
+type envelope struct {
+	Node    string          `json:"node"`
+	Message pushpop.Message `json:"message"`
+}
+
+// New creates a Broker for the topology described by cfg.
+func New(cfg Config) *Broker {
+	if cfg.Channel == "" {
+		cfg.Channel = "pushpop"
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	client := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		MasterName:       cfg.MasterName,
+		SentinelPassword: cfg.SentinelPassword,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		TLSConfig:        cfg.TLS,
+	})
+	return &Broker{
+		client:  client,
+		channel: cfg.Channel,
+		node:    newNodeID(),
+		retry:   cfg.RetryDelay,
+	}
+}
+
+// Publish relays message to the other nodes.
+func (b *Broker) Publish(ctx context.Context, message pushpop.Message) error {
+	data, err := json.Marshal(envelope{Node: b.node, Message: message})
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, data).Err()
+}
+
+// Subscribe delivers messages from other nodes to handler until ctx is
+// cancelled. Dropped connections, Sentinel failovers, and cluster slot
+// moves are handled by resubscribing.
+func (b *Broker) Subscribe(ctx context.Context, handler func(pushpop.Message)) error {
+	for {
+		pubsub := b.client.Subscribe(ctx, b.channel)
+		if _, err := pubsub.Receive(ctx); err == nil {
+			b.receive(ctx, pubsub, handler)
+		}
+		_ = pubsub.Close()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(b.retry):
+		}
+	}
+}
+
+// receive drains a subscription until it closes or ctx is cancelled.
+func (b *Broker) receive(ctx context.Context, pubsub *redis.PubSub, handler func(pushpop.Message)) {
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var env envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil || env.Node == b.node {
+				continue
+			}
+			handler(env.Message)
+		}
+	}
+}
+
+// Ping checks connectivity to the Redis deployment.
+func (b *Broker) Ping(ctx context.Context) error {
+	return b.client.Ping(ctx).Err()
+}
+
+// Close releases the Redis connections.
+func (b *Broker) Close() error {
+	return b.client.Close()
+}
+
+func newNodeID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,124 @@
+package pushpop
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errUnknownChannel is returned in strict mode for channels that were not
+// declared.
+var errUnknownChannel = errors.New("channel is not declared")
+
+// channelRegistry holds the declared channels, their settings, and the
+// prefix-based defaults the settings are resolved against.
+type channelRegistry struct {
+	mu       sync.RWMutex
+	strict   bool
+	declared map[string]bool
+	settings map[string]ChannelSettings
+	// aliases maps alias names to their target channels.
+	aliases map[string]string
+	// defaults are kept sorted by prefix length, so more specific
+	// prefixes are applied last.
+	defaults []channelDefaults
+}
+
+type channelDefaults struct {
+	prefix   string
+	settings ChannelSettings
+}
+
+// configured reports whether any settings or defaults exist, letting hot
+// paths skip resolution entirely.
+func (r *channelRegistry) configured() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.settings) > 0 || len(r.defaults) > 0
+}
+
+// WithStrictChannels switches the hub to a closed topology: clients may only
+// subscribe and messages may only be published to declared channels, rather
+// than channels being created on first subscribe. Names ending in "*"
+// declare every channel with that prefix, e.g. "chat-*".
+func WithStrictChannels(names ...string) Option {
+	return func(h *Hub) {
+		h.registry.strict = true
+		for _, name := range names {
+			h.DeclareChannel(name)
+		}
+	}
+}
+
+// DeclareChannel declares a channel, or with a trailing "*" every channel
+// with that prefix.
+func (h *Hub) DeclareChannel(name string) {
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+	if h.registry.declared == nil {
+		h.registry.declared = make(map[string]bool)
+	}
+	h.registry.declared[name] = true
+}
+
+// UndeclareChannel removes a declaration and the channel's settings.
+// Existing subscriptions are kept.
+func (h *Hub) UndeclareChannel(name string) bool {
+	h.registry.mu.Lock()
+	if !h.registry.declared[name] {
+		h.registry.mu.Unlock()
+		return false
+	}
+	delete(h.registry.declared, name)
+	delete(h.registry.settings, name)
+	h.registry.mu.Unlock()
+	h.resetLimiter(name)
+	return true
+}
+
+// DeclaredChannels returns the declared channels and prefixes.
+func (h *Hub) DeclaredChannels() []string {
+	h.registry.mu.RLock()
+	defer h.registry.mu.RUnlock()
+	names := make([]string, 0, len(h.registry.declared))
+	for name := range h.registry.declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// channelAllowed reports whether channel may be used. Outside strict mode
+// every channel is allowed.
+func (h *Hub) channelAllowed(channel string) bool {
+	h.registry.mu.RLock()
+	defer h.registry.mu.RUnlock()
+	if target, ok := h.registry.aliases[channel]; ok {
+		channel = target
+	}
+	if !h.registry.strict || h.registry.declared[channel] {
+		return true
+	}
+	for name := range h.registry.declared {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok && strings.HasPrefix(channel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAdminUndeclare removes a channel declaration.
+func (h *Hub) handleAdminUndeclare(w http.ResponseWriter, r *http.Request) {
+	if !h.UndeclareChannel(r.PathValue("name")) {
+		http.Error(w, "Unknown Channel", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminDeclared lists declared channels.
+func (h *Hub) handleAdminDeclared(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"channels": h.DeclaredChannels()})
+}
@@ -0,0 +1,302 @@
+package pushpop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReplayCancelled is the status of a replay cancelled before it finished.
+const ReplayCancelled = "cancelled"
+
+// ReplaySource reads the messages a channel carried in a time range, e.g.
+// from an archive; see WithReplaySource.
+type ReplaySource interface {
+	// Messages returns the channel's messages published from from until
+	// to, oldest first, with their envelopes.
+	Messages(ctx context.Context, channel string, from, to time.Time) ([]Message, error)
+}
+
+// WithReplaySource lets replays read from source, by the given name,
+// besides the hub's own "history".
+func WithReplaySource(name string, source ReplaySource) Option {
+	return func(h *Hub) {
+		h.replays.sources[name] = source
+	}
+}
+
+// Replay publishes the messages a channel carried in a time range again,
+// e.g. to debug a consumer or rebuild downstream state. Replayed messages
+// keep their envelope and are marked as replayed, so they are not stored in
+// history again, archived, relayed to federated hubs, or POSTed to webhooks.
+type Replay struct {
+	ID string `json:"id"`
+	// Channel is the channel whose messages are replayed, and Target the
+	// channel they are published to, Channel by default.
+	Channel string `json:"channel"`
+	Target  string `json:"target,omitempty"`
+	// Source is "history", the default, or the name of a ReplaySource.
+	Source string    `json:"source,omitempty"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Speed paces the replay relative to the original timing, e.g. 1 for
+	// the original pace or 10 for ten times faster; 0 publishes the
+	// messages as fast as the channel allows.
+	Speed float64 `json:"speed,omitempty"`
+
+	// The rest is maintained by the hub; Status is one of the job
+	// statuses or ReplayCancelled.
+	Status    string     `json:"status"`
+	Total     int        `json:"total"`
+	Published int        `json:"published"`
+	Error     string     `json:"error,omitempty"`
+	Created   time.Time  `json:"created"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+// replayStore keeps the replay sources and the replays that ran.
+type replayStore struct {
+	sources map[string]ReplaySource
+
+	mu      sync.Mutex
+	replays map[string]*Replay
+	cancels map[string]context.CancelFunc
+}
+
+func newReplayStore() *replayStore {
+	return &replayStore{
+		sources: make(map[string]ReplaySource),
+		replays: make(map[string]*Replay),
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+// Messages returns the messages of channel kept in history, from from until
+// to, making the history a ReplaySource.
+func (s *historyStore) Messages(_ context.Context, channel string, from, to time.Time) ([]Message, error) {
+	var messages []Message
+	for _, stored := range s.recent(channel, 0) {
+		if stored.Deleted || stored.Time.Before(from) || !stored.Time.Before(to) {
+			continue
+		}
+		messages = append(messages, stored.Message)
+	}
+	return messages, nil
+}
+
+// StartReplay starts a replay in the background and returns it. Follow its
+// progress with Replays, and stop it with CancelReplay.
+func (h *Hub) StartReplay(replay Replay) (Replay, error) {
+	if replay.Channel == "" {
+		return Replay{}, errors.New("missing channel")
+	}
+	if replay.Target == "" {
+		replay.Target = replay.Channel
+	}
+	replay.Target = h.resolveChannel(replay.Target)
+	if !h.channelAllowed(replay.Target) {
+		return Replay{}, errUnknownChannel
+	}
+	if replay.To.IsZero() {
+		replay.To = time.Now()
+	}
+	if !replay.From.Before(replay.To) {
+		return Replay{}, errors.New("from must be before to")
+	}
+	if replay.Speed < 0 {
+		return Replay{}, errors.New("invalid speed")
+	}
+	var source ReplaySource = h.history
+	if replay.Source == "" {
+		replay.Source = "history"
+	} else if replay.Source != "history" {
+		if source = h.replays.sources[replay.Source]; source == nil {
+			return Replay{}, fmt.Errorf("unknown source %q", replay.Source)
+		}
+	}
+
+	replay.ID = newToken()
+	replay.Status = JobRunning
+	replay.Total, replay.Published, replay.Error, replay.Finished = 0, 0, "", nil
+	replay.Created = time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	stored := replay
+	s := h.replays
+	s.mu.Lock()
+	for id, old := range s.replays {
+		if old.Finished != nil && replay.Created.Sub(*old.Finished) > jobRetention {
+			delete(s.replays, id)
+		}
+	}
+	s.replays[replay.ID] = &stored
+	s.cancels[replay.ID] = cancel
+	s.mu.Unlock()
+
+	go func() {
+		select {
+		case <-h.stopped():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go h.runReplay(ctx, &stored, source)
+	return replay, nil
+}
+
+// Replays returns the running replays and those that finished within the
+// last hour, newest first.
+func (h *Hub) Replays() []Replay {
+	s := h.replays
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replays := make([]Replay, 0, len(s.replays))
+	for _, replay := range s.replays {
+		replays = append(replays, *replay)
+	}
+	sort.Slice(replays, func(i, j int) bool { return replays[i].Created.After(replays[j].Created) })
+	return replays
+}
+
+// Replay returns a replay.
+func (h *Hub) Replay(id string) (Replay, bool) {
+	s := h.replays
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replay, ok := s.replays[id]
+	if !ok {
+		return Replay{}, false
+	}
+	return *replay, true
+}
+
+// CancelReplay stops a running replay and reports whether it was running.
+func (h *Hub) CancelReplay(id string) bool {
+	s := h.replays
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replay, ok := s.replays[id]
+	if !ok || replay.Finished != nil {
+		return false
+	}
+	s.cancels[id]()
+	return true
+}
+
+// update applies fn to a replay under the store's lock.
+func (s *replayStore) update(replay *Replay, fn func(*Replay)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(replay)
+}
+
+// runReplay reads the replay's messages and publishes them, paced by their
+// envelope timestamps.
+func (h *Hub) runReplay(ctx context.Context, replay *Replay, source ReplaySource) {
+	s := h.replays
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		replay.Finished = &now
+		switch {
+		case replay.Error != "":
+			replay.Status = JobFailed
+		case ctx.Err() != nil:
+			replay.Status = ReplayCancelled
+		default:
+			replay.Status = JobCompleted
+		}
+		s.cancels[replay.ID]()
+		delete(s.cancels, replay.ID)
+	}()
+
+	messages, err := source.Messages(ctx, replay.Channel, replay.From, replay.To)
+	if err != nil {
+		s.update(replay, func(r *Replay) { r.Error = err.Error() })
+		return
+	}
+	s.update(replay, func(r *Replay) { r.Total = len(messages) })
+
+	var previous time.Time
+	for _, message := range messages {
+		if message.Envelope != nil && replay.Speed > 0 {
+			if !previous.IsZero() {
+				wait := time.Duration(float64(message.Envelope.Timestamp.Sub(previous)) / replay.Speed)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+			previous = message.Envelope.Timestamp
+		}
+		message.Channel = replay.Target
+		message.Replayed = true
+		message.SocketID = ""
+		message = stamp(message, Origin{Type: OriginServer})
+		send, err := h.admit(message)
+		if err == errHubStopped {
+			return
+		}
+		if err != nil || !send {
+			h.log.Warn("Dropped replayed message", "replay", replay.ID, "channel", message.Channel, "err", err)
+			continue
+		}
+		select {
+		case h.broadcast <- message:
+		case <-ctx.Done():
+			return
+		}
+		s.update(replay, func(r *Replay) { r.Published++ })
+	}
+}
+
+// handleAdminReplays lists the replays.
+func (h *Hub) handleAdminReplays(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"replays": h.Replays()})
+}
+
+// handleAdminStartReplay starts a replay from the body and answers 202
+// with it.
+func (h *Hub) handleAdminStartReplay(w http.ResponseWriter, r *http.Request) {
+	var replay Replay
+	if err := json.NewDecoder(r.Body).Decode(&replay); err != nil {
+		http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+	replay, err := h.StartReplay(replay)
+	switch {
+	case err == errUnknownChannel:
+		http.Error(w, "Unknown Channel", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Location", "/admin/replays/"+replay.ID)
+	writeJSON(w, http.StatusAccepted, replay)
+}
+
+// handleAdminReplay reports a replay.
+func (h *Hub) handleAdminReplay(w http.ResponseWriter, r *http.Request) {
+	replay, ok := h.Replay(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Unknown Replay", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, replay)
+}
+
+// handleAdminCancelReplay cancels a running replay.
+func (h *Hub) handleAdminCancelReplay(w http.ResponseWriter, r *http.Request) {
+	if !h.CancelReplay(r.PathValue("id")) {
+		http.Error(w, "Unknown Replay", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
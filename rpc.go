@@ -0,0 +1,271 @@
+package pushpop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// EventReply carries the reply to a client's request.
+const EventReply = "pushpop:reply"
+
+// defaultRequestTimeout bounds request handlers unless WithRequestTimeout
+// is set.
+const defaultRequestTimeout = 30 * time.Second
+
+var errRequestPanicked = errors.New("request handler panicked")
+
+// Error codes of request replies.
+const (
+	CodeNoHandler     = "no_handler"
+	CodeUnknownMethod = "unknown_method"
+	CodeForbidden     = "forbidden"
+	CodeRateLimited   = "rate_limited"
+	CodeTimeout       = "timeout"
+	CodeInternal      = "internal"
+)
+
+// Request is a client's request over a channel or to a method. The client
+// sends
+//
+//	{"action": "request", "channel": "orders", "id": "c1", "reply_to": "inbox", "payload": {...}}
+//
+// or {"action": "request", "method": "orders.cancel", ...} and receives a
+// reply event on reply_to, or the request channel when it is empty. Replies
+// are only ever sent to the requesting connection.
+type Request struct {
+	Channel string
+	Method  string
+	// ID correlates the reply with the request; it is chosen by the client.
+	ID      string
+	ReplyTo string
+	Payload interface{}
+	Session *Session
+}
+
+// Decode decodes the request payload into v.
+func (r *Request) Decode(v interface{}) error {
+	data, err := json.Marshal(r.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Reply is the payload of an EventReply message.
+type Reply struct {
+	ID     string      `json:"id"`
+	Result interface{} `json:"result,omitempty"`
+	Error  *ReplyError `json:"error,omitempty"`
+}
+
+// ReplyError is the error of a failed request.
+type ReplyError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *ReplyError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// RequestHandler answers requests. The returned value is sent back as the
+// reply's result, or the error as its error. A *ReplyError, or an error
+// with a Code() string method, chooses the code; other errors are sent
+// with the code "internal".
+type RequestHandler func(ctx context.Context, req *Request) (interface{}, error)
+
+// WithRequestTimeout bounds how long request handlers may take before the
+// client is sent a timeout error. It defaults to 30s.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(h *Hub) {
+		h.requestTimeout = timeout
+	}
+}
+
+// HandleRequests registers the handler of requests sent on channel. Each
+// request runs on its own goroutine. The returned func removes the handler.
+func (h *Hub) HandleRequests(channel string, handler RequestHandler) (remove func()) {
+	h.handlersMu.Lock()
+	defer h.handlersMu.Unlock()
+	if h.requestHandlers == nil {
+		h.requestHandlers = make(map[string]RequestHandler)
+	}
+	h.requestHandlers[channel] = handler
+	return func() {
+		h.handlersMu.Lock()
+		defer h.handlersMu.Unlock()
+		delete(h.requestHandlers, channel)
+	}
+}
+
+// MethodOption configures a method registered with Handle.
+type MethodOption func(*method)
+
+// method is a registered RPC method.
+type method struct {
+	handler   RequestHandler
+	authorize func(session *Session) error
+	limiter   *channelLimiter
+}
+
+// MethodAuth authorizes callers of a method, e.g. by role. A non-nil error
+// is sent back with the code "forbidden".
+func MethodAuth(authorize func(session *Session) error) MethodOption {
+	return func(m *method) {
+		m.authorize = authorize
+	}
+}
+
+// MethodRateLimit caps how often a method may be called on this node,
+// across all callers. Calls over the limit are answered with the code
+// "rate_limited"; the limit's overflow mode is ignored.
+func MethodRateLimit(limit RateLimit) MethodOption {
+	return func(m *method) {
+		limit = limit.withDefaults()
+		m.limiter = &channelLimiter{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+	}
+}
+
+// Handle registers the handler of an RPC method, such as "orders.cancel".
+// Unlike HandleRequests, methods are not tied to a channel, so only the
+// method's own authorization applies. The returned func removes the
+// method.
+func (h *Hub) Handle(name string, handler RequestHandler, opts ...MethodOption) (remove func()) {
+	m := &method{handler: handler}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	h.handlersMu.Lock()
+	defer h.handlersMu.Unlock()
+	if h.methods == nil {
+		h.methods = make(map[string]*method)
+	}
+	h.methods[name] = m
+	return func() {
+		h.handlersMu.Lock()
+		defer h.handlersMu.Unlock()
+		if h.methods[name] == m {
+			delete(h.methods, name)
+		}
+	}
+}
+
+// handleRequest authorizes a request frame and answers it in the
+// background.
+func (h *Hub) handleRequest(client *Client, req *Request) {
+	if req.Method != "" {
+		h.handleMethod(client, req)
+		return
+	}
+
+	h.handlersMu.RLock()
+	handler := h.requestHandlers[req.Channel]
+	h.handlersMu.RUnlock()
+
+	if handler == nil {
+		h.reply(client, req, nil, &ReplyError{Code: CodeNoHandler, Message: "no handler for channel"})
+		return
+	}
+	if !h.channelAllowed(req.Channel) {
+		h.reply(client, req, nil, &ReplyError{Code: CodeForbidden, Message: errUnknownChannel.Error()})
+		return
+	}
+	if err := h.authorizeSubscribe(client.session, req.Channel); err != nil {
+		h.reply(client, req, nil, &ReplyError{Code: CodeForbidden, Message: err.Error()})
+		return
+	}
+	h.runRequest(client, req, handler)
+}
+
+// handleMethod routes a request to its method after the method's
+// authorization and rate limit.
+func (h *Hub) handleMethod(client *Client, req *Request) {
+	h.handlersMu.RLock()
+	m := h.methods[req.Method]
+	h.handlersMu.RUnlock()
+
+	if m == nil {
+		h.reply(client, req, nil, &ReplyError{Code: CodeUnknownMethod, Message: "unknown method " + req.Method})
+		return
+	}
+	if h.blocklist.blocked(client.session) {
+		h.reply(client, req, nil, &ReplyError{Code: CodeForbidden, Message: errBlocked.Error()})
+		return
+	}
+	if m.authorize != nil {
+		if err := m.authorize(client.session); err != nil {
+			h.reply(client, req, nil, &ReplyError{Code: CodeForbidden, Message: err.Error()})
+			return
+		}
+	}
+	if m.limiter != nil && !m.limiter.allow(time.Now()) {
+		h.reply(client, req, nil, &ReplyError{Code: CodeRateLimited, Message: "method rate limit exceeded"})
+		return
+	}
+	h.runRequest(client, req, m.handler)
+}
+
+// runRequest runs handler on its own goroutine and replies with its
+// outcome, or a timeout error.
+func (h *Hub) runRequest(client *Client, req *Request, handler RequestHandler) {
+	go func() {
+		timeout := h.requestTimeout
+		if timeout <= 0 {
+			timeout = defaultRequestTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		type outcome struct {
+			result interface{}
+			err    error
+		}
+		done := make(chan outcome, 1)
+		go func() {
+			out := outcome{err: errRequestPanicked}
+			h.safely(client, func() { out.result, out.err = handler(ctx, req) })
+			done <- out
+		}()
+
+		// Time out without waiting for handlers that ignore ctx.
+		select {
+		case out := <-done:
+			h.reply(client, req, out.result, out.err)
+		case <-ctx.Done():
+			h.reply(client, req, nil, ctx.Err())
+		}
+	}()
+}
+
+// replyError serializes a handler error for the caller.
+func replyError(err error) *ReplyError {
+	var replyErr *ReplyError
+	var coded interface{ Code() string }
+	switch {
+	case errors.As(err, &replyErr):
+		return replyErr
+	case errors.Is(err, context.DeadlineExceeded):
+		return &ReplyError{Code: CodeTimeout, Message: "request timed out"}
+	case errors.As(err, &coded):
+		return &ReplyError{Code: coded.Code(), Message: err.Error()}
+	default:
+		return &ReplyError{Code: CodeInternal, Message: err.Error()}
+	}
+}
+
+// reply sends the outcome of a request to the requesting client.
+func (h *Hub) reply(client *Client, req *Request, result interface{}, err error) {
+	reply := Reply{ID: req.ID, Result: result}
+	if err != nil {
+		reply.Result, reply.Error = nil, replyError(err)
+	}
+	channel := req.ReplyTo
+	if channel == "" {
+		channel = req.Channel
+	}
+	h.sendControl(client, Message{Channel: channel, Event: EventReply, Payload: reply, Priority: PriorityHigh})
+}
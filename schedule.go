@@ -0,0 +1,409 @@
+package pushpop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errScheduleChannel = errors.New("scheduled messages need a channel")
+
+// ScheduledMessage is a message held by the hub until DeliverAt.
+type ScheduledMessage struct {
+	// ID is the message's envelope ID.
+	ID        string    `json:"id"`
+	DeliverAt time.Time `json:"deliver_at"`
+	Channels  []string  `json:"channels"`
+	Message   Message   `json:"message"`
+}
+
+// ScheduleStore keeps scheduled messages durably, so they survive a restart
+// or a crash of the node that accepted them. A node delivers every message
+// its store loads, so nodes of a cluster need stores of their own.
+type ScheduleStore interface {
+	// Load returns the messages still scheduled.
+	Load() ([]ScheduledMessage, error)
+	Save(message ScheduledMessage) error
+	Delete(id string) error
+}
+
+// WithScheduleStore keeps scheduled messages in store and loads those it
+// holds; messages that came due while the hub was down are delivered as
+// soon as it runs.
+func WithScheduleStore(store ScheduleStore) Option {
+	return func(h *Hub) {
+		h.schedule.store = store
+		messages, err := store.Load()
+		if err != nil {
+			h.log.Error("Failed to load scheduled messages", "err", err)
+			return
+		}
+		for _, message := range messages {
+			h.schedule.messages[message.ID] = message
+		}
+	}
+}
+
+// scheduler holds scheduled messages until they are due.
+type scheduler struct {
+	store ScheduleStore
+
+	mu       sync.Mutex
+	messages map[string]ScheduledMessage
+	// wake tells the running scheduler that the earliest message changed.
+	wake chan struct{}
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{messages: make(map[string]ScheduledMessage), wake: make(chan struct{}, 1)}
+}
+
+// add schedules a message and wakes the scheduler.
+func (s *scheduler) add(message ScheduledMessage) error {
+	if s.store != nil {
+		if err := s.store.Save(message); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.messages[message.ID] = message
+	s.mu.Unlock()
+	s.notify()
+	return nil
+}
+
+// remove unschedules a message and reports whether it was scheduled.
+func (s *scheduler) remove(id string) (bool, error) {
+	s.mu.Lock()
+	_, ok := s.messages[id]
+	delete(s.messages, id)
+	s.mu.Unlock()
+	if !ok || s.store == nil {
+		return ok, nil
+	}
+	return true, s.store.Delete(id)
+}
+
+// purge removes the channels matching match from every scheduled message,
+// unscheduling those left without one, and returns how many messages it
+// changed.
+func (s *scheduler) purge(match func(channel string) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := 0
+	for id, message := range s.messages {
+		channels := slices.DeleteFunc(slices.Clone(message.Channels), match)
+		if len(channels) == len(message.Channels) {
+			continue
+		}
+		changed++
+		if len(channels) == 0 {
+			delete(s.messages, id)
+			if s.store != nil {
+				if err := s.store.Delete(id); err != nil {
+					return changed, err
+				}
+			}
+			continue
+		}
+		message.Channels = channels
+		s.messages[id] = message
+		if s.store != nil {
+			if err := s.store.Save(message); err != nil {
+				return changed, err
+			}
+		}
+	}
+	return changed, nil
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the earliest scheduled message.
+func (s *scheduler) next() (ScheduledMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next ScheduledMessage
+	found := false
+	for _, message := range s.messages {
+		if !found || message.DeliverAt.Before(next.DeliverAt) {
+			next, found = message, true
+		}
+	}
+	return next, found
+}
+
+// list returns the scheduled messages, earliest first.
+func (s *scheduler) list() []ScheduledMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]ScheduledMessage, 0, len(s.messages))
+	for _, message := range s.messages {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].DeliverAt.Before(messages[j].DeliverAt) })
+	return messages
+}
+
+// get returns a scheduled message.
+func (s *scheduler) get(id string) (ScheduledMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message, ok := s.messages[id]
+	return message, ok
+}
+
+// Schedule holds message until at and then publishes it to channels, or to
+// message.Channel if none are given, like Trigger. The message is checked
+// against the channels' settings now, and its envelope ID, returned as
+// ScheduledMessage.ID, is kept for delivery; its timestamp is the delivery
+// time. A time in the past delivers the message at once.
+func (h *Hub) Schedule(message Message, at time.Time, channels ...string) (ScheduledMessage, error) {
+	if message.SocketID != "" {
+		return ScheduledMessage{}, errScheduleChannel
+	}
+	if len(channels) == 0 {
+		channels = []string{message.Channel}
+	}
+	resolved := make([]string, len(channels))
+	for i, channel := range channels {
+		if channel == "" {
+			return ScheduledMessage{}, errScheduleChannel
+		}
+		message.Channel = h.resolveChannel(channel)
+		if !h.channelAllowed(message.Channel) {
+			return ScheduledMessage{}, errUnknownChannel
+		}
+		if !h.payloadFits(message) {
+			return ScheduledMessage{}, errPayloadTooLarge
+		}
+		if err := h.validatePayload(message); err != nil {
+			return ScheduledMessage{}, err
+		}
+		resolved[i] = message.Channel
+	}
+	message.Channel = ""
+	message = stamp(message, Origin{Type: OriginServer})
+	scheduled := ScheduledMessage{ID: message.Envelope.ID, DeliverAt: at, Channels: resolved, Message: message}
+	if err := h.schedule.add(scheduled); err != nil {
+		return ScheduledMessage{}, err
+	}
+	return scheduled, nil
+}
+
+// CancelScheduled unschedules the message with envelope ID id and reports
+// whether it was still scheduled.
+func (h *Hub) CancelScheduled(id string) bool {
+	ok, err := h.schedule.remove(id)
+	if err != nil {
+		h.log.Error("Failed to delete scheduled message", "id", id, "err", err)
+	}
+	return ok
+}
+
+// ScheduledMessages returns the messages waiting for delivery, earliest
+// first.
+func (h *Hub) ScheduledMessages() []ScheduledMessage {
+	return h.schedule.list()
+}
+
+// runSchedule delivers scheduled messages as they come due until ctx is
+// cancelled. Messages not yet delivered stay scheduled for the next run.
+func (h *Hub) runSchedule(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		if next, ok := h.schedule.next(); ok {
+			if wait := time.Until(next.DeliverAt); wait > 0 {
+				timer.Reset(wait)
+			} else if !h.deliverScheduled(ctx, next) {
+				return
+			} else {
+				continue
+			}
+		} else {
+			timer.Stop()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.schedule.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// deliverScheduled publishes a due message to its channels. It reports
+// false if ctx was cancelled first, leaving the message scheduled.
+func (h *Hub) deliverScheduled(ctx context.Context, scheduled ScheduledMessage) bool {
+	if ok, _ := h.schedule.remove(scheduled.ID); !ok {
+		// Cancelled in the meantime.
+		return true
+	}
+	message := scheduled.Message
+	origin := Origin{Type: OriginServer}
+	if message.Envelope != nil {
+		origin = message.Envelope.Origin
+	}
+	message.Envelope = &Envelope{ID: scheduled.ID, Timestamp: time.Now(), Origin: origin}
+	for i, channel := range scheduled.Channels {
+		message.Channel = channel
+		send, err := h.admit(message)
+		if err == errHubStopped {
+			return h.keepScheduled(scheduled, i)
+		}
+		if err != nil {
+			h.log.Warn("Dropped scheduled message", "id", scheduled.ID, "channel", channel, "err", err)
+			continue
+		}
+		if !send {
+			continue
+		}
+		select {
+		case h.broadcast <- message:
+		case <-ctx.Done():
+			return h.keepScheduled(scheduled, i)
+		}
+	}
+	return true
+}
+
+// keepScheduled reschedules the channels of a message from the i-th on,
+// when the hub stops during its delivery, and reports false.
+func (h *Hub) keepScheduled(scheduled ScheduledMessage, i int) bool {
+	scheduled.Channels = scheduled.Channels[i:]
+	if err := h.schedule.add(scheduled); err != nil {
+		h.log.Error("Failed to keep scheduled message", "id", scheduled.ID, "err", err)
+	}
+	return false
+}
+
+// FileScheduleStore is a ScheduleStore that keeps scheduled messages in a
+// JSON file, rewritten atomically on every change. It suits a single node;
+// clusters need a shared store.
+type FileScheduleStore struct {
+	// Keyring, if set, encrypts the file at rest. Files written without
+	// it are still read, and are encrypted on the next change.
+	Keyring *Keyring
+
+	path string
+
+	mu       sync.Mutex
+	messages map[string]ScheduledMessage
+}
+
+// NewFileScheduleStore returns a store backed by the file at path, which is
+// created on the first save.
+func NewFileScheduleStore(path string) *FileScheduleStore {
+	return &FileScheduleStore{path: path}
+}
+
+// Load reads the scheduled messages from the file.
+func (s *FileScheduleStore) Load() ([]ScheduledMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = make(map[string]ScheduledMessage)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err = s.Keyring.Decrypt(data); err != nil {
+		return nil, fmt.Errorf("invalid schedule file: %w", err)
+	}
+	var messages []ScheduledMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("invalid schedule file: %w", err)
+	}
+	for _, message := range messages {
+		s.messages[message.ID] = message
+	}
+	return messages, nil
+}
+
+// Save adds a message to the file.
+func (s *FileScheduleStore) Save(message ScheduledMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.messages == nil {
+		s.messages = make(map[string]ScheduledMessage)
+	}
+	s.messages[message.ID] = message
+	return s.write()
+}
+
+// Delete removes a message from the file.
+func (s *FileScheduleStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.messages[id]; !ok {
+		return nil
+	}
+	delete(s.messages, id)
+	return s.write()
+}
+
+// write replaces the file with the messages. Callers hold mu.
+func (s *FileScheduleStore) write() error {
+	messages := make([]ScheduledMessage, 0, len(s.messages))
+	for _, message := range s.messages {
+		messages = append(messages, message)
+	}
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	if data, err = s.Keyring.Encrypt(data); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// HandleScheduled returns an HTTP handler that reports the scheduled
+// message named by the {id} path value. Mount it on "GET /scheduled/{id}".
+// Once publish API keys exist it requires one, like /trigger.
+func HandleScheduled(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hub.authorizedPublisher(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		scheduled, ok := hub.schedule.get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Unknown Message", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, scheduled)
+	}
+}
+
+// HandleCancelScheduled returns an HTTP handler that cancels the scheduled
+// message named by the {id} path value. Mount it on
+// "DELETE /scheduled/{id}". It is authorized like HandleScheduled.
+func HandleCancelScheduled(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hub.authorizedPublisher(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !hub.CancelScheduled(r.PathValue("id")) {
+			http.Error(w, "Unknown Message", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,139 @@
+package pushpop
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultSecretInterval is how often WatchSecret polls unless another
+// interval is given.
+const defaultSecretInterval = 10 * time.Second
+
+// SecretProvider looks up secrets by name. It is the extension point for
+// external secret stores such as Vault or a cloud secret manager.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// FileSecrets is a SecretProvider that reads each secret from a file, named
+// by its path or by a path relative to Dir, e.g. a Kubernetes secret volume
+// or Docker secrets in /run/secrets. Trailing newlines are trimmed.
+type FileSecrets struct {
+	Dir string
+}
+
+// Secret reads the named file.
+func (f FileSecrets) Secret(_ context.Context, name string) (string, error) {
+	if f.Dir != "" {
+		name = filepath.Join(f.Dir, name)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Secret is a secret value that may be replaced at runtime, so rotated
+// credentials apply without a restart. It is safe for concurrent use, and
+// a nil Secret is empty.
+type Secret struct {
+	value atomic.Pointer[string]
+}
+
+// NewSecret returns a Secret holding value.
+func NewSecret(value string) *Secret {
+	s := &Secret{}
+	s.Set(value)
+	return s
+}
+
+// Get returns the current value.
+func (s *Secret) Get() string {
+	if s == nil {
+		return ""
+	}
+	if value := s.value.Load(); value != nil {
+		return *value
+	}
+	return ""
+}
+
+// Set replaces the value.
+func (s *Secret) Set(value string) {
+	s.value.Store(&value)
+}
+
+// WatchSecret loads a secret from provider and polls it for changes every
+// interval, 10s if it is zero, until ctx is cancelled. Polling rather than
+// file notifications also catches the symlink swaps Kubernetes uses to
+// update mounted secrets. A failed refresh keeps the last value.
+func WatchSecret(ctx context.Context, provider SecretProvider, name string, interval time.Duration) (*Secret, error) {
+	value, err := provider.Secret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultSecretInterval
+	}
+	secret := NewSecret(value)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if value, err := provider.Secret(ctx, name); err == nil {
+					secret.Set(value)
+				}
+			}
+		}
+	}()
+	return secret, nil
+}
+
+// WithAdminSecret is WithAdminToken with a token that may change, e.g. one
+// returned by WatchSecret.
+func WithAdminSecret(secret *Secret) Option {
+	return func(h *Hub) {
+		h.adminToken = secret
+	}
+}
+
+// SecretVerifier builds a webhook verifier from the current value of
+// secret for every request, so rotated webhook secrets apply without a
+// restart. Requests are rejected while the secret is empty:
+//
+//	pushpop.SecretVerifier(secret, func(s string) pushpop.WebhookVerifier {
+//		return pushpop.GitHubVerifier(s)
+//	})
+func SecretVerifier(secret *Secret, build func(secret string) WebhookVerifier) WebhookVerifier {
+	return &secretVerifier{secret: secret, build: build}
+}
+
+type secretVerifier struct {
+	secret *Secret
+	build  func(string) WebhookVerifier
+}
+
+func (v *secretVerifier) Verify(r *http.Request, body []byte) error {
+	secret := v.secret.Get()
+	if secret == "" {
+		return errNoWebhookSecret
+	}
+	return v.build(secret).Verify(r, body)
+}
+
+func (v *secretVerifier) EventName(r *http.Request, payload interface{}) string {
+	if namer, ok := v.build(v.secret.Get()).(eventNamer); ok {
+		return namer.EventName(r, payload)
+	}
+	return ""
+}
@@ -0,0 +1,42 @@
+package pushpop
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSecretVerifier(t *testing.T) {
+	const body = `{"ok": true}`
+	secret := NewSecret("first")
+	var built []string
+	verifier := SecretVerifier(secret, func(s string) WebhookVerifier {
+		built = append(built, s)
+		return HMACVerifier("X-Signature", s)
+	})
+
+	tests := []struct {
+		name   string
+		secret string
+		signed string
+		err    error
+	}{
+		{"current secret", "first", "first", nil},
+		{"rotated secret", "second", "second", nil},
+		{"previous secret after rotation", "second", "first", errInvalidSignature},
+		{"empty secret", "", "", errNoWebhookSecret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret.Set(tt.secret)
+			r := webhook(body, http.Header{"X-Signature": {sign(tt.signed, body)}})
+			if err := verifier.Verify(r, []byte(body)); err != tt.err {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+	for _, s := range built {
+		if s == "" {
+			t.Error("verifier built with an empty secret")
+		}
+	}
+}
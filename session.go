@@ -0,0 +1,148 @@
+package pushpop
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Session describes a client connection as it was established. It is
+// captured from the HTTP upgrade request so hooks can make authorization
+// and logging decisions after the request itself is gone.
+type Session struct {
+	// ID is the connection's socket ID.
+	ID string
+	// RemoteIP is the IP address of the peer that opened the connection.
+	RemoteIP string
+	// UserAgent is the User-Agent of the upgrade request.
+	UserAgent string
+	// Header holds the headers of the upgrade request.
+	Header http.Header
+	// Query holds the query parameters of the upgrade request.
+	Query url.Values
+	// TLS is the TLS state of the upgrade request, or nil for plaintext.
+	TLS *tls.ConnectionState
+	// ConnectedAt is when the connection was established.
+	ConnectedAt time.Time
+
+	// UserID identifies the authenticated user, if any. Hooks set it in
+	// OnConnect.
+	UserID string
+	// UserInfo is application data describing the user, such as a display
+	// name and avatar. It is shared with other members of presence
+	// channels. Hooks set it in OnConnect or OnSubscribe; presence channels
+	// joined afterwards see the change.
+	UserInfo interface{}
+	// Tenant identifies the tenant or app the connection belongs to, for
+	// per-tenant limits. Hooks set it in OnConnect.
+	Tenant string
+
+	// host and uri are the Host and request URI of the upgrade request,
+	// for forward auth.
+	host string
+	uri  string
+
+	mu           sync.RWMutex
+	values       map[string]interface{}
+	tags         map[string]string
+	shadowBanned bool
+}
+
+// newSession captures the connection metadata of an upgrade request.
+func newSession(r *http.Request) *Session {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+	return &Session{
+		ID:          newToken(),
+		RemoteIP:    ip,
+		UserAgent:   r.UserAgent(),
+		Header:      r.Header.Clone(),
+		Query:       r.URL.Query(),
+		TLS:         r.TLS,
+		ConnectedAt: time.Now(),
+		host:        r.Host,
+		uri:         uri,
+	}
+}
+
+// Set stores an application value on the session, e.g. decoded token
+// claims.
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]interface{})
+	}
+	s.values[key] = value
+}
+
+// Get returns an application value stored with Set.
+func (s *Session) Get(key string) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// Session returns the connection metadata of the client.
+func (c *Client) Session() *Session {
+	return c.session
+}
+
+// authorizeSubscribe checks the blocklist, runs the OnSubscribe hook, and
+// checks user channel ownership and the policy once the hook had its
+// chance to set the user ID.
+func (h *Hub) authorizeSubscribe(session *Session, channel string) error {
+	if h.blocklist.blocked(session) {
+		return errBlocked
+	}
+	if h.hooks.OnSubscribe != nil {
+		if err := h.hooks.OnSubscribe(session, channel); err != nil {
+			return err
+		}
+	}
+	if err := authorizeUserChannel(session, channel); err != nil {
+		return err
+	}
+	return h.authorize(session, ActionSubscribe, channel)
+}
+
+// connect checks the blocklist, validates the OIDC token, and runs the
+// OnConnect hook for a new session. The blocklist is checked again
+// afterwards, since the token and the hook set the user ID.
+func (h *Hub) connect(session *Session) error {
+	if h.blocklist.blocked(session) {
+		return errBlocked
+	}
+	if h.forwardAuth != nil {
+		if err := h.forwardAuth.authenticate(session); err != nil {
+			return err
+		}
+	}
+	if h.oidc != nil {
+		if err := h.oidc.authenticate(session); err != nil {
+			return err
+		}
+	}
+	if h.hooks.OnConnect != nil {
+		if err := h.hooks.OnConnect(session); err != nil {
+			return err
+		}
+	}
+	if h.blocklist.blocked(session) {
+		return errBlocked
+	}
+	if !h.tenants.admit(session.Tenant) {
+		return errTenantQuota
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package pushpop
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+var (
+	// errPublishNotAllowed is returned for client publishes to channels
+	// that disallow them.
+	errPublishNotAllowed = errors.New("clients may not publish to this channel")
+	// errInvalidPayload wraps schema validation failures.
+	errInvalidPayload = errors.New("invalid payload")
+)
+
+// ChannelSettings configures a channel. A channel's effective settings are
+// resolved from the defaults of every matching prefix, shortest first, and
+// then the settings configured for it by name; each set field overrides
+// the ones before it. Unset fields keep the hub's defaults.
+//
+// Every per-channel behavior, from presence and history to rate and
+// connection limits, is decided from the resolved settings.
+type ChannelSettings struct {
+	// HistorySize is how many recent messages the channel keeps.
+	HistorySize int `json:"history_size,omitempty"`
+	// CatchUp is how many of the latest messages every new subscriber
+	// receives right after subscribing, marked as replayed. History is kept
+	// for at least that many messages.
+	CatchUp int `json:"catch_up,omitempty"`
+	// HistoryTTL evicts history messages older than the TTL.
+	HistoryTTL time.Duration `json:"history_ttl,omitempty"`
+	// HistoryMaxBytes evicts the oldest history messages once their
+	// encoded payloads exceed this many bytes.
+	HistoryMaxBytes int `json:"history_max_bytes,omitempty"`
+	// Presence turns presence tracking on or off, overriding the
+	// "presence-" prefix.
+	Presence *bool `json:"presence,omitempty"`
+	// ClientPublish allows clients to publish to the channel over their
+	// connection. Defaults to true.
+	ClientPublish *bool `json:"client_publish,omitempty"`
+	// RateLimit limits how fast messages may be published.
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	// Limits raises the connection limits of subscribers.
+	Limits *ChannelLimits `json:"limits,omitempty"`
+	// Schema is a JSON Schema that every payload published to the channel
+	// must satisfy.
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Compression turns compression of the channel's messages off, e.g.
+	// for channels carrying already-compressed data, or back on. It has no
+	// effect unless the hub compresses messages; see WithCompression.
+	Compression *bool `json:"compression,omitempty"`
+	// CompressionThreshold overrides the hub's minimum encoded message size
+	// for compression.
+	CompressionThreshold int `json:"compression_threshold,omitempty"`
+	// Receipts collects acks of the channel's messages from subscribers.
+	Receipts *Receipts `json:"receipts,omitempty"`
+	// Transform is a Go template that reshapes every payload on the
+	// channel before fan-out, e.g. to project a large internal event into
+	// a slim public shape; see TransformInput.
+	Transform string `json:"transform,omitempty"`
+	// Transformer reshapes payloads in Go, e.g. with a CEL program, after
+	// Transform. It is not part of the JSON settings.
+	Transformer Transformer `json:"-"`
+	// Lifetime makes the channel temporary, e.g. for a match lobby: once
+	// it elapses, subscribers receive EventChannelExpired and are
+	// unsubscribed, and the channel's history and settings are deleted.
+	// It counts from ConfigureChannel, which sets ExpiresAt, and only
+	// applies to settings configured by name.
+	Lifetime time.Duration `json:"lifetime,omitempty"`
+	// ExpiresAt is when a temporary channel expires. Set it instead of
+	// Lifetime for a fixed time.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Webhook also POSTs every message on the channel to an HTTP endpoint;
+	// see EgressWebhook.
+	Webhook *EgressWebhook `json:"webhook,omitempty"`
+
+	schema    *jsonschema.Schema
+	transform *template.Template
+}
+
+// MarshalJSON writes HistoryTTL and Lifetime as duration strings like
+// "30s".
+func (s ChannelSettings) MarshalJSON() ([]byte, error) {
+	type plain ChannelSettings
+	return json.Marshal(struct {
+		plain
+		HistoryTTL jsonDuration `json:"history_ttl,omitempty"`
+		Lifetime   jsonDuration `json:"lifetime,omitempty"`
+	}{plain(s), jsonDuration(s.HistoryTTL), jsonDuration(s.Lifetime)})
+}
+
+// UnmarshalJSON reads HistoryTTL and Lifetime as duration strings, or as
+// nanoseconds as written before.
+func (s *ChannelSettings) UnmarshalJSON(data []byte) error {
+	type plain ChannelSettings
+	v := struct {
+		*plain
+		HistoryTTL jsonDuration `json:"history_ttl,omitempty"`
+		Lifetime   jsonDuration `json:"lifetime,omitempty"`
+	}{(*plain)(s), jsonDuration(s.HistoryTTL), jsonDuration(s.Lifetime)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.HistoryTTL, s.Lifetime = time.Duration(v.HistoryTTL), time.Duration(v.Lifetime)
+	return nil
+}
+
+// jsonDuration is a time.Duration written in JSON as a string like "30s",
+// as the admin API's query parameters are. Numbers are read as
+// nanoseconds.
+type jsonDuration time.Duration
+
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*d = jsonDuration(parsed)
+		return nil
+	}
+	var nanoseconds int64
+	if err := json.Unmarshal(data, &nanoseconds); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	*d = jsonDuration(nanoseconds)
+	return nil
+}
+
+// compile prepares the settings for use.
+func (s *ChannelSettings) compile(channel string) error {
+	if err := s.compileSchema(channel); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	if err := s.compileTransform(channel); err != nil {
+		return fmt.Errorf("invalid transform: %w", err)
+	}
+	if s.RateLimit != nil {
+		if err := s.RateLimit.validate(); err != nil {
+			return fmt.Errorf("invalid rate limit: %w", err)
+		}
+	}
+	return nil
+}
+
+// compileSchema compiles the settings' JSON Schema.
+func (s *ChannelSettings) compileSchema(channel string) error {
+	if len(s.Schema) == 0 {
+		s.schema = nil
+		return nil
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(s.Schema))
+	if err != nil {
+		return err
+	}
+	compiler := jsonschema.NewCompiler()
+	url := "pushpop:///channels/" + channel + ".json"
+	if err := compiler.AddResource(url, doc); err != nil {
+		return err
+	}
+	s.schema, err = compiler.Compile(url)
+	return err
+}
+
+// merge returns s with every field set in over replacing its own.
+func (s ChannelSettings) merge(over ChannelSettings) ChannelSettings {
+	if over.HistorySize > 0 {
+		s.HistorySize = over.HistorySize
+	}
+	if over.CatchUp > 0 {
+		s.CatchUp = over.CatchUp
+	}
+	if over.HistoryTTL > 0 {
+		s.HistoryTTL = over.HistoryTTL
+	}
+	if over.HistoryMaxBytes > 0 {
+		s.HistoryMaxBytes = over.HistoryMaxBytes
+	}
+	if over.Presence != nil {
+		s.Presence = over.Presence
+	}
+	if over.ClientPublish != nil {
+		s.ClientPublish = over.ClientPublish
+	}
+	if over.RateLimit != nil {
+		s.RateLimit = over.RateLimit
+	}
+	if over.Limits != nil {
+		s.Limits = over.Limits
+	}
+	if len(over.Schema) > 0 {
+		s.Schema, s.schema = over.Schema, over.schema
+	}
+	if over.Compression != nil {
+		s.Compression = over.Compression
+	}
+	if over.CompressionThreshold > 0 {
+		s.CompressionThreshold = over.CompressionThreshold
+	}
+	if over.Receipts != nil {
+		s.Receipts = over.Receipts
+	}
+	if over.Transform != "" {
+		s.Transform, s.transform = over.Transform, over.transform
+	}
+	if over.Transformer != nil {
+		s.Transformer = over.Transformer
+	}
+	if over.Lifetime > 0 {
+		s.Lifetime = over.Lifetime
+	}
+	if over.ExpiresAt != nil {
+		s.ExpiresAt = over.ExpiresAt
+	}
+	if over.Webhook != nil {
+		s.Webhook = over.Webhook
+	}
+	return s
+}
+
+// WithChannelDefaults applies settings to every channel starting with
+// prefix, e.g. a history size for all "chat-" channels. Settings configured
+// by name with ConfigureChannel take precedence. An invalid schema or
+// transform is logged and ignored.
+func WithChannelDefaults(prefix string, settings ChannelSettings) Option {
+	return func(h *Hub) {
+		if err := settings.compileSchema(prefix); err != nil {
+			h.log.Error("Invalid channel defaults schema", "prefix", prefix, "err", err)
+			settings.Schema = nil
+		}
+		if err := settings.compileTransform(prefix); err != nil {
+			h.log.Error("Invalid channel defaults transform", "prefix", prefix, "err", err)
+			settings.Transform = ""
+		}
+		if settings.RateLimit != nil {
+			if err := settings.RateLimit.validate(); err != nil {
+				h.log.Error("Invalid channel defaults rate limit", "prefix", prefix, "err", err)
+				settings.RateLimit = nil
+			}
+		}
+		settings.Lifetime, settings.ExpiresAt = 0, nil
+		h.registry.defaults = append(h.registry.defaults, channelDefaults{prefix: prefix, settings: settings})
+		sort.SliceStable(h.registry.defaults, func(i, j int) bool {
+			return len(h.registry.defaults[i].prefix) < len(h.registry.defaults[j].prefix)
+		})
+	}
+}
+
+// settingsFor resolves the effective settings of channel.
+func (h *Hub) settingsFor(channel string) ChannelSettings {
+	h.registry.mu.RLock()
+	defer h.registry.mu.RUnlock()
+	var resolved ChannelSettings
+	for _, defaults := range h.registry.defaults {
+		if strings.HasPrefix(channel, defaults.prefix) {
+			resolved = resolved.merge(defaults.settings)
+		}
+	}
+	if settings, ok := h.registry.settings[channel]; ok {
+		resolved = resolved.merge(settings)
+	}
+	return resolved
+}
+
+// ConfigureChannel stores the settings of a channel and declares it. The
+// settings take effect immediately.
+func (h *Hub) ConfigureChannel(name string, settings ChannelSettings) error {
+	if err := settings.compile(name); err != nil {
+		return err
+	}
+	settings.expiresAt(time.Now())
+	h.registry.mu.Lock()
+	if h.registry.settings == nil {
+		h.registry.settings = make(map[string]ChannelSettings)
+	}
+	h.registry.settings[name] = settings
+	if h.registry.declared == nil {
+		h.registry.declared = make(map[string]bool)
+	}
+	h.registry.declared[name] = true
+	h.registry.mu.Unlock()
+
+	h.resetLimiter(name)
+	return nil
+}
+
+// ChannelSettings returns the settings configured for a channel by name,
+// without prefix defaults.
+func (h *Hub) ChannelSettings(name string) (ChannelSettings, bool) {
+	h.registry.mu.RLock()
+	defer h.registry.mu.RUnlock()
+	settings, ok := h.registry.settings[name]
+	return settings, ok
+}
+
+// presenceEnabled reports whether channel tracks presence.
+func (h *Hub) presenceEnabled(channel string) bool {
+	if presence := h.settingsFor(channel).Presence; presence != nil {
+		return *presence
+	}
+	return IsPresenceChannel(channel)
+}
+
+// clientPublishAllowed reports whether clients may publish to channel.
+func (h *Hub) clientPublishAllowed(channel string) bool {
+	allowed := h.settingsFor(channel).ClientPublish
+	return allowed == nil || *allowed
+}
+
+// validatePayload checks message against its channel's schema, and that
+// edit events name a message.
+func (h *Hub) validatePayload(message Message) error {
+	payload := message.Payload
+	if isEdit(message) {
+		// Edits carry the replacement payload, and deletes none.
+		edit, ok := decodeEdit(payload)
+		if !ok {
+			return fmt.Errorf("%w: edit events need the id of a message", errInvalidPayload)
+		}
+		if message.Event == EventMessageDeleted {
+			return nil
+		}
+		payload = edit.Payload
+	}
+	settings := h.settingsFor(message.Channel)
+	if settings.schema == nil {
+		return nil
+	}
+	// Round-trip through JSON so typed payloads validate like decoded ones.
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidPayload, err)
+	}
+	value, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidPayload, err)
+	}
+	if err := settings.schema.Validate(value); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidPayload, err)
+	}
+	return nil
+}
+
+// handleAdminConfigure declares a channel and stores the settings in the
+// optional body.
+func (h *Hub) handleAdminConfigure(w http.ResponseWriter, r *http.Request) {
+	var settings ChannelSettings
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid Request Body", http.StatusBadRequest)
+			return
+		}
+	}
+	name := r.PathValue("name")
+	if err := h.ConfigureChannel(name, settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, settings.redacted())
+}
@@ -0,0 +1,111 @@
+package pushpop
+
+import (
+	"net/http"
+	"sync"
+)
+
+// shadowBans holds the shadow-banned user IDs.
+type shadowBans struct {
+	mu    sync.RWMutex
+	users map[string]bool
+}
+
+// SetShadowBanned marks the connection as shadow-banned, see ShadowBanUser.
+func (s *Session) SetShadowBanned(banned bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shadowBanned = banned
+}
+
+// ShadowBanUser shadow-bans a user: their published messages are accepted
+// and echoed back to them, but nobody else receives them.
+func (h *Hub) ShadowBanUser(userID string) {
+	h.shadowBans.mu.Lock()
+	defer h.shadowBans.mu.Unlock()
+	if h.shadowBans.users == nil {
+		h.shadowBans.users = make(map[string]bool)
+	}
+	h.shadowBans.users[userID] = true
+}
+
+// LiftShadowBanUser lifts a user's shadow ban.
+func (h *Hub) LiftShadowBanUser(userID string) {
+	h.shadowBans.mu.Lock()
+	defer h.shadowBans.mu.Unlock()
+	delete(h.shadowBans.users, userID)
+}
+
+// shadowBanned reports whether the session or its user is shadow-banned.
+func (h *Hub) shadowBanned(session *Session) bool {
+	session.mu.RLock()
+	banned := session.shadowBanned
+	session.mu.RUnlock()
+	if banned || session.UserID == "" {
+		return banned
+	}
+	h.shadowBans.mu.RLock()
+	defer h.shadowBans.mu.RUnlock()
+	return h.shadowBans.users[session.UserID]
+}
+
+// publish broadcasts a message published by a client. Messages from a
+// shadow-banned client are only echoed back to it, and only if it is
+// subscribed to the channel, just as it would see a real broadcast.
+func (h *Hub) publish(client *Client, message Message) error {
+	if !h.clientPublishAllowed(message.Channel) {
+		return errPublishNotAllowed
+	}
+	if err := h.authorize(client.session, ActionPublish, message.Channel); err != nil {
+		return err
+	}
+	message, err := h.moderate(client, message)
+	if err != nil {
+		return err
+	}
+	message = stamp(message, Origin{Type: OriginClient, ID: client.id, User: client.session.UserID})
+	if h.shadowBanned(client.session) {
+		h.triggerTargeted(targetedMessage{
+			match: func(c *Client) bool {
+				if c != client {
+					return false
+				}
+				_, subscribed := c.channels.Load(message.Channel)
+				return subscribed
+			},
+			message: message,
+		})
+		return nil
+	}
+	return h.accept(message)
+}
+
+// handleAdminShadowBanUser shadow-bans a user, or lifts the ban for DELETE.
+func (h *Hub) handleAdminShadowBanUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		h.LiftShadowBanUser(r.PathValue("id"))
+	} else {
+		h.ShadowBanUser(r.PathValue("id"))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminShadowBanConnection shadow-bans a single connection, or lifts
+// the ban for DELETE.
+func (h *Hub) handleAdminShadowBanConnection(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	found := false
+	h.clients.Range(func(key, _ interface{}) bool {
+		if client := key.(*Client); client.id == id {
+			client.session.SetShadowBanned(r.Method != http.MethodDelete)
+			found = true
+			return false
+		}
+		return true
+	})
+	if !found {
+		http.Error(w, "Unknown Connection", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,170 @@
+package pushpop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotVersion is the format version written to snapshots.
+const snapshotVersion = 1
+
+// defaultPresenceGrace is how long restored presence members are kept
+// waiting for their clients when no recovery window is configured.
+const defaultPresenceGrace = 30 * time.Second
+
+var errHubRunning = errors.New("snapshot must be restored before Run")
+
+// Snapshot is the hub state that survives a planned restart: the channel
+// registry and aliases, presence members, history message IDs and read
+// positions, API keys, and recurring publishes.
+// Connections and subscriptions are not included; clients reconnect and
+// resubscribe.
+type Snapshot struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	// Declared lists the declared channels and prefixes.
+	Declared []string `json:"declared,omitempty"`
+	// Settings are the channel settings configured by name.
+	Settings map[string]ChannelSettings `json:"settings,omitempty"`
+	// Aliases maps channel aliases to their targets.
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// Presence lists the members of every presence channel.
+	Presence map[string][]Member `json:"presence,omitempty"`
+	// Sequences are the last history message ID of every channel, so IDs
+	// keep increasing across the restart.
+	Sequences map[string]uint64 `json:"sequences,omitempty"`
+	// APIKeys are the API keys, with hashed secrets.
+	APIKeys []StoredAPIKey `json:"api_keys,omitempty"`
+	// KeyScopes are the scopes that require a key, even once their last
+	// key was revoked.
+	KeyScopes []KeyScope `json:"key_scopes,omitempty"`
+	// Reads are the read positions of every channel.
+	Reads map[string][]ReadPosition `json:"reads,omitempty"`
+	// Recurring are the recurring publishes.
+	Recurring []RecurringPublish `json:"recurring,omitempty"`
+}
+
+// Snapshot exports the hub state.
+func (h *Hub) Snapshot() Snapshot {
+	h.registry.mu.RLock()
+	settings := make(map[string]ChannelSettings, len(h.registry.settings))
+	for name, s := range h.registry.settings {
+		settings[name] = s
+	}
+	h.registry.mu.RUnlock()
+
+	return Snapshot{
+		Version:   snapshotVersion,
+		Time:      time.Now(),
+		Declared:  h.DeclaredChannels(),
+		Settings:  settings,
+		Aliases:   h.ChannelAliases(),
+		Presence:  h.presence.snapshot(),
+		Sequences: h.history.sequences(),
+		APIKeys:   h.apiKeys.snapshot(),
+		KeyScopes: h.apiKeys.scopes(),
+		Reads:     h.history.allReads(),
+		Recurring: h.RecurringPublishes(),
+	}
+}
+
+// Restore loads a snapshot into the hub. It must be called before Run, or
+// between runs of a restarted hub. Restored presence members are listed
+// until they reconnect, or until the recovery window (30s by default)
+// passes and their departure is announced, so a restart does not look like
+// everyone leaving.
+func (h *Hub) Restore(snapshot Snapshot) error {
+	h.lifecycleMu.Lock()
+	running := h.cancelRun != nil
+	h.lifecycleMu.Unlock()
+	if running {
+		return errHubRunning
+	}
+	if snapshot.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	for _, name := range snapshot.Declared {
+		h.DeclareChannel(name)
+	}
+	for name, settings := range snapshot.Settings {
+		if err := h.ConfigureChannel(name, settings); err != nil {
+			return fmt.Errorf("channel %s: %w", name, err)
+		}
+	}
+	for alias, target := range snapshot.Aliases {
+		if err := h.AliasChannel(alias, target); err != nil {
+			return fmt.Errorf("alias %s: %w", alias, err)
+		}
+	}
+	for _, publish := range snapshot.Recurring {
+		if err := h.AddRecurringPublish(publish); err != nil {
+			return fmt.Errorf("recurring publish %s: %w", publish.Name, err)
+		}
+	}
+
+	grace := h.recoveryWindow
+	if grace <= 0 {
+		grace = defaultPresenceGrace
+	}
+	if len(snapshot.Presence) > 0 {
+		h.presence.restore(snapshot.Presence, time.Now().Add(grace))
+	}
+	h.history.restore(snapshot.Sequences)
+	h.history.restoreReads(snapshot.Reads)
+	if len(snapshot.APIKeys) > 0 || len(snapshot.KeyScopes) > 0 {
+		h.apiKeys.restore(snapshot.APIKeys, snapshot.KeyScopes)
+	}
+	return nil
+}
+
+// SaveSnapshot writes a snapshot of the hub to path. The file is replaced
+// atomically, so a crash never leaves a partial snapshot.
+func (h *Hub) SaveSnapshot(path string) error {
+	data, err := json.Marshal(h.Snapshot())
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file in the same directory.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot restores the snapshot at path. It must be called before Run.
+func (h *Hub) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+	return h.Restore(snapshot)
+}
+
+// handleAdminSnapshot exports the hub state.
+func (h *Hub) handleAdminSnapshot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.Snapshot())
+}
@@ -0,0 +1,38 @@
+package pushpop
+
+// TriggerSocket delivers message to the connection with the given socket
+// ID, such as the browser tab that started an async job, whether or not it
+// is subscribed to the message's channel. The channel may be empty. With a
+// broker the message is relayed to every node and delivered by the one
+// holding the connection; it is dropped if no node does.
+func (h *Hub) TriggerSocket(socketID string, message Message) {
+	message.SocketID = socketID
+	select {
+	case h.broadcast <- message:
+	case <-h.stopped():
+	}
+}
+
+// deliverSocket queues a message addressed to a socket ID for that
+// connection, if it is on this node. It runs on the Run goroutine.
+func (h *Hub) deliverSocket(message Message, report *deliveryReport) {
+	socketID := message.SocketID
+	message.SocketID = ""
+	h.clients.Range(func(key, _ interface{}) bool {
+		client := key.(*Client)
+		if client.id != socketID {
+			return true
+		}
+		if reason := h.deliver(client, message); reason == "" {
+			report.enqueued++
+		} else {
+			report.failures = append(report.failures, DeliveryFailure{
+				Channel:  message.Channel,
+				SocketID: client.id,
+				UserID:   client.session.UserID,
+				Reason:   reason,
+			})
+		}
+		return false
+	})
+}
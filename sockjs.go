@@ -0,0 +1,486 @@
+package pushpop
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Constants for the SockJS fallback transports.
+const (
+	sockjsHeartbeatDelay   = 25 * time.Second
+	sockjsDisconnectDelay  = 5 * time.Second
+	sockjsStreamingLimit   = 128 * 1024
+	sockjsStreamingPrelude = 2048
+)
+
+var errSockJSClosed = &websocket.CloseError{Code: websocket.CloseGoingAway, Text: "sockjs session closed"}
+
+// HandleSockJS returns an HTTP handler serving a SockJS compatible endpoint
+// tree under prefix, so clients that cannot open a raw WebSocket can reach
+// the hub through the websocket, xhr-streaming, or xhr-polling transports.
+// The handler should be mounted on prefix + "/".
+func HandleSockJS(hub *Hub, prefix string) http.Handler {
+	return &sockjsServer{
+		hub:    hub,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}
+}
+
+type sockjsServer struct {
+	hub      *Hub
+	prefix   string
+	sessions sync.Map
+}
+
+func (s *sockjsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.hub.closing.Load() {
+		http.Error(w, "Server Shutting Down", http.StatusServiceUnavailable)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, s.prefix), "/")
+	switch path {
+	case "":
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		_, _ = w.Write([]byte("Welcome to SockJS!\n"))
+		return
+	case "info":
+		s.serveInfo(w, r)
+		return
+	}
+
+	// {server}/{session}/{transport}
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || strings.Contains(parts[1], ".") {
+		http.NotFound(w, r)
+		return
+	}
+	sessionID, kind := parts[1], parts[2]
+
+	if r.Method == http.MethodOptions {
+		setSockJSCORS(w, r)
+		w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, POST")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch kind {
+	case "websocket":
+		s.serveWebsocket(w, r)
+	case "xhr":
+		s.serveXHR(w, r, sessionID, false)
+	case "xhr_streaming":
+		s.serveXHR(w, r, sessionID, true)
+	case "xhr_send":
+		s.serveXHRSend(w, r, sessionID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *sockjsServer) serveInfo(w http.ResponseWriter, r *http.Request) {
+	setSockJSCORS(w, r)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"websocket":     true,
+		"origins":       []string{"*:*"},
+		"cookie_needed": false,
+		"entropy":       rand.Uint32(),
+	})
+}
+
+// serveWebsocket upgrades the request and speaks SockJS framing over the
+// WebSocket.
+func (s *sockjsServer) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	s.hub.upgrades.add()
+	defer s.hub.upgrades.done()
+	if !s.hub.accepting() {
+		http.Error(w, "Server Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	session := newSession(r)
+	if err := s.hub.connect(session); err != nil {
+		s.hub.log.Warn("Connection rejected", "ip", session.RemoteIP, "err", err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	conn, err := s.hub.upgrade(w, r)
+	if err != nil {
+		s.hub.log.Error("Failed to upgrade connection", "err", err)
+		return
+	}
+	conn.SetReadLimit(maxMessageSize)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("o")); err != nil {
+		s.hub.log.Error("Error opening sockjs session", "err", err)
+		conn.Close()
+		return
+	}
+	s.hub.serveClient(&sockjsWebsocket{Conn: conn}, session)
+}
+
+// serveXHR serves the receiving side of the xhr-polling and xhr-streaming
+// transports, creating the session on first contact.
+func (s *sockjsServer) serveXHR(w http.ResponseWriter, r *http.Request, id string, streaming bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid Request Method", http.StatusMethodNotAllowed)
+		return
+	}
+	setSockJSCORS(w, r)
+	w.Header().Set("Content-Type", "application/javascript; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if streaming {
+		_, _ = w.Write([]byte(strings.Repeat("h", sockjsStreamingPrelude) + "\n"))
+		flush()
+	}
+
+	var session *sockjsSession
+	val, ok := s.sessions.Load(id)
+	if ok {
+		session = val.(*sockjsSession)
+	} else {
+		var refusal string
+		if session, ok, refusal = s.open(r, id); session == nil {
+			_, _ = w.Write([]byte(refusal + "\n"))
+			return
+		}
+	}
+	if !ok {
+		_, _ = w.Write([]byte("o\n"))
+		flush()
+		if !streaming {
+			session.detach()
+			return
+		}
+	}
+
+	if !session.attach() {
+		_, _ = w.Write([]byte(`c[2010,"Another connection still open"]` + "\n"))
+		return
+	}
+	defer session.detach()
+
+	written := 0
+	heartbeat := time.NewTimer(sockjsHeartbeatDelay)
+	defer heartbeat.Stop()
+	for {
+		if frame := session.drain(); frame != "" {
+			n, err := w.Write([]byte(frame + "\n"))
+			if err != nil {
+				return
+			}
+			flush()
+			written += n
+			if !streaming || written >= sockjsStreamingLimit {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-session.notify:
+		case <-session.closed:
+			_, _ = w.Write([]byte(`c[3000,"Go away!"]` + "\n"))
+			return
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte("h\n")); err != nil || !streaming {
+				return
+			}
+			flush()
+			heartbeat.Reset(sockjsHeartbeatDelay)
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// open creates the session named id and admits it to the hub, like an
+// upgrade. It returns the session and whether another request created it
+// first, or nil and the close frame refusing it. The session is stored
+// before it is admitted, so only the request that created it runs the
+// hub's admission; a refused session is closed, which ends any request
+// that found it in the meantime.
+func (s *sockjsServer) open(r *http.Request, id string) (*sockjsSession, bool, string) {
+	s.hub.upgrades.add()
+	defer s.hub.upgrades.done()
+	if !s.hub.accepting() {
+		return nil, false, `c[3000,"Go away!"]`
+	}
+	session := newSockJSSession(id, r.RemoteAddr)
+	session.onClose = func() { s.sessions.CompareAndDelete(id, session) }
+	if val, loaded := s.sessions.LoadOrStore(id, session); loaded {
+		return val.(*sockjsSession), true, ""
+	}
+	meta := newSession(r)
+	if err := s.hub.connect(meta); err != nil {
+		s.hub.log.Warn("Connection rejected", "ip", meta.RemoteIP, "err", err)
+		_ = session.Close()
+		return nil, false, `c[2000,"Forbidden"]`
+	}
+	s.hub.serveClient(session, meta)
+	return session, false, ""
+}
+
+// serveXHRSend accepts a batch of client frames for an existing session.
+func (s *sockjsServer) serveXHRSend(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid Request Method", http.StatusMethodNotAllowed)
+		return
+	}
+	setSockJSCORS(w, r)
+
+	val, ok := s.sessions.Load(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	session := val.(*sockjsSession)
+
+	var frames []string
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize*16)).Decode(&frames); err != nil {
+		http.Error(w, "Broken JSON encoding.", http.StatusInternalServerError)
+		return
+	}
+	for _, frame := range frames {
+		if !session.receive([]byte(frame)) {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setSockJSCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+}
+
+// sockjsFrame encodes messages as a SockJS array frame.
+func sockjsFrame(messages []string) string {
+	b, _ := json.Marshal(messages)
+	return "a" + string(b)
+}
+
+// sockjsWebsocket adapts a WebSocket to SockJS framing.
+type sockjsWebsocket struct {
+	*websocket.Conn
+	pending []string
+}
+
+func (c *sockjsWebsocket) ReadMessage() (int, []byte, error) {
+	for len(c.pending) == 0 {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		// Clients send either a single string or an array of strings.
+		if err := json.Unmarshal(data, &c.pending); err != nil {
+			var frame string
+			if err := json.Unmarshal(data, &frame); err != nil {
+				return 0, nil, err
+			}
+			c.pending = []string{frame}
+		}
+	}
+	frame := c.pending[0]
+	c.pending = c.pending[1:]
+	return websocket.TextMessage, []byte(frame), nil
+}
+
+func (c *sockjsWebsocket) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case websocket.PingMessage:
+		return c.Conn.WriteMessage(websocket.TextMessage, []byte("h"))
+	case websocket.CloseMessage:
+		_ = c.Conn.WriteMessage(websocket.TextMessage, []byte(`c[3000,"Go away!"]`))
+		return c.Conn.WriteMessage(websocket.CloseMessage, data)
+	default:
+		return c.Conn.WriteMessage(websocket.TextMessage, []byte(sockjsFrame([]string{string(data)})))
+	}
+}
+
+func (c *sockjsWebsocket) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, b)
+}
+
+// sockjsSession is the transport behind the xhr-polling and xhr-streaming
+// fallbacks. Outbound frames are buffered until a receiving request drains
+// them; inbound frames arrive through xhr_send.
+type sockjsSession struct {
+	id      string
+	addr    net.Addr
+	inbound chan []byte
+	notify  chan struct{}
+	closed  chan struct{}
+	onClose func()
+
+	mu        sync.Mutex
+	pending   []string
+	attached  bool
+	timer     *time.Timer
+	closeOnce sync.Once
+}
+
+func newSockJSSession(id, remoteAddr string) *sockjsSession {
+	return &sockjsSession{
+		id:      id,
+		addr:    sockjsAddr(remoteAddr),
+		inbound: make(chan []byte, 64),
+		notify:  make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+// attach marks a receiving request as connected. Only one may be attached
+// at a time.
+func (s *sockjsSession) attach() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attached {
+		return false
+	}
+	s.attached = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	return true
+}
+
+// detach marks the receiving request as gone and closes the session if no
+// other request attaches within the disconnect delay.
+func (s *sockjsSession) detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attached = false
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(sockjsDisconnectDelay, func() {
+		s.mu.Lock()
+		attached := s.attached
+		s.mu.Unlock()
+		if !attached {
+			_ = s.Close()
+		}
+	})
+}
+
+// drain returns all buffered outbound messages as a single frame.
+func (s *sockjsSession) drain() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return ""
+	}
+	frame := sockjsFrame(s.pending)
+	s.pending = nil
+	return frame
+}
+
+func (s *sockjsSession) enqueue(message string) error {
+	select {
+	case <-s.closed:
+		return errSockJSClosed
+	default:
+	}
+	s.mu.Lock()
+	s.pending = append(s.pending, message)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *sockjsSession) receive(frame []byte) bool {
+	select {
+	case s.inbound <- frame:
+		return true
+	case <-s.closed:
+		return false
+	}
+}
+
+func (s *sockjsSession) ReadMessage() (int, []byte, error) {
+	select {
+	case frame := <-s.inbound:
+		return websocket.TextMessage, frame, nil
+	case <-s.closed:
+		return 0, nil, errSockJSClosed
+	}
+}
+
+func (s *sockjsSession) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case websocket.PingMessage:
+		// Receiving requests send their own heartbeats.
+		return nil
+	case websocket.CloseMessage:
+		return s.Close()
+	default:
+		return s.enqueue(string(data))
+	}
+}
+
+func (s *sockjsSession) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.enqueue(string(b))
+}
+
+func (s *sockjsSession) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (s *sockjsSession) RemoteAddr() net.Addr {
+	return s.addr
+}
+
+func (s *sockjsSession) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		if s.onClose != nil {
+			s.onClose()
+		}
+	})
+	return nil
+}
+
+// sockjsAddr is the remote address of an HTTP based session.
+type sockjsAddr string
+
+func (a sockjsAddr) Network() string { return "tcp" }
+func (a sockjsAddr) String() string  { return string(a) }
@@ -0,0 +1,33 @@
+package pushpop
+
+import "runtime"
+
+// Stats is a point-in-time summary of the hub, for debugging a hung or
+// overloaded node.
+type Stats struct {
+	Connections   int `json:"connections"`
+	Channels      int `json:"channels"`
+	Subscriptions int `json:"subscriptions"`
+	// Queued counts messages and subscription changes waiting for Run.
+	Queued     int  `json:"queued"`
+	Draining   bool `json:"draining"`
+	Goroutines int  `json:"goroutines"`
+}
+
+// Stats summarizes the hub's connections, channels, and queues.
+func (h *Hub) Stats() Stats {
+	stats := Stats{
+		Queued:     len(h.broadcast) + len(h.remote) + len(h.targeted) + len(h.register) + len(h.unregister) + len(h.leave) + len(h.resume),
+		Draining:   h.Draining(),
+		Goroutines: runtime.NumGoroutine(),
+	}
+	h.clients.Range(func(_, _ interface{}) bool {
+		stats.Connections++
+		return true
+	})
+	for _, channel := range h.Channels() {
+		stats.Channels++
+		stats.Subscriptions += channel.Subscribers
+	}
+	return stats
+}
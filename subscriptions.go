@@ -0,0 +1,86 @@
+package pushpop
+
+import (
+	"context"
+	"errors"
+)
+
+// Subscription events.
+const (
+	// EventSubscriptionSucceeded tells a client that it is subscribed to a
+	// channel and has received any catch-up messages. For presence
+	// channels the payload lists the current members.
+	EventSubscriptionSucceeded = "pushpop:subscription_succeeded"
+	// EventSubscriptionError tells a client that a subscription was
+	// rejected.
+	EventSubscriptionError = "pushpop:subscription_error"
+)
+
+// Subscription error codes.
+const (
+	// CodeSubscriptionLimit means the connection already holds the maximum
+	// number of subscriptions. Retrying succeeds after unsubscribing.
+	CodeSubscriptionLimit = "subscription_limit"
+	// CodeChannelLimit means the subscription would create a new channel
+	// beyond the node or tenant channel limit.
+	CodeChannelLimit = "channel_limit"
+	// CodeUnknownChannel means the channel was not declared and the hub
+	// runs with WithStrictChannels.
+	CodeUnknownChannel = "unknown_channel"
+	// CodeInvalidChannel means the subscribe frame named no channel.
+	CodeInvalidChannel = "invalid_channel"
+	// CodeUnavailable means authorization could not be decided, e.g.
+	// because the policy service timed out. Retrying later may succeed.
+	CodeUnavailable = "unavailable"
+)
+
+// Subscriptions denied by the blocklist, a hook, user channel ownership,
+// or the policy are rejected with CodeForbidden and should not be retried.
+// Hooks and policies choose another code by returning an error with a
+// Code() string method, as for request handlers.
+
+// WithMaxSubscriptions caps how many channels a single connection may be
+// subscribed to. Further subscriptions are rejected with an
+// EventSubscriptionError.
+func WithMaxSubscriptions(n int) Option {
+	return func(h *Hub) {
+		h.maxSubscriptions = n
+	}
+}
+
+// subscriptionError maps an authorization error to the code and message
+// of a subscription error. Only coded errors have their message passed on,
+// so internal details do not reach clients.
+func subscriptionError(err error) (code, message string) {
+	var coded interface{ Code() string }
+	switch {
+	case errors.As(err, &coded):
+		return coded.Code(), err.Error()
+	case errors.Is(err, errPolicyUnavailable), errors.Is(err, context.DeadlineExceeded):
+		return CodeUnavailable, "authorization unavailable"
+	default:
+		return CodeForbidden, "subscription denied"
+	}
+}
+
+// rejectSubscription tells client that its subscription to channel was
+// rejected.
+func (h *Hub) rejectSubscription(client *Client, channel, code, reason string) {
+	h.log.Warn("Subscription rejected", "client", client.conn.RemoteAddr(), "channel", channel, "code", code)
+	h.sendControl(client, Message{
+		Channel:  channel,
+		Event:    EventSubscriptionError,
+		Payload:  map[string]interface{}{"code": code, "message": reason},
+		Priority: PriorityHigh,
+	})
+}
+
+// acknowledgeSubscription tells client that it is subscribed to channel
+// under name, which differs from channel for aliases.
+func (h *Hub) acknowledgeSubscription(client *Client, name, channel string) {
+	payload := map[string]interface{}{}
+	if h.presenceEnabled(channel) {
+		payload["members"] = h.Members(channel)
+	}
+	h.sendControl(client, Message{Channel: name, Event: EventSubscriptionSucceeded, Payload: payload})
+}
@@ -0,0 +1,105 @@
+package pushpop
+
+import "strings"
+
+// Selector matches connections by tag. Every key must be present on the
+// connection with the same value.
+type Selector map[string]string
+
+// ParseSelector parses a selector written as comma separated key=value
+// pairs, e.g. "plan=pro,region=eu".
+func ParseSelector(s string) Selector {
+	selector := make(Selector)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if key != "" {
+			selector[key] = value
+		}
+	}
+	return selector
+}
+
+// Matches reports whether session carries every tag in the selector.
+func (sel Selector) Matches(session *Session) bool {
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	for key, value := range sel {
+		if tag, ok := session.tags[key]; !ok || tag != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SetTag attaches a tag to the session, e.g. SetTag("plan", "pro"). Tags
+// can be set from hooks at any time during the connection.
+func (s *Session) SetTag(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tags == nil {
+		s.tags = make(map[string]string)
+	}
+	s.tags[key] = value
+}
+
+// RemoveTag removes a tag from the session.
+func (s *Session) RemoveTag(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tags, key)
+}
+
+// Tag returns the value of a tag.
+func (s *Session) Tag(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.tags[key]
+	return value, ok
+}
+
+// Tags returns a copy of the session's tags.
+func (s *Session) Tags() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tags := make(map[string]string, len(s.tags))
+	for key, value := range s.tags {
+		tags[key] = value
+	}
+	return tags
+}
+
+// targetedMessage is a message delivered to every connection matched by a
+// predicate rather than to a channel's subscribers.
+type targetedMessage struct {
+	match   func(client *Client) bool
+	message Message
+}
+
+// TriggerTagged delivers message to every connection on this node whose
+// tags match selector, regardless of its channel subscriptions. It is
+// useful for targeted announcements such as notices to every pro-plan
+// user in a region.
+func (h *Hub) TriggerTagged(selector Selector, message Message) {
+	h.triggerTargeted(targetedMessage{
+		match:   func(client *Client) bool { return selector.Matches(client.session) },
+		message: message,
+	})
+}
+
+func (h *Hub) triggerTargeted(target targetedMessage) {
+	select {
+	case h.targeted <- target:
+	case <-h.stopped():
+	}
+}
+
+// deliverTargeted queues a targeted message for every matching client.
+func (h *Hub) deliverTargeted(target targetedMessage) {
+	h.clients.Range(func(key, _ interface{}) bool {
+		client := key.(*Client)
+		if target.match(client) {
+			h.deliver(client, target.message)
+		}
+		return true
+	})
+}
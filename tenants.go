@@ -0,0 +1,280 @@
+package pushpop
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultUsagePeriod is the metering period unless another is given.
+const defaultUsagePeriod = 24 * time.Hour
+
+var errTenantQuota = errors.New("tenant connection quota exceeded")
+
+// QuotaOverflow selects what happens to messages for a tenant once its
+// message or byte quota for the period is used up.
+type QuotaOverflow string
+
+// Quota overflow modes.
+const (
+	// QuotaReject drops every further message until the period ends. It is
+	// the default.
+	QuotaReject QuotaOverflow = "reject"
+	// QuotaThrottle keeps delivering at TenantQuota.ThrottleRate and drops
+	// the rest.
+	QuotaThrottle QuotaOverflow = "throttle"
+)
+
+// TenantQuota limits a tenant, see Session.Tenant, on this node. Zero
+// fields are unlimited.
+type TenantQuota struct {
+	// MaxConnections caps the tenant's concurrent connections; further
+	// connections are refused.
+	MaxConnections int
+	// MaxMessages caps the messages delivered to the tenant's connections
+	// per metering period.
+	MaxMessages int64
+	// MaxBytes caps the bytes sent to the tenant's connections per
+	// metering period.
+	MaxBytes int64
+	// Overflow selects what happens once MaxMessages or MaxBytes is
+	// reached.
+	Overflow QuotaOverflow
+	// ThrottleRate is the messages per second still delivered with
+	// QuotaThrottle. Defaults to 1.
+	ThrottleRate float64
+}
+
+// TenantUsage is a tenant's usage on this node in the current metering
+// period.
+type TenantUsage struct {
+	Tenant      string    `json:"tenant"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Connections int       `json:"connections"`
+	// PeakConnections is the most concurrent connections in the period.
+	PeakConnections int `json:"peak_connections"`
+	// Messages counts the messages delivered to the tenant's connections.
+	Messages int64 `json:"messages"`
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+	// Rejected counts the messages dropped by the tenant's quota.
+	Rejected int64 `json:"rejected"`
+}
+
+// WithTenantMetering tracks each tenant's connections, messages, and
+// bandwidth over periods of the given length, aligned to UTC, e.g. days
+// for 24h, the default if period is zero.
+func WithTenantMetering(period time.Duration) Option {
+	return func(h *Hub) {
+		if period <= 0 {
+			period = defaultUsagePeriod
+		}
+		h.tenantMeter().period = period
+	}
+}
+
+// WithTenantQuota sets the quota of tenant, which is "*" for every tenant
+// without its own. Quotas turn on metering with the default period unless
+// WithTenantMetering is given.
+func WithTenantQuota(tenant string, quota TenantQuota) Option {
+	return func(h *Hub) {
+		meter := h.tenantMeter()
+		if meter.quotas == nil {
+			meter.quotas = make(map[string]TenantQuota)
+		}
+		meter.quotas[tenant] = quota
+	}
+}
+
+// tenantMeter returns the hub's meter, creating it.
+func (h *Hub) tenantMeter() *tenantMeter {
+	if h.tenants == nil {
+		h.tenants = &tenantMeter{period: defaultUsagePeriod, usage: make(map[string]*tenantState)}
+	}
+	return h.tenants
+}
+
+// tenantMeter meters tenants and enforces their quotas. A nil meter meters
+// nothing.
+type tenantMeter struct {
+	period time.Duration
+	quotas map[string]TenantQuota
+	sink   UsageSink
+
+	mu    sync.Mutex
+	usage map[string]*tenantState
+	// rollups holds the usage of completed periods, oldest first, and
+	// pending those not yet exported to the sink.
+	rollups []TenantUsage
+	pending []TenantUsage
+}
+
+// tenantState is a tenant's usage and throttle bucket.
+type tenantState struct {
+	usage  TenantUsage
+	tokens float64
+	last   time.Time
+}
+
+// quota returns the quota of tenant.
+func (m *tenantMeter) quota(tenant string) TenantQuota {
+	if quota, ok := m.quotas[tenant]; ok {
+		return quota
+	}
+	return m.quotas["*"]
+}
+
+// state returns the usage of tenant, starting a new period if the current
+// one has ended. Callers hold mu.
+func (m *tenantMeter) state(tenant string, now time.Time) *tenantState {
+	s, ok := m.usage[tenant]
+	if !ok {
+		s = &tenantState{usage: TenantUsage{Tenant: tenant}}
+		m.usage[tenant] = s
+	}
+	if start := now.Truncate(m.period); !s.usage.PeriodStart.Equal(start) {
+		if !s.usage.PeriodStart.IsZero() {
+			m.complete(s.usage, now)
+		}
+		s.usage = TenantUsage{
+			Tenant:          tenant,
+			PeriodStart:     start,
+			PeriodEnd:       start.Add(m.period),
+			Connections:     s.usage.Connections,
+			PeakConnections: s.usage.Connections,
+		}
+	}
+	return s
+}
+
+// admit reports whether tenant may open another connection.
+func (m *tenantMeter) admit(tenant string) bool {
+	if m == nil {
+		return true
+	}
+	max := m.quota(tenant).MaxConnections
+	if max <= 0 {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state(tenant, time.Now()).usage.Connections < max
+}
+
+// connected records a connection opening, or closing if delta is -1.
+func (m *tenantMeter) connected(tenant string, delta int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.state(tenant, time.Now())
+	s.usage.Connections += delta
+	s.usage.PeakConnections = max(s.usage.PeakConnections, s.usage.Connections)
+}
+
+// deliver reports whether a message may be delivered to a connection of
+// tenant under its quota, and counts it if so.
+func (m *tenantMeter) deliver(tenant string) bool {
+	if m == nil {
+		return true
+	}
+	quota := m.quota(tenant)
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.state(tenant, now)
+	exhausted := (quota.MaxMessages > 0 && s.usage.Messages >= quota.MaxMessages) ||
+		(quota.MaxBytes > 0 && s.usage.BytesOut >= quota.MaxBytes)
+	if exhausted && !s.throttle(quota, now) {
+		s.usage.Rejected++
+		return false
+	}
+	s.usage.Messages++
+	return true
+}
+
+// throttle reports whether an exhausted quota still lets a message
+// through, taking a token from the throttle bucket.
+func (s *tenantState) throttle(quota TenantQuota, now time.Time) bool {
+	if quota.Overflow != QuotaThrottle {
+		return false
+	}
+	rate := quota.ThrottleRate
+	if rate <= 0 {
+		rate = 1
+	}
+	burst := max(rate, 1)
+	if s.last.IsZero() {
+		s.tokens = burst
+	} else {
+		s.tokens = min(burst, s.tokens+now.Sub(s.last).Seconds()*rate)
+	}
+	s.last = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// transferred counts bytes received from and sent to a connection of
+// tenant.
+func (m *tenantMeter) transferred(tenant string, in, out int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.state(tenant, time.Now())
+	s.usage.BytesIn += int64(in)
+	s.usage.BytesOut += int64(out)
+}
+
+// TenantUsage returns the usage of tenant in the current metering period.
+// It reports false unless metering is on and the tenant has connected.
+func (h *Hub) TenantUsage(tenant string) (TenantUsage, bool) {
+	if h.tenants == nil {
+		return TenantUsage{}, false
+	}
+	h.tenants.mu.Lock()
+	defer h.tenants.mu.Unlock()
+	if _, ok := h.tenants.usage[tenant]; !ok {
+		return TenantUsage{}, false
+	}
+	return h.tenants.state(tenant, time.Now()).usage, true
+}
+
+// TenantUsages returns the usage of every metered tenant, sorted by name.
+func (h *Hub) TenantUsages() []TenantUsage {
+	usages := []TenantUsage{}
+	if h.tenants == nil {
+		return usages
+	}
+	h.tenants.mu.Lock()
+	defer h.tenants.mu.Unlock()
+	now := time.Now()
+	for tenant := range h.tenants.usage {
+		usages = append(usages, h.tenants.state(tenant, now).usage)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Tenant < usages[j].Tenant })
+	return usages
+}
+
+// handleAdminTenants lists the usage of every tenant.
+func (h *Hub) handleAdminTenants(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tenants": h.TenantUsages()})
+}
+
+// handleAdminTenant reports the usage of a single tenant.
+func (h *Hub) handleAdminTenant(w http.ResponseWriter, r *http.Request) {
+	usage, ok := h.TenantUsage(r.PathValue("tenant"))
+	if !ok {
+		http.Error(w, "Unknown Tenant", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
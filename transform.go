@@ -0,0 +1,132 @@
+package pushpop
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Transformer reshapes the payloads of a channel before fan-out, e.g. with
+// a CEL program. It returns the payload to deliver and record in history,
+// or an error to drop the message.
+type Transformer interface {
+	Transform(message Message) (interface{}, error)
+}
+
+// TransformerFunc adapts a function to a Transformer.
+type TransformerFunc func(message Message) (interface{}, error)
+
+// Transform calls f.
+func (f TransformerFunc) Transform(message Message) (interface{}, error) {
+	return f(message)
+}
+
+// TransformInput is the data ChannelSettings.Transform templates execute
+// with; for edits, Event is EventMessageEdited and Payload the replacement
+// payload. Payload is decoded from JSON, so a template reads fields with
+// {{.Payload.user.name}} whatever type the payload was published as. The
+// template must render JSON, and the json function encodes a value, e.g.
+//
+//	{"id": {{json .Payload.id}}, "title": {{json .Payload.title}}}
+type TransformInput struct {
+	Channel string
+	Event   string
+	Payload interface{}
+}
+
+var errEmptyTransform = errors.New("transform rendered nothing")
+
+var transformFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// compileTransform parses the settings' Transform template.
+func (s *ChannelSettings) compileTransform(channel string) error {
+	if s.Transform == "" {
+		return nil
+	}
+	tmpl, err := template.New(channel).Funcs(transformFuncs).Option("missingkey=zero").Parse(s.Transform)
+	if err != nil {
+		return err
+	}
+	s.transform = tmpl
+	return nil
+}
+
+// transformable reports whether message's payload is reshaped by its
+// channel's transform. Pushpop's own events keep their payloads, apart from
+// edits, whose replacement payload is transformed like the original.
+func transformable(message Message) bool {
+	return !strings.HasPrefix(message.Event, "pushpop:") || message.Event == EventMessageEdited
+}
+
+// transform applies the transform of message's channel to its payload.
+func (h *Hub) transform(message Message) (Message, error) {
+	if !transformable(message) {
+		return message, nil
+	}
+	settings := h.settingsFor(message.Channel)
+	if settings.transform == nil && settings.Transformer == nil {
+		return message, nil
+	}
+	if message.Event == EventMessageEdited {
+		edit, ok := decodeEdit(message.Payload)
+		if !ok {
+			return message, nil
+		}
+		inner := message
+		inner.Payload = edit.Payload
+		payload, err := settings.apply(inner)
+		if err != nil {
+			return message, err
+		}
+		edit.Payload = payload
+		message.Payload = edit
+		return message, nil
+	}
+	payload, err := settings.apply(message)
+	if err != nil {
+		return message, err
+	}
+	message.Payload = payload
+	return message, nil
+}
+
+// apply runs the settings' template and then their Transformer on the
+// payload of message.
+func (s ChannelSettings) apply(message Message) (interface{}, error) {
+	if s.transform != nil {
+		// Round-trip through JSON so typed payloads read like decoded ones.
+		data, err := json.Marshal(message.Payload)
+		if err != nil {
+			return nil, err
+		}
+		var payload interface{}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		input := TransformInput{Channel: message.Channel, Event: message.Event, Payload: payload}
+		if err := s.transform.Execute(&out, input); err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(out.Bytes())) == 0 {
+			return nil, errEmptyTransform
+		}
+		var result interface{}
+		if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+			return nil, fmt.Errorf("transform rendered invalid JSON: %w", err)
+		}
+		message.Payload = result
+	}
+	if s.Transformer != nil {
+		return s.Transformer.Transform(message)
+	}
+	return message.Payload, nil
+}
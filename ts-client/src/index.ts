@@ -71,6 +71,30 @@ export interface SocketMessage<T = any> {
   event: string;
   /** The message payload */
   payload: T;
+  /** Set on messages re-sent from the channel's history, such as catch-up */
+  replayed?: boolean;
+  /** The ID, timestamp, and origin the server stamped on the broadcast */
+  envelope?: MessageEnvelope;
+  /** Set on channels with delivery receipts; the client acks the message */
+  ack?: boolean;
+}
+
+/**
+ * Metadata the server stamps on every broadcast.
+ */
+export interface MessageEnvelope {
+  /** A ULID, unique across nodes and sortable by time */
+  id: string;
+  /** When the message was published, as an RFC 3339 timestamp */
+  timestamp: string;
+  /** What published the message */
+  origin: {
+    type: "api" | "client" | "webhook" | "bridge" | "server";
+    /** The socket ID of a client, the source of a webhook, or the name of a bridge */
+    id?: string;
+    /** The user ID of the client that published the message, if it has one */
+    user?: string;
+  };
 }
 
 /**
@@ -126,6 +150,12 @@ export class SocketClient {
   private reconnectAttempts = 0;
   private maxReconnectAttempts = 5;
   private debug = false;
+  private resumeToken: string | null = null;
+  private heartbeatTimer: ReturnType<typeof setInterval> | null = null;
+  private clockRequests: Record<number, (message: SocketMessage) => void> =
+    {};
+  private clockSeq = 0;
+  private reconnectAdvice: { target?: string; jitter?: number } | null = null;
 
   /**
    * Constructs a new SocketClient instance and initiates connection.
@@ -170,17 +200,17 @@ export class SocketClient {
     const socketUrl = this.port
       ? `${protocol}://${this.host}:${this.port}/ws`
       : `${protocol}://${this.host}/ws`;
+    const resume = this.resumeToken
+      ? `?resume=${encodeURIComponent(this.resumeToken)}`
+      : '';
 
-    this.socket = new WebSocket(socketUrl);
+    this.socket = new WebSocket(socketUrl + resume);
 
     this.socket.onopen = () => {
       this.reconnectAttempts = 0;
       // Resubscribe to all channels upon reconnection
-      Object.keys(this.channels).forEach((channelName) => {
-        this.send({
-          action: 'subscribe',
-          channel: channelName,
-        });
+      Object.values(this.channels).forEach((channel) => {
+        this.send(channel.subscribeMessage());
       });
 
       // Flush message queue
@@ -191,11 +221,28 @@ export class SocketClient {
     };
 
     this.socket.onclose = (event) => {
+      this.stopHeartbeat();
       if (this.reconnectTimeout) {
         clearTimeout(this.reconnectTimeout);
         this.reconnectTimeout = null;
       }
 
+      const advice = this.reconnectAdvice;
+      if (advice) {
+        // The server is draining: move to the advised host[:port] after a
+        // random delay inside the jitter window.
+        this.reconnectAdvice = null;
+        if (advice.target) {
+          this.host = advice.target;
+          this.port = undefined;
+        }
+        this.reconnectTimeout = setTimeout(
+          () => this.connect(),
+          Math.random() * (advice.jitter ?? 0) * 1000,
+        );
+        return;
+      }
+
       const shouldReconnect = event.code !== 1000 && event.code !== 1001;
 
       if (
@@ -218,10 +265,44 @@ export class SocketClient {
       try {
         const message = JSON.parse(event.data) as SocketMessage;
 
+        if (message.event === 'pushpop:connection_established') {
+          // Remember the token so a reconnect can recover missed messages
+          this.resumeToken = message.payload?.resume_token ?? null;
+          this.startHeartbeat(message.payload?.heartbeat);
+          return;
+        }
+
+        if (message.event === 'pushpop:reconnect') {
+          this.reconnectAdvice = message.payload ?? {};
+          return;
+        }
+
+        if (message.event === 'pushpop:time') {
+          const resolve = this.clockRequests[message.payload?.echo];
+          if (resolve) {
+            delete this.clockRequests[message.payload.echo];
+            resolve(message);
+          }
+          return;
+        }
+
         const channel = this.channels[message.channel];
         if (channel) {
           channel.trigger(message.event, message.payload);
         }
+        if (message.event === 'pushpop:channel_expired') {
+          // The server has already unsubscribed us; don't resubscribe on
+          // reconnect
+          delete this.channels[message.channel];
+          return;
+        }
+        if (message.ack && message.envelope) {
+          this.send({
+            action: 'ack',
+            channel: message.channel,
+            id: message.envelope.id,
+          });
+        }
       } catch (error) {
         console.error(
           'Error: ',
@@ -237,6 +318,27 @@ export class SocketClient {
     };
   }
 
+  /**
+   * Starts sending app-level pings when the server advertises the app
+   * heartbeat mode; protocol pings are answered by the browser itself.
+   * @param heartbeat The heartbeat advertised at connect time.
+   */
+  private startHeartbeat(heartbeat?: { mode: string; interval?: number }) {
+    this.stopHeartbeat();
+    if (heartbeat?.mode !== 'app' || !heartbeat.interval) return;
+    this.heartbeatTimer = setInterval(
+      () => this.send({ action: 'ping' }),
+      heartbeat.interval * 1000,
+    );
+  }
+
+  private stopHeartbeat() {
+    if (this.heartbeatTimer) {
+      clearInterval(this.heartbeatTimer);
+      this.heartbeatTimer = null;
+    }
+  }
+
   // Queue for messages to be sent when the WebSocket is open
   private messageQueue: any[] = [];
 
@@ -253,6 +355,22 @@ export class SocketClient {
     }
   }
 
+  /**
+   * Estimates the offset between the server clock and the local clock.
+   * @returns Milliseconds to add to `Date.now()` to get server time.
+   */
+  syncClock(): Promise<number> {
+    const id = ++this.clockSeq;
+    const sent = Date.now();
+    return new Promise((resolve) => {
+      this.clockRequests[id] = (message) => {
+        const received = Date.now();
+        resolve(message.payload.server_time - (sent + received) / 2);
+      };
+      this.send({ action: 'time', payload: id });
+    });
+  }
+
   /**
    * Returns the current state of the WebSocket connection.
    */
@@ -275,16 +393,15 @@ export class SocketClient {
   /**
    * Subscribes to a channel.
    * @param channelName The name of the channel to subscribe to.
+   * @param events The events to receive (optional); the server filters out
+   * the channel's other events.
    * @returns The Channel instance.
    */
-  subscribe(channelName: string): Channel {
+  subscribe(channelName: string, events?: string[]): Channel {
     if (!this.channels[channelName]) {
-      this.channels[channelName] = new Channel(channelName);
+      this.channels[channelName] = new Channel(channelName, events);
       if (this.socket && this.socket.readyState === WebSocket.OPEN) {
-        this.send({
-          action: 'subscribe',
-          channel: channelName,
-        });
+        this.send(this.channels[channelName].subscribeMessage());
       }
     }
     return this.channels[channelName];
@@ -306,6 +423,16 @@ export class SocketClient {
     }
   }
 
+  /**
+   * Marks a channel read up to a message. Other members receive a
+   * `pushpop:read` event with the new position.
+   * @param channelName The name of the channel.
+   * @param messageId The envelope ID of the last message read.
+   */
+  markRead(channelName: string, messageId: string) {
+    this.send({ action: 'mark_read', channel: channelName, id: messageId });
+  }
+
   /**
    * Binds a callback function to an event on a channel.
    * @param channelName The name of the channel.
@@ -350,14 +477,27 @@ export class SocketClient {
 class Channel {
   name: string;
   private events: Record<string, Set<Function>> = {};
+  private filter?: string[];
 
   /**
    * Constructs a new Channel instance.
    * @param name The name of the channel.
+   * @param filter The events to receive (optional); all events if omitted.
    */
-  constructor(name: string) {
+  constructor(name: string, filter?: string[]) {
     this.name = name;
     this.events = {};
+    this.filter = filter;
+  }
+
+  /**
+   * Builds the message that subscribes to the channel.
+   * @returns The subscribe message.
+   */
+  subscribeMessage() {
+    return this.filter?.length
+      ? { action: 'subscribe', channel: this.name, events: this.filter }
+      : { action: 'subscribe', channel: this.name };
   }
 
   /**
@@ -1,25 +1,40 @@
 // __tests__/client.test.ts
-import { beforeEach, describe, expect, it, vi } from "vitest";
+import { afterEach, beforeEach, describe, expect, it, vi } from "vitest";
 import { SocketClient, type SocketMessage, SocketServer } from "../src";
 
 // Mock the global WebSocket class
 class MockWebSocket {
+	static CONNECTING = 0;
+	static OPEN = 1;
+	static CLOSING = 2;
+	static CLOSED = 3;
+	// Every socket created, in order, so tests can follow reconnects
+	static instances: MockWebSocket[] = [];
+
 	public onopen: (() => void) | null = null;
 	public onmessage: ((e: MessageEvent) => void) | null = null;
 	public onerror: ((e: Event) => void) | null = null;
 	public onclose: ((e: CloseEvent) => void) | null = null;
 	public readyState: number = WebSocket.CONNECTING;
 
-	constructor(public url: string) {}
+	public sent: any[] = [];
+
+	constructor(public url: string) {
+		MockWebSocket.instances.push(this);
+	}
 
 	send(data: string) {
-		// No-op for now, or you could capture sent data for assertions
+		this.sent.push(JSON.parse(data));
 	}
 
 	close() {
+		this.simulateClose(1000);
+	}
+
+	simulateClose(code: number) {
 		this.readyState = WebSocket.CLOSED;
 		if (this.onclose)
-			this.onclose({ code: 1000, reason: "Normal closure" } as CloseEvent);
+			this.onclose({ code, reason: "Normal closure" } as CloseEvent);
 	}
 
 	simulateOpen() {
@@ -68,6 +83,149 @@ describe("SocketClient", () => {
 	});
 });
 
+// latestSocket returns the socket of the client's current connection.
+function latestSocket() {
+	return MockWebSocket.instances[MockWebSocket.instances.length - 1];
+}
+
+// established simulates the server accepting the connection.
+function established(ws: MockWebSocket, payload: Record<string, unknown>) {
+	ws.simulateOpen();
+	ws.simulateMessage({
+		channel: "",
+		event: "pushpop:connection_established",
+		payload: { socket_id: "s1", ...payload },
+	});
+}
+
+describe("SocketClient reconnects", () => {
+	beforeEach(() => {
+		vi.useFakeTimers();
+		MockWebSocket.instances = [];
+	});
+
+	afterEach(() => {
+		vi.useRealTimers();
+	});
+
+	it("should resume the session and resubscribe", () => {
+		const client = new SocketClient({ host: "localhost" });
+		const first = latestSocket();
+		established(first, { resume_token: "token/1" });
+		client.subscribe("orders");
+		expect(first.sent).toEqual([{ action: "subscribe", channel: "orders" }]);
+
+		first.simulateClose(1006);
+		vi.advanceTimersByTime(1500);
+
+		expect(MockWebSocket.instances).toHaveLength(2);
+		const second = latestSocket();
+		expect(second.url).toBe("ws://localhost/ws?resume=token%2F1");
+		second.simulateOpen();
+		expect(second.sent).toEqual([{ action: "subscribe", channel: "orders" }]);
+	});
+
+	it("should not reconnect after a normal closure", () => {
+		const client = new SocketClient({ host: "localhost" });
+		established(latestSocket(), { resume_token: "token" });
+
+		client.close();
+		vi.advanceTimersByTime(60000);
+
+		expect(MockWebSocket.instances).toHaveLength(1);
+	});
+
+	it("should send app heartbeats until the connection is lost", () => {
+		new SocketClient({ host: "localhost" });
+		const first = latestSocket();
+		established(first, {
+			resume_token: "token",
+			heartbeat: { mode: "app", interval: 25 },
+		});
+
+		vi.advanceTimersByTime(50000);
+		expect(first.sent).toEqual([{ action: "ping" }, { action: "ping" }]);
+
+		// The server closes a connection whose heartbeat timed out without a
+		// close frame; the client stops pinging it and reconnects.
+		first.simulateClose(1006);
+		vi.advanceTimersByTime(1500);
+
+		expect(first.sent).toHaveLength(2);
+		const second = latestSocket();
+		expect(second).not.toBe(first);
+		expect(second.url).toBe("ws://localhost/ws?resume=token");
+	});
+
+	it("should leave protocol heartbeats to the browser", () => {
+		new SocketClient({ host: "localhost" });
+		const ws = latestSocket();
+		established(ws, { heartbeat: { mode: "protocol", interval: 25 } });
+
+		vi.advanceTimersByTime(100000);
+
+		expect(ws.sent).toEqual([]);
+	});
+});
+
+describe("SocketClient acks", () => {
+	const envelope = {
+		id: "01HZX3Q9V6K8N2B4C7D5E1F0G9",
+		timestamp: "2024-06-01T12:00:00Z",
+		origin: { type: "api" as const },
+	};
+
+	beforeEach(() => {
+		MockWebSocket.instances = [];
+	});
+
+	it("should ack messages that request a receipt", () => {
+		const client = new SocketClient({ host: "localhost" });
+		const ws = latestSocket();
+		ws.simulateOpen();
+		client.subscribe("orders");
+		const callback = vi.fn();
+		client.bind("orders", "paid", callback);
+
+		ws.simulateMessage({
+			channel: "orders",
+			event: "paid",
+			payload: { id: 7 },
+			envelope,
+			ack: true,
+		});
+
+		expect(callback).toHaveBeenCalledWith({ id: 7 });
+		expect(ws.sent).toContainEqual({
+			action: "ack",
+			channel: "orders",
+			id: envelope.id,
+		});
+	});
+
+	it("should not ack other messages", () => {
+		const client = new SocketClient({ host: "localhost" });
+		const ws = latestSocket();
+		ws.simulateOpen();
+		client.subscribe("orders");
+
+		ws.simulateMessage({
+			channel: "orders",
+			event: "paid",
+			payload: { id: 7 },
+			envelope,
+		});
+		ws.simulateMessage({
+			channel: "orders",
+			event: "paid",
+			payload: { id: 8 },
+			ack: true,
+		});
+
+		expect(ws.sent).toEqual([{ action: "subscribe", channel: "orders" }]);
+	});
+});
+
 describe("SocketServer", () => {
 	beforeEach(() => {
 		globalThis.fetch = vi.fn(() =>
@@ -0,0 +1,65 @@
+package pushpop
+
+import "encoding/json"
+
+// TypedChannel publishes to and subscribes on a channel whose payloads are
+// of type T, so embedders get compile-time checked payloads instead of
+// interface{}.
+type TypedChannel[T any] struct {
+	hub  *Hub
+	name string
+}
+
+// ChannelOf returns a typed handle for the named channel on hub.
+func ChannelOf[T any](hub *Hub, name string) *TypedChannel[T] {
+	return &TypedChannel[T]{hub: hub, name: name}
+}
+
+// Name returns the channel name.
+func (c *TypedChannel[T]) Name() string {
+	return c.name
+}
+
+// Publish triggers event on the channel with payload.
+func (c *TypedChannel[T]) Publish(event string, payload T) {
+	c.hub.Trigger(Message{Channel: c.name, Event: event, Payload: payload})
+}
+
+// Subscribe registers a server-side handler for every message on the
+// channel. Payloads that did not originate as a T, such as JSON from
+// clients or the trigger API, are decoded into a T; messages that fail to
+// decode are logged and skipped. Like Hub.Subscribe, handlers must not
+// block. The returned func removes the handler.
+func (c *TypedChannel[T]) Subscribe(handler func(event string, payload T)) (unsubscribe func()) {
+	return c.hub.Subscribe(c.name, func(message Message) {
+		payload, err := decodePayload[T](message.Payload)
+		if err != nil {
+			c.hub.log.Warn("Failed to decode typed payload", "channel", c.name, "event", message.Event, "err", err)
+			return
+		}
+		handler(message.Event, payload)
+	})
+}
+
+// On is like Subscribe but only calls handler for the given event.
+func (c *TypedChannel[T]) On(event string, handler func(payload T)) (unsubscribe func()) {
+	return c.Subscribe(func(e string, payload T) {
+		if e == event {
+			handler(payload)
+		}
+	})
+}
+
+// decodePayload converts a message payload into a T.
+func decodePayload[T any](payload interface{}) (T, error) {
+	if v, ok := payload.(T); ok {
+		return v, nil
+	}
+	var v T
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
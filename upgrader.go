@@ -0,0 +1,102 @@
+package pushpop
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Upgrader upgrades an HTTP request to a WebSocket connection. It is the
+// extension point for WebSocket libraries other than gorilla/websocket on
+// net/http, e.g. to apply stricter origin checks or custom buffer sizes.
+// Connections that also implement SetReadLimit, SetReadDeadline, and
+// SetPongHandler get frame size limits and heartbeats, and those that
+// implement EnableWriteCompression get per-message compression.
+type Upgrader interface {
+	Upgrade(w http.ResponseWriter, r *http.Request) (Conn, error)
+}
+
+// UpgraderFunc adapts a function to an Upgrader.
+type UpgraderFunc func(w http.ResponseWriter, r *http.Request) (Conn, error)
+
+// Upgrade calls f.
+func (f UpgraderFunc) Upgrade(w http.ResponseWriter, r *http.Request) (Conn, error) {
+	return f(w, r)
+}
+
+// WithUpgrader upgrades /ws requests with u instead of the built-in
+// gorilla/websocket upgrader. Authentication, blocklists, and tenant quotas
+// still run before u is called. The SockJS websocket transport keeps the
+// built-in upgrader.
+func WithUpgrader(u Upgrader) Option {
+	return func(h *Hub) {
+		h.upgrader = u
+	}
+}
+
+// upgradeConn upgrades a /ws request with the hub's Upgrader.
+func (h *Hub) upgradeConn(w http.ResponseWriter, r *http.Request) (Conn, error) {
+	if h.upgrader != nil {
+		return h.upgrader.Upgrade(w, r)
+	}
+	return h.upgrade(w, r)
+}
+
+// ServeConn hands the hub a WebSocket connection accepted by another HTTP
+// stack, such as fasthttp, or a custom listener, and serves it like a /ws
+// connection until it closes. session describes the upgrade request;
+// ServeConn fills in a missing ID, ConnectedAt, UserAgent, and RemoteIP, the
+// latter from the connection's remote address. The OnConnect hook, OIDC
+// authentication, blocklists, and tenant quotas run as they do for /ws; if
+// they refuse the connection, or the hub is shutting down or draining,
+// ServeConn closes it and returns the error.
+func (h *Hub) ServeConn(conn Conn, session *Session) error {
+	client, err := h.acceptConn(conn, session)
+	if err != nil {
+		return err
+	}
+	<-client.flushed
+	return nil
+}
+
+// acceptConn admits and registers a connection for ServeConn. It counts as
+// an upgrade in progress for shutdown.
+func (h *Hub) acceptConn(conn Conn, session *Session) (*Client, error) {
+	h.upgrades.add()
+	defer h.upgrades.done()
+	if !h.accepting() {
+		refuse(conn, websocket.CloseTryAgainLater)
+		return nil, errHubStopped
+	}
+	if session.ID == "" {
+		session.ID = newToken()
+	}
+	if session.ConnectedAt.IsZero() {
+		session.ConnectedAt = time.Now()
+	}
+	if session.UserAgent == "" {
+		session.UserAgent = session.Header.Get("User-Agent")
+	}
+	if session.RemoteIP == "" {
+		addr := conn.RemoteAddr().String()
+		if ip, _, err := net.SplitHostPort(addr); err == nil {
+			addr = ip
+		}
+		session.RemoteIP = addr
+	}
+	if err := h.connect(session); err != nil {
+		h.log.Warn("Connection rejected", "ip", session.RemoteIP, "err", err)
+		refuse(conn, websocket.ClosePolicyViolation)
+		return nil, err
+	}
+	return h.serveClient(conn, session), nil
+}
+
+// refuse closes a connection that will not be served with code.
+func refuse(conn Conn, code int) {
+	_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""))
+	_ = conn.Close()
+}
@@ -0,0 +1,182 @@
+package pushpop
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// usageRetention is how many periods of roll-ups are kept in memory.
+	usageRetention = 90
+	// usageExportTimeout bounds each export to the usage sink.
+	usageExportTimeout = 30 * time.Second
+)
+
+// UsageSink receives the usage roll-ups of each completed metering period,
+// e.g. to feed a billing system.
+type UsageSink interface {
+	ExportUsage(ctx context.Context, usage []TenantUsage) error
+}
+
+// UsageSinkFunc adapts a function to a UsageSink.
+type UsageSinkFunc func(ctx context.Context, usage []TenantUsage) error
+
+// ExportUsage calls f.
+func (f UsageSinkFunc) ExportUsage(ctx context.Context, usage []TenantUsage) error {
+	return f(ctx, usage)
+}
+
+// UsageFile is a UsageSink that appends roll-ups as CSV rows to the file at
+// its path, writing the header first if the file is new or empty.
+type UsageFile string
+
+// ExportUsage appends usage to the file.
+func (f UsageFile) ExportUsage(_ context.Context, usage []TenantUsage) error {
+	file, err := os.OpenFile(string(f), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := writeUsageCSV(file, usage, info.Size() == 0); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WithUsageSink exports each tenant's usage to sink at the end of every
+// metering period. It turns on metering with the default period unless
+// WithTenantMetering is given.
+func WithUsageSink(sink UsageSink) Option {
+	return func(h *Hub) {
+		h.tenantMeter().sink = sink
+	}
+}
+
+// complete records the usage of a completed period. Callers hold mu.
+func (m *tenantMeter) complete(usage TenantUsage, now time.Time) {
+	m.rollups = append(m.rollups, usage)
+	cutoff := now.Add(-usageRetention * m.period)
+	for len(m.rollups) > 0 && m.rollups[0].PeriodStart.Before(cutoff) {
+		m.rollups = m.rollups[1:]
+	}
+	if m.sink != nil {
+		m.pending = append(m.pending, usage)
+	}
+}
+
+// rollOver completes the period of every tenant whose period has ended and
+// returns the roll-ups not yet exported. Tenants without connections are
+// forgotten once their period is complete.
+func (m *tenantMeter) rollOver(now time.Time) []TenantUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tenant := range m.usage {
+		if m.state(tenant, now).usage.Connections == 0 {
+			delete(m.usage, tenant)
+		}
+	}
+	pending := m.pending
+	m.pending = nil
+	return pending
+}
+
+// rollUpUsage completes every tenant's period as it ends and exports the
+// roll-ups to the sink, until ctx is cancelled. It runs with Run.
+func (h *Hub) rollUpUsage(ctx context.Context) {
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(h.tenants.period).Add(h.tenants.period).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now = <-timer.C:
+		}
+		usage := h.tenants.rollOver(now)
+		if h.tenants.sink == nil || len(usage) == 0 {
+			continue
+		}
+		exportCtx, cancel := context.WithTimeout(ctx, usageExportTimeout)
+		if err := h.tenants.sink.ExportUsage(exportCtx, usage); err != nil {
+			h.log.Error("Failed to export usage", "periods", len(usage), "err", err)
+		}
+		cancel()
+	}
+}
+
+// UsageHistory returns the usage of every tenant in the completed metering
+// periods kept in memory, the last 90, ordered by period and tenant.
+func (h *Hub) UsageHistory() []TenantUsage {
+	usage := []TenantUsage{}
+	if h.tenants == nil {
+		return usage
+	}
+	h.tenants.mu.Lock()
+	usage = append(usage, h.tenants.rollups...)
+	h.tenants.mu.Unlock()
+	sort.SliceStable(usage, func(i, j int) bool {
+		if !usage[i].PeriodStart.Equal(usage[j].PeriodStart) {
+			return usage[i].PeriodStart.Before(usage[j].PeriodStart)
+		}
+		return usage[i].Tenant < usage[j].Tenant
+	})
+	return usage
+}
+
+// writeUsageCSV writes usage as CSV rows, preceded by a header if header is
+// true.
+func writeUsageCSV(w io.Writer, usage []TenantUsage, header bool) error {
+	out := csv.NewWriter(w)
+	if header {
+		_ = out.Write([]string{"tenant", "period_start", "period_end", "peak_connections", "messages", "bytes_in", "bytes_out", "rejected"})
+	}
+	for _, u := range usage {
+		_ = out.Write([]string{
+			u.Tenant,
+			u.PeriodStart.UTC().Format(time.RFC3339),
+			u.PeriodEnd.UTC().Format(time.RFC3339),
+			strconv.Itoa(u.PeakConnections),
+			strconv.FormatInt(u.Messages, 10),
+			strconv.FormatInt(u.BytesIn, 10),
+			strconv.FormatInt(u.BytesOut, 10),
+			strconv.FormatInt(u.Rejected, 10),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// handleAdminUsage exports the completed usage roll-ups as JSON, or as CSV
+// with ?format=csv. The optional tenant query parameter selects a tenant.
+func (h *Hub) handleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	usage := h.UsageHistory()
+	if query.Has("tenant") {
+		tenant := query.Get("tenant")
+		filtered := usage[:0]
+		for _, u := range usage {
+			if u.Tenant == tenant {
+				filtered = append(filtered, u)
+			}
+		}
+		usage = filtered
+	}
+	if query.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+		_ = writeUsageCSV(w, usage, true)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"usage": usage})
+}
@@ -0,0 +1,43 @@
+package pushpop
+
+import (
+	"errors"
+	"strings"
+)
+
+// UserChannelPrefix marks private per-user channels, named "user:{id}".
+// Only a connection authenticated as that user may subscribe, so servers
+// can push to a user, on all of their connections, without writing their
+// own authorization.
+const UserChannelPrefix = "user:"
+
+var errOtherUserChannel = errors.New("channel belongs to another user")
+
+// UserChannel returns the private channel of a user.
+func UserChannel(userID string) string {
+	return UserChannelPrefix + userID
+}
+
+// IsUserChannel reports whether channel is a user channel.
+func IsUserChannel(channel string) bool {
+	return strings.HasPrefix(channel, UserChannelPrefix)
+}
+
+// authorizeUserChannel only lets a session's own user subscribe to a user
+// channel.
+func authorizeUserChannel(session *Session, channel string) error {
+	if !IsUserChannel(channel) {
+		return nil
+	}
+	if session.UserID == "" || channel != UserChannel(session.UserID) {
+		return errOtherUserChannel
+	}
+	return nil
+}
+
+// TriggerUser sends a message to a user's private channel, reaching every
+// connection the user has subscribed with.
+func (h *Hub) TriggerUser(userID string, message Message) {
+	message.Channel = UserChannel(userID)
+	h.Trigger(message)
+}